@@ -143,8 +143,8 @@ func startPushOggFile(t *testing.T, track *webrtc.TrackLocalStaticSample, oggFil
 
 func startPushPulseAudioFromEncoder(ctx context.Context, t *testing.T, track *webrtc.TrackLocalStaticSample, encoderAddr string) {
 	pulse := gameserver.NewPulseAudioCapturer("localhost:4713")
-	p := gameserver.NewOpusEncoder(pulse)
-	gstPipeline, err := p.CompileGstPipeline()
+	p := gameserver.NewOpusEncoder(pulse, 2, nil)
+	gstPipeline, err := gameserver.CompileGstPipeline(p)
 	if err != nil {
 		panic(fmt.Errorf("failed to complie gst pipeline: %+v", err))
 	}
@@ -14,6 +14,11 @@ require (
 	github.com/grpc-ecosystem/go-grpc-middleware v1.2.2
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/notedit/gst v0.0.9
+	github.com/pion/interceptor v0.0.8
+	github.com/pion/logging v0.2.2
+	github.com/pion/rtcp v1.2.6
+	github.com/pion/rtp v1.6.2
+	github.com/pion/transport v0.12.0
 	github.com/pion/webrtc/v3 v3.0.1
 	github.com/pkg/errors v0.9.1
 	github.com/sclevine/agouti v3.0.0+incompatible
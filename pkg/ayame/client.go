@@ -4,35 +4,81 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"io"
+	"fmt"
 	"log"
-	"strings"
+	"net"
 	"sync"
+	"time"
 
 	"github.com/pion/webrtc/v3"
 
 	"golang.org/x/net/websocket"
 )
 
+var (
+	ErrClosed = errors.New("ayame client closed")
+	// the remote peer left the room
+	errBye          = errors.New("bye received from ayame")
+	errNotConnected = errors.New("not connected to ayame")
+)
+
+// RejectError is returned by Connect when Ayame rejects the register message.
+type RejectError struct {
+	Reason string
+}
+
+func (e *RejectError) Error() string {
+	return fmt.Sprintf("rejected by ayame (reason: %s)", e.Reason)
+}
+
 type Client struct {
-	conn *websocket.Conn
-	pc   *webrtc.PeerConnection
-	rid  string
-	cid  string
-	opts *opts
+	// the current connection to Ayame, which is written only by writeLoop
+	conn     *websocket.Conn
+	outgoing chan *outgoingMessage
+	pc       *webrtc.PeerConnection
+	rid      string
+	cid      string
+	url      string
+	req      *ConnectRequest
+	opts     *opts
+
+	// ICE servers configured by the caller, which are kept when Ayame gives its ICE servers
+	iceServers []webrtc.ICEServer
 
 	onConnect    func()
 	onDisconnect func()
 	callbackMu   sync.Mutex
 
+	// remote candidates received before the remote description
 	pendingCandidates []*webrtc.ICECandidateInit
+	candidateMu       sync.Mutex
+
+	// canceled by Close or the context of Connect, and reset when Connect fails
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	closed bool
+	mu     sync.Mutex
 }
 
+const (
+	defaultConnectTimeout      = 10 * time.Second
+	defaultMinReconnectBackoff = 500 * time.Millisecond
+	defaultMaxReconnectBackoff = 30 * time.Second
+)
+
 type opts struct {
+	connectTimeout      time.Duration
+	minReconnectBackoff time.Duration
+	maxReconnectBackoff time.Duration
 }
 
 func defaultOptions() *opts {
-	return &opts{}
+	return &opts{
+		connectTimeout:      defaultConnectTimeout,
+		minReconnectBackoff: defaultMinReconnectBackoff,
+		maxReconnectBackoff: defaultMaxReconnectBackoff,
+	}
 }
 
 type ClientOption interface {
@@ -45,118 +91,412 @@ func (f ClientOptionFunc) apply(opts *opts) {
 	f(opts)
 }
 
+// WithConnectTimeout sets how long to wait for Ayame to accept or reject the register message.
+func WithConnectTimeout(timeout time.Duration) ClientOption {
+	return ClientOptionFunc(func(opts *opts) {
+		opts.connectTimeout = timeout
+	})
+}
+
+// WithReconnectBackoff sets the range of the exponential backoff to reconnect to Ayame.
+func WithReconnectBackoff(min, max time.Duration) ClientOption {
+	return ClientOptionFunc(func(opts *opts) {
+		opts.minReconnectBackoff = min
+		opts.maxReconnectBackoff = max
+	})
+}
+
 func NewClient(pc *webrtc.PeerConnection, options ...ClientOption) *Client {
 	opts := defaultOptions()
 	for _, opt := range options {
 		opt.apply(opts)
 	}
 	return &Client{
-		pc:   pc,
-		opts: opts,
+		pc:         pc,
+		iceServers: pc.GetConfiguration().ICEServers,
+		opts:       opts,
+		outgoing:   make(chan *outgoingMessage),
 	}
 }
 
+// OnConnect sets a handler called when the client is accepted by Ayame, including reconnection.
+func (c *Client) OnConnect(f func()) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.onConnect = f
+}
+
+// OnDisconnect sets a handler called when the connection to Ayame is lost or closed.
+// The client may reconnect after it unless closed.
+func (c *Client) OnDisconnect(f func()) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.onDisconnect = f
+}
+
 type ConnectRequest struct {
 	RoomID       string
 	ClientID     string
 	SignalingKey string
 }
 
+// Connect registers the client to the room and returns when Ayame accepts it, or returns *RejectError.
+// The client keeps signaling until the context is canceled or Close is called,
+// and reconnects to Ayame while the peer connection is alive.
 func (c *Client) Connect(ctx context.Context, url_ string, req *ConnectRequest) error {
-	return c.signaling(ctx, url_, req)
-}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	if c.ctx != nil {
+		c.mu.Unlock()
+		return errors.New("ayame client already connected")
+	}
+	c.url = url_
+	c.req = req
+	c.cid = req.ClientID
+	c.rid = req.RoomID
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	c.ctx, c.cancel, c.done = ctx, cancel, done
+	c.mu.Unlock()
+	go c.writeLoop(ctx)
 
-func (c *Client) signaling(ctx context.Context, url_ string, req *ConnectRequest) error {
-	conn, err := websocket.Dial(url_, "", url_)
+	conn, err := c.connect(ctx)
 	if err != nil {
+		cancel()
+		// Connect can be called again after the failure
+		c.mu.Lock()
+		c.ctx, c.cancel = nil, nil
+		c.mu.Unlock()
+		close(done)
 		return err
 	}
-	c.conn = conn
-	go c.recv(ctx)
-	if err := c.sendRegisterMessage(req); err != nil {
-		return err
+	c.notify(c.onConnectHandler())
+	go c.run(conn)
+	return nil
+}
+
+// Close stops signaling and waits for the connection to Ayame to be closed. The peer connection is not closed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
 	}
+	c.closed = true
+	cancel, done := c.cancel, c.done
+	c.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
 	return nil
 }
 
-func (c *Client) recv(ctx context.Context) {
-	defer func() {
-		_ = c.conn.Close()
-		log.Printf("disconnected from ayame")
+// connect dials to Ayame and waits for the register message to be accepted.
+func (c *Client) connect(ctx context.Context) (*websocket.Conn, error) {
+	config, err := websocket.NewConfig(c.url, c.url)
+	if err != nil {
+		return nil, err
+	}
+	config.Dialer = &net.Dialer{Timeout: c.opts.connectTimeout}
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+	c.setConn(conn)
+	fail := func(err error) (*websocket.Conn, error) {
+		c.setConn(nil)
+		_ = conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(c.opts.connectTimeout)); err != nil {
+		return fail(err)
+	}
+	if err := c.sendRegisterMessage(c.req); err != nil {
+		return fail(err)
+	}
+	if err := c.waitAccept(conn); err != nil {
+		return fail(err)
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return fail(err)
+	}
+	return conn, nil
+}
+
+func (c *Client) setConn(conn *websocket.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn = conn
+}
+
+// closeOnDone closes the connection when the context is done, which unblocks reading the connection.
+// Call the returned function to stop watching the context.
+func closeOnDone(ctx context.Context, conn *websocket.Conn) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-stop:
+		}
 	}()
+	return func() { close(stop) }
+}
+
+func (c *Client) waitAccept(conn *websocket.Conn) error {
+	for {
+		var msg receivedMessage
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			return err
+		}
+		switch msg.Type {
+		case "ping":
+			if err := c.send(&pingPongMessage{Type: "pong"}); err != nil {
+				return err
+			}
+		case "accept":
+			var acc acceptMessage
+			if err := json.Unmarshal(msg.Payload, &acc); err != nil {
+				return err
+			}
+			return c.handleAccept(&acc)
+		case "reject":
+			var rej rejectMessage
+			if err := json.Unmarshal(msg.Payload, &rej); err != nil {
+				return err
+			}
+			return &RejectError{Reason: rej.Reason}
+		default:
+			return fmt.Errorf("unexpected message before accept: %s", msg.Type)
+		}
+	}
+}
+
+// run receives messages and reconnects to Ayame until the client is closed.
+func (c *Client) run(conn *websocket.Conn) {
+	defer close(c.done)
+	for {
+		err := c.recv(conn)
+		c.setConn(nil)
+		_ = conn.Close()
+		c.notify(c.onDisconnectHandler())
+		if c.ctx.Err() != nil {
+			log.Printf("[%s] disconnected from ayame", c.cid)
+			return
+		}
+		if errors.Is(err, errBye) {
+			log.Printf("[%s] bye received from ayame", c.cid)
+			return
+		}
+		log.Printf("[%s] connection to ayame lost: %+v", c.cid, err)
+		conn = c.reconnect()
+		if conn == nil {
+			return
+		}
+		c.notify(c.onConnectHandler())
+	}
+}
+
+// reconnect connects to Ayame with exponential backoff while the peer connection is alive.
+func (c *Client) reconnect() *websocket.Conn {
+	backoff := c.opts.minReconnectBackoff
+	for {
+		select {
+		case <-c.ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if c.pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			log.Printf("[%s] peer connection closed, stop reconnecting to ayame", c.cid)
+			return nil
+		}
+		conn, err := c.connect(c.ctx)
+		if err == nil {
+			log.Printf("[%s] reconnected to ayame", c.cid)
+			return conn
+		}
+		var rej *RejectError
+		if errors.As(err, &rej) || c.ctx.Err() != nil {
+			log.Printf("[%s] failed to reconnect to ayame: %+v", c.cid, err)
+			return nil
+		}
+		if backoff *= 2; backoff > c.opts.maxReconnectBackoff {
+			backoff = c.opts.maxReconnectBackoff
+		}
+		log.Printf("[%s] failed to reconnect to ayame, retrying in %v: %+v", c.cid, backoff, err)
+	}
+}
+
+// recv handles messages until the connection is closed or the context is done.
+func (c *Client) recv(conn *websocket.Conn) error {
+	stop := closeOnDone(c.ctx, conn)
+	defer stop()
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(conn, &data); err != nil {
+			return err
+		}
+		var msg receivedMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Printf("failed to unmarshal JSON: %+v", err)
+			continue
+		}
+		if msg.Type == "bye" {
+			return errBye
+		}
+		c.handleMessage(&msg)
+	}
+}
+
+type outgoingMessage struct {
+	msg    interface{}
+	result chan error
+}
+
+// send writes the message to Ayame through writeLoop and waits for the result.
+// It is safe to call from any goroutine (e.g. the callback of ICE candidates of the peer connection).
+func (c *Client) send(msg interface{}) error {
+	c.mu.Lock()
+	ctx := c.ctx
+	c.mu.Unlock()
+	if ctx == nil {
+		return errNotConnected
+	}
+	m := &outgoingMessage{msg: msg, result: make(chan error, 1)}
+	select {
+	case c.outgoing <- m:
+	case <-ctx.Done():
+		return ErrClosed
+	}
+	select {
+	case err := <-m.result:
+		return err
+	case <-ctx.Done():
+		return ErrClosed
+	}
+}
+
+// writeLoop is the only writer of the connections to Ayame.
+func (c *Client) writeLoop(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		default:
-			var msg receivedMessage
-			if err := websocket.JSON.Receive(c.conn, &msg); err != nil {
-				if errors.Is(err, io.EOF) || strings.Contains(err.Error(), "use of closed network connection") {
-					break
-				}
-				log.Printf("failed to receive JSON: %+v", err)
+		case m := <-c.outgoing:
+			c.mu.Lock()
+			conn := c.conn
+			c.mu.Unlock()
+			if conn == nil {
+				m.result <- errNotConnected
 				continue
 			}
-			c.handleMessage(&msg)
+			m.result <- websocket.JSON.Send(conn, m.msg)
+		}
+	}
+}
+
+func (c *Client) onConnectHandler() func() {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	return c.onConnect
+}
+
+func (c *Client) onDisconnectHandler() func() {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	return c.onDisconnect
+}
+
+func (c *Client) notify(h func()) {
+	if h != nil {
+		h()
+	}
+}
+
+// setRemoteDescription applies the remote description and the candidates received before it.
+func (c *Client) setRemoteDescription(sdp webrtc.SessionDescription) error {
+	c.candidateMu.Lock()
+	defer c.candidateMu.Unlock()
+	if err := c.pc.SetRemoteDescription(sdp); err != nil {
+		return err
+	}
+	for _, cand := range c.pendingCandidates {
+		if err := c.pc.AddICECandidate(*cand); err != nil {
+			log.Printf("[%s] failed to add ice candidate: %+v", c.cid, err)
+		}
+	}
+	c.pendingCandidates = nil
+	return nil
+}
+
+// addICECandidate adds the remote candidate, or keeps it until the remote description is applied.
+func (c *Client) addICECandidate(cand *webrtc.ICECandidateInit) error {
+	c.candidateMu.Lock()
+	defer c.candidateMu.Unlock()
+	if c.pc.RemoteDescription() == nil {
+		c.pendingCandidates = append(c.pendingCandidates, cand)
+		return nil
+	}
+	return c.pc.AddICECandidate(*cand)
+}
+
+func (c *Client) handleAccept(acc *acceptMessage) error {
+	log.Printf("[%s] accepted(room: %s)", c.cid, c.rid)
+	if len(acc.IceServers) > 0 {
+		log.Printf("[%s] add ICE servers", c.cid)
+		// the ICE servers configured by the caller are kept (e.g. TURN servers configured for the game server),
+		// and the ones of the previous accept are replaced on reconnection
+		conf := c.pc.GetConfiguration()
+		conf.ICEServers = append([]webrtc.ICEServer{}, c.iceServers...)
+		for _, resp := range acc.IceServers {
+			conf.ICEServers = append(conf.ICEServers, webrtc.ICEServer{
+				URLs:       resp.URLs,
+				Username:   resp.Username,
+				Credential: resp.Credential,
+			})
+		}
+		if err := c.pc.SetConfiguration(conf); err != nil {
+			log.Printf("[%s] failed to set configuration: %+v", c.cid, err)
+		}
+	}
+	c.pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		var ice *webrtc.ICECandidateInit
+		if candidate != nil {
+			c := candidate.ToJSON()
+			ice = &c
+		}
+		log.Printf("[%s] new ICE candidate: %v", c.cid, candidate)
+		if err := c.send(&candidateMessage{Type: "candidate", ICECandidate: ice}); err != nil {
+			log.Printf("failed to send JSON: %+v", err)
+		}
+	})
+	// on reconnection, the peer connection has been negotiated already
+	if acc.IsExistClient && c.pc.RemoteDescription() == nil {
+		if err := c.sendOffer(nil); err != nil {
+			return fmt.Errorf("failed to send offer: %w", err)
 		}
 	}
+	return nil
 }
 
 func (c *Client) handleMessage(msg *receivedMessage) {
 	switch msg.Type {
 	case "ping":
 		pong := &pingPongMessage{Type: "pong"}
-		if err := websocket.JSON.Send(c.conn, pong); err != nil {
+		if err := c.send(pong); err != nil {
 			log.Printf("failed to send json: %+v", err)
 			return
 		}
-	case "accept":
-		var acc acceptMessage
-		if err := json.Unmarshal(msg.Payload, &acc); err != nil {
-			log.Printf("failed to unmarshal json: %+v", err)
-			return
-		}
-		log.Printf("[%s] accepted(room: %s)", c.cid, c.rid)
-		if len(acc.IceServers) > 0 {
-			log.Printf("[%s] set ICE servers", c.cid)
-			conf := c.pc.GetConfiguration()
-			conf.ICEServers = nil
-			for _, resp := range acc.IceServers {
-				conf.ICEServers = append(conf.ICEServers, webrtc.ICEServer{
-					URLs:       resp.URLs,
-					Username:   resp.Username,
-					Credential: resp.Credential,
-				})
-			}
-			if err := c.pc.SetConfiguration(conf); err != nil {
-				log.Printf("[%s] failed to set configuration: %+v", c.cid, err)
-				return
-			}
-		}
-		c.pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
-			var ice *webrtc.ICECandidateInit
-			if candidate != nil {
-				c := candidate.ToJSON()
-				ice = &c
-			}
-			log.Printf("[%s] new ICE candidate: %v", c.cid, candidate)
-			if err := websocket.JSON.Send(c.conn, &candidateMessage{Type: "candidate", ICECandidate: ice}); err != nil {
-				log.Printf("failed to send JSON: %+v", err)
-			}
-		})
-		if acc.IsExistClient {
-			if err := c.sendOffer(); err != nil {
-				log.Printf("failed to send offer: %+v", err)
-				return
-			}
-		}
-	case "reject":
-		var rej rejectMessage
-		if err := json.Unmarshal(msg.Payload, &rej); err != nil {
-			log.Printf("failed to unmarshal json: %+v", err)
-			return
-		}
-		log.Printf("rejected (reason: %s)", rej.Reason)
 	case "offer":
 		log.Printf("[%s] offer received", c.cid)
 		var sdp webrtc.SessionDescription
@@ -164,17 +504,10 @@ func (c *Client) handleMessage(msg *receivedMessage) {
 			log.Printf("failed to unmarshal json: %+v", err)
 			return
 		}
-		if err := c.pc.SetRemoteDescription(sdp); err != nil {
+		if err := c.setRemoteDescription(sdp); err != nil {
 			log.Printf("failed to set remote desc: %+v", err)
 			return
 		}
-		for _, cand := range c.pendingCandidates {
-			if err := c.pc.AddICECandidate(*cand); err != nil {
-				log.Printf("failed to add ice candidate: %+v", err)
-				return
-			}
-		}
-		c.pendingCandidates = nil
 		if err := c.sendAnswer(); err != nil {
 			log.Printf("failed to send answer: %+v", err)
 			return
@@ -186,17 +519,10 @@ func (c *Client) handleMessage(msg *receivedMessage) {
 			log.Printf("failed to unmarshal json: %+v", err)
 			return
 		}
-		if err := c.pc.SetRemoteDescription(sdp); err != nil {
+		if err := c.setRemoteDescription(sdp); err != nil {
 			log.Printf("failed to set remote desc: %+v", err)
 			return
 		}
-		for _, cand := range c.pendingCandidates {
-			if err := c.pc.AddICECandidate(*cand); err != nil {
-				log.Printf("failed to add ice candidate: %+v", err)
-				return
-			}
-		}
-		c.pendingCandidates = nil
 	case "candidate":
 		var candMsg candidateMessage
 		if err := json.Unmarshal(msg.Payload, &candMsg); err != nil {
@@ -205,18 +531,11 @@ func (c *Client) handleMessage(msg *receivedMessage) {
 		}
 		if candMsg.ICECandidate != nil {
 			log.Printf("[%s] add ice candidate from remote peer: %s", c.cid, candMsg.ICECandidate.Candidate)
-			if c.pc.RemoteDescription() != nil {
-				if err := c.pc.AddICECandidate(*candMsg.ICECandidate); err != nil {
-					log.Printf("failed to add ice candidate: %+v", err)
-					return
-				}
-			} else {
-				c.pendingCandidates = append(c.pendingCandidates, candMsg.ICECandidate)
+			if err := c.addICECandidate(candMsg.ICECandidate); err != nil {
+				log.Printf("failed to add ice candidate: %+v", err)
+				return
 			}
 		}
-	case "bye":
-		log.Printf("[%s] bye received from ayame", c.cid)
-		_ = c.conn.Close()
 	case "error":
 		log.Printf("[%s] error received from ayame: %s", c.cid, string(msg.Payload))
 	default:
@@ -231,20 +550,24 @@ func (c *Client) sendRegisterMessage(req *ConnectRequest) error {
 		ClientID:     req.ClientID,
 		SignalingKey: req.SignalingKey,
 	}
-	c.cid = req.ClientID
-	c.rid = req.RoomID
-	return websocket.JSON.Send(c.conn, msg)
+	return c.send(msg)
+}
+
+// Renegotiate sends a new offer to the remote peer (e.g. with ICERestart to restart ICE on a failed connection).
+// The answer is applied to the peer connection when it arrives.
+func (c *Client) Renegotiate(ctx context.Context, options *webrtc.OfferOptions) error {
+	return c.sendOffer(options)
 }
 
-func (c *Client) sendOffer() error {
-	offer, err := c.pc.CreateOffer(nil)
+func (c *Client) sendOffer(options *webrtc.OfferOptions) error {
+	offer, err := c.pc.CreateOffer(options)
 	if err != nil {
 		return err
 	}
 	if err := c.pc.SetLocalDescription(offer); err != nil {
 		return err
 	}
-	if err := websocket.JSON.Send(c.conn, c.pc.LocalDescription()); err != nil {
+	if err := c.send(c.pc.LocalDescription()); err != nil {
 		return err
 	}
 	log.Printf("[%s] offer sent", c.cid)
@@ -259,7 +582,7 @@ func (c *Client) sendAnswer() error {
 	if err := c.pc.SetLocalDescription(answer); err != nil {
 		return err
 	}
-	if err := websocket.JSON.Send(c.conn, c.pc.LocalDescription()); err != nil {
+	if err := c.send(c.pc.LocalDescription()); err != nil {
 		return err
 	}
 	log.Printf("[%s] answer sent", c.cid)
@@ -0,0 +1,399 @@
+package ayame
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+// fakeAyame is an in-process Ayame server which responds to register messages by respond.
+type fakeAyame struct {
+	hs *httptest.Server
+	// respond handles the n-th (from 1) connection after receiving the register message
+	respond   func(conn *websocket.Conn, n int)
+	registers []*registerMessage
+	closed    chan int
+	mu        sync.Mutex
+}
+
+func newFakeAyame(respond func(conn *websocket.Conn, n int)) *fakeAyame {
+	f := &fakeAyame{respond: respond, closed: make(chan int, 10)}
+	f.hs = httptest.NewServer(websocket.Server{Handler: f.serve})
+	return f
+}
+
+func (f *fakeAyame) URL() string {
+	return "ws" + strings.TrimPrefix(f.hs.URL, "http")
+}
+
+func (f *fakeAyame) Registers() []*registerMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*registerMessage(nil), f.registers...)
+}
+
+func (f *fakeAyame) serve(conn *websocket.Conn) {
+	defer conn.Close()
+	var reg registerMessage
+	if err := websocket.JSON.Receive(conn, &reg); err != nil {
+		return
+	}
+	f.mu.Lock()
+	f.registers = append(f.registers, &reg)
+	n := len(f.registers)
+	f.mu.Unlock()
+	f.respond(conn, n)
+	// wait for the client to close the connection
+	var data []byte
+	for websocket.Message.Receive(conn, &data) == nil {
+	}
+	f.closed <- n
+}
+
+func accept(conn *websocket.Conn) {
+	_ = websocket.JSON.Send(conn, &acceptMessage{Type: "accept"})
+}
+
+func newPeerConnection(t *testing.T) *webrtc.PeerConnection {
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pc
+}
+
+func TestConnect(t *testing.T) {
+	f := newFakeAyame(func(conn *websocket.Conn, n int) { accept(conn) })
+	defer f.hs.Close()
+	pc := newPeerConnection(t)
+	defer pc.Close()
+
+	c := NewClient(pc)
+	err := c.Connect(context.Background(), f.URL(), &ConnectRequest{RoomID: "room1", ClientID: "client1", SignalingKey: "key"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*registerMessage{{Type: "register", RoomID: "room1", ClientID: "client1", SignalingKey: "key"}}, f.Registers())
+
+	assert.NoError(t, c.Close())
+	select {
+	case <-f.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the connection to be closed")
+	}
+	assert.NoError(t, c.Close())
+	assert.Equal(t, ErrClosed, c.Connect(context.Background(), f.URL(), &ConnectRequest{RoomID: "room1", ClientID: "client1"}))
+}
+
+func TestConnectRejected(t *testing.T) {
+	f := newFakeAyame(func(conn *websocket.Conn, n int) {
+		if n == 1 {
+			_ = websocket.JSON.Send(conn, &rejectMessage{Type: "reject", Reason: "TOO-MANY-USERS"})
+			return
+		}
+		accept(conn)
+	})
+	defer f.hs.Close()
+	pc := newPeerConnection(t)
+	defer pc.Close()
+
+	c := NewClient(pc)
+	err := c.Connect(context.Background(), f.URL(), &ConnectRequest{RoomID: "room1", ClientID: "client1"})
+	var rej *RejectError
+	assert.True(t, errors.As(err, &rej), err)
+	assert.Equal(t, "TOO-MANY-USERS", rej.Reason)
+
+	// the client can retry after rejected
+	assert.NoError(t, c.Connect(context.Background(), f.URL(), &ConnectRequest{RoomID: "room1", ClientID: "client1"}))
+	assert.Len(t, f.Registers(), 2)
+	assert.NoError(t, c.Close())
+}
+
+func TestConnectTimeout(t *testing.T) {
+	// the fake never responds
+	f := newFakeAyame(func(conn *websocket.Conn, n int) {})
+	defer f.hs.Close()
+	pc := newPeerConnection(t)
+	defer pc.Close()
+
+	started := time.Now()
+	err := NewClient(pc, WithConnectTimeout(200*time.Millisecond)).Connect(context.Background(), f.URL(), &ConnectRequest{RoomID: "room1", ClientID: "client1"})
+	assert.Error(t, err)
+	assert.True(t, time.Since(started) < 5*time.Second)
+
+	// canceling the context stops waiting as well
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+	err = NewClient(pc).Connect(ctx, f.URL(), &ConnectRequest{RoomID: "room1", ClientID: "client1"})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestContextCancellation(t *testing.T) {
+	f := newFakeAyame(func(conn *websocket.Conn, n int) { accept(conn) })
+	defer f.hs.Close()
+	pc := newPeerConnection(t)
+	defer pc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewClient(pc)
+	assert.NoError(t, c.Connect(ctx, f.URL(), &ConnectRequest{RoomID: "room1", ClientID: "client1"}))
+	cancel()
+	select {
+	case <-f.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the connection to be closed")
+	}
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the client to stop")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	f := newFakeAyame(func(conn *websocket.Conn, n int) {
+		accept(conn)
+		// the connection is lost twice
+		if n <= 2 {
+			_ = conn.Close()
+		}
+	})
+	defer f.hs.Close()
+	pc := newPeerConnection(t)
+	defer pc.Close()
+
+	c := NewClient(pc, WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	assert.NoError(t, c.Connect(context.Background(), f.URL(), &ConnectRequest{RoomID: "room1", ClientID: "client1"}))
+	assert.Eventually(t, func() bool { return len(f.Registers()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	for _, reg := range f.Registers() {
+		assert.Equal(t, "room1", reg.RoomID)
+		assert.Equal(t, "client1", reg.ClientID)
+	}
+	assert.NoError(t, c.Close())
+
+	// no reconnection after the peer connection is closed
+	f2 := newFakeAyame(func(conn *websocket.Conn, n int) {
+		accept(conn)
+		_ = conn.Close()
+	})
+	defer f2.hs.Close()
+	pc2 := newPeerConnection(t)
+	c2 := NewClient(pc2, WithReconnectBackoff(100*time.Millisecond, 100*time.Millisecond))
+	assert.NoError(t, c2.Connect(context.Background(), f2.URL(), &ConnectRequest{RoomID: "room1", ClientID: "client1"}))
+	assert.NoError(t, pc2.Close())
+	select {
+	case <-c2.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the client to stop")
+	}
+	assert.Len(t, f2.Registers(), 1)
+}
+
+func TestReconnectICEServers(t *testing.T) {
+	f := newFakeAyame(func(conn *websocket.Conn, n int) {
+		_ = websocket.JSON.Send(conn, &acceptMessage{Type: "accept", IceServers: []*iceServer{
+			{URLs: []string{fmt.Sprintf("stun:ayame%d.example.com:3478", n)}},
+		}})
+		// the connection is lost once
+		if n == 1 {
+			_ = conn.Close()
+		}
+	})
+	defer f.hs.Close()
+	configured := webrtc.ICEServer{URLs: []string{"stun:gameserver.example.com:3478"}}
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{ICEServers: []webrtc.ICEServer{configured}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	c := NewClient(pc, WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	assert.NoError(t, c.Connect(context.Background(), f.URL(), &ConnectRequest{RoomID: "room1", ClientID: "client1"}))
+	defer c.Close()
+	assert.Eventually(t, func() bool { return len(f.Registers()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	// the ICE servers of the previous accept are replaced
+	expected := []webrtc.ICEServer{configured, {URLs: []string{"stun:ayame2.example.com:3478"}, Credential: ""}}
+	assert.Eventually(t, func() bool {
+		return reflect.DeepEqual(expected, pc.GetConfiguration().ICEServers)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestLifecycleCallbacks(t *testing.T) {
+	f := newFakeAyame(func(conn *websocket.Conn, n int) {
+		accept(conn)
+		if n == 1 {
+			_ = conn.Close()
+		}
+	})
+	defer f.hs.Close()
+	pc := newPeerConnection(t)
+	defer pc.Close()
+
+	var connectCount, disconnectCount int32
+	c := NewClient(pc, WithReconnectBackoff(10*time.Millisecond, 10*time.Millisecond))
+	c.OnConnect(func() { atomic.AddInt32(&connectCount, 1) })
+	c.OnDisconnect(func() { atomic.AddInt32(&disconnectCount, 1) })
+	assert.NoError(t, c.Connect(context.Background(), f.URL(), &ConnectRequest{RoomID: "room1", ClientID: "client1"}))
+	// connected, lost and reconnected
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&connectCount) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&disconnectCount))
+	assert.NoError(t, c.Close())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&disconnectCount))
+}
+
+// newOffer returns an offer without candidates and the candidates of the remote peer, which are trickled separately.
+func newOffer(t *testing.T, remote *webrtc.PeerConnection) (webrtc.SessionDescription, []*webrtc.ICECandidateInit) {
+	if _, err := remote.CreateDataChannel("data", nil); err != nil {
+		t.Fatal(err)
+	}
+	offer, err := remote.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gatheringComplete := webrtc.GatheringCompletePromise(remote)
+	if err := remote.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-gatheringComplete
+	var candidates []*webrtc.ICECandidateInit
+	mid := "0"
+	for _, line := range strings.Split(remote.LocalDescription().SDP, "\r\n") {
+		if strings.HasPrefix(line, "a=candidate:") {
+			candidates = append(candidates, &webrtc.ICECandidateInit{Candidate: strings.TrimPrefix(line, "a="), SDPMid: &mid})
+		}
+	}
+	if len(candidates) == 0 {
+		t.Fatal("no candidates gathered")
+	}
+	return offer, candidates
+}
+
+func mustReceivedMessage(t *testing.T, msg interface{}) *receivedMessage {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received receivedMessage
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatal(err)
+	}
+	return &received
+}
+
+func TestCandidatesBeforeRemoteDescription(t *testing.T) {
+	remote := newPeerConnection(t)
+	defer remote.Close()
+	offer, candidates := newOffer(t, remote)
+	pc := newPeerConnection(t)
+	defer pc.Close()
+	c := NewClient(pc)
+
+	// candidates race with the offer
+	var wg sync.WaitGroup
+	for _, cand := range candidates {
+		wg.Add(1)
+		go func(cand *webrtc.ICECandidateInit) {
+			defer wg.Done()
+			c.handleMessage(mustReceivedMessage(t, &candidateMessage{Type: "candidate", ICECandidate: cand}))
+		}(cand)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.handleMessage(mustReceivedMessage(t, &offer))
+	}()
+	wg.Wait()
+
+	assert.NotNil(t, pc.RemoteDescription())
+	c.candidateMu.Lock()
+	defer c.candidateMu.Unlock()
+	// all the candidates received before the offer have been added
+	assert.Empty(t, c.pendingCandidates)
+}
+
+func TestTrickledCandidates(t *testing.T) {
+	remote := newPeerConnection(t)
+	defer remote.Close()
+	offer, candidates := newOffer(t, remote)
+	f := newFakeAyame(func(conn *websocket.Conn, n int) {
+		accept(conn)
+		// the fake writes pings concurrently with the candidates and the offer of the remote peer
+		var writeMu sync.Mutex
+		write := func(msg interface{}) {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			_ = websocket.JSON.Send(conn, msg)
+		}
+		stopPing := make(chan struct{})
+		defer close(stopPing)
+		go func() {
+			for {
+				select {
+				case <-stopPing:
+					return
+				case <-time.After(time.Millisecond):
+					write(&pingPongMessage{Type: "ping"})
+				}
+			}
+		}()
+		for _, cand := range candidates {
+			write(&candidateMessage{Type: "candidate", ICECandidate: cand})
+		}
+		write(&offer)
+
+		// the candidates of the client may arrive before the answer as well
+		var pending []webrtc.ICECandidateInit
+		for {
+			var msg receivedMessage
+			if err := websocket.JSON.Receive(conn, &msg); err != nil {
+				return
+			}
+			switch msg.Type {
+			case "answer":
+				var sdp webrtc.SessionDescription
+				assert.NoError(t, json.Unmarshal(msg.Payload, &sdp))
+				assert.NoError(t, remote.SetRemoteDescription(sdp))
+				for _, cand := range pending {
+					assert.NoError(t, remote.AddICECandidate(cand))
+				}
+				pending = nil
+			case "candidate":
+				var cm candidateMessage
+				assert.NoError(t, json.Unmarshal(msg.Payload, &cm))
+				if cm.ICECandidate == nil {
+					continue
+				}
+				if remote.RemoteDescription() == nil {
+					pending = append(pending, *cm.ICECandidate)
+				} else {
+					assert.NoError(t, remote.AddICECandidate(*cm.ICECandidate))
+				}
+			}
+		}
+	})
+	defer f.hs.Close()
+	pc := newPeerConnection(t)
+	defer pc.Close()
+
+	c := NewClient(pc)
+	assert.NoError(t, c.Connect(context.Background(), f.URL(), &ConnectRequest{RoomID: "room1", ClientID: "client1"}))
+	defer c.Close()
+	for _, p := range []*webrtc.PeerConnection{pc, remote} {
+		assert.Eventually(t, func() bool {
+			return p.ICEConnectionState() == webrtc.ICEConnectionStateConnected
+		}, 10*time.Second, 10*time.Millisecond)
+	}
+}
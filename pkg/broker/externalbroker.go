@@ -3,13 +3,17 @@ package broker
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/castaneai/mashimaro/pkg/allocator"
 
 	"github.com/castaneai/mashimaro/pkg/gamemetadata"
 	"github.com/castaneai/mashimaro/pkg/gamesession"
+	"github.com/castaneai/mashimaro/pkg/iceserver"
+	"github.com/castaneai/mashimaro/pkg/signaling"
 
 	"github.com/go-chi/chi"
 )
@@ -18,14 +22,56 @@ type ExternalBroker struct {
 	sessionStore  gamesession.Store
 	metadataStore gamemetadata.Store
 	allocator     allocator.Allocator
+	opts          *externalBrokerOptions
 }
 
-func NewExternalBroker(sessionStore gamesession.Store, metadataStore gamemetadata.Store, alloc allocator.Allocator) *ExternalBroker {
-	return &ExternalBroker{sessionStore: sessionStore, metadataStore: metadataStore, allocator: alloc}
+type externalBrokerOptions struct {
+	iceServers      *iceserver.Config
+	joinTokenSecret string
+	joinTokenTTL    time.Duration
+}
+
+type ExternalBrokerOption interface {
+	apply(opts *externalBrokerOptions)
+}
+
+type ExternalBrokerOptionFunc func(*externalBrokerOptions)
+
+func (f ExternalBrokerOptionFunc) apply(opts *externalBrokerOptions) {
+	f(opts)
+}
+
+// WithICEServers hands the ICE servers to players in the response of a new game,
+// with TURN credentials issued for the session.
+func WithICEServers(conf iceserver.Config) ExternalBrokerOption {
+	return ExternalBrokerOptionFunc(func(opts *externalBrokerOptions) {
+		opts.iceServers = &conf
+	})
+}
+
+// WithJoinTokens hands a join token of the session to players in the response of a new game,
+// which is the signaling key for the signaling server of pkg/signaling authenticating clients with the secret.
+func WithJoinTokens(secret string, ttl time.Duration) ExternalBrokerOption {
+	return ExternalBrokerOptionFunc(func(opts *externalBrokerOptions) {
+		opts.joinTokenSecret = secret
+		opts.joinTokenTTL = ttl
+	})
+}
+
+func NewExternalBroker(sessionStore gamesession.Store, metadataStore gamemetadata.Store, alloc allocator.Allocator, options ...ExternalBrokerOption) *ExternalBroker {
+	opts := &externalBrokerOptions{}
+	for _, opt := range options {
+		opt.apply(opts)
+	}
+	return &ExternalBroker{sessionStore: sessionStore, metadataStore: metadataStore, allocator: alloc, opts: opts}
 }
 
 type newGameResponse struct {
 	SessionID gamesession.SessionID `json:"sessionId"`
+	// ICE servers for RTCPeerConnection of the player. The player uses its own ones if empty.
+	ICEServers []iceserver.Server `json:"iceServers,omitempty"`
+	// the signaling key to join the room of the session
+	SignalingKey string `json:"signalingKey,omitempty"`
 }
 
 func (s *ExternalBroker) newGame(ctx context.Context, gameID string) (*gamesession.Session, error) {
@@ -75,8 +121,15 @@ func (s *ExternalBroker) HTTPHandler() http.Handler {
 			w.Write([]byte(`{"error": "internal server error"}`))
 			return
 		}
+		resp := &newGameResponse{SessionID: ss.SessionID}
+		if s.opts.iceServers != nil {
+			resp.ICEServers = s.opts.iceServers.Servers(fmt.Sprintf("%s-player", ss.SessionID), time.Now())
+		}
+		if s.opts.joinTokenSecret != "" {
+			resp.SignalingKey = signaling.JoinToken(s.opts.joinTokenSecret, string(ss.SessionID), time.Now().Add(s.opts.joinTokenTTL))
+		}
 		enc := json.NewEncoder(w)
-		if err := enc.Encode(&newGameResponse{SessionID: ss.SessionID}); err != nil {
+		if err := enc.Encode(resp); err != nil {
 			log.Printf("failed to encode JSON: %+v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(`{"error": "internal server error"}`))
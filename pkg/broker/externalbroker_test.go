@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -15,32 +18,42 @@ import (
 	"github.com/castaneai/mashimaro/pkg/gamemetadata"
 
 	"github.com/castaneai/mashimaro/pkg/gamesession"
+	"github.com/castaneai/mashimaro/pkg/iceserver"
+	"github.com/castaneai/mashimaro/pkg/signaling"
 )
 
 type externalBrokerClient struct {
 	hs *httptest.Server
 }
 
-func newExternalBrokerClient(sstore gamesession.Store, mstore gamemetadata.Store, allocator allocator.Allocator) *externalBrokerClient {
-	s := NewExternalBroker(sstore, mstore, allocator)
+func newExternalBrokerClient(sstore gamesession.Store, mstore gamemetadata.Store, allocator allocator.Allocator, opts ...ExternalBrokerOption) *externalBrokerClient {
+	s := NewExternalBroker(sstore, mstore, allocator, opts...)
 	return &externalBrokerClient{
 		httptest.NewServer(s.HTTPHandler()),
 	}
 }
 
 func (ts *externalBrokerClient) NewGame(gameID string) (gamesession.SessionID, error) {
+	resp, err := ts.newGame(gameID)
+	if err != nil {
+		return "", err
+	}
+	return resp.SessionID, nil
+}
+
+func (ts *externalBrokerClient) newGame(gameID string) (*newGameResponse, error) {
 	url := fmt.Sprintf("%s/newgame/%s", ts.hs.URL, gameID)
 	resp, err := http.Post(url, "application/json", nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 	var newGameResp newGameResponse
 	dec := json.NewDecoder(resp.Body)
 	if err := dec.Decode(&newGameResp); err != nil {
-		return "", err
+		return nil, err
 	}
-	return newGameResp.SessionID, nil
+	return &newGameResp, nil
 }
 
 func TestExternalBroker(t *testing.T) {
@@ -63,3 +76,63 @@ func TestExternalBroker(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, ss.SessionID, sid)
 }
+
+func TestExternalBrokerICEServers(t *testing.T) {
+	ctx := context.Background()
+	sstore := gamesession.NewInMemoryStore()
+	mstore := gamemetadata.NewInMemoryStore()
+	metadata := &gamemetadata.Metadata{
+		GameID:  "test-game",
+		Command: "test-command",
+	}
+	assert.NoError(t, mstore.AddGameMetadata(ctx, metadata))
+	alloc := allocator.NewMockAllocator(&allocator.AllocatedServer{ID: "dummy"})
+
+	// no ICE servers by default
+	client := newExternalBrokerClient(sstore, mstore, alloc)
+	resp, err := client.newGame(metadata.GameID)
+	assert.NoError(t, err)
+	assert.Empty(t, resp.ICEServers)
+
+	client = newExternalBrokerClient(sstore, mstore, alloc, WithICEServers(iceserver.Config{
+		STUNURLs:   []string{"stun:turn.example.com:3478"},
+		TURNURLs:   []string{"turn:turn.example.com:3478"},
+		TURNSecret: "secret",
+	}))
+	resp, err = client.newGame(metadata.GameID)
+	assert.NoError(t, err)
+	assert.Len(t, resp.ICEServers, 2)
+	turn := resp.ICEServers[1]
+	assert.Equal(t, []string{"turn:turn.example.com:3478"}, turn.URLs)
+	// the credential is issued for the session
+	assert.True(t, strings.HasSuffix(turn.Username, fmt.Sprintf(":%s-player", resp.SessionID)), turn.Username)
+	expiresAt, err := strconv.ParseInt(strings.SplitN(turn.Username, ":", 2)[0], 10, 64)
+	assert.NoError(t, err)
+	assert.True(t, time.Unix(expiresAt, 0).After(time.Now()))
+	_, password := iceserver.TURNCredential("secret", strings.SplitN(turn.Username, ":", 2)[1], time.Unix(expiresAt, 0))
+	assert.Equal(t, password, turn.Credential)
+}
+
+func TestExternalBrokerJoinTokens(t *testing.T) {
+	ctx := context.Background()
+	sstore := gamesession.NewInMemoryStore()
+	mstore := gamemetadata.NewInMemoryStore()
+	metadata := &gamemetadata.Metadata{
+		GameID:  "test-game",
+		Command: "test-command",
+	}
+	assert.NoError(t, mstore.AddGameMetadata(ctx, metadata))
+	alloc := allocator.NewMockAllocator(&allocator.AllocatedServer{ID: "dummy"})
+
+	client := newExternalBrokerClient(sstore, mstore, alloc)
+	resp, err := client.newGame(metadata.GameID)
+	assert.NoError(t, err)
+	assert.Empty(t, resp.SignalingKey)
+
+	client = newExternalBrokerClient(sstore, mstore, alloc, WithJoinTokens("secret", time.Hour))
+	resp, err = client.newGame(metadata.GameID)
+	assert.NoError(t, err)
+	// the player joins the room of the session with the token
+	assert.NoError(t, signaling.VerifyJoinToken("secret", string(resp.SessionID), resp.SignalingKey, time.Now()))
+	assert.Error(t, signaling.VerifyJoinToken("secret", string(resp.SessionID), resp.SignalingKey, time.Now().Add(2*time.Hour)))
+}
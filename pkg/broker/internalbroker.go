@@ -2,6 +2,7 @@ package broker
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -14,6 +15,11 @@ import (
 	"github.com/castaneai/mashimaro/pkg/proto"
 )
 
+const (
+	// thumbnails are saved in a Firestore document, which is limited to 1 MiB
+	maxThumbnailSize = 512 * 1024
+)
+
 type internalBroker struct {
 	sessionStore  gamesession.Store
 	metadataStore gamemetadata.Store
@@ -46,6 +52,7 @@ func (s *internalBroker) FindSession(ctx context.Context, req *proto.FindSession
 			SessionId:         string(ss.SessionID),
 			AllocatedServerId: ss.AllocatedServerID,
 			GameId:            ss.GameID,
+			Recording:         ss.Recording,
 		},
 	}, nil
 }
@@ -82,3 +89,60 @@ func (s *internalBroker) DeleteSession(ctx context.Context, req *proto.DeleteSes
 	}
 	return &proto.DeleteSessionResponse{}, nil
 }
+
+// SetRecording requests the game server of the session to start or stop recording.
+// The game server watches the session and follows the request.
+func (s *internalBroker) SetRecording(ctx context.Context, req *proto.SetRecordingRequest) (*proto.SetRecordingResponse, error) {
+	err := s.sessionStore.UpdateSessionRecording(ctx, gamesession.SessionID(req.SessionId), req.Recording)
+	if errors.Is(err, gamesession.ErrSessionNotFound) {
+		return nil, status.Error(codes.NotFound, "game session not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &proto.SetRecordingResponse{}, nil
+}
+
+func (s *internalBroker) UpdateGameThumbnail(ctx context.Context, req *proto.UpdateGameThumbnailRequest) (*proto.UpdateGameThumbnailResponse, error) {
+	if req.ContentType != "image/png" && req.ContentType != "image/jpeg" {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported content type of thumbnail: %s", req.ContentType)
+	}
+	if len(req.Image) > maxThumbnailSize {
+		return nil, status.Errorf(codes.InvalidArgument, "too large thumbnail (size: %d, max: %d)", len(req.Image), maxThumbnailSize)
+	}
+	err := s.metadataStore.UpdateThumbnail(ctx, req.GameId, gamemetadata.ThumbnailDataURL(req.ContentType, req.Image))
+	if errors.Is(err, gamemetadata.ErrMetadataNotFound) {
+		return nil, status.Errorf(codes.NotFound, "game metadata not found(gameID: %s)", req.GameId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &proto.UpdateGameThumbnailResponse{}, nil
+}
+
+// ReportConnectionStats saves the latest connection stats of the session, which are reported by the game server periodically.
+func (s *internalBroker) ReportConnectionStats(ctx context.Context, req *proto.ReportConnectionStatsRequest) (*proto.ReportConnectionStatsResponse, error) {
+	if req.Stats == nil {
+		return nil, status.Error(codes.InvalidArgument, "connection stats required")
+	}
+	stats := &gamesession.ConnectionStats{
+		RoundTripTimeMs: req.Stats.RoundTripTimeMs,
+		JitterMs:        req.Stats.JitterMs,
+		PacketLoss:      req.Stats.PacketLoss,
+		Bitrate:         req.Stats.Bitrate,
+		Framerate:       req.Stats.Framerate,
+		FramesSent:      int64(req.Stats.FramesSent),
+		NACKCount:       int64(req.Stats.NackCount),
+		PLICount:        int64(req.Stats.PliCount),
+		CandidateType:   req.Stats.CandidateType,
+		UpdatedAt:       time.Now(),
+	}
+	err := s.sessionStore.UpdateSessionConnectionStats(ctx, gamesession.SessionID(req.SessionId), stats)
+	if errors.Is(err, gamesession.ErrSessionNotFound) {
+		return nil, status.Error(codes.NotFound, "game session not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &proto.ReportConnectionStatsResponse{}, nil
+}
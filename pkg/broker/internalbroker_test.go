@@ -11,6 +11,8 @@ import (
 	"github.com/castaneai/mashimaro/pkg/proto"
 	"github.com/castaneai/mashimaro/pkg/testutils"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/castaneai/mashimaro/pkg/gamesession"
 )
@@ -42,6 +44,15 @@ func TestInternalBroker(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, resp.Found)
 	assert.Equal(t, string(ss.SessionID), resp.Session.SessionId)
+	assert.False(t, resp.Session.Recording)
+
+	_, err = client.SetRecording(ctx, &proto.SetRecordingRequest{SessionId: string(ss.SessionID), Recording: true})
+	assert.NoError(t, err)
+	resp, err = client.FindSession(ctx, &proto.FindSessionRequest{AllocatedServerId: allocatedServer.ID})
+	assert.NoError(t, err)
+	assert.True(t, resp.Session.Recording)
+	_, err = client.SetRecording(ctx, &proto.SetRecordingRequest{SessionId: "unknown", Recording: true})
+	assert.Equal(t, codes.NotFound, status.Code(err))
 
 	mdResp, err := client.GetGameMetadata(ctx, &proto.GetGameMetadataRequest{GameId: metadata.GameID})
 	assert.NoError(t, err)
@@ -50,6 +61,31 @@ func TestInternalBroker(t *testing.T) {
 	assert.Equal(t, metadata.GameID, respMd.GameID)
 	assert.Equal(t, metadata.Command, respMd.Command)
 
+	_, err = client.UpdateGameThumbnail(ctx, &proto.UpdateGameThumbnailRequest{GameId: metadata.GameID, Image: []byte("png"), ContentType: "image/png"})
+	assert.NoError(t, err)
+	md, err := mstore.GetGameMetadata(ctx, metadata.GameID)
+	assert.NoError(t, err)
+	assert.Equal(t, "data:image/png;base64,cG5n", md.Thumbnail)
+	_, err = client.UpdateGameThumbnail(ctx, &proto.UpdateGameThumbnailRequest{GameId: metadata.GameID, Image: []byte("gif"), ContentType: "image/gif"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.UpdateGameThumbnail(ctx, &proto.UpdateGameThumbnailRequest{GameId: "unknown", Image: []byte("png"), ContentType: "image/png"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.ReportConnectionStats(ctx, &proto.ReportConnectionStatsRequest{
+		SessionId: string(ss.SessionID),
+		Stats:     &proto.ConnectionStats{RoundTripTimeMs: 20, PacketLoss: 0.01, Bitrate: 2000000, CandidateType: "relay"},
+	})
+	assert.NoError(t, err)
+	reported, err := sstore.GetSession(ctx, ss.SessionID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, reported.ConnectionStats) {
+		assert.Equal(t, 20.0, reported.ConnectionStats.RoundTripTimeMs)
+		assert.Equal(t, int64(2000000), reported.ConnectionStats.Bitrate)
+		assert.Equal(t, "relay", reported.ConnectionStats.CandidateType)
+	}
+	_, err = client.ReportConnectionStats(ctx, &proto.ReportConnectionStatsRequest{SessionId: "unknown", Stats: &proto.ConnectionStats{}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
 	_, err = client.DeleteSession(ctx, &proto.DeleteSessionRequest{
 		SessionId:         resp.Session.SessionId,
 		AllocatedServerId: resp.Session.AllocatedServerId,
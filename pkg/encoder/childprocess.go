@@ -0,0 +1,188 @@
+package encoder
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+
+	"github.com/castaneai/mashimaro/pkg/proto"
+)
+
+const (
+	// childProcessEnv makes the encoder service run as a child process of the supervisor.
+	childProcessEnv = "MASHIMARO_ENCODER_CHILD"
+	// childClockBaseTimeEnv passes the base time of the shared clock to child processes.
+	childClockBaseTimeEnv = "MASHIMARO_ENCODER_CLOCK_BASE_TIME"
+	// the child process writes its gRPC port to this file descriptor (ExtraFiles[0] of exec.Cmd)
+	childPortFD = 3
+
+	childStartTimeout   = 10 * time.Second
+	childRequestTimeout = 5 * time.Second
+)
+
+// IsChildProcess reports whether the process was started by the encoder service with WithProcessIsolation.
+// Such a process must call ServeChildProcess instead of serving the encoder service.
+func IsChildProcess() bool {
+	return os.Getenv(childProcessEnv) != ""
+}
+
+// ServeChildProcess serves the encoder service for the supervisor on a random port of the loopback interface.
+// The process exits when the supervisor exits.
+func ServeChildProcess(options ...EncoderServerOption) error {
+	baseTime, err := strconv.ParseUint(os.Getenv(childClockBaseTimeEnv), 10, 64)
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s", childClockBaseTimeEnv)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	portFile := os.NewFile(childPortFD, "port")
+	if _, err := fmt.Fprintf(portFile, "%d\n", lis.Addr().(*net.TCPAddr).Port); err != nil {
+		return errors.Wrap(err, "failed to write port to supervisor")
+	}
+	_ = portFile.Close()
+	go func() {
+		// the supervisor holds stdin open while it is alive
+		_, _ = io.Copy(ioutil.Discard, os.Stdin)
+		log.Printf("supervisor exited")
+		os.Exit(0)
+	}()
+	options = append(options, EncoderServerOptionFunc(func(opts *options) {
+		opts.processIsolation = false
+		opts.clockBaseTime = baseTime
+	}))
+	es, err := NewEncoderServer(options...)
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer()
+	proto.RegisterEncoderServer(s, es)
+	return s.Serve(lis)
+}
+
+// childProcess is an encoder service running one pipeline in a child process.
+type childProcess struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	cc       *grpc.ClientConn
+	client   proto.EncoderClient
+	dataAddr string
+	exited   chan struct{}
+	exitErr  error
+}
+
+// startChildProcess starts a child process of the executable and the pipeline in it.
+// The error of StartEncoding or StartDecoding of the child is returned as is, which is a gRPC status.
+func startChildProcess(command string, clock *sharedClock, pipelineID, pipelineStr, inputCaps string) (*childProcess, error) {
+	portReader, portWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer portReader.Close()
+	cmd := exec.Command(command)
+	cmd.Env = append(os.Environ(),
+		childProcessEnv+"=1",
+		fmt.Sprintf("%s=%d", childClockBaseTimeEnv, clock.baseTime),
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{portWriter}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		_ = portWriter.Close()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		_ = portWriter.Close()
+		return nil, errors.Wrap(err, "failed to start child process")
+	}
+	_ = portWriter.Close()
+	cp := &childProcess{
+		cmd:    cmd,
+		stdin:  stdin,
+		exited: make(chan struct{}),
+	}
+	go func() {
+		cp.exitErr = cmd.Wait()
+		close(cp.exited)
+	}()
+	if err := cp.start(portReader, pipelineID, pipelineStr, inputCaps); err != nil {
+		cp.Kill()
+		return nil, err
+	}
+	return cp, nil
+}
+
+func (cp *childProcess) start(portReader *os.File, pipelineID, pipelineStr, inputCaps string) error {
+	_ = portReader.SetReadDeadline(time.Now().Add(childStartTimeout))
+	line, err := bufio.NewReader(portReader).ReadString('\n')
+	if err != nil {
+		return errors.Wrap(err, "failed to read port of child process")
+	}
+	addr := fmt.Sprintf("127.0.0.1:%s", strings.TrimSpace(line))
+	ctx, cancel := context.WithTimeout(context.Background(), childStartTimeout)
+	defer cancel()
+	cc, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to child process")
+	}
+	cp.cc = cc
+	cp.client = proto.NewEncoderClient(cc)
+	var port uint32
+	if inputCaps != "" {
+		resp, err := cp.client.StartDecoding(ctx, &proto.StartDecodingRequest{PipelineId: pipelineID, GstPipeline: pipelineStr, Caps: inputCaps})
+		if err != nil {
+			return err
+		}
+		port = resp.ListenPort
+	} else {
+		resp, err := cp.client.StartEncoding(ctx, &proto.StartEncodingRequest{PipelineId: pipelineID, GstPipeline: pipelineStr})
+		if err != nil {
+			return err
+		}
+		port = resp.ListenPort
+	}
+	cp.dataAddr = fmt.Sprintf("127.0.0.1:%d", port)
+	return nil
+}
+
+// Pid returns the process ID of the child process.
+func (cp *childProcess) Pid() int {
+	return cp.cmd.Process.Pid
+}
+
+// Err returns why the child process exited, or nil if it is running.
+func (cp *childProcess) Err() error {
+	select {
+	case <-cp.exited:
+		if cp.exitErr == nil {
+			return errors.New("child process exited")
+		}
+		return cp.exitErr
+	default:
+		return nil
+	}
+}
+
+// Kill kills the child process and waits for it to exit.
+func (cp *childProcess) Kill() {
+	if cp.cc != nil {
+		_ = cp.cc.Close()
+	}
+	_ = cp.stdin.Close()
+	_ = cp.cmd.Process.Kill()
+	<-cp.exited
+}
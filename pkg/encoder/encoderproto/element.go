@@ -0,0 +1,25 @@
+package encoderproto
+
+const (
+	// EncoderElementName is the name of the encoder element in a pipeline.
+	// UpdateEncodingParams changes the bitrate of the element with this name.
+	EncoderElementName = "encoder"
+
+	// FramerateFilterName is the name of the capsfilter deciding the framerate of a video pipeline.
+	// UpdateEncodingParams changes the framerate of the capsfilter with this name.
+	FramerateFilterName = "framerate"
+
+	// CropElementName is the name of the videocrop cropping the capture rect from the source.
+	// Its right and bottom are -1 to crop the size of the CropSizeFilterName.
+	// UpdateVideoGeometry changes the left and top of the element with this name.
+	CropElementName = "crop"
+
+	// CropSizeFilterName is the name of the capsfilter deciding the size of the capture rect.
+	// UpdateVideoGeometry changes the size of the capsfilter with this name.
+	CropSizeFilterName = "cropsize"
+
+	// OutputSizeFilterName is the name of the capsfilter deciding the size the cropped video is scaled to.
+	// The capsfilter follows videoscale with add-borders, which keeps the aspect ratio with black borders.
+	// UpdateVideoGeometry changes the size of the capsfilter with this name.
+	OutputSizeFilterName = "size"
+)
@@ -11,6 +11,8 @@ import (
 type SamplePacket struct {
 	Data     []byte
 	Duration time.Duration
+	// PTS is the running time on the clock shared by pipelines of the encoder service. Zero means unknown.
+	PTS time.Duration
 }
 
 func ReadSamplePacket(r io.Reader, p *SamplePacket) error {
@@ -23,15 +25,17 @@ func ReadSamplePacket(r io.Reader, p *SamplePacket) error {
 		return err
 	}
 	p.Duration = time.Duration(binary.LittleEndian.Uint64(buf[:8]))
-	p.Data = buf[8:]
+	p.PTS = time.Duration(binary.LittleEndian.Uint64(buf[8:16]))
+	p.Data = buf[16:]
 	return nil
 }
 
 func WriteSamplePacket(w io.Writer, p *SamplePacket) error {
-	buf := make([]byte, 4+8+len(p.Data))
+	buf := make([]byte, 4+8+8+len(p.Data))
 	binary.LittleEndian.PutUint32(buf, uint32(len(buf)-4))
 	binary.LittleEndian.PutUint64(buf[4:], uint64(p.Duration))
-	if copied := copy(buf[4+8:], p.Data); copied != len(p.Data) {
+	binary.LittleEndian.PutUint64(buf[4+8:], uint64(p.PTS))
+	if copied := copy(buf[4+8+8:], p.Data); copied != len(p.Data) {
 		return errors.New("invalid cooy")
 	}
 	if _, err := w.Write(buf); err != nil {
@@ -11,20 +11,34 @@ import (
 	"time"
 
 	"github.com/castaneai/mashimaro/pkg/encoder/encoderproto"
+	"github.com/castaneai/mashimaro/pkg/proto"
 
 	"github.com/notedit/gst"
 	"github.com/pkg/errors"
 )
 
-func startGstServer(pipelineStr string, port int) (*GstServer, error) {
+var errElementNotAllowed = errors.New("element not allowed")
+
+// startGstServer starts a pipeline producing samples to the client.
+// If inputCaps is not empty, the pipeline consumes samples with the caps from the client instead.
+func startGstServer(pipelineStr, inputCaps string, port int, allowedElements map[string]struct{}, clock *sharedClock) (*GstServer, error) {
 	lis, err := listenTCP(port)
 	if err != nil {
 		return nil, err
 	}
 	gs := newGstServer(lis)
+	gs.inputCaps = inputCaps
+	gs.allowedElements = allowedElements
+	gs.clock = clock
+	// parse the pipeline before returning so that the caller knows an invalid pipeline (e.g. missing elements) immediately
+	appElement, err := gs.prepare(pipelineStr)
+	if err != nil {
+		gs.Stop()
+		return nil, err
+	}
 	go func() {
 		defer gs.Stop()
-		if err := gs.Serve(pipelineStr); err != nil {
+		if err := gs.serve(appElement); err != nil {
 			log.Printf("failed to serve: %+v", err)
 		}
 	}()
@@ -36,12 +50,26 @@ type GstServer struct {
 	pipelineStr string
 	pipeline    *gst.Pipeline
 	conn        net.Conn
-	mu          sync.Mutex
+	// the pipeline starts with appsrc of the caps if not empty, otherwise ends with appsink
+	inputCaps string
+	// all elements are allowed if nil
+	allowedElements map[string]struct{}
+	// the pipeline uses its own clock if nil
+	clock  *sharedClock
+	events *pipelineEvents
+	// closed to stop watching the bus of the running pipeline
+	busDone chan struct{}
+	// closed when watching the bus stopped
+	busStopped chan struct{}
+	// the ERROR or EOS which ended the pipeline
+	endEvent *proto.PipelineEvent
+	mu       sync.Mutex
 }
 
 func newGstServer(lis net.Listener) *GstServer {
 	return &GstServer{
-		lis: lis,
+		lis:    lis,
+		events: newPipelineEvents(),
 	}
 }
 
@@ -58,15 +86,46 @@ func (g *GstServer) Addr() net.Addr {
 }
 
 func (g *GstServer) Serve(pipelineStr string) error {
-	pipelineStr += " ! appsink name=out"
+	appElement, err := g.prepare(pipelineStr)
+	if err != nil {
+		return err
+	}
+	return g.serve(appElement)
+}
+
+// prepare parses the pipeline and returns its appsink, or appsrc in decoding mode.
+func (g *GstServer) prepare(pipelineStr string) (*gst.Element, error) {
+	appElementName := "out"
+	if g.inputCaps != "" {
+		appElementName = "in"
+		pipelineStr = fmt.Sprintf("appsrc name=in format=time is-live=true do-timestamp=true caps=%q ! %s", g.inputCaps, pipelineStr)
+	} else {
+		pipelineStr += " ! appsink name=out"
+	}
 	pipeline, err := gst.ParseLaunch(pipelineStr)
 	if err != nil {
-		return errors.Wrapf(err, "failed to parse pipeline str: %s", pipelineStr)
+		return nil, errors.Wrapf(err, "failed to parse pipeline str: %s", pipelineStr)
 	}
-	src := pipeline.GetByName("out")
 	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.allowedElements != nil {
+		for _, name := range elementFactoryNames(pipeline) {
+			if _, ok := g.allowedElements[name]; !ok {
+				return nil, errors.Wrapf(errElementNotAllowed, "'%s' in pipeline: %s", name, pipelineStr)
+			}
+		}
+	}
+	if g.clock != nil {
+		g.clock.apply(pipeline)
+	}
 	g.pipelineStr = pipelineStr
 	g.pipeline = pipeline
+	return pipeline.GetByName(appElementName), nil
+}
+
+func (g *GstServer) serve(appElement *gst.Element) error {
+	g.mu.Lock()
+	pipelineStr := g.pipelineStr
 	lis := g.lis
 	g.mu.Unlock()
 	log.Printf("waiting for connection on %v...", lis.Addr())
@@ -85,7 +144,10 @@ func (g *GstServer) Serve(pipelineStr string) error {
 		return err
 	}
 	log.Printf("pipeline started: %s", pipelineStr)
-	return g.serveSample(conn, src)
+	if g.inputCaps != "" {
+		return g.receiveSample(conn, appElement)
+	}
+	return g.serveSample(conn, appElement)
 }
 
 func (g *GstServer) setPipelineStateLocked(state gst.StateOptions) error {
@@ -95,7 +157,9 @@ func (g *GstServer) setPipelineStateLocked(state gst.StateOptions) error {
 		return nil
 	case gst.StateChangeAsync:
 		// block until done
-		g.pipeline.GetBus().Pull(gst.MessageAsyncDone)
+		if !waitStateChange(g.pipeline) {
+			return fmt.Errorf("failed to change state asynchronously")
+		}
 		return nil
 	default:
 		return fmt.Errorf("failed to set state to playing (return: %v)", ret)
@@ -107,6 +171,9 @@ func (g *GstServer) serveSample(w io.Writer, src *gst.Element) error {
 	for {
 		sample, err := src.PullSample()
 		if err != nil {
+			if err := g.endError(); err != nil {
+				return err
+			}
 			if src.IsEOS() {
 				return errors.New("received EOS when trying to pull sample")
 			}
@@ -115,6 +182,7 @@ func (g *GstServer) serveSample(w io.Writer, src *gst.Element) error {
 		packet := encoderproto.SamplePacket{
 			Data:     sample.Data,
 			Duration: time.Duration(sample.Duration),
+			PTS:      samplePTS(sample.Pts),
 		}
 		if err := encoderproto.WriteSamplePacket(w, &packet); err != nil {
 			if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
@@ -126,22 +194,39 @@ func (g *GstServer) serveSample(w io.Writer, src *gst.Element) error {
 	}
 }
 
+func (g *GstServer) receiveSample(r io.Reader, sink *gst.Element) error {
+	defer g.stopPipeline()
+	for {
+		var packet encoderproto.SamplePacket
+		if err := encoderproto.ReadSamplePacket(r, &packet); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) {
+				log.Printf("media data client disconnected")
+				return nil
+			}
+			return errors.Wrap(err, "failed to read sample packet")
+		}
+		// appsrc timestamps buffers on arrival (do-timestamp), which is enough for live input
+		if err := sink.PushBuffer(packet.Data); err != nil {
+			if err := g.endError(); err != nil {
+				return err
+			}
+			return errors.Wrap(err, "failed to push buffer")
+		}
+	}
+}
+
 func (g *GstServer) startPipeline() error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	done, stopped := make(chan struct{}), make(chan struct{})
+	g.busDone, g.busStopped = done, stopped
+	pipeline := g.pipeline
 	go func() {
-		bus := g.pipeline.GetBus()
-		for {
-			msg := bus.Pull(gst.MessageAny)
-			if msg.GetType() != gst.MessageStateChanged {
-				s := msg.GetName()
-				if st := msg.GetStructure(); st.C != nil {
-					s = strings.ReplaceAll(st.ToString(), "\\", "")
-				}
-				log.Printf("[gst] %s", s)
-			}
-		}
-
+		defer close(stopped)
+		watchBus(pipeline, g.events, done, func(ev *proto.PipelineEvent) {
+			// stopping the pipeline waits for watching the bus to stop
+			go g.endPipeline(ev)
+		})
 	}()
 	if err := g.setPipelineStateLocked(gst.StatePlaying); err != nil {
 		return fmt.Errorf("failed to stop pipeline: %+v (%s)", err, g.pipelineStr)
@@ -149,9 +234,33 @@ func (g *GstServer) startPipeline() error {
 	return nil
 }
 
+// endPipeline stops the pipeline ended by ERROR or EOS, so that serving samples returns the cause.
+func (g *GstServer) endPipeline(ev *proto.PipelineEvent) {
+	log.Printf("[gst] %s from %s: %s (%s)", ev.Type, ev.Source, ev.Message, ev.Debug)
+	g.mu.Lock()
+	g.endEvent = ev
+	g.mu.Unlock()
+	g.stopPipeline()
+}
+
+// endError returns the error describing the ERROR or EOS which ended the pipeline, or nil.
+func (g *GstServer) endError() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.endEvent == nil {
+		return nil
+	}
+	return pipelineEventError(g.endEvent)
+}
+
 func (g *GstServer) stopPipeline() {
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	if g.busDone != nil {
+		close(g.busDone)
+		<-g.busStopped
+		g.busDone, g.busStopped = nil, nil
+	}
 	if g.pipeline == nil {
 		return
 	}
@@ -162,6 +271,65 @@ func (g *GstServer) stopPipeline() {
 	log.Printf("pipeline stopped: %s", g.pipelineStr)
 }
 
+func (g *GstServer) RequestKeyframe() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.pipeline == nil {
+		return errors.New("pipeline is not running")
+	}
+	if !sendForceKeyUnit(g.pipeline) {
+		return errors.New("force-key-unit event was not handled by pipeline")
+	}
+	return nil
+}
+
+func (g *GstServer) UpdateEncodingParams(bitrateKbps, framerate uint32) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.pipeline == nil {
+		return errors.New("pipeline is not running")
+	}
+	if bitrateKbps > 0 {
+		if err := setEncoderBitrate(g.pipeline, bitrateKbps); err != nil {
+			return errors.Wrap(err, "failed to update bitrate")
+		}
+	}
+	if framerate > 0 {
+		if err := setFramerate(g.pipeline, framerate); err != nil {
+			return errors.Wrap(err, "failed to update framerate")
+		}
+	}
+	return nil
+}
+
+func (g *GstServer) UpdateVideoGeometry(x, y, width, height, outputWidth, outputHeight uint32) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.pipeline == nil {
+		return errors.New("pipeline is not running")
+	}
+	if err := setVideoGeometry(g.pipeline, x, y, width, height, outputWidth, outputHeight); err != nil {
+		return errors.Wrap(err, "failed to update video geometry")
+	}
+	return nil
+}
+
+// Status returns the status of the pipeline, which never restarts in the process of the encoder service.
+func (g *GstServer) Status() *proto.GetPipelineStatusResponse {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	state := proto.PipelineState_PIPELINE_RUNNING
+	if g.lis == nil {
+		state = proto.PipelineState_PIPELINE_STOPPED
+	}
+	return &proto.GetPipelineStatusResponse{State: state}
+}
+
+// Watch returns a channel receiving bus events of the pipeline. The channel is closed when the server stops.
+func (g *GstServer) Watch() (<-chan *proto.PipelineEvent, func()) {
+	return g.events.watch()
+}
+
 func (g *GstServer) Stop() {
 	g.stopPipeline()
 	g.mu.Lock()
@@ -180,6 +348,7 @@ func (g *GstServer) Stop() {
 		g.lis = nil
 		log.Printf("media data connection listener was closed: %v", addr)
 	}
+	g.events.close()
 }
 
 func listenTCP(port int) (*net.TCPListener, error) {
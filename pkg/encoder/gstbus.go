@@ -0,0 +1,118 @@
+package encoder
+
+/*
+#cgo pkg-config: gstreamer-1.0
+
+#include <stdlib.h>
+#include <gst/gst.h>
+
+typedef struct {
+	GstMessageType type;
+	gchar *source;
+	gchar *message;
+	gchar *debug;
+} bus_event;
+
+// Pops the next ERROR, WARNING or EOS message within the timeout, dropping other messages.
+// Returns FALSE on timeout. The caller must free the strings of the event with free_bus_event.
+static gboolean pop_bus_event(GstElement *pipeline, GstClockTime timeout, bus_event *ev) {
+	GstBus *bus = gst_element_get_bus(pipeline);
+	GstMessage *msg = gst_bus_timed_pop_filtered(bus, timeout, GST_MESSAGE_ERROR | GST_MESSAGE_WARNING | GST_MESSAGE_EOS);
+	gst_object_unref(bus);
+	if (msg == NULL) {
+		return FALSE;
+	}
+	GError *err = NULL;
+	gchar *debug = NULL;
+	ev->type = GST_MESSAGE_TYPE(msg);
+	if (ev->type == GST_MESSAGE_ERROR) {
+		gst_message_parse_error(msg, &err, &debug);
+	} else if (ev->type == GST_MESSAGE_WARNING) {
+		gst_message_parse_warning(msg, &err, &debug);
+	}
+	ev->source = g_strdup(GST_MESSAGE_SRC_NAME(msg));
+	ev->message = err != NULL ? g_strdup(err->message) : NULL;
+	ev->debug = debug;
+	if (err != NULL) {
+		g_error_free(err);
+	}
+	gst_message_unref(msg);
+	return TRUE;
+}
+
+static void free_bus_event(bus_event *ev) {
+	g_free(ev->source);
+	g_free(ev->message);
+	g_free(ev->debug);
+}
+
+// Blocks until the asynchronous state change of the pipeline completes.
+// Waiting for ASYNC_DONE on the bus would race with pop_bus_event.
+static GstStateChangeReturn wait_state_change(GstElement *pipeline) {
+	return gst_element_get_state(pipeline, NULL, NULL, GST_CLOCK_TIME_NONE);
+}
+*/
+import "C"
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/notedit/gst"
+
+	"github.com/castaneai/mashimaro/pkg/proto"
+)
+
+// the interval to check whether to stop watching the bus
+const busPollInterval = 100 * time.Millisecond
+
+// watchBus publishes ERROR, WARNING and EOS messages of the pipeline until done is closed.
+// onEnd is called once on ERROR or EOS, after which the pipeline produces no more samples.
+// The messages posted before done is closed are published, so the pipeline must not go to NULL,
+// which flushes the bus, until watchBus returns.
+func watchBus(pipeline *gst.Pipeline, events *pipelineEvents, done <-chan struct{}, onEnd func(ev *proto.PipelineEvent)) {
+	element := (*C.GstElement)(unsafe.Pointer(pipeline.GstElement))
+	ended := false
+	pop := func(timeout time.Duration) bool {
+		var cev C.bus_event
+		if C.pop_bus_event(element, C.GstClockTime(timeout), &cev) != C.TRUE {
+			return false
+		}
+		ev := &proto.PipelineEvent{
+			Source:         C.GoString(cev.source),
+			Message:        C.GoString(cev.message),
+			Debug:          C.GoString(cev.debug),
+			TimeUnixMillis: time.Now().UnixNano() / int64(time.Millisecond),
+		}
+		switch cev._type {
+		case C.GST_MESSAGE_ERROR:
+			ev.Type = proto.PipelineEventType_PIPELINE_EVENT_ERROR
+		case C.GST_MESSAGE_WARNING:
+			ev.Type = proto.PipelineEventType_PIPELINE_EVENT_WARNING
+		default:
+			ev.Type = proto.PipelineEventType_PIPELINE_EVENT_EOS
+		}
+		C.free_bus_event(&cev)
+		events.publish(ev)
+		if ev.Type != proto.PipelineEventType_PIPELINE_EVENT_WARNING && !ended {
+			ended = true
+			onEnd(ev)
+		}
+		return true
+	}
+	for {
+		select {
+		case <-done:
+			for pop(0) {
+			}
+			return
+		default:
+			pop(busPollInterval)
+		}
+	}
+}
+
+// waitStateChange blocks until the asynchronous state change completes and reports whether it succeeded.
+func waitStateChange(pipeline *gst.Pipeline) bool {
+	return C.wait_state_change((*C.GstElement)(unsafe.Pointer(pipeline.GstElement))) != C.GST_STATE_CHANGE_FAILURE
+}
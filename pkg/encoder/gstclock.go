@@ -0,0 +1,60 @@
+package encoder
+
+/*
+#cgo pkg-config: gstreamer-1.0
+
+#include <gst/gst.h>
+
+static GstClockTime system_clock_time() {
+	GstClock *clock = gst_system_clock_obtain();
+	GstClockTime t = gst_clock_get_time(clock);
+	gst_object_unref(clock);
+	return t;
+}
+
+// Makes the running time of the pipeline start at the base time on the system clock.
+// Pipelines sharing the base time have buffers timestamped on the same timeline.
+static void use_shared_clock(GstElement *pipeline, GstClockTime base_time) {
+	GstClock *clock = gst_system_clock_obtain();
+	gst_pipeline_use_clock(GST_PIPELINE(pipeline), clock);
+	gst_object_unref(clock);
+	// disables the base time distribution on PLAYING
+	gst_element_set_start_time(pipeline, GST_CLOCK_TIME_NONE);
+	gst_element_set_base_time(pipeline, base_time);
+}
+*/
+import "C"
+
+import (
+	"math"
+	"time"
+	"unsafe"
+
+	"github.com/notedit/gst"
+)
+
+// GST_CLOCK_TIME_NONE
+const gstClockTimeNone = math.MaxUint64
+
+// sharedClock is the clock shared by pipelines of the encoder service.
+// Buffers of video and audio pipelines are timestamped with the running time since the same base time,
+// so that their PTS can be compared to synchronize them.
+type sharedClock struct {
+	baseTime uint64
+}
+
+func newSharedClock() *sharedClock {
+	return &sharedClock{baseTime: uint64(C.system_clock_time())}
+}
+
+func (c *sharedClock) apply(pipeline *gst.Pipeline) {
+	C.use_shared_clock((*C.GstElement)(unsafe.Pointer(pipeline.GstElement)), C.GstClockTime(c.baseTime))
+}
+
+// samplePTS converts the PTS of a sample to the one in encoderproto, where zero means unknown.
+func samplePTS(pts uint64) time.Duration {
+	if pts == gstClockTimeNone {
+		return 0
+	}
+	return time.Duration(pts)
+}
@@ -0,0 +1,234 @@
+package encoder
+
+/*
+#cgo pkg-config: gstreamer-1.0
+
+#include <stdlib.h>
+#include <gst/gst.h>
+
+static GstElement *bin_get_by_name(GstElement *bin, const gchar *name) {
+	return gst_bin_get_by_name(GST_BIN(bin), name);
+}
+
+static const gchar *element_factory_name(GstElement *element) {
+	GstElementFactory *factory = gst_element_get_factory(element);
+	if (factory == NULL) {
+		return NULL;
+	}
+	return gst_plugin_feature_get_name(GST_PLUGIN_FEATURE(factory));
+}
+
+// Sets an integer property regardless of its actual type (int, uint, int64, ...).
+static gboolean set_integer_property(GstElement *element, const gchar *name, guint64 value) {
+	GParamSpec *spec = g_object_class_find_property(G_OBJECT_GET_CLASS(element), name);
+	if (spec == NULL) {
+		return FALSE;
+	}
+	GValue src = G_VALUE_INIT;
+	GValue dst = G_VALUE_INIT;
+	g_value_init(&src, G_TYPE_UINT64);
+	g_value_set_uint64(&src, value);
+	g_value_init(&dst, G_PARAM_SPEC_VALUE_TYPE(spec));
+	gboolean ok = g_value_transform(&src, &dst);
+	if (ok) {
+		g_object_set_property(G_OBJECT(element), name, &dst);
+	}
+	g_value_unset(&src);
+	g_value_unset(&dst);
+	return ok;
+}
+
+static GList *list_encoder_factories() {
+	return gst_element_factory_list_get_elements(GST_ELEMENT_FACTORY_TYPE_ENCODER, GST_RANK_NONE);
+}
+
+static const gchar *feature_name(gpointer feature) {
+	return gst_plugin_feature_get_name(GST_PLUGIN_FEATURE(feature));
+}
+
+// Returns comma-separated factory names of all elements in the bin. The caller must g_free it.
+static gchar *bin_element_factory_names(GstElement *bin) {
+	GString *names = g_string_new(NULL);
+	GstIterator *it = gst_bin_iterate_recurse(GST_BIN(bin));
+	GValue item = G_VALUE_INIT;
+	gboolean done = FALSE;
+	while (!done) {
+		switch (gst_iterator_next(it, &item)) {
+		case GST_ITERATOR_OK: {
+			const gchar *name = element_factory_name(GST_ELEMENT(g_value_get_object(&item)));
+			if (names->len > 0) {
+				g_string_append_c(names, ',');
+			}
+			g_string_append(names, name != NULL ? name : "");
+			g_value_reset(&item);
+			break;
+		}
+		case GST_ITERATOR_RESYNC:
+			gst_iterator_resync(it);
+			g_string_truncate(names, 0);
+			break;
+		default:
+			done = TRUE;
+			break;
+		}
+	}
+	g_value_unset(&item);
+	gst_iterator_free(it);
+	return g_string_free(names, FALSE);
+}
+
+static gboolean set_caps_property(GstElement *element, const gchar *caps_str) {
+	GstCaps *caps = gst_caps_from_string(caps_str);
+	if (caps == NULL) {
+		return FALSE;
+	}
+	g_object_set(G_OBJECT(element), "caps", caps, NULL);
+	gst_caps_unref(caps);
+	return TRUE;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/notedit/gst"
+	"github.com/pkg/errors"
+
+	"github.com/castaneai/mashimaro/pkg/encoder/encoderproto"
+)
+
+type bitrateProperty struct {
+	name string
+	// multiplier to convert kbps to the unit of the property
+	multiplier uint64
+}
+
+// bitrateProperties maps encoder element names to their bitrate property.
+// Encoders do not agree on the name and the unit of it.
+var bitrateProperties = map[string]bitrateProperty{
+	"x264enc":      {name: "bitrate", multiplier: 1},
+	"nvh264enc":    {name: "bitrate", multiplier: 1},
+	"vaapih264enc": {name: "bitrate", multiplier: 1},
+	"openh264enc":  {name: "bitrate", multiplier: 1000},
+	"vp8enc":       {name: "target-bitrate", multiplier: 1000},
+	"vp9enc":       {name: "target-bitrate", multiplier: 1000},
+	"av1enc":       {name: "target-bitrate", multiplier: 1},
+	"opusenc":      {name: "bitrate", multiplier: 1000},
+}
+
+// encoderElementNames returns the names of all encoder elements registered in GStreamer.
+func encoderElementNames() []string {
+	factories := C.list_encoder_factories()
+	defer C.gst_plugin_feature_list_free(factories)
+	var names []string
+	for l := factories; l != nil; l = l.next {
+		names = append(names, C.GoString(C.feature_name(l.data)))
+	}
+	return names
+}
+
+// elementFactoryNames returns the factory names of all elements in the pipeline.
+func elementFactoryNames(pipeline *gst.Pipeline) []string {
+	names := C.bin_element_factory_names((*C.GstElement)(unsafe.Pointer(pipeline.GstElement)))
+	defer C.g_free(C.gpointer(names))
+	return strings.Split(C.GoString(names), ",")
+}
+
+func getElementByName(pipeline *gst.Pipeline, name string) *C.GstElement {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	return C.bin_get_by_name((*C.GstElement)(unsafe.Pointer(pipeline.GstElement)), cname)
+}
+
+// setEncoderBitrate changes the target bitrate of the encoder element in the running pipeline.
+func setEncoderBitrate(pipeline *gst.Pipeline, bitrateKbps uint32) error {
+	element := getElementByName(pipeline, encoderproto.EncoderElementName)
+	if element == nil {
+		return fmt.Errorf("element named '%s' not found in pipeline", encoderproto.EncoderElementName)
+	}
+	defer C.gst_object_unref(C.gpointer(element))
+
+	factoryName := C.GoString(C.element_factory_name(element))
+	prop, ok := bitrateProperties[factoryName]
+	if !ok {
+		return fmt.Errorf("changing bitrate of %s is not supported", factoryName)
+	}
+	cprop := C.CString(prop.name)
+	defer C.free(unsafe.Pointer(cprop))
+	if C.set_integer_property(element, cprop, C.guint64(uint64(bitrateKbps)*prop.multiplier)) != C.TRUE {
+		return fmt.Errorf("failed to set property '%s' of %s", prop.name, factoryName)
+	}
+	return nil
+}
+
+// setFramerate changes the framerate of the running video pipeline.
+// The source element renegotiates its caps with the new framerate.
+func setFramerate(pipeline *gst.Pipeline, framerate uint32) error {
+	element := getElementByName(pipeline, encoderproto.FramerateFilterName)
+	if element == nil {
+		return fmt.Errorf("element named '%s' not found in pipeline", encoderproto.FramerateFilterName)
+	}
+	defer C.gst_object_unref(C.gpointer(element))
+
+	caps := C.CString(fmt.Sprintf("video/x-raw,framerate=%d/1", framerate))
+	defer C.free(unsafe.Pointer(caps))
+	if C.set_caps_property(element, caps) != C.TRUE {
+		return errors.New("failed to set caps of framerate filter")
+	}
+	return nil
+}
+
+func setCapsByName(pipeline *gst.Pipeline, name, caps string) error {
+	element := getElementByName(pipeline, name)
+	if element == nil {
+		return fmt.Errorf("element named '%s' not found in pipeline", name)
+	}
+	defer C.gst_object_unref(C.gpointer(element))
+
+	ccaps := C.CString(caps)
+	defer C.free(unsafe.Pointer(ccaps))
+	if C.set_caps_property(element, ccaps) != C.TRUE {
+		return fmt.Errorf("failed to set caps of %s", name)
+	}
+	return nil
+}
+
+func setCropOffset(element *C.GstElement, left, top uint32) error {
+	for prop, value := range map[string]uint32{"left": left, "top": top} {
+		cprop := C.CString(prop)
+		ok := C.set_integer_property(element, cprop, C.guint64(value))
+		C.free(unsafe.Pointer(cprop))
+		if ok != C.TRUE {
+			return fmt.Errorf("failed to set property '%s' of crop element", prop)
+		}
+	}
+	return nil
+}
+
+// setVideoGeometry changes the capture rect and the output size of the running video pipeline.
+func setVideoGeometry(pipeline *gst.Pipeline, x, y, width, height, outputWidth, outputHeight uint32) error {
+	crop := getElementByName(pipeline, encoderproto.CropElementName)
+	if crop == nil {
+		return fmt.Errorf("element named '%s' not found in pipeline", encoderproto.CropElementName)
+	}
+	defer C.gst_object_unref(C.gpointer(crop))
+
+	// The caps are renegotiated with each change.
+	// Moving to the origin first keeps the intermediate rect inside the source in any order of changes.
+	if err := setCropOffset(crop, 0, 0); err != nil {
+		return err
+	}
+	if err := setCapsByName(pipeline, encoderproto.CropSizeFilterName, fmt.Sprintf("video/x-raw,width=%d,height=%d", width, height)); err != nil {
+		return err
+	}
+	if err := setCropOffset(crop, x, y); err != nil {
+		return err
+	}
+	if outputWidth == 0 || outputHeight == 0 {
+		outputWidth, outputHeight = width, height
+	}
+	return setCapsByName(pipeline, encoderproto.OutputSizeFilterName, fmt.Sprintf("video/x-raw,width=%d,height=%d,pixel-aspect-ratio=1/1", outputWidth, outputHeight))
+}
@@ -0,0 +1,30 @@
+package encoder
+
+/*
+#cgo pkg-config: gstreamer-1.0
+
+#include <gst/gst.h>
+
+// The same event as gst_video_event_new_upstream_force_key_unit() without linking gstreamer-video.
+static gboolean send_upstream_force_key_unit(GstElement *element) {
+	GstStructure *s = gst_structure_new("GstForceKeyUnit",
+		"running-time", G_TYPE_UINT64, GST_CLOCK_TIME_NONE,
+		"all-headers", G_TYPE_BOOLEAN, TRUE,
+		"count", G_TYPE_UINT, 0,
+		NULL);
+	return gst_element_send_event(element, gst_event_new_custom(GST_EVENT_CUSTOM_UPSTREAM, s));
+}
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/notedit/gst"
+)
+
+// sendForceKeyUnit asks the encoder in the pipeline to produce a keyframe as soon as possible.
+// An upstream event sent to a bin is dispatched to its sink elements, so it reaches the encoder via appsink.
+func sendForceKeyUnit(pipeline *gst.Pipeline) bool {
+	return C.send_upstream_force_key_unit((*C.GstElement)(unsafe.Pointer(pipeline.GstElement))) == C.TRUE
+}
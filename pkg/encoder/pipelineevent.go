@@ -0,0 +1,96 @@
+package encoder
+
+import (
+	"log"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/castaneai/mashimaro/pkg/proto"
+)
+
+const (
+	// the number of recent events replayed to a new watcher
+	maxPipelineEventHistory = 20
+	// events are dropped for a watcher falling behind by this number of events
+	pipelineEventBufferSize = 64
+)
+
+// pipelineEventError describes the ERROR or EOS which ended a pipeline.
+func pipelineEventError(ev *proto.PipelineEvent) error {
+	if ev.Type == proto.PipelineEventType_PIPELINE_EVENT_EOS {
+		return errors.Errorf("pipeline received EOS from %s", ev.Source)
+	}
+	return errors.Errorf("pipeline error from %s: %s (%s)", ev.Source, ev.Message, ev.Debug)
+}
+
+// pipelineEvents distributes bus events of a pipeline to watchers of WatchPipeline.
+type pipelineEvents struct {
+	history  []*proto.PipelineEvent
+	watchers map[chan *proto.PipelineEvent]struct{}
+	closed   bool
+	mu       sync.Mutex
+}
+
+func newPipelineEvents() *pipelineEvents {
+	return &pipelineEvents{
+		watchers: make(map[chan *proto.PipelineEvent]struct{}),
+	}
+}
+
+func (e *pipelineEvents) publish(ev *proto.PipelineEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	e.history = append(e.history, ev)
+	if len(e.history) > maxPipelineEventHistory {
+		e.history = e.history[len(e.history)-maxPipelineEventHistory:]
+	}
+	for ch := range e.watchers {
+		select {
+		case ch <- ev:
+		default:
+			log.Printf("pipeline event dropped for slow watcher: %v", ev)
+		}
+	}
+}
+
+// watch returns a channel receiving the recent events and the following ones.
+// The channel is closed when the pipeline stops. Call the returned function to stop watching.
+func (e *pipelineEvents) watch() (<-chan *proto.PipelineEvent, func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ch := make(chan *proto.PipelineEvent, pipelineEventBufferSize)
+	for _, ev := range e.history {
+		ch <- ev
+	}
+	if e.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	e.watchers[ch] = struct{}{}
+	return ch, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if _, ok := e.watchers[ch]; ok {
+			delete(e.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// close ends all watchers. Events published after close are ignored.
+func (e *pipelineEvents) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	e.closed = true
+	for ch := range e.watchers {
+		close(ch)
+		delete(e.watchers, ch)
+	}
+}
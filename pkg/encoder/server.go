@@ -4,50 +4,249 @@ import (
 	"context"
 	"log"
 	"net"
+	"os"
 	"sync"
 
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	"github.com/castaneai/mashimaro/pkg/proto"
 )
 
+// DefaultAllowedElements are the elements that the encoder service accepts in pipelines.
+// Pipelines come over gRPC, so elements that write files or talk to network (e.g. filesink) are not allowed.
+var DefaultAllowedElements = []string{
+	// sources
+	"ximagesrc", "pulsesrc", "videotestsrc", "audiotestsrc",
+	// sinks
+	"pulsesink",
+	// filters
+	"capsfilter", "queue", "videoconvert", "videoscale", "videorate", "videocrop", "audioconvert", "audioresample", "h264parse",
+	// encoders
+	"x264enc", "vaapih264enc", "nvh264enc", "openh264enc", "vp8enc", "vp9enc", "av1enc", "opusenc",
+	// decoders
+	"opusdec",
+	// the sink appended and the source prepended by the encoder service
+	"appsink", "appsrc",
+}
+
+// pipeline is a pipeline running in the process of the encoder service (GstServer) or in a child process (supervisedPipeline).
+type pipeline interface {
+	Addr() net.Addr
+	RequestKeyframe() error
+	UpdateEncodingParams(bitrateKbps, framerate uint32) error
+	UpdateVideoGeometry(x, y, width, height, outputWidth, outputHeight uint32) error
+	Status() *proto.GetPipelineStatusResponse
+	Watch() (<-chan *proto.PipelineEvent, func())
+	Stop()
+}
+
 type encoderServer struct {
-	gstServers map[string]*GstServer
-	mu         sync.Mutex
+	pipelines       map[string]pipeline
+	allowedElements map[string]struct{}
+	clock           *sharedClock
+	// pipelines run in child processes of the command if not empty
+	childCommand string
+	mu           sync.Mutex
+}
+
+type options struct {
+	allowedElements  []string
+	processIsolation bool
+	// the base time of the shared clock, or zero to start the clock now
+	clockBaseTime uint64
+}
+
+func defaultOptions() *options {
+	return &options{
+		allowedElements: DefaultAllowedElements,
+	}
+}
+
+type EncoderServerOption interface {
+	apply(opts *options)
+}
+
+type EncoderServerOptionFunc func(*options)
+
+func (f EncoderServerOptionFunc) apply(opts *options) {
+	f(opts)
+}
+
+// WithAllowedElements replaces the elements allowed in pipelines.
+func WithAllowedElements(elements ...string) EncoderServerOption {
+	return EncoderServerOptionFunc(func(opts *options) {
+		opts.allowedElements = elements
+	})
 }
 
-func NewEncoderServer() proto.EncoderServer {
-	return &encoderServer{
-		gstServers: map[string]*GstServer{},
+// WithProcessIsolation runs each pipeline in a child process, so that a crash of GStreamer affects only the pipeline.
+// A failed pipeline restarts with backoff while the client keeps the connection.
+// The child processes are the executable itself, which must call ServeChildProcess if IsChildProcess.
+func WithProcessIsolation() EncoderServerOption {
+	return EncoderServerOptionFunc(func(opts *options) {
+		opts.processIsolation = true
+	})
+}
+
+func NewEncoderServer(options ...EncoderServerOption) (proto.EncoderServer, error) {
+	opts := defaultOptions()
+	for _, opt := range options {
+		opt.apply(opts)
+	}
+	allowedElements := make(map[string]struct{})
+	for _, e := range opts.allowedElements {
+		allowedElements[e] = struct{}{}
+	}
+	clock := newSharedClock()
+	if opts.clockBaseTime > 0 {
+		clock = &sharedClock{baseTime: opts.clockBaseTime}
 	}
+	s := &encoderServer{
+		pipelines:       map[string]pipeline{},
+		allowedElements: allowedElements,
+		clock:           clock,
+	}
+	if opts.processIsolation {
+		command, err := os.Executable()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get executable for child processes")
+		}
+		s.childCommand = command
+	}
+	return s, nil
 }
 
 func (s *encoderServer) StartEncoding(ctx context.Context, req *proto.StartEncodingRequest) (*proto.StartEncodingResponse, error) {
-	s.stopGstServer(req.PipelineId)
-	addr, err := s.startGstServer(req.PipelineId, req.GstPipeline, int(req.Port))
+	s.stopPipeline(req.PipelineId)
+	addr, err := s.startPipeline(req.PipelineId, req.GstPipeline, "", int(req.Port))
 	if err != nil {
+		if errors.Is(err, errElementNotAllowed) {
+			return nil, status.Errorf(codes.InvalidArgument, "%+v", err)
+		}
 		return nil, err
 	}
 	return &proto.StartEncodingResponse{ListenPort: uint32(addr.Port)}, nil
 }
 
-func (s *encoderServer) startGstServer(pipelineID, pipelineStr string, port int) (*net.TCPAddr, error) {
-	gs, err := startGstServer(pipelineStr, port)
+func (s *encoderServer) StartDecoding(ctx context.Context, req *proto.StartDecodingRequest) (*proto.StartDecodingResponse, error) {
+	if req.Caps == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "caps must not be empty")
+	}
+	s.stopPipeline(req.PipelineId)
+	addr, err := s.startPipeline(req.PipelineId, req.GstPipeline, req.Caps, int(req.Port))
+	if err != nil {
+		if errors.Is(err, errElementNotAllowed) {
+			return nil, status.Errorf(codes.InvalidArgument, "%+v", err)
+		}
+		return nil, err
+	}
+	return &proto.StartDecodingResponse{ListenPort: uint32(addr.Port)}, nil
+}
+
+func (s *encoderServer) RequestKeyframe(ctx context.Context, req *proto.RequestKeyframeRequest) (*proto.RequestKeyframeResponse, error) {
+	p, ok := s.getPipeline(req.PipelineId)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "pipeline not found (pipelineID: %s)", req.PipelineId)
+	}
+	if err := p.RequestKeyframe(); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "failed to request keyframe: %+v", err)
+	}
+	return &proto.RequestKeyframeResponse{}, nil
+}
+
+func (s *encoderServer) UpdateEncodingParams(ctx context.Context, req *proto.UpdateEncodingParamsRequest) (*proto.UpdateEncodingParamsResponse, error) {
+	p, ok := s.getPipeline(req.PipelineId)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "pipeline not found (pipelineID: %s)", req.PipelineId)
+	}
+	if err := p.UpdateEncodingParams(req.BitrateKbps, req.Framerate); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "failed to update encoding params: %+v", err)
+	}
+	return &proto.UpdateEncodingParamsResponse{}, nil
+}
+
+func (s *encoderServer) GetCapabilities(ctx context.Context, req *proto.GetCapabilitiesRequest) (*proto.GetCapabilitiesResponse, error) {
+	return &proto.GetCapabilitiesResponse{EncoderElements: encoderElementNames()}, nil
+}
+
+func (s *encoderServer) UpdateVideoGeometry(ctx context.Context, req *proto.UpdateVideoGeometryRequest) (*proto.UpdateVideoGeometryResponse, error) {
+	if req.CropWidth == 0 || req.CropHeight == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "crop size must not be zero (%dx%d)", req.CropWidth, req.CropHeight)
+	}
+	p, ok := s.getPipeline(req.PipelineId)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "pipeline not found (pipelineID: %s)", req.PipelineId)
+	}
+	if err := p.UpdateVideoGeometry(req.CropX, req.CropY, req.CropWidth, req.CropHeight, req.OutputWidth, req.OutputHeight); err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "%+v", err)
+	}
+	return &proto.UpdateVideoGeometryResponse{}, nil
+}
+
+func (s *encoderServer) GetPipelineStatus(ctx context.Context, req *proto.GetPipelineStatusRequest) (*proto.GetPipelineStatusResponse, error) {
+	p, ok := s.getPipeline(req.PipelineId)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "pipeline not found (pipelineID: %s)", req.PipelineId)
+	}
+	return p.Status(), nil
+}
+
+func (s *encoderServer) WatchPipeline(req *proto.WatchPipelineRequest, stream proto.Encoder_WatchPipelineServer) error {
+	p, ok := s.getPipeline(req.PipelineId)
+	if !ok {
+		return status.Errorf(codes.NotFound, "pipeline not found (pipelineID: %s)", req.PipelineId)
+	}
+	events, cancel := p.Watch()
+	defer cancel()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *encoderServer) getPipeline(pipelineID string) (pipeline, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pipelines[pipelineID]
+	return p, ok
+}
+
+func (s *encoderServer) startPipeline(pipelineID, pipelineStr, inputCaps string, port int) (*net.TCPAddr, error) {
+	var p pipeline
+	var err error
+	if s.childCommand != "" {
+		p, err = startSupervisedPipeline(pipelineID, pipelineStr, inputCaps, port, s.childCommand, s.clock)
+	} else {
+		p, err = startGstServer(pipelineStr, inputCaps, port, s.allowedElements, s.clock)
+	}
 	if err != nil {
 		return nil, err
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.gstServers[pipelineID] = gs
+	s.pipelines[pipelineID] = p
 	log.Printf("gst pipeline started (pipelineID: %s, %s)", pipelineID, pipelineStr)
-	return gs.Addr().(*net.TCPAddr), nil
+	return p.Addr().(*net.TCPAddr), nil
 }
 
-func (s *encoderServer) stopGstServer(pipelineID string) {
+func (s *encoderServer) stopPipeline(pipelineID string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	gs, ok := s.gstServers[pipelineID]
+	p, ok := s.pipelines[pipelineID]
 	if ok {
-		gs.Stop()
-		delete(s.gstServers, pipelineID)
-		log.Printf("gst pipeline stopped (pipelineID: %s, gst: %v)", pipelineID, gs)
+		p.Stop()
+		delete(s.pipelines, pipelineID)
+		log.Printf("gst pipeline stopped (pipelineID: %s, gst: %v)", pipelineID, p)
 	}
 }
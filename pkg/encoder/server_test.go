@@ -3,24 +3,37 @@ package encoder
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"sort"
 	"testing"
 	"time"
 
 	"github.com/castaneai/mashimaro/pkg/encoder/encoderproto"
+	"github.com/castaneai/mashimaro/pkg/h264"
 	"github.com/castaneai/mashimaro/pkg/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/castaneai/mashimaro/pkg/testutils"
 )
 
+func newEncoderServer(t *testing.T, options ...EncoderServerOption) proto.EncoderServer {
+	es, err := NewEncoderServer(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return es
+}
+
 func TestEncoderServer(t *testing.T) {
 	lis := testutils.ListenTCPWithRandomPort(t)
 	s := grpc.NewServer()
-	proto.RegisterEncoderServer(s, NewEncoderServer())
+	proto.RegisterEncoderServer(s, newEncoderServer(t))
 	go func() {
 		if err := s.Serve(lis); err != nil {
 			log.Printf("failed to serve gRPC server: %+v", err)
@@ -48,3 +61,374 @@ func TestEncoderServer(t *testing.T) {
 		assert.NoError(t, cc.Close())
 	}
 }
+
+func TestRequestKeyframe(t *testing.T) {
+	lis := testutils.ListenTCPWithRandomPort(t)
+	s := grpc.NewServer()
+	proto.RegisterEncoderServer(s, newEncoderServer(t))
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("failed to serve gRPC server: %+v", err)
+		}
+	}()
+	cc, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+	c := proto.NewEncoderClient(cc)
+	ctx := context.Background()
+
+	_, err = c.RequestKeyframe(ctx, &proto.RequestKeyframeRequest{PipelineId: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	resp, err := c.StartEncoding(ctx, &proto.StartEncodingRequest{
+		PipelineId:  "video",
+		GstPipeline: "videotestsrc is-live=true ! capsfilter caps=video/x-raw,framerate=30/1 ! x264enc speed-preset=ultrafast tune=zerolatency byte-stream=true key-int-max=1000",
+		Port:        0,
+	})
+	assert.NoError(t, err)
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", resp.ListenPort))
+	assert.NoError(t, err)
+	defer conn.Close()
+	var sp encoderproto.SamplePacket
+	// the first frame is always a keyframe
+	assert.NoError(t, encoderproto.ReadSamplePacket(conn, &sp))
+
+	_, err = c.RequestKeyframe(ctx, &proto.RequestKeyframeRequest{PipelineId: "video"})
+	assert.NoError(t, err)
+	// the next keyframe of key-int-max comes long after the requested one
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for i := 0; i < 30; i++ {
+		if err := encoderproto.ReadSamplePacket(conn, &sp); err != nil {
+			t.Fatalf("failed to read a frame: %+v", err)
+		}
+		if h264.IsKeyframe(sp.Data) {
+			return
+		}
+	}
+	t.Fatal("no keyframe after requested")
+}
+
+func TestUpdateEncodingParams(t *testing.T) {
+	lis := testutils.ListenTCPWithRandomPort(t)
+	s := grpc.NewServer()
+	proto.RegisterEncoderServer(s, newEncoderServer(t))
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("failed to serve gRPC server: %+v", err)
+		}
+	}()
+	cc, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+	c := proto.NewEncoderClient(cc)
+	ctx := context.Background()
+
+	_, err = c.UpdateEncodingParams(ctx, &proto.UpdateEncodingParamsRequest{PipelineId: "unknown", BitrateKbps: 1000})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	resp, err := c.StartEncoding(ctx, &proto.StartEncodingRequest{
+		PipelineId:  "video",
+		GstPipeline: "videotestsrc is-live=true ! capsfilter name=framerate caps=video/x-raw,framerate=60/1 ! x264enc name=encoder speed-preset=ultrafast tune=zerolatency byte-stream=true bitrate=2000",
+		Port:        0,
+	})
+	assert.NoError(t, err)
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", resp.ListenPort))
+	assert.NoError(t, err)
+	defer conn.Close()
+	var sp encoderproto.SamplePacket
+	assert.NoError(t, encoderproto.ReadSamplePacket(conn, &sp))
+
+	_, err = c.UpdateEncodingParams(ctx, &proto.UpdateEncodingParamsRequest{PipelineId: "video", BitrateKbps: 500, Framerate: 30})
+	assert.NoError(t, err)
+	// the frames of 60fps in flight arrive first
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for sp.Duration != time.Second/30 {
+		if err := encoderproto.ReadSamplePacket(conn, &sp); err != nil {
+			t.Fatalf("failed to receive a frame of 30fps: %+v", err)
+		}
+	}
+}
+
+func TestUpdateVideoGeometry(t *testing.T) {
+	lis := testutils.ListenTCPWithRandomPort(t)
+	s := grpc.NewServer()
+	proto.RegisterEncoderServer(s, newEncoderServer(t))
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("failed to serve gRPC server: %+v", err)
+		}
+	}()
+	cc, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+	c := proto.NewEncoderClient(cc)
+	ctx := context.Background()
+
+	_, err = c.UpdateVideoGeometry(ctx, &proto.UpdateVideoGeometryRequest{PipelineId: "unknown", CropWidth: 320, CropHeight: 240})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = c.UpdateVideoGeometry(ctx, &proto.UpdateVideoGeometryRequest{PipelineId: "video"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	resp, err := c.StartEncoding(ctx, &proto.StartEncodingRequest{
+		PipelineId: "video",
+		GstPipeline: "videotestsrc is-live=true ! video/x-raw,width=640,height=480 " +
+			"! videocrop name=crop left=0 top=0 right=-1 bottom=-1 ! capsfilter name=cropsize caps=video/x-raw,width=320,height=240 " +
+			"! videoscale ! capsfilter name=size caps=video/x-raw,width=320,height=240 " +
+			"! videoconvert ! video/x-raw,format=I420 ! x264enc speed-preset=ultrafast tune=zerolatency byte-stream=true",
+		Port: 0,
+	})
+	assert.NoError(t, err)
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", resp.ListenPort))
+	assert.NoError(t, err)
+	defer conn.Close()
+	var sp encoderproto.SamplePacket
+	assert.NoError(t, encoderproto.ReadSamplePacket(conn, &sp))
+
+	// the pipeline keeps running on the same connection
+	_, err = c.UpdateVideoGeometry(ctx, &proto.UpdateVideoGeometryRequest{
+		PipelineId:   "video",
+		CropX:        400,
+		CropY:        300,
+		CropWidth:    240,
+		CropHeight:   180,
+		OutputWidth:  480,
+		OutputHeight: 360,
+	})
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, encoderproto.ReadSamplePacket(conn, &sp))
+	}
+}
+
+func TestGetCapabilities(t *testing.T) {
+	lis := testutils.ListenTCPWithRandomPort(t)
+	s := grpc.NewServer()
+	proto.RegisterEncoderServer(s, newEncoderServer(t))
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("failed to serve gRPC server: %+v", err)
+		}
+	}()
+	cc, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+	c := proto.NewEncoderClient(cc)
+	ctx := context.Background()
+
+	resp, err := c.GetCapabilities(ctx, &proto.GetCapabilitiesRequest{})
+	assert.NoError(t, err)
+	assert.Contains(t, resp.EncoderElements, "x264enc")
+	assert.NotContains(t, resp.EncoderElements, "videotestsrc")
+
+	// a pipeline with missing elements fails immediately
+	_, err = c.StartEncoding(ctx, &proto.StartEncodingRequest{
+		PipelineId:  "video",
+		GstPipeline: "videotestsrc ! no-such-encoder",
+		Port:        0,
+	})
+	assert.Error(t, err)
+}
+
+func TestAllowedElements(t *testing.T) {
+	lis := testutils.ListenTCPWithRandomPort(t)
+	s := grpc.NewServer()
+	proto.RegisterEncoderServer(s, newEncoderServer(t))
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("failed to serve gRPC server: %+v", err)
+		}
+	}()
+	cc, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+	c := proto.NewEncoderClient(cc)
+	ctx := context.Background()
+
+	_, err = c.StartEncoding(ctx, &proto.StartEncodingRequest{
+		PipelineId:  "video",
+		GstPipeline: "videotestsrc ! tee name=t ! queue ! filesink location=/tmp/mashimaro-test t.",
+		Port:        0,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = c.StartEncoding(ctx, &proto.StartEncodingRequest{
+		PipelineId:  "video",
+		GstPipeline: "videotestsrc ! videoconvert ! video/x-raw,format=I420 ! x264enc",
+		Port:        0,
+	})
+	assert.NoError(t, err)
+}
+
+func TestAVSync(t *testing.T) {
+	lis := testutils.ListenTCPWithRandomPort(t)
+	s := grpc.NewServer()
+	proto.RegisterEncoderServer(s, newEncoderServer(t))
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("failed to serve gRPC server: %+v", err)
+		}
+	}()
+	cc, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+	c := proto.NewEncoderClient(cc)
+	ctx := context.Background()
+
+	pipelines := map[string]string{
+		"video": "videotestsrc is-live=true ! videoconvert ! video/x-raw,format=I420 ! x264enc speed-preset=ultrafast tune=zerolatency byte-stream=true",
+		"audio": "audiotestsrc is-live=true ! audioconvert ! opusenc",
+	}
+	started := time.Now()
+	offsets := make(chan time.Duration, len(pipelines))
+	for id, pipeline := range pipelines {
+		resp, err := c.StartEncoding(ctx, &proto.StartEncodingRequest{PipelineId: id, GstPipeline: pipeline})
+		assert.NoError(t, err)
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", resp.ListenPort))
+		assert.NoError(t, err)
+		defer conn.Close()
+		go func() {
+			// the offset of PTS from the arrival time, which is the same between pipelines if they are in sync
+			var diffs []time.Duration
+			for time.Since(started) < 2*time.Second {
+				var sp encoderproto.SamplePacket
+				if err := encoderproto.ReadSamplePacket(conn, &sp); err != nil {
+					break
+				}
+				if sp.PTS > 0 {
+					diffs = append(diffs, time.Since(started)-sp.PTS)
+				}
+			}
+			offsets <- median(diffs)
+		}()
+	}
+	offset := <-offsets - <-offsets
+	if offset < 0 {
+		offset = -offset
+	}
+	assert.True(t, offset < 100*time.Millisecond, "A/V offset: %v", offset)
+}
+
+func median(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+func TestStartDecoding(t *testing.T) {
+	lis := testutils.ListenTCPWithRandomPort(t)
+	s := grpc.NewServer()
+	proto.RegisterEncoderServer(s, newEncoderServer(t, WithAllowedElements(append(DefaultAllowedElements, "fakesink")...)))
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("failed to serve gRPC server: %+v", err)
+		}
+	}()
+	cc, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+	c := proto.NewEncoderClient(cc)
+	ctx := context.Background()
+
+	_, err = c.StartDecoding(ctx, &proto.StartDecodingRequest{PipelineId: "microphone", GstPipeline: "opusdec ! fakesink"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	encResp, err := c.StartEncoding(ctx, &proto.StartEncodingRequest{
+		PipelineId:  "audio",
+		GstPipeline: "audiotestsrc is-live=true ! audioconvert ! opusenc",
+	})
+	assert.NoError(t, err)
+	encConn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", encResp.ListenPort))
+	assert.NoError(t, err)
+	defer encConn.Close()
+
+	decResp, err := c.StartDecoding(ctx, &proto.StartDecodingRequest{
+		PipelineId:  "microphone",
+		GstPipeline: "opusdec ! audioconvert ! fakesink",
+		Caps:        "audio/x-opus,channel-mapping-family=0",
+	})
+	assert.NoError(t, err)
+	decConn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", decResp.ListenPort))
+	assert.NoError(t, err)
+	defer decConn.Close()
+
+	for i := 0; i < 50; i++ {
+		var sp encoderproto.SamplePacket
+		assert.NoError(t, encoderproto.ReadSamplePacket(encConn, &sp))
+		assert.NoError(t, encoderproto.WriteSamplePacket(decConn, &sp))
+	}
+}
+
+func TestWatchPipeline(t *testing.T) {
+	lis := testutils.ListenTCPWithRandomPort(t)
+	s := grpc.NewServer()
+	proto.RegisterEncoderServer(s, newEncoderServer(t))
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("failed to serve gRPC server: %+v", err)
+		}
+	}()
+	cc, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+	c := proto.NewEncoderClient(cc)
+	ctx := context.Background()
+
+	stream, err := c.WatchPipeline(ctx, &proto.WatchPipelineRequest{PipelineId: "unknown"})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	cases := map[string]struct {
+		pipeline  string
+		eventType proto.PipelineEventType
+	}{
+		"eos": {
+			pipeline:  "videotestsrc num-buffers=10",
+			eventType: proto.PipelineEventType_PIPELINE_EVENT_EOS,
+		},
+		"error": {
+			// cropping more than the width fails to negotiate caps
+			pipeline:  "videotestsrc ! video/x-raw,width=320,height=240 ! videocrop left=400",
+			eventType: proto.PipelineEventType_PIPELINE_EVENT_ERROR,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			resp, err := c.StartEncoding(ctx, &proto.StartEncodingRequest{PipelineId: "video", GstPipeline: tc.pipeline})
+			assert.NoError(t, err)
+			stream, err := c.WatchPipeline(ctx, &proto.WatchPipelineRequest{PipelineId: "video"})
+			assert.NoError(t, err)
+			conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", resp.ListenPort))
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			// the pipeline ends and closes the connection
+			for {
+				var sp encoderproto.SamplePacket
+				if err := encoderproto.ReadSamplePacket(conn, &sp); err != nil {
+					break
+				}
+			}
+			var ev *proto.PipelineEvent
+			for ev == nil || ev.Type == proto.PipelineEventType_PIPELINE_EVENT_WARNING {
+				ev, err = stream.Recv()
+				if !assert.NoError(t, err) {
+					return
+				}
+			}
+			assert.Equal(t, tc.eventType, ev.Type)
+			assert.NotEmpty(t, ev.Source)
+			if tc.eventType == proto.PipelineEventType_PIPELINE_EVENT_ERROR {
+				assert.NotEmpty(t, ev.Message)
+			}
+			// the stream ends with the pipeline
+			for err == nil {
+				_, err = stream.Recv()
+			}
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+}
@@ -0,0 +1,402 @@
+package encoder
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/castaneai/mashimaro/pkg/encoder/encoderproto"
+	"github.com/castaneai/mashimaro/pkg/proto"
+)
+
+const (
+	minRestartBackoff = 500 * time.Millisecond
+	maxRestartBackoff = 10 * time.Second
+	// the number of recent restarts kept for GetPipelineStatus
+	maxRestartHistory = 10
+	// how long to wait for the exit status of a child process which closed the connection
+	childExitWait = time.Second
+)
+
+var errPipelineRestarting = errors.New("pipeline is restarting")
+
+// supervisedPipeline runs a pipeline in a child process and restarts it on failure.
+// The client keeps the connection to the supervisor while the child process restarts,
+// and sample packets are relayed between them.
+// The latest settings by UpdateEncodingParams and UpdateVideoGeometry are replayed to a restarted pipeline.
+type supervisedPipeline struct {
+	id          string
+	pipelineStr string
+	// the pipeline consumes samples with the caps if not empty
+	inputCaps string
+	command   string
+	clock     *sharedClock
+	lis       net.Listener
+	events    *pipelineEvents
+
+	child *childProcess
+	// the ERROR or EOS of the current child process
+	endEvent     *proto.PipelineEvent
+	conn         net.Conn
+	state        proto.PipelineState
+	restartCount int
+	restarts     []*proto.PipelineRestart
+	stopped      chan struct{}
+	stopOnce     sync.Once
+	mu           sync.Mutex
+
+	// the latest settings replayed to a restarted child process (zero keeps the value of the pipeline string)
+	bitrateKbps uint32
+	framerate   uint32
+	geometry    *proto.UpdateVideoGeometryRequest
+	// serializes updates of the settings and the replay so that a child process does not get a stale setting
+	settingsMu sync.Mutex
+}
+
+func startSupervisedPipeline(id, pipelineStr, inputCaps string, port int, command string, clock *sharedClock) (*supervisedPipeline, error) {
+	lis, err := listenTCP(port)
+	if err != nil {
+		return nil, err
+	}
+	// start the first child process before returning so that the caller knows an invalid pipeline immediately
+	child, err := startChildProcess(command, clock, id, pipelineStr, inputCaps)
+	if err != nil {
+		_ = lis.Close()
+		return nil, err
+	}
+	p := &supervisedPipeline{
+		id:          id,
+		pipelineStr: pipelineStr,
+		inputCaps:   inputCaps,
+		command:     command,
+		clock:       clock,
+		lis:         lis,
+		events:      newPipelineEvents(),
+		child:       child,
+		state:       proto.PipelineState_PIPELINE_RUNNING,
+		stopped:     make(chan struct{}),
+	}
+	go p.forwardEvents(child)
+	go p.serve()
+	return p, nil
+}
+
+func (p *supervisedPipeline) String() string {
+	return fmt.Sprintf("%T(pipeline: %s)", p, p.pipelineStr)
+}
+
+func (p *supervisedPipeline) Addr() net.Addr {
+	return p.lis.Addr()
+}
+
+func (p *supervisedPipeline) serve() {
+	defer p.Stop()
+	log.Printf("waiting for connection on %v...", p.lis.Addr())
+	conn, err := p.lis.Accept()
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	p.conn = conn
+	p.mu.Unlock()
+	log.Printf("accepted new conn")
+
+	backoff := minRestartBackoff
+	for {
+		started := time.Now()
+		err := p.relay(conn)
+		if p.isStopped() {
+			return
+		}
+		if errors.Is(err, errClientDisconnected) {
+			log.Printf("media data client disconnected")
+			return
+		}
+		reason := err
+		if exitErr := p.killChild(childExitWait); exitErr != nil {
+			reason = exitErr
+		} else if ev := p.takeEndEvent(); ev != nil {
+			reason = pipelineEventError(ev)
+		}
+		log.Printf("pipeline process failed, restarting in %v (pipelineID: %s): %+v", backoff, p.id, reason)
+		p.recordRestart(reason)
+
+		if time.Since(started) > maxRestartBackoff {
+			backoff = minRestartBackoff
+		}
+		for {
+			select {
+			case <-p.stopped:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxRestartBackoff {
+				backoff = maxRestartBackoff
+			}
+			child, err := startChildProcess(p.command, p.clock, p.id, p.pipelineStr, p.inputCaps)
+			if err != nil {
+				log.Printf("failed to restart pipeline process, retrying in %v (pipelineID: %s): %+v", backoff, p.id, err)
+				p.recordRestart(err)
+				continue
+			}
+			if !p.setChild(child) {
+				child.Kill()
+				return
+			}
+			p.replaySettings(child)
+			go p.forwardEvents(child)
+			log.Printf("pipeline process restarted (pipelineID: %s, pid: %d)", p.id, child.Pid())
+			break
+		}
+	}
+}
+
+var errClientDisconnected = errors.New("client disconnected")
+
+// relay relays sample packets between the client and the current child process until either fails.
+func (p *supervisedPipeline) relay(conn net.Conn) error {
+	p.mu.Lock()
+	child := p.child
+	p.mu.Unlock()
+	if child == nil {
+		return errPipelineRestarting
+	}
+	childConn, err := net.Dial("tcp", child.dataAddr)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to child process")
+	}
+	defer childConn.Close()
+	// the child process closes the connection when it exits
+	go func() {
+		select {
+		case <-child.exited:
+			_ = childConn.Close()
+		case <-p.stopped:
+		}
+	}()
+
+	src, dst := childConn, conn
+	srcErr, dstErr := errors.New("child process closed connection"), errClientDisconnected
+	if p.inputCaps != "" {
+		src, dst = conn, childConn
+		srcErr, dstErr = dstErr, srcErr
+	}
+	r := bufio.NewReader(src)
+	for {
+		var packet encoderproto.SamplePacket
+		if err := encoderproto.ReadSamplePacket(r, &packet); err != nil {
+			return errors.Wrap(srcErr, err.Error())
+		}
+		if err := encoderproto.WriteSamplePacket(dst, &packet); err != nil {
+			return errors.Wrap(dstErr, err.Error())
+		}
+	}
+}
+
+// forwardEvents publishes bus events of the pipeline in the child process until it is killed.
+func (p *supervisedPipeline) forwardEvents(child *childProcess) {
+	stream, err := child.client.WatchPipeline(context.Background(), &proto.WatchPipelineRequest{PipelineId: p.id})
+	if err != nil {
+		log.Printf("failed to watch pipeline in child process (pipelineID: %s): %+v", p.id, err)
+		return
+	}
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			return
+		}
+		if ev.Type != proto.PipelineEventType_PIPELINE_EVENT_WARNING {
+			p.mu.Lock()
+			p.endEvent = ev
+			p.mu.Unlock()
+		}
+		p.events.publish(ev)
+	}
+}
+
+func (p *supervisedPipeline) takeEndEvent() *proto.PipelineEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ev := p.endEvent
+	p.endEvent = nil
+	return ev
+}
+
+// killChild kills the child process and returns why it exited if it exits within the wait.
+func (p *supervisedPipeline) killChild(wait time.Duration) error {
+	p.mu.Lock()
+	child := p.child
+	p.child = nil
+	p.mu.Unlock()
+	if child == nil {
+		return nil
+	}
+	// the exit status tells more than the closed connection (e.g. "signal: segmentation fault"),
+	// but the connection may be closed before the exit is observed
+	select {
+	case <-child.exited:
+	case <-time.After(wait):
+	}
+	err := child.Err()
+	child.Kill()
+	return err
+}
+
+func (p *supervisedPipeline) setChild(child *childProcess) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state == proto.PipelineState_PIPELINE_STOPPED {
+		return false
+	}
+	p.child = child
+	p.state = proto.PipelineState_PIPELINE_RUNNING
+	return true
+}
+
+// replaySettings applies the latest settings to the restarted child process before it starts playing.
+func (p *supervisedPipeline) replaySettings(child *childProcess) {
+	p.settingsMu.Lock()
+	defer p.settingsMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), childRequestTimeout)
+	defer cancel()
+	if p.bitrateKbps > 0 || p.framerate > 0 {
+		if _, err := child.client.UpdateEncodingParams(ctx, &proto.UpdateEncodingParamsRequest{PipelineId: p.id, BitrateKbps: p.bitrateKbps, Framerate: p.framerate}); err != nil {
+			log.Printf("failed to replay encoding params to restarted pipeline (pipelineID: %s): %+v", p.id, err)
+		}
+	}
+	if p.geometry != nil {
+		if _, err := child.client.UpdateVideoGeometry(ctx, p.geometry); err != nil {
+			log.Printf("failed to replay video geometry to restarted pipeline (pipelineID: %s): %+v", p.id, err)
+		}
+	}
+}
+
+func (p *supervisedPipeline) recordRestart(reason error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state == proto.PipelineState_PIPELINE_STOPPED {
+		return
+	}
+	p.state = proto.PipelineState_PIPELINE_RESTARTING
+	p.restartCount++
+	p.restarts = append(p.restarts, &proto.PipelineRestart{
+		TimeUnixMillis: time.Now().UnixNano() / int64(time.Millisecond),
+		Reason:         reason.Error(),
+	})
+	if len(p.restarts) > maxRestartHistory {
+		p.restarts = p.restarts[len(p.restarts)-maxRestartHistory:]
+	}
+}
+
+func (p *supervisedPipeline) isStopped() bool {
+	select {
+	case <-p.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *supervisedPipeline) client() (proto.EncoderClient, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.child == nil {
+		return nil, errPipelineRestarting
+	}
+	return p.child.client, nil
+}
+
+func (p *supervisedPipeline) RequestKeyframe() error {
+	c, err := p.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), childRequestTimeout)
+	defer cancel()
+	_, err = c.RequestKeyframe(ctx, &proto.RequestKeyframeRequest{PipelineId: p.id})
+	return err
+}
+
+// UpdateEncodingParams updates the pipeline of the current child process.
+// The params are kept even if the pipeline is restarting, and replayed when it restarts.
+func (p *supervisedPipeline) UpdateEncodingParams(bitrateKbps, framerate uint32) error {
+	p.settingsMu.Lock()
+	defer p.settingsMu.Unlock()
+	if bitrateKbps > 0 {
+		p.bitrateKbps = bitrateKbps
+	}
+	if framerate > 0 {
+		p.framerate = framerate
+	}
+	c, err := p.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), childRequestTimeout)
+	defer cancel()
+	_, err = c.UpdateEncodingParams(ctx, &proto.UpdateEncodingParamsRequest{PipelineId: p.id, BitrateKbps: bitrateKbps, Framerate: framerate})
+	return err
+}
+
+// UpdateVideoGeometry updates the pipeline of the current child process.
+// The geometry is kept even if the pipeline is restarting, and replayed when it restarts.
+func (p *supervisedPipeline) UpdateVideoGeometry(x, y, width, height, outputWidth, outputHeight uint32) error {
+	req := &proto.UpdateVideoGeometryRequest{
+		PipelineId:   p.id,
+		CropX:        x,
+		CropY:        y,
+		CropWidth:    width,
+		CropHeight:   height,
+		OutputWidth:  outputWidth,
+		OutputHeight: outputHeight,
+	}
+	p.settingsMu.Lock()
+	defer p.settingsMu.Unlock()
+	p.geometry = req
+	c, err := p.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), childRequestTimeout)
+	defer cancel()
+	_, err = c.UpdateVideoGeometry(ctx, req)
+	return err
+}
+
+func (p *supervisedPipeline) Status() *proto.GetPipelineStatusResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return &proto.GetPipelineStatusResponse{
+		State:        p.state,
+		RestartCount: uint32(p.restartCount),
+		Restarts:     append([]*proto.PipelineRestart(nil), p.restarts...),
+	}
+}
+
+// Watch returns a channel receiving bus events of the pipeline across restarts.
+// The channel is closed when the pipeline stops.
+func (p *supervisedPipeline) Watch() (<-chan *proto.PipelineEvent, func()) {
+	return p.events.watch()
+}
+
+func (p *supervisedPipeline) Stop() {
+	p.stopOnce.Do(func() {
+		p.mu.Lock()
+		p.state = proto.PipelineState_PIPELINE_STOPPED
+		if p.conn != nil {
+			_ = p.conn.Close()
+		}
+		close(p.stopped)
+		p.mu.Unlock()
+		_ = p.lis.Close()
+		_ = p.killChild(0)
+		p.events.close()
+		log.Printf("supervised pipeline stopped (pipelineID: %s)", p.id)
+	})
+}
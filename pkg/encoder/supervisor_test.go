@@ -0,0 +1,167 @@
+package encoder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/castaneai/mashimaro/pkg/encoder/encoderproto"
+	"github.com/castaneai/mashimaro/pkg/proto"
+	"github.com/castaneai/mashimaro/pkg/testutils"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary is the child process of WithProcessIsolation
+	if IsChildProcess() {
+		if err := ServeChildProcess(); err != nil {
+			log.Fatalf("failed to serve child process: %+v", err)
+		}
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func TestProcessIsolation(t *testing.T) {
+	lis := testutils.ListenTCPWithRandomPort(t)
+	s := grpc.NewServer()
+	es := newEncoderServer(t, WithProcessIsolation())
+	proto.RegisterEncoderServer(s, es)
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("failed to serve gRPC server: %+v", err)
+		}
+	}()
+	cc, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+	c := proto.NewEncoderClient(cc)
+	ctx := context.Background()
+
+	// an invalid pipeline fails immediately as well
+	_, err = c.StartEncoding(ctx, &proto.StartEncodingRequest{
+		PipelineId:  "video",
+		GstPipeline: "videotestsrc ! tee name=t ! queue ! filesink location=/tmp/mashimaro-test t.",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	conns := make(map[string]net.Conn)
+	for id, pipeline := range map[string]string{
+		"video": "videotestsrc is-live=true ! videoconvert ! video/x-raw,format=I420 ! x264enc name=encoder speed-preset=ultrafast tune=zerolatency byte-stream=true",
+		"audio": "audiotestsrc is-live=true ! audioconvert ! opusenc name=encoder",
+	} {
+		resp, err := c.StartEncoding(ctx, &proto.StartEncodingRequest{PipelineId: id, GstPipeline: pipeline})
+		assert.NoError(t, err)
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", resp.ListenPort))
+		assert.NoError(t, err)
+		defer conn.Close()
+		var sp encoderproto.SamplePacket
+		assert.NoError(t, encoderproto.ReadSamplePacket(conn, &sp))
+		conns[id] = conn
+	}
+
+	// crash the process of the video pipeline
+	p, ok := es.(*encoderServer).getPipeline("video")
+	assert.True(t, ok)
+	supervised := p.(*supervisedPipeline)
+	supervised.mu.Lock()
+	pid := supervised.child.Pid()
+	supervised.mu.Unlock()
+	assert.NoError(t, syscall.Kill(pid, syscall.SIGKILL))
+
+	// the audio pipeline is not affected
+	audioStarted := time.Now()
+	for time.Since(audioStarted) < time.Second {
+		var packet encoderproto.SamplePacket
+		assert.NoError(t, encoderproto.ReadSamplePacket(conns["audio"], &packet))
+	}
+	// the video pipeline restarts on the same connection
+	for i := 0; i < 10; i++ {
+		var packet encoderproto.SamplePacket
+		assert.NoError(t, encoderproto.ReadSamplePacket(conns["video"], &packet))
+	}
+	st, err := c.GetPipelineStatus(ctx, &proto.GetPipelineStatusRequest{PipelineId: "video"})
+	assert.NoError(t, err)
+	assert.Equal(t, proto.PipelineState_PIPELINE_RUNNING, st.State)
+	assert.Equal(t, uint32(1), st.RestartCount)
+	assert.Len(t, st.Restarts, 1)
+	assert.Contains(t, st.Restarts[0].Reason, "killed")
+	_, err = c.RequestKeyframe(ctx, &proto.RequestKeyframeRequest{PipelineId: "video"})
+	assert.NoError(t, err)
+
+	st, err = c.GetPipelineStatus(ctx, &proto.GetPipelineStatusRequest{PipelineId: "audio"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), st.RestartCount)
+
+	_, err = c.GetPipelineStatus(ctx, &proto.GetPipelineStatusRequest{PipelineId: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestProcessIsolationReplaysSettings(t *testing.T) {
+	lis := testutils.ListenTCPWithRandomPort(t)
+	s := grpc.NewServer()
+	es := newEncoderServer(t, WithProcessIsolation())
+	proto.RegisterEncoderServer(s, es)
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Printf("failed to serve gRPC server: %+v", err)
+		}
+	}()
+	cc, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+	c := proto.NewEncoderClient(cc)
+	ctx := context.Background()
+
+	resp, err := c.StartEncoding(ctx, &proto.StartEncodingRequest{
+		PipelineId:  "video",
+		GstPipeline: "videotestsrc is-live=true ! capsfilter name=framerate caps=video/x-raw,framerate=60/1 ! x264enc name=encoder speed-preset=ultrafast tune=zerolatency byte-stream=true bitrate=2000",
+	})
+	assert.NoError(t, err)
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", resp.ListenPort))
+	assert.NoError(t, err)
+	defer conn.Close()
+	var sp encoderproto.SamplePacket
+	assert.NoError(t, encoderproto.ReadSamplePacket(conn, &sp))
+	_, err = c.UpdateEncodingParams(ctx, &proto.UpdateEncodingParamsRequest{PipelineId: "video", Framerate: 30})
+	assert.NoError(t, err)
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for sp.Duration != time.Second/30 {
+		if err := encoderproto.ReadSamplePacket(conn, &sp); err != nil {
+			t.Fatalf("failed to receive a frame of 30fps: %+v", err)
+		}
+	}
+
+	// crash the process after the update
+	p, ok := es.(*encoderServer).getPipeline("video")
+	assert.True(t, ok)
+	supervised := p.(*supervisedPipeline)
+	supervised.mu.Lock()
+	pid := supervised.child.Pid()
+	supervised.mu.Unlock()
+	assert.NoError(t, syscall.Kill(pid, syscall.SIGKILL))
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Second)))
+	for {
+		if err := encoderproto.ReadSamplePacket(conn, &sp); err != nil {
+			t.Fatalf("failed to receive a frame after the restart: %+v", err)
+		}
+		if st := supervised.Status(); st.RestartCount > 0 && st.State == proto.PipelineState_PIPELINE_RUNNING {
+			break
+		}
+	}
+
+	// the restarted pipeline keeps the framerate instead of the one of the pipeline string
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, encoderproto.ReadSamplePacket(conn, &sp))
+		assert.Equal(t, time.Second/30, sp.Duration)
+	}
+}
@@ -0,0 +1,283 @@
+// Package fmp4 packs H.264 video into fragmented MP4 (ISO/IEC 14496-12), which browsers play by Media Source Extensions.
+package fmp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/castaneai/mashimaro/pkg/h264"
+)
+
+const (
+	videoTrackID = 1
+	// timescale is the clock rate of the timestamps in the video track, which is the same as RTP for H.264.
+	timescale = 90000
+)
+
+// Format is the video format of an init segment.
+type Format struct {
+	// MIMEType is for MediaSource.addSourceBuffer (e.g. `video/mp4; codecs="avc1.42c01f"`).
+	MIMEType string
+	Width    int
+	Height   int
+}
+
+// Segment is an init segment (ftyp and moov) or a media segment (moof and mdat).
+type Segment struct {
+	Data []byte
+	// Format is set for an init segment, which the media segments following it are decoded by.
+	Format *Format
+}
+
+// Muxer packs H.264 frames into fragmented MP4 with a fragment per frame for low latency.
+// B-frames are not supported, as the encoder doesn't produce them for streaming.
+type Muxer struct {
+	// AVCDecoderConfigurationRecord of the latest init segment
+	config         []byte
+	sequenceNumber uint32
+	decodeTime     uint64
+	lastDuration   uint64
+}
+
+func NewMuxer() *Muxer {
+	return &Muxer{}
+}
+
+// Mux packs a frame of H.264 byte-stream into segments.
+// An init segment precedes the first keyframe and the ones with new SPS or PPS (e.g. by changing the resolution).
+// Frames before the first keyframe are dropped, as they cannot be decoded.
+// Zero pts means unknown, and the frame follows the previous one.
+func (m *Muxer) Mux(frame []byte, pts, duration time.Duration) ([]Segment, error) {
+	var segments []Segment
+	keyframe := h264.IsKeyframe(frame)
+	if keyframe {
+		config, err := h264.DecoderConfig(frame)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(config, m.config) {
+			data, format, err := initSegment(frame, config)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, Segment{Data: data, Format: format})
+			m.config = config
+		}
+	}
+	if m.config == nil {
+		return nil, nil
+	}
+	if pts > 0 {
+		m.decodeTime = toTimescale(pts)
+	} else if m.sequenceNumber > 0 {
+		m.decodeTime += m.lastDuration
+	}
+	m.lastDuration = toTimescale(duration)
+	m.sequenceNumber++
+	segments = append(segments, Segment{Data: mediaSegment(m.sequenceNumber, m.decodeTime, uint32(m.lastDuration), keyframe, h264.AnnexBToAVC(frame))})
+	return segments, nil
+}
+
+func toTimescale(d time.Duration) uint64 {
+	if d <= 0 {
+		return 0
+	}
+	// avoid overflow of multiplying nanoseconds
+	return uint64(d/time.Second)*timescale + uint64(d%time.Second)*timescale/uint64(time.Second)
+}
+
+func initSegment(keyframe, config []byte) ([]byte, *Format, error) {
+	sps, _, err := h264.ParameterSets(keyframe)
+	if err != nil {
+		return nil, nil, err
+	}
+	width, height, err := h264.PictureSize(sps)
+	if err != nil {
+		return nil, nil, err
+	}
+	format := &Format{
+		MIMEType: fmt.Sprintf(`video/mp4; codecs="avc1.%02x%02x%02x"`, sps[1], sps[2], sps[3]),
+		Width:    width,
+		Height:   height,
+	}
+	ftyp := box("ftyp", []byte("iso5"), u32(512), []byte("iso5iso6mp41"))
+	moov := box("moov",
+		mvhd(),
+		box("trak",
+			tkhd(width, height),
+			box("mdia",
+				mdhd(),
+				hdlr(),
+				box("minf",
+					fullBox("vmhd", 0, 1, make([]byte, 8)),
+					box("dinf", fullBox("dref", 0, 0, u32(1), fullBox("url ", 0, 1))),
+					box("stbl",
+						fullBox("stsd", 0, 0, u32(1), avc1(width, height, config)),
+						fullBox("stts", 0, 0, u32(0)),
+						fullBox("stsc", 0, 0, u32(0)),
+						fullBox("stsz", 0, 0, u32(0), u32(0)),
+						fullBox("stco", 0, 0, u32(0)),
+					),
+				),
+			),
+		),
+		box("mvex", fullBox("trex", 0, 0, u32(videoTrackID), u32(1), u32(0), u32(0), u32(0))),
+	)
+	return append(ftyp, moov...), format, nil
+}
+
+// the unity matrix of mvhd and tkhd
+var matrix = concat(u32(0x00010000), u32(0), u32(0), u32(0), u32(0x00010000), u32(0), u32(0), u32(0), u32(0x40000000))
+
+func mvhd() []byte {
+	return fullBox("mvhd", 0, 0,
+		u32(0),          // creation_time
+		u32(0),          // modification_time
+		u32(1000),       // timescale
+		u32(0),          // duration
+		u32(0x00010000), // rate: 1.0
+		u16(0x0100),     // volume: 1.0
+		make([]byte, 10),
+		matrix,
+		make([]byte, 24),
+		u32(videoTrackID+1), // next_track_ID
+	)
+}
+
+func tkhd(width, height int) []byte {
+	// track_enabled | track_in_movie
+	return fullBox("tkhd", 0, 3,
+		u32(0), // creation_time
+		u32(0), // modification_time
+		u32(videoTrackID),
+		u32(0), // reserved
+		u32(0), // duration
+		make([]byte, 8),
+		u16(0), // layer
+		u16(0), // alternate_group
+		u16(0), // volume
+		u16(0), // reserved
+		matrix,
+		u32(uint32(width)<<16),
+		u32(uint32(height)<<16),
+	)
+}
+
+func mdhd() []byte {
+	return fullBox("mdhd", 0, 0,
+		u32(0), // creation_time
+		u32(0), // modification_time
+		u32(timescale),
+		u32(0),      // duration
+		u16(0x55C4), // language: und
+		u16(0),
+	)
+}
+
+func hdlr() []byte {
+	return fullBox("hdlr", 0, 0,
+		u32(0), // pre_defined
+		[]byte("vide"),
+		make([]byte, 12),
+		[]byte("VideoHandler\x00"),
+	)
+}
+
+func avc1(width, height int, config []byte) []byte {
+	return box("avc1",
+		make([]byte, 6), // reserved
+		u16(1),          // data_reference_index
+		make([]byte, 16),
+		u16(uint16(width)),
+		u16(uint16(height)),
+		u32(0x00480000), // horizresolution: 72 dpi
+		u32(0x00480000), // vertresolution: 72 dpi
+		u32(0),
+		u16(1), // frame_count
+		make([]byte, 32),
+		u16(0x0018), // depth
+		u16(0xFFFF), // pre_defined: -1
+		box("avcC", config),
+	)
+}
+
+const (
+	tfhdDefaultBaseIsMoof = 0x020000
+
+	trunDataOffsetPresent     = 0x000001
+	trunSampleDurationPresent = 0x000100
+	trunSampleSizePresent     = 0x000200
+	trunSampleFlagsPresent    = 0x000400
+
+	// sample_depends_on: 2 (does not depend on others)
+	sampleFlagsKeyframe = 0x02000000
+	// sample_depends_on: 1 (depends on others) and sample_is_non_sync_sample
+	sampleFlagsNonKeyframe = 0x01010000
+)
+
+func mediaSegment(sequenceNumber uint32, decodeTime uint64, duration uint32, keyframe bool, sample []byte) []byte {
+	flags := uint32(sampleFlagsNonKeyframe)
+	if keyframe {
+		flags = sampleFlagsKeyframe
+	}
+	moof := func(dataOffset uint32) []byte {
+		return box("moof",
+			fullBox("mfhd", 0, 0, u32(sequenceNumber)),
+			box("traf",
+				fullBox("tfhd", 0, tfhdDefaultBaseIsMoof, u32(videoTrackID)),
+				fullBox("tfdt", 1, 0, u64(decodeTime)),
+				fullBox("trun", 0, trunDataOffsetPresent|trunSampleDurationPresent|trunSampleSizePresent|trunSampleFlagsPresent,
+					u32(1), // sample_count
+					u32(dataOffset),
+					u32(duration),
+					u32(uint32(len(sample))),
+					u32(flags),
+				),
+			),
+		)
+	}
+	// the data offset is from the beginning of moof to the sample in mdat
+	size := len(moof(0))
+	return append(moof(uint32(size+8)), box("mdat", sample)...)
+}
+
+func box(typ string, payloads ...[]byte) []byte {
+	payload := concat(payloads...)
+	buf := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(8+len(payload)))
+	copy(buf[4:], typ)
+	return append(buf, payload...)
+}
+
+func fullBox(typ string, version byte, flags uint32, payloads ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return box(typ, append([][]byte{header}, payloads...)...)
+}
+
+func concat(bs ...[]byte) []byte {
+	var buf []byte
+	for _, b := range bs {
+		buf = append(buf, b...)
+	}
+	return buf
+}
+
+func u16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func u64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,152 @@
+package fmp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	// 1920x1080 of High Profile encoded by x264
+	sps = []byte{0x67, 0x64, 0x00, 0x28, 0xac, 0xd9, 0x40, 0x78, 0x02, 0x27, 0xe5, 0xc0, 0x44, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc6, 0x58}
+	pps = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+)
+
+func keyframe(idr ...byte) []byte {
+	return bytes.Join([][]byte{{}, sps, pps, append([]byte{0x65}, idr...)}, []byte{0, 0, 0, 1})
+}
+
+func interframe(slice ...byte) []byte {
+	return append([]byte{0, 0, 0, 1, 0x41}, slice...)
+}
+
+type mp4Box struct {
+	typ     string
+	payload []byte
+}
+
+func readBoxes(t *testing.T, data []byte) []mp4Box {
+	var boxes []mp4Box
+	for len(data) > 0 {
+		if !assert.True(t, len(data) >= 8) {
+			return nil
+		}
+		size := binary.BigEndian.Uint32(data)
+		if !assert.True(t, int(size) <= len(data) && size >= 8, "invalid box size") {
+			return nil
+		}
+		boxes = append(boxes, mp4Box{typ: string(data[4:8]), payload: data[8:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+// findBox finds the box by the path of box types from the data.
+func findBox(t *testing.T, data []byte, path ...string) []byte {
+	for _, typ := range path {
+		found := false
+		for _, b := range readBoxes(t, data) {
+			if b.typ == typ {
+				data = b.payload
+				found = true
+				break
+			}
+		}
+		if !assert.True(t, found, "box not found: %s", typ) {
+			return nil
+		}
+	}
+	return data
+}
+
+func boxTypes(t *testing.T, data []byte) []string {
+	var types []string
+	for _, b := range readBoxes(t, data) {
+		types = append(types, b.typ)
+	}
+	return types
+}
+
+func TestMuxer(t *testing.T) {
+	m := NewMuxer()
+
+	// frames before the first keyframe are dropped
+	segments, err := m.Mux(interframe(0x9a), 0, 33*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Empty(t, segments)
+
+	segments, err = m.Mux(keyframe(0x88, 0x84), time.Second, 33*time.Millisecond)
+	assert.NoError(t, err)
+	if !assert.Len(t, segments, 2) {
+		return
+	}
+	initSegment := segments[0]
+	assert.Equal(t, &Format{MIMEType: `video/mp4; codecs="avc1.640028"`, Width: 1920, Height: 1080}, initSegment.Format)
+	assert.Equal(t, []string{"ftyp", "moov"}, boxTypes(t, initSegment.Data))
+	tkhd := findBox(t, initSegment.Data, "moov", "trak", "tkhd")
+	assert.Equal(t, uint32(1920<<16), binary.BigEndian.Uint32(tkhd[len(tkhd)-8:]))
+	assert.Equal(t, uint32(1080<<16), binary.BigEndian.Uint32(tkhd[len(tkhd)-4:]))
+	stsd := findBox(t, initSegment.Data, "moov", "trak", "mdia", "minf", "stbl", "stsd")
+	avcC := findBox(t, findBox(t, stsd[8:], "avc1")[78:], "avcC")
+	assert.Equal(t, []byte{1, 0x64, 0x00, 0x28, 0xff, 0xe1}, avcC[:6])
+	assert.NotNil(t, findBox(t, initSegment.Data, "moov", "mvex", "trex"))
+
+	media := segments[1]
+	assert.Nil(t, media.Format)
+	assertMediaSegment(t, media.Data, 1, 90000, 2970, true, keyframe(0x88, 0x84))
+
+	// the frame without PTS follows the previous one
+	segments, err = m.Mux(interframe(0x9a, 0x02), 0, 33*time.Millisecond)
+	assert.NoError(t, err)
+	if assert.Len(t, segments, 1) {
+		assertMediaSegment(t, segments[0].Data, 2, 90000+2970, 2970, false, interframe(0x9a, 0x02))
+	}
+
+	// the same parameter sets don't need another init segment
+	segments, err = m.Mux(keyframe(0x88, 0x85), 2*time.Second, 33*time.Millisecond)
+	assert.NoError(t, err)
+	if assert.Len(t, segments, 1) {
+		assertMediaSegment(t, segments[0].Data, 3, 180000, 2970, true, keyframe(0x88, 0x85))
+	}
+
+	// new parameter sets are sent by another init segment
+	defer func(prev []byte) { pps = prev }(pps)
+	pps = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc1}
+	segments, err = m.Mux(keyframe(0x88, 0x86), 3*time.Second, 33*time.Millisecond)
+	assert.NoError(t, err)
+	if assert.Len(t, segments, 2) {
+		assert.NotNil(t, segments[0].Format)
+		assertMediaSegment(t, segments[1].Data, 4, 270000, 2970, true, keyframe(0x88, 0x86))
+	}
+}
+
+func assertMediaSegment(t *testing.T, data []byte, sequenceNumber uint32, decodeTime uint64, duration uint32, keyframe bool, frame []byte) {
+	t.Helper()
+	assert.Equal(t, []string{"moof", "mdat"}, boxTypes(t, data))
+	mfhd := findBox(t, data, "moof", "mfhd")
+	assert.Equal(t, sequenceNumber, binary.BigEndian.Uint32(mfhd[4:]))
+	tfdt := findBox(t, data, "moof", "traf", "tfdt")
+	assert.Equal(t, decodeTime, binary.BigEndian.Uint64(tfdt[4:]))
+	trun := findBox(t, data, "moof", "traf", "trun")
+	assert.Equal(t, uint32(1), binary.BigEndian.Uint32(trun[4:]))
+	offset := binary.BigEndian.Uint32(trun[8:])
+	assert.Equal(t, duration, binary.BigEndian.Uint32(trun[12:]))
+	size := binary.BigEndian.Uint32(trun[16:])
+	flags := binary.BigEndian.Uint32(trun[20:])
+	assert.Equal(t, keyframe, flags&0x00010000 == 0)
+
+	// the sample is in AVC format at the offset from moof
+	var avc []byte
+	for _, nalu := range bytes.Split(frame, []byte{0, 0, 0, 1}) {
+		if len(nalu) > 0 {
+			avc = append(append(avc, 0, 0, 0, byte(len(nalu))), nalu...)
+		}
+	}
+	if assert.True(t, int(offset+size) <= len(data)) {
+		assert.Equal(t, avc, data[offset:offset+size])
+	}
+	assert.Equal(t, avc, findBox(t, data, "mdat"))
+}
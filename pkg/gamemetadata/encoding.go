@@ -0,0 +1,141 @@
+package gamemetadata
+
+import (
+	"fmt"
+)
+
+// EncodingProfile is the encoding settings of a game.
+// Zero values are replaced with DefaultEncodingProfile.
+type EncodingProfile struct {
+	// Framerate is the max framerate of video.
+	Framerate int `yaml:"framerate,omitempty" firestore:"framerate,omitempty"`
+	// MinFramerate is the framerate used on poor networks.
+	MinFramerate int `yaml:"minFramerate,omitempty" firestore:"minFramerate,omitempty"`
+
+	// VideoBitrate is the initial bitrate of video in kbps.
+	VideoBitrate int `yaml:"videoBitrate,omitempty" firestore:"videoBitrate,omitempty"`
+	// MinVideoBitrate and MaxVideoBitrate are the bounds of adaptive bitrate in kbps.
+	MinVideoBitrate int `yaml:"minVideoBitrate,omitempty" firestore:"minVideoBitrate,omitempty"`
+	MaxVideoBitrate int `yaml:"maxVideoBitrate,omitempty" firestore:"maxVideoBitrate,omitempty"`
+
+	// Preset is the speed preset of x264 (e.g. "ultrafast", "veryfast").
+	Preset string `yaml:"preset,omitempty" firestore:"preset,omitempty"`
+	// KeyframeInterval is the max number of frames between keyframes. 0 means the encoder's default.
+	KeyframeInterval int `yaml:"keyframeInterval,omitempty" firestore:"keyframeInterval,omitempty"`
+
+	// OutputWidth and OutputHeight fix the video size (e.g. 1280x720).
+	// The game window is scaled into it keeping the aspect ratio with black borders.
+	// 0 means the video size follows the window size.
+	OutputWidth  int `yaml:"outputWidth,omitempty" firestore:"outputWidth,omitempty"`
+	OutputHeight int `yaml:"outputHeight,omitempty" firestore:"outputHeight,omitempty"`
+
+	// AudioBitrate is the bitrate of audio in kbps.
+	AudioBitrate int `yaml:"audioBitrate,omitempty" firestore:"audioBitrate,omitempty"`
+	// AudioChannels is 1 (mono) or 2 (stereo).
+	AudioChannels int `yaml:"audioChannels,omitempty" firestore:"audioChannels,omitempty"`
+}
+
+var DefaultEncodingProfile = EncodingProfile{
+	Framerate:        60,
+	MinFramerate:     30,
+	VideoBitrate:     2000,
+	MinVideoBitrate:  500,
+	MaxVideoBitrate:  8000,
+	Preset:           "ultrafast",
+	KeyframeInterval: 0,
+	AudioBitrate:     128,
+	AudioChannels:    2,
+}
+
+var x264Presets = []string{
+	"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow", "placebo",
+}
+
+// WithDefaults returns the profile whose zero values are filled with DefaultEncodingProfile.
+func (p EncodingProfile) WithDefaults() EncodingProfile {
+	d := DefaultEncodingProfile
+	if p.Framerate == 0 {
+		p.Framerate = d.Framerate
+	}
+	if p.MinFramerate == 0 {
+		p.MinFramerate = d.MinFramerate
+		if p.MinFramerate > p.Framerate {
+			p.MinFramerate = p.Framerate
+		}
+	}
+	if p.VideoBitrate == 0 {
+		p.VideoBitrate = d.VideoBitrate
+	}
+	if p.MinVideoBitrate == 0 {
+		p.MinVideoBitrate = d.MinVideoBitrate
+		if p.MinVideoBitrate > p.VideoBitrate {
+			p.MinVideoBitrate = p.VideoBitrate
+		}
+	}
+	if p.MaxVideoBitrate == 0 {
+		p.MaxVideoBitrate = d.MaxVideoBitrate
+		if p.MaxVideoBitrate < p.VideoBitrate {
+			p.MaxVideoBitrate = p.VideoBitrate
+		}
+	}
+	if p.Preset == "" {
+		p.Preset = d.Preset
+	}
+	if p.AudioBitrate == 0 {
+		p.AudioBitrate = d.AudioBitrate
+	}
+	if p.AudioChannels == 0 {
+		p.AudioChannels = d.AudioChannels
+	}
+	return p
+}
+
+// Validate checks the profile filled with defaults.
+func (p EncodingProfile) Validate() error {
+	if p.Framerate < 1 || p.Framerate > 120 {
+		return fmt.Errorf("framerate must be between 1 and 120 (got: %d)", p.Framerate)
+	}
+	if p.MinFramerate < 1 || p.MinFramerate > p.Framerate {
+		return fmt.Errorf("minFramerate must be between 1 and framerate (got: %d)", p.MinFramerate)
+	}
+	if p.MinVideoBitrate < 100 {
+		return fmt.Errorf("minVideoBitrate must be 100 kbps or more (got: %d)", p.MinVideoBitrate)
+	}
+	if p.MaxVideoBitrate > 50000 {
+		return fmt.Errorf("maxVideoBitrate must be 50000 kbps or less (got: %d)", p.MaxVideoBitrate)
+	}
+	if p.VideoBitrate < p.MinVideoBitrate || p.VideoBitrate > p.MaxVideoBitrate {
+		return fmt.Errorf("videoBitrate must be between minVideoBitrate and maxVideoBitrate (got: %d, min: %d, max: %d)",
+			p.VideoBitrate, p.MinVideoBitrate, p.MaxVideoBitrate)
+	}
+	if !isX264Preset(p.Preset) {
+		return fmt.Errorf("unknown preset: %s", p.Preset)
+	}
+	if p.KeyframeInterval < 0 {
+		return fmt.Errorf("keyframeInterval must not be negative (got: %d)", p.KeyframeInterval)
+	}
+	if p.OutputWidth != 0 || p.OutputHeight != 0 {
+		// H.264 requires even dimensions, and x264enc requires 16 pixels at least.
+		if p.OutputWidth < 16 || p.OutputHeight < 16 || p.OutputWidth > 4096 || p.OutputHeight > 4096 ||
+			p.OutputWidth%2 != 0 || p.OutputHeight%2 != 0 {
+			return fmt.Errorf("outputWidth and outputHeight must be even numbers between 16 and 4096 (got: %dx%d)", p.OutputWidth, p.OutputHeight)
+		}
+	}
+	// https://tools.ietf.org/html/rfc6716#section-2.1.1
+	if p.AudioBitrate < 6 || p.AudioBitrate > 510 {
+		return fmt.Errorf("audioBitrate must be between 6 and 510 kbps (got: %d)", p.AudioBitrate)
+	}
+	if p.AudioChannels != 1 && p.AudioChannels != 2 {
+		return fmt.Errorf("audioChannels must be 1 or 2 (got: %d)", p.AudioChannels)
+	}
+	return nil
+}
+
+func isX264Preset(preset string) bool {
+	for _, p := range x264Presets {
+		if p == preset {
+			return true
+		}
+	}
+	return false
+}
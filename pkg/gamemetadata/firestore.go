@@ -41,3 +41,22 @@ func (s *FirestoreStore) GetGameMetadata(ctx context.Context, gameID string) (*M
 	}
 	return &metadata, nil
 }
+
+func (s *FirestoreStore) UpdateThumbnail(ctx context.Context, gameID string, thumbnail string) error {
+	ds, err := s.c.Collection(s.collection).Where("gameId", "==", gameID).Documents(ctx).Next()
+	if err == iterator.Done {
+		return ErrMetadataNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !ds.Exists() {
+		return ErrMetadataNotFound
+	}
+	if _, err := ds.Ref.Update(ctx, []firestore.Update{
+		{Path: "thumbnail", Value: thumbnail},
+	}); err != nil {
+		return err
+	}
+	return nil
+}
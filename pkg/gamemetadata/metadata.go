@@ -1,6 +1,8 @@
 package gamemetadata
 
 import (
+	"encoding/base64"
+	"fmt"
 	"strings"
 
 	"github.com/goccy/go-yaml"
@@ -8,8 +10,24 @@ import (
 )
 
 type Metadata struct {
-	GameID  string `yaml:"gameId" firestore:"gameId"`
-	Command string `yaml:"command" firestore:"command"`
+	GameID   string           `yaml:"gameId" firestore:"gameId"`
+	Command  string           `yaml:"command" firestore:"command"`
+	Encoding *EncodingProfile `yaml:"encoding,omitempty" firestore:"encoding,omitempty"`
+	// Thumbnail is a screenshot of the game as a data URL (e.g. "data:image/jpeg;base64,...").
+	Thumbnail   string       `yaml:"thumbnail,omitempty" firestore:"thumbnail,omitempty"`
+	Permissions *Permissions `yaml:"permissions,omitempty" firestore:"permissions,omitempty"`
+}
+
+// Permissions are what players are allowed to do in addition to playing the game.
+// Nothing is permitted by default.
+type Permissions struct {
+	// Microphone allows players to send their microphone input to the game.
+	Microphone bool `yaml:"microphone,omitempty" firestore:"microphone,omitempty"`
+}
+
+// MicrophonePermitted reports whether players can send their microphone input to the game.
+func (md *Metadata) MicrophonePermitted() bool {
+	return md.Permissions != nil && md.Permissions.Microphone
 }
 
 func Marshal(md *Metadata) ([]byte, error) {
@@ -32,3 +50,21 @@ func (md *Metadata) ParseCommand() (cmd string, args []string, err error) {
 	}
 	return
 }
+
+// EncodingProfile returns the validated encoding profile of the game.
+func (md *Metadata) EncodingProfile() (EncodingProfile, error) {
+	var p EncodingProfile
+	if md.Encoding != nil {
+		p = *md.Encoding
+	}
+	p = p.WithDefaults()
+	if err := p.Validate(); err != nil {
+		return EncodingProfile{}, errors.Wrapf(err, "invalid encoding profile (gameID: %s)", md.GameID)
+	}
+	return p, nil
+}
+
+// ThumbnailDataURL returns a data URL of the image to save as a thumbnail.
+func ThumbnailDataURL(contentType string, image []byte) string {
+	return fmt.Sprintf("data:%s;base64,%s", contentType, base64.StdEncoding.EncodeToString(image))
+}
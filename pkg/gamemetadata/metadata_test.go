@@ -0,0 +1,76 @@
+package gamemetadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodingProfile(t *testing.T) {
+	var md Metadata
+	assert.NoError(t, Unmarshal([]byte(`
+gameId: microkiri
+command: wine /games/microkiri/microkiri.exe
+encoding:
+  framerate: 30
+  videoBitrate: 1000
+  maxVideoBitrate: 2000
+  audioChannels: 1
+  outputWidth: 1280
+  outputHeight: 720
+`), &md))
+	p, err := md.EncodingProfile()
+	assert.NoError(t, err)
+	assert.Equal(t, EncodingProfile{
+		Framerate:       30,
+		MinFramerate:    30,
+		VideoBitrate:    1000,
+		MinVideoBitrate: 500,
+		MaxVideoBitrate: 2000,
+		Preset:          "ultrafast",
+		AudioBitrate:    128,
+		AudioChannels:   1,
+		OutputWidth:     1280,
+		OutputHeight:    720,
+	}, p)
+
+	// no encoding section
+	md = Metadata{GameID: "notepad", Command: "wine notepad"}
+	p, err = md.EncodingProfile()
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultEncodingProfile, p)
+
+	invalids := []EncodingProfile{
+		{Framerate: 240},
+		{Framerate: 30, MinFramerate: 60},
+		{VideoBitrate: 10000, MaxVideoBitrate: 5000},
+		{MinVideoBitrate: 10},
+		{Preset: "turbo"},
+		{KeyframeInterval: -1},
+		{AudioBitrate: 1000},
+		{AudioChannels: 6},
+		{OutputWidth: 1280},
+		{OutputWidth: 1281, OutputHeight: 720},
+		{OutputWidth: 8, OutputHeight: 8},
+	}
+	for _, invalid := range invalids {
+		invalid := invalid
+		md := Metadata{GameID: "invalid", Encoding: &invalid}
+		_, err := md.EncodingProfile()
+		assert.Error(t, err, "%+v should be invalid", invalid)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	var md Metadata
+	assert.NoError(t, Unmarshal([]byte(`
+gameId: karaoke
+command: wine /games/karaoke/karaoke.exe
+permissions:
+  microphone: true
+`), &md))
+	assert.True(t, md.MicrophonePermitted())
+
+	md = Metadata{GameID: "notepad", Command: "wine notepad"}
+	assert.False(t, md.MicrophonePermitted())
+}
@@ -12,6 +12,7 @@ var (
 
 type Store interface {
 	GetGameMetadata(ctx context.Context, gameID string) (*Metadata, error)
+	UpdateThumbnail(ctx context.Context, gameID string, thumbnail string) error
 }
 
 type InMemoryStore struct {
@@ -41,3 +42,14 @@ func (s *InMemoryStore) GetGameMetadata(ctx context.Context, gameID string) (*Me
 	}
 	return m, nil
 }
+
+func (s *InMemoryStore) UpdateThumbnail(ctx context.Context, gameID string, thumbnail string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.metas[gameID]
+	if !ok {
+		return ErrMetadataNotFound
+	}
+	m.Thumbnail = thumbnail
+	return nil
+}
@@ -0,0 +1,157 @@
+package gameserver
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/castaneai/mashimaro/pkg/gamemetadata"
+	"github.com/castaneai/mashimaro/pkg/proto"
+	"github.com/castaneai/mashimaro/pkg/transport"
+)
+
+const (
+	// The encoder needs some time to settle after its bitrate changed.
+	bitrateUpdateInterval = 1 * time.Second
+
+	// Part of the estimated bandwidth is left for audio, RTP headers and retransmissions.
+	videoBandwidthRatio = 0.85
+
+	// Bitrate changes smaller than this ratio are ignored to avoid reconfiguring the encoder too often.
+	minBitrateChangeRatio = 0.1
+)
+
+type adaptiveBitrateConfig struct {
+	MinBitrateKbps     int
+	MaxBitrateKbps     int
+	InitialBitrateKbps int
+	MinFramerate       int
+	MaxFramerate       int
+}
+
+func newAdaptiveBitrateConfig(profile gamemetadata.EncodingProfile) adaptiveBitrateConfig {
+	return adaptiveBitrateConfig{
+		MinBitrateKbps:     profile.MinVideoBitrate,
+		MaxBitrateKbps:     profile.MaxVideoBitrate,
+		InitialBitrateKbps: profile.VideoBitrate,
+		MinFramerate:       profile.MinFramerate,
+		MaxFramerate:       profile.Framerate,
+	}
+}
+
+type encodingParams struct {
+	BitrateKbps int
+	Framerate   int
+}
+
+// bitrateController decides video encoding params from the estimated bandwidth to the player.
+// The framerate is lowered when the bitrate gets close to the minimum,
+// so that each frame keeps enough bits to be legible.
+type bitrateController struct {
+	config  adaptiveBitrateConfig
+	current encodingParams
+	mu      sync.Mutex
+}
+
+func newBitrateController(config adaptiveBitrateConfig) *bitrateController {
+	return &bitrateController{
+		config: config,
+		current: encodingParams{
+			BitrateKbps: clampInt(config.InitialBitrateKbps, config.MinBitrateKbps, config.MaxBitrateKbps),
+			Framerate:   config.MaxFramerate,
+		},
+	}
+}
+
+// Current returns the params that a newly started video pipeline should use.
+func (c *bitrateController) Current() encodingParams {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current
+}
+
+// Update applies the estimate and returns the new params and whether they have changed enough to reconfigure the encoder.
+func (c *bitrateController) Update(estimate transport.BandwidthEstimate) (encodingParams, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bitrateKbps := clampInt(int(float64(estimate.Bitrate)*videoBandwidthRatio/1000), c.config.MinBitrateKbps, c.config.MaxBitrateKbps)
+	next := encodingParams{
+		BitrateKbps: bitrateKbps,
+		Framerate:   c.framerateForBitrateLocked(bitrateKbps),
+	}
+
+	bitrateDiff := float64(next.BitrateKbps - c.current.BitrateKbps)
+	if bitrateDiff < 0 {
+		bitrateDiff = -bitrateDiff
+	}
+	bitrateChanged := bitrateDiff >= float64(c.current.BitrateKbps)*minBitrateChangeRatio ||
+		// always reach the bounds, even when it is a small change
+		(next.BitrateKbps != c.current.BitrateKbps && (next.BitrateKbps == c.config.MinBitrateKbps || next.BitrateKbps == c.config.MaxBitrateKbps))
+	if !bitrateChanged && next.Framerate == c.current.Framerate {
+		return c.current, false
+	}
+	if !bitrateChanged {
+		next.BitrateKbps = c.current.BitrateKbps
+	}
+	c.current = next
+	return next, true
+}
+
+// framerateForBitrateLocked switches between the min and the max framerate with hysteresis to avoid flapping.
+func (c *bitrateController) framerateForBitrateLocked(bitrateKbps int) int {
+	bitrateRange := c.config.MaxBitrateKbps - c.config.MinBitrateKbps
+	lowThreshold := c.config.MinBitrateKbps + bitrateRange/4
+	highThreshold := c.config.MinBitrateKbps + bitrateRange/3
+	switch {
+	case bitrateKbps < lowThreshold:
+		return c.config.MinFramerate
+	case bitrateKbps > highThreshold:
+		return c.config.MaxFramerate
+	default:
+		return c.current.Framerate
+	}
+}
+
+// startAdaptingBitrate applies the latest bandwidth estimate to the video encoder at most once per interval.
+func (s *GameServer) startAdaptingBitrate(ctx context.Context, controller *bitrateController, estimated <-chan transport.BandwidthEstimate, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var latest *transport.BandwidthEstimate
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case estimate := <-estimated:
+			latest = &estimate
+		case <-ticker.C:
+			if latest == nil {
+				continue
+			}
+			params, changed := controller.Update(*latest)
+			latest = nil
+			if !changed {
+				continue
+			}
+			if _, err := s.encoder.UpdateEncodingParams(ctx, &proto.UpdateEncodingParamsRequest{
+				PipelineId:  videoPipelineID,
+				BitrateKbps: uint32(params.BitrateKbps),
+				Framerate:   uint32(params.Framerate),
+			}); err != nil {
+				log.Printf("failed to update encoding params: %+v", err)
+				continue
+			}
+			log.Printf("encoding params updated (bitrate: %d kbps, framerate: %d)", params.BitrateKbps, params.Framerate)
+		}
+	}
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
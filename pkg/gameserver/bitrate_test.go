@@ -0,0 +1,58 @@
+package gameserver
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/castaneai/mashimaro/pkg/transport"
+)
+
+func estimateKbps(kbps int) transport.BandwidthEstimate {
+	// cancel videoBandwidthRatio to make the expected bitrate readable
+	return transport.BandwidthEstimate{Bitrate: int(math.Ceil(float64(kbps*1000) / videoBandwidthRatio))}
+}
+
+func TestBitrateController(t *testing.T) {
+	c := newBitrateController(adaptiveBitrateConfig{
+		MinBitrateKbps:     1000,
+		MaxBitrateKbps:     5000,
+		InitialBitrateKbps: 3000,
+		MinFramerate:       30,
+		MaxFramerate:       60,
+	})
+	assert.Equal(t, encodingParams{BitrateKbps: 3000, Framerate: 60}, c.Current())
+
+	// small changes are ignored
+	_, changed := c.Update(estimateKbps(3100))
+	assert.False(t, changed)
+
+	params, changed := c.Update(estimateKbps(4000))
+	assert.True(t, changed)
+	assert.Equal(t, encodingParams{BitrateKbps: 4000, Framerate: 60}, params)
+
+	// bounded by the max bitrate
+	params, changed = c.Update(estimateKbps(100000))
+	assert.True(t, changed)
+	assert.Equal(t, encodingParams{BitrateKbps: 5000, Framerate: 60}, params)
+
+	// low bitrate lowers the framerate
+	params, changed = c.Update(estimateKbps(1500))
+	assert.True(t, changed)
+	assert.Equal(t, encodingParams{BitrateKbps: 1500, Framerate: 30}, params)
+
+	// the framerate does not go back until the bitrate recovers enough (hysteresis)
+	params, changed = c.Update(estimateKbps(2200))
+	assert.True(t, changed)
+	assert.Equal(t, encodingParams{BitrateKbps: 2200, Framerate: 30}, params)
+	params, changed = c.Update(estimateKbps(2500))
+	assert.True(t, changed)
+	assert.Equal(t, encodingParams{BitrateKbps: 2500, Framerate: 60}, params)
+
+	// bounded by the min bitrate
+	params, changed = c.Update(estimateKbps(10))
+	assert.True(t, changed)
+	assert.Equal(t, encodingParams{BitrateKbps: 1000, Framerate: 30}, params)
+	assert.Equal(t, params, c.Current())
+}
@@ -0,0 +1,88 @@
+package gameserver
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/castaneai/mashimaro/pkg/gamesession"
+	"github.com/castaneai/mashimaro/pkg/proto"
+	"github.com/castaneai/mashimaro/pkg/transport"
+)
+
+const (
+	// the broker saves the stats in the session, which is not worth updating as often as the player is notified
+	connStatsReportInterval = 10 * time.Second
+)
+
+// summarizeConnStats summarizes the stats for the player.
+// The frames are of the video stream sending the most frames (i.e. the main video).
+func summarizeConnStats(stats transport.ConnStats) *ConnectionStatsMessage {
+	msg := &ConnectionStatsMessage{
+		RoundTripTimeMs: durationMs(stats.RoundTripTime),
+		PacketLoss:      stats.PacketLoss(),
+		Bitrate:         int64(stats.SendBitrate),
+		CandidateType:   stats.LocalCandidateType,
+	}
+	for _, stream := range stats.Streams {
+		if jitter := durationMs(stream.Jitter); jitter > msg.JitterMs {
+			msg.JitterMs = jitter
+		}
+		msg.NACKCount += stream.NACKCount
+		msg.PLICount += stream.PLICount
+		if stream.Kind == transport.TrackKindVideo && stream.FramesSent > msg.FramesSent {
+			msg.FramesSent = stream.FramesSent
+			msg.Framerate = stream.Framerate
+		}
+	}
+	return msg
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// startReportingConnStats sends the summary of every snapshot of the connection stats to the player,
+// and reports it to the broker at connStatsReportInterval, until the context is done or the connection is disconnected.
+func (s *GameServer) startReportingConnStats(ctx context.Context, sessionID gamesession.SessionID, conn transport.StreamerConn) {
+	var lastReported time.Time
+	for stats := range conn.SubscribeStats(ctx) {
+		summary := summarizeConnStats(stats)
+		if err := sendConnStats(ctx, conn, summary); err != nil {
+			log.Printf("failed to send connection stats: %+v", err)
+		}
+		if stats.Timestamp.Sub(lastReported) < connStatsReportInterval {
+			continue
+		}
+		lastReported = stats.Timestamp
+		if _, err := s.broker.ReportConnectionStats(ctx, &proto.ReportConnectionStatsRequest{
+			SessionId: string(sessionID),
+			Stats: &proto.ConnectionStats{
+				RoundTripTimeMs: summary.RoundTripTimeMs,
+				JitterMs:        summary.JitterMs,
+				PacketLoss:      summary.PacketLoss,
+				Bitrate:         summary.Bitrate,
+				Framerate:       summary.Framerate,
+				FramesSent:      summary.FramesSent,
+				NackCount:       summary.NACKCount,
+				PliCount:        summary.PLICount,
+				CandidateType:   summary.CandidateType,
+			},
+		}); err != nil {
+			log.Printf("failed to report connection stats: %+v", err)
+		}
+	}
+}
+
+func sendConnStats(ctx context.Context, conn transport.Conn, summary *ConnectionStatsMessage) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(&Message{Type: MessageTypeConnectionStats, Body: body})
+	if err != nil {
+		return err
+	}
+	return conn.SendMessage(ctx, msg)
+}
@@ -0,0 +1,89 @@
+package gameserver
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/castaneai/mashimaro/pkg/gamemetadata"
+	"github.com/castaneai/mashimaro/pkg/gamesession"
+	"github.com/castaneai/mashimaro/pkg/transport"
+)
+
+func TestSummarizeConnStats(t *testing.T) {
+	summary := summarizeConnStats(transport.ConnStats{
+		LocalCandidateType: "relay",
+		RoundTripTime:      30 * time.Millisecond,
+		SendBitrate:        2500000,
+		Streams: []transport.RTPStreamStats{
+			{Kind: transport.TrackKindVideo, FramesSent: 600, Framerate: 30, FractionLost: 0.02, Jitter: 5 * time.Millisecond, NACKCount: 3, PLICount: 1},
+			{Kind: transport.TrackKindVideo, FramesSent: 300, Framerate: 15, NACKCount: 1},
+			{Kind: transport.TrackKindAudio, FractionLost: 0.1, Jitter: 12 * time.Millisecond},
+		},
+	})
+	assert.Equal(t, &ConnectionStatsMessage{
+		RoundTripTimeMs: 30,
+		JitterMs:        12,
+		PacketLoss:      0.1,
+		Bitrate:         2500000,
+		Framerate:       30,
+		FramesSent:      600,
+		NACKCount:       4,
+		PLICount:        1,
+		CandidateType:   "relay",
+	}, summary)
+}
+
+type statsStreamerConn struct {
+	transport.StreamerConn
+	stats    chan transport.ConnStats
+	messages [][]byte
+	mu       sync.Mutex
+}
+
+func (c *statsStreamerConn) SubscribeStats(ctx context.Context) <-chan transport.ConnStats {
+	return c.stats
+}
+
+func (c *statsStreamerConn) SendMessage(ctx context.Context, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, data)
+	return nil
+}
+
+func TestReportingConnStats(t *testing.T) {
+	ctx := context.Background()
+	sstore := gamesession.NewInMemoryStore()
+	ss, err := sstore.NewSession(ctx, &gamesession.NewSessionRequest{GameID: "test-game", AllocatedServerID: "dummy"})
+	assert.NoError(t, err)
+	s := &GameServer{broker: newTestInternalBrokerClient(t, sstore, gamemetadata.NewInMemoryStore())}
+	conn := &statsStreamerConn{stats: make(chan transport.ConnStats, 3)}
+
+	now := time.Now()
+	conn.stats <- transport.ConnStats{Timestamp: now, SendBitrate: 1000000, LocalCandidateType: "host"}
+	// reported to the player only
+	conn.stats <- transport.ConnStats{Timestamp: now.Add(2 * time.Second), SendBitrate: 2000000, LocalCandidateType: "host"}
+	conn.stats <- transport.ConnStats{Timestamp: now.Add(connStatsReportInterval), SendBitrate: 3000000, LocalCandidateType: "host"}
+	close(conn.stats)
+	s.startReportingConnStats(ctx, ss.SessionID, conn)
+
+	assert.Len(t, conn.messages, 3)
+	var msg Message
+	assert.NoError(t, json.Unmarshal(conn.messages[1], &msg))
+	assert.Equal(t, MessageTypeConnectionStats, msg.Type)
+	var summary ConnectionStatsMessage
+	assert.NoError(t, json.Unmarshal(msg.Body, &summary))
+	assert.Equal(t, 2000000, summary.Bitrate)
+
+	reported, err := sstore.GetSession(ctx, ss.SessionID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, reported.ConnectionStats) {
+		assert.Equal(t, int64(3000000), reported.ConnectionStats.Bitrate)
+		assert.Equal(t, "host", reported.ConnectionStats.CandidateType)
+	}
+}
@@ -8,38 +8,35 @@ import (
 
 	"github.com/pkg/errors"
 
-	"github.com/BurntSushi/xgbutil"
-	"github.com/castaneai/mashimaro/pkg/x11"
-
 	"github.com/BurntSushi/xgb/xproto"
+	"github.com/castaneai/mashimaro/pkg/gamemetadata"
 	"github.com/castaneai/mashimaro/pkg/proto"
+	"github.com/castaneai/mashimaro/pkg/transport"
 )
 
 var (
 	errGameExited = errors.New("game exited")
 )
 
-func (s *GameServer) startController(ctx context.Context, message <-chan []byte, captureRectChanged <-chan ScreenRect) error {
+func (s *GameServer) startController(ctx context.Context, conn transport.Conn, profile gamemetadata.EncodingProfile, message <-chan []byte, captureRectChanged <-chan ScreenRect, recordingRequested chan bool) error {
 	log.Printf("initialing x11 connection")
-	xu, err := xgbutil.NewConn()
-	if err != nil {
-		return errors.Wrap(err, "failed to connect to X11")
-	}
-	xi, err := x11.NewInputter(xu)
+	display, err := s.opts.openDisplay()
 	if err != nil {
-		return errors.Wrap(err, "failed to new X11 inputter")
+		return err
 	}
+	defer display.Close()
 	log.Printf("start messaging")
-	var captureRect *ScreenRect
+	// maps mouse positions on the video to the screen
+	var transform *videoTransform
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case rect := <-captureRectChanged:
 			log.Printf("capture rect has changed: %s", &rect)
-			captureRect = &rect
+			transform = newVideoTransform(rect, profile.OutputWidth, profile.OutputHeight)
 		case msg := <-message:
-			if err := s.handleControllerMessage(ctx, msg, captureRect, xu, xi); err != nil {
+			if err := s.handleControllerMessage(ctx, conn, msg, transform, display, recordingRequested); err != nil {
 				if err == errGameExited {
 					return err
 				}
@@ -49,57 +46,75 @@ func (s *GameServer) startController(ctx context.Context, message <-chan []byte,
 	}
 }
 
-func (s *GameServer) handleControllerMessage(ctx context.Context, data []byte, captureRect *ScreenRect, xu *xgbutil.XUtil, xinput *x11.Inputter) error {
+func (s *GameServer) handleControllerMessage(ctx context.Context, conn transport.Conn, data []byte, transform *videoTransform, display Display, recordingRequested chan bool) error {
 	var msg Message
 	if err := json.Unmarshal(data, &msg); err != nil {
 		return err
 	}
 	switch msg.Type {
 	case MessageTypeMove:
-		if captureRect == nil {
+		if transform == nil {
 			return nil
 		}
 		var body MoveMessage
 		if err := json.Unmarshal(msg.Body, &body); err != nil {
 			return err
 		}
-		x := captureRect.StartX + body.X
-		y := captureRect.StartY + body.Y
-		xinput.Move(x, y)
+		display.Move(transform.ToScreen(body.X, body.Y))
 		return nil
 	case MessageTypeMouseDown:
 		var body MouseDownMessage
 		if err := json.Unmarshal(msg.Body, &body); err != nil {
 			return err
 		}
-		xinput.SendButton(xu.RootWin(), xproto.Button(body.Button), true)
+		display.SendButton(xproto.Button(body.Button), true)
 		return nil
 	case MessageTypeMouseUp:
 		var body MouseUpMessage
 		if err := json.Unmarshal(msg.Body, &body); err != nil {
 			return err
 		}
-		xinput.SendButton(xu.RootWin(), xproto.Button(body.Button), false)
+		display.SendButton(xproto.Button(body.Button), false)
 		return nil
 	case MessageTypeKeyDown:
 		var body KeyDownMessage
 		if err := json.Unmarshal(msg.Body, &body); err != nil {
 			return err
 		}
-		xinput.SendKey(xu.RootWin(), xproto.Keycode(body.Key), true)
+		display.SendKey(xproto.Keycode(body.Key), true)
 		return nil
 	case MessageTypeKeyUp:
 		var body KeyUpMessage
 		if err := json.Unmarshal(msg.Body, &body); err != nil {
 			return err
 		}
-		xinput.SendKey(xu.RootWin(), xproto.Keycode(body.Key), false)
+		display.SendKey(xproto.Keycode(body.Key), false)
 		return nil
 	case MessageTypeExitGame:
 		if _, err := s.gameProcess.ExitGame(ctx, &proto.ExitGameRequest{}); err != nil {
 			return err
 		}
 		return errGameExited
+	case MessageTypeStartRecording:
+		requestRecording(recordingRequested, true)
+		return nil
+	case MessageTypeStopRecording:
+		requestRecording(recordingRequested, false)
+		return nil
+	case MessageTypeScreenshot:
+		var body ScreenshotMessage
+		if len(msg.Body) > 0 {
+			if err := json.Unmarshal(msg.Body, &body); err != nil {
+				return err
+			}
+		}
+		// capturing and encoding take time, so inputs are not blocked
+		go func() {
+			if err := s.sendScreenshot(ctx, conn, &body); err != nil {
+				log.Printf("failed to send screenshot: %+v", err)
+			}
+		}()
+		return nil
 	default:
 		return fmt.Errorf("unknown message type: %s", msg.Type)
 	}
@@ -0,0 +1,91 @@
+package gameserver
+
+import (
+	"image"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/pkg/errors"
+
+	"github.com/castaneai/mashimaro/pkg/x11"
+)
+
+// Display is the screen and the input devices of the X server where the game runs.
+// The game server opens a display for each of watching the game window, input and screenshots.
+type Display interface {
+	// MainWindowRect returns the rect of the main window of the game on the screen, or errNoWindows if there are no windows yet.
+	MainWindowRect() (*ScreenRect, error)
+	CaptureScreen(rect *ScreenRect) (*image.RGBA, error)
+	Move(x, y int)
+	SendButton(button xproto.Button, isPress bool)
+	SendKey(keycode xproto.Keycode, isPress bool)
+	Close() error
+}
+
+type x11Display struct {
+	xu    *xgbutil.XUtil
+	input *x11.Inputter
+}
+
+// openX11Display connects to the X server of $DISPLAY.
+func openX11Display() (Display, error) {
+	xu, err := xgbutil.NewConn()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to X11")
+	}
+	xi, err := x11.NewInputter(xu)
+	if err != nil {
+		xu.Conn().Close()
+		return nil, errors.Wrap(err, "failed to new X11 inputter")
+	}
+	return &x11Display{xu: xu, input: xi}, nil
+}
+
+func (d *x11Display) MainWindowRect() (*ScreenRect, error) {
+	windows, err := x11.EnumWindows(d.xu, d.xu.RootWin(), true)
+	if err != nil {
+		return nil, err
+	}
+	if len(windows) == 0 {
+		return nil, errNoWindows
+	}
+	mainWindow, err := x11.GetMainWindow(d.xu, windows)
+	if err != nil {
+		return nil, err
+	}
+	x, y, err := x11.GetWindowPositionOnScreen(d.xu, d.xu.Screen(), mainWindow)
+	if err != nil {
+		return nil, err
+	}
+	width, height, err := x11.GetWindowSize(d.xu, mainWindow)
+	if err != nil {
+		return nil, err
+	}
+	return &ScreenRect{
+		StartX: x,
+		StartY: y,
+		EndX:   x + width,
+		EndY:   y + height,
+	}, nil
+}
+
+func (d *x11Display) CaptureScreen(rect *ScreenRect) (*image.RGBA, error) {
+	return x11.CaptureScreen(d.xu, rect.StartX, rect.StartY, rect.Width(), rect.Height())
+}
+
+func (d *x11Display) Move(x, y int) {
+	d.input.Move(x, y)
+}
+
+func (d *x11Display) SendButton(button xproto.Button, isPress bool) {
+	d.input.SendButton(d.xu.RootWin(), button, isPress)
+}
+
+func (d *x11Display) SendKey(keycode xproto.Keycode, isPress bool) {
+	d.input.SendKey(d.xu.RootWin(), keycode, isPress)
+}
+
+func (d *x11Display) Close() error {
+	d.xu.Conn().Close()
+	return nil
+}
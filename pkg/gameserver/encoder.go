@@ -3,42 +3,78 @@ package gameserver
 import (
 	"fmt"
 	"math"
+
+	"github.com/castaneai/mashimaro/pkg/encoder/encoderproto"
+	"github.com/castaneai/mashimaro/pkg/gstpipeline"
 )
 
 type GstPipeliner interface {
-	CompileGstPipeline() (string, error)
+	GstPipeline() (*gstpipeline.Pipeline, error)
+}
+
+// CompileGstPipeline returns the pipeline description for the encoder service.
+func CompileGstPipeline(p GstPipeliner) (string, error) {
+	pipeline, err := p.GstPipeline()
+	if err != nil {
+		return "", err
+	}
+	return pipeline.Compile()
 }
 
 type X11ScreenCapturer struct {
-	display    string
-	screenRect *ScreenRect
+	display      string
+	screenRect   *ScreenRect
+	framerate    int
+	outputWidth  int
+	outputHeight int
 }
 
-func NewX11ScreenCapturer(captureDisplay string, screenRect *ScreenRect) *X11ScreenCapturer {
-	return &X11ScreenCapturer{display: captureDisplay, screenRect: screenRect}
+func NewX11ScreenCapturer(captureDisplay string, screenRect *ScreenRect, framerate int) *X11ScreenCapturer {
+	return &X11ScreenCapturer{display: captureDisplay, screenRect: screenRect, framerate: framerate}
 }
 
-func (c *X11ScreenCapturer) CompileGstPipeline() (string, error) {
-	c.screenRect.FixForH264()
-	startX := c.screenRect.StartX
-	if startX < 0 {
-		startX = 0
-	}
-	startY := c.screenRect.StartY
-	if startY < 0 {
-		startY = 0
-	}
-	endX := c.screenRect.EndX - 1
-	if endX < 0 {
-		endX = 0
-	}
-	endY := c.screenRect.EndY - 1
-	if endY < 0 {
-		endY = 0
-	}
-	// why use-damage=0?: https://github.com/GoogleCloudPlatform/selkies-vdi/blob/0da21b7c9432bd5c99f1f9f7c541ac9c583f9ef4/images/gst-webrtc-app/gstwebrtc_app.py#L148
-	return fmt.Sprintf("ximagesrc display-name=%s remote=1 use-damage=0 startx=%d starty=%d endx=%d endy=%d ! video/x-raw,framerate=60/1",
-		c.display, startX, startY, endX, endY), nil
+// WithOutputSize scales the screen rect into the fixed size with black borders.
+func (c *X11ScreenCapturer) WithOutputSize(width, height int) *X11ScreenCapturer {
+	c.outputWidth = width
+	c.outputHeight = height
+	return c
+}
+
+// GstPipeline captures the whole screen and crops the screen rect from it,
+// so that the rect can be changed by UpdateVideoGeometry while playing.
+func (c *X11ScreenCapturer) GstPipeline() (*gstpipeline.Pipeline, error) {
+	rect := c.screenRect.clamped()
+	outputWidth, outputHeight := newVideoTransform(rect, c.outputWidth, c.outputHeight).OutputSize()
+	return gstpipeline.New(
+		gstpipeline.NewElement("ximagesrc",
+			gstpipeline.Prop("display-name", c.display),
+			gstpipeline.Prop("remote", true),
+			// why use-damage=0?: https://github.com/GoogleCloudPlatform/selkies-vdi/blob/0da21b7c9432bd5c99f1f9f7c541ac9c583f9ef4/images/gst-webrtc-app/gstwebrtc_app.py#L148
+			gstpipeline.Prop("use-damage", false),
+		),
+		// the framerate filter is named to change the framerate while playing
+		gstpipeline.CapsFilter(gstpipeline.NewCaps("video/x-raw",
+			gstpipeline.Prop("framerate", gstpipeline.Fraction{Numerator: c.framerate, Denominator: 1}),
+		)).WithName(encoderproto.FramerateFilterName),
+		// right and bottom are cropped automatically to match the size of the cropsize filter
+		gstpipeline.NewElement("videocrop",
+			gstpipeline.Prop("left", rect.StartX),
+			gstpipeline.Prop("top", rect.StartY),
+			gstpipeline.Prop("right", -1),
+			gstpipeline.Prop("bottom", -1),
+		).WithName(encoderproto.CropElementName),
+		gstpipeline.CapsFilter(gstpipeline.NewCaps("video/x-raw",
+			gstpipeline.Prop("width", rect.Width()),
+			gstpipeline.Prop("height", rect.Height()),
+		)).WithName(encoderproto.CropSizeFilterName),
+		gstpipeline.NewElement("videoscale", gstpipeline.Prop("add-borders", true)),
+		// the square pixels make videoscale add borders instead of stretching
+		gstpipeline.CapsFilter(gstpipeline.NewCaps("video/x-raw",
+			gstpipeline.Prop("width", outputWidth),
+			gstpipeline.Prop("height", outputHeight),
+			gstpipeline.Prop("pixel-aspect-ratio", gstpipeline.Fraction{Numerator: 1, Denominator: 1}),
+		)).WithName(encoderproto.OutputSizeFilterName),
+	), nil
 }
 
 type ScreenRect struct {
@@ -65,6 +101,19 @@ func (a *ScreenRect) IsValid() bool {
 		a.Width() >= 16 && a.Height() >= 16 // x264enc's min width/height is 16 https://gstreamer.freedesktop.org/documentation/x264/index.html?gi-language=c#sink
 }
 
+// clamped returns the rect inside the screen with even dimensions.
+func (a *ScreenRect) clamped() ScreenRect {
+	rect := *a
+	if rect.StartX < 0 {
+		rect.StartX = 0
+	}
+	if rect.StartY < 0 {
+		rect.StartY = 0
+	}
+	rect.FixForH264()
+	return rect
+}
+
 func (a *ScreenRect) FixForH264() {
 	// H264 requirement is that video dimensions are divisible by 2.
 	// ref: https://github.com/hzbd/kazam/blob/491869ac29860a19254fa8c226f75314a7eee83d/kazam/backend/gstreamer.py#L128
@@ -83,51 +132,207 @@ func (a *ScreenRect) FixForH264() {
 }
 
 type X264Encoder struct {
-	srcPipeline  GstPipeliner
-	encodeParams string
+	srcPipeline GstPipeliner
+	props       []gstpipeline.Property
 }
 
-func NewX264Encoder(srcPipeline GstPipeliner, encodeParams string) *X264Encoder {
-	return &X264Encoder{srcPipeline: srcPipeline, encodeParams: encodeParams}
+func NewX264Encoder(srcPipeline GstPipeliner, props []gstpipeline.Property) *X264Encoder {
+	return &X264Encoder{srcPipeline: srcPipeline, props: props}
 }
 
-func (e *X264Encoder) CompileGstPipeline() (string, error) {
-	src, err := e.srcPipeline.CompileGstPipeline()
+func (e *X264Encoder) GstPipeline() (*gstpipeline.Pipeline, error) {
+	src, err := e.srcPipeline.GstPipeline()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return src.Link(
+		gstpipeline.NewElement("videoconvert"),
+		gstpipeline.NewCaps("video/x-raw", gstpipeline.Prop("format", "I420")),
+		gstpipeline.NewElement("x264enc", e.props...).WithName(encoderproto.EncoderElementName),
+	), nil
+}
+
+type VAAPIH264Encoder struct {
+	srcPipeline GstPipeliner
+	props       []gstpipeline.Property
+}
+
+func NewVAAPIH264Encoder(srcPipeline GstPipeliner, props []gstpipeline.Property) *VAAPIH264Encoder {
+	return &VAAPIH264Encoder{srcPipeline: srcPipeline, props: props}
+}
+
+func (e *VAAPIH264Encoder) GstPipeline() (*gstpipeline.Pipeline, error) {
+	src, err := e.srcPipeline.GstPipeline()
+	if err != nil {
+		return nil, err
+	}
+	return src.Link(
+		gstpipeline.NewElement("videoconvert"),
+		gstpipeline.NewCaps("video/x-raw", gstpipeline.Prop("format", "NV12")),
+		gstpipeline.NewElement("vaapih264enc", e.props...).WithName(encoderproto.EncoderElementName),
+		gstpipeline.NewCaps("video/x-h264", gstpipeline.Prop("stream-format", "byte-stream")),
+	), nil
+}
+
+type NVH264Encoder struct {
+	srcPipeline GstPipeliner
+	props       []gstpipeline.Property
+}
+
+func NewNVH264Encoder(srcPipeline GstPipeliner, props []gstpipeline.Property) *NVH264Encoder {
+	return &NVH264Encoder{srcPipeline: srcPipeline, props: props}
+}
+
+func (e *NVH264Encoder) GstPipeline() (*gstpipeline.Pipeline, error) {
+	src, err := e.srcPipeline.GstPipeline()
+	if err != nil {
+		return nil, err
+	}
+	return src.Link(
+		gstpipeline.NewElement("videoconvert"),
+		gstpipeline.NewCaps("video/x-raw", gstpipeline.Prop("format", "NV12")),
+		gstpipeline.NewElement("nvh264enc", e.props...).WithName(encoderproto.EncoderElementName),
+		gstpipeline.NewCaps("video/x-h264", gstpipeline.Prop("stream-format", "byte-stream")),
+	), nil
+}
+
+type OpenH264Encoder struct {
+	srcPipeline GstPipeliner
+	props       []gstpipeline.Property
+}
+
+func NewOpenH264Encoder(srcPipeline GstPipeliner, props []gstpipeline.Property) *OpenH264Encoder {
+	return &OpenH264Encoder{srcPipeline: srcPipeline, props: props}
+}
+
+func (e *OpenH264Encoder) GstPipeline() (*gstpipeline.Pipeline, error) {
+	src, err := e.srcPipeline.GstPipeline()
+	if err != nil {
+		return nil, err
 	}
-	return fmt.Sprintf("%s ! videoconvert ! video/x-raw,format=I420 ! x264enc %s", src, e.encodeParams), nil
+	return src.Link(
+		gstpipeline.NewElement("videoconvert"),
+		gstpipeline.NewCaps("video/x-raw", gstpipeline.Prop("format", "I420")),
+		gstpipeline.NewElement("openh264enc", e.props...).WithName(encoderproto.EncoderElementName),
+		gstpipeline.NewCaps("video/x-h264", gstpipeline.Prop("stream-format", "byte-stream")),
+	), nil
 }
 
+type VP8Encoder struct {
+	srcPipeline GstPipeliner
+	props       []gstpipeline.Property
+}
+
+func NewVP8Encoder(srcPipeline GstPipeliner, props []gstpipeline.Property) *VP8Encoder {
+	return &VP8Encoder{srcPipeline: srcPipeline, props: props}
+}
+
+func (e *VP8Encoder) GstPipeline() (*gstpipeline.Pipeline, error) {
+	src, err := e.srcPipeline.GstPipeline()
+	if err != nil {
+		return nil, err
+	}
+	return src.Link(
+		gstpipeline.NewElement("videoconvert"),
+		gstpipeline.NewCaps("video/x-raw", gstpipeline.Prop("format", "I420")),
+		gstpipeline.NewElement("vp8enc", e.props...).WithName(encoderproto.EncoderElementName),
+	), nil
+}
+
+type VP9Encoder struct {
+	srcPipeline GstPipeliner
+	props       []gstpipeline.Property
+}
+
+func NewVP9Encoder(srcPipeline GstPipeliner, props []gstpipeline.Property) *VP9Encoder {
+	return &VP9Encoder{srcPipeline: srcPipeline, props: props}
+}
+
+func (e *VP9Encoder) GstPipeline() (*gstpipeline.Pipeline, error) {
+	src, err := e.srcPipeline.GstPipeline()
+	if err != nil {
+		return nil, err
+	}
+	return src.Link(
+		gstpipeline.NewElement("videoconvert"),
+		gstpipeline.NewCaps("video/x-raw", gstpipeline.Prop("format", "I420")),
+		gstpipeline.NewElement("vp9enc", e.props...).WithName(encoderproto.EncoderElementName),
+	), nil
+}
+
+type AV1Encoder struct {
+	srcPipeline GstPipeliner
+	props       []gstpipeline.Property
+}
+
+func NewAV1Encoder(srcPipeline GstPipeliner, props []gstpipeline.Property) *AV1Encoder {
+	return &AV1Encoder{srcPipeline: srcPipeline, props: props}
+}
+
+func (e *AV1Encoder) GstPipeline() (*gstpipeline.Pipeline, error) {
+	src, err := e.srcPipeline.GstPipeline()
+	if err != nil {
+		return nil, err
+	}
+	return src.Link(
+		gstpipeline.NewElement("videoconvert"),
+		gstpipeline.NewCaps("video/x-raw", gstpipeline.Prop("format", "I420")),
+		gstpipeline.NewElement("av1enc", e.props...).WithName(encoderproto.EncoderElementName),
+		// a temporal unit in a sample for RTP
+		gstpipeline.NewCaps("video/x-av1", gstpipeline.Prop("stream-format", "obu-stream"), gstpipeline.Prop("alignment", "tu")),
+	), nil
+}
+
+// the monitor of the sink the game plays into (see services/gameserver/pulseaudio/default.pa)
+// The default source is the microphone input, so the device must be explicit.
+const gameAudioSourceName = "game.monitor"
+
 type PulseAudioCapturer struct {
 	PulseServer string
+	Device      string
 }
 
 func NewPulseAudioCapturer(pulseServer string) *PulseAudioCapturer {
 	return &PulseAudioCapturer{
 		PulseServer: pulseServer,
+		Device:      gameAudioSourceName,
 	}
 }
 
-func (c *PulseAudioCapturer) CompileGstPipeline() (string, error) {
-	// TODO: `provide-clock=1` causes stuttering, but the reason is still unknown to me. For now, I set it to 0 and it works fine.
-	return fmt.Sprintf("pulsesrc server=%s provide-clock=0", c.PulseServer), nil
+func (c *PulseAudioCapturer) GstPipeline() (*gstpipeline.Pipeline, error) {
+	return gstpipeline.New(
+		gstpipeline.NewElement("pulsesrc",
+			gstpipeline.Prop("server", c.PulseServer),
+			gstpipeline.Prop("device", c.Device),
+			// the encoder service runs every pipeline on the shared system clock to synchronize audio and video,
+			// so the clock of pulsesrc would never be used.
+			gstpipeline.Prop("provide-clock", false),
+		),
+	), nil
 }
 
 type OpusEncoder struct {
 	srcPipeline GstPipeliner
+	channels    int
+	props       []gstpipeline.Property
 }
 
-func NewOpusEncoder(srcPipeline GstPipeliner) *OpusEncoder {
+func NewOpusEncoder(srcPipeline GstPipeliner, channels int, props []gstpipeline.Property) *OpusEncoder {
 	return &OpusEncoder{
 		srcPipeline: srcPipeline,
+		channels:    channels,
+		props:       props,
 	}
 }
 
-func (e *OpusEncoder) CompileGstPipeline() (string, error) {
-	src, err := e.srcPipeline.CompileGstPipeline()
+func (e *OpusEncoder) GstPipeline() (*gstpipeline.Pipeline, error) {
+	src, err := e.srcPipeline.GstPipeline()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return fmt.Sprintf("%s ! opusenc", src), nil
+	return src.Link(
+		gstpipeline.NewElement("audioconvert"),
+		gstpipeline.NewCaps("audio/x-raw", gstpipeline.Prop("channels", e.channels)),
+		gstpipeline.NewElement("opusenc", e.props...).WithName(encoderproto.EncoderElementName),
+	), nil
 }
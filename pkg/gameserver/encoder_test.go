@@ -0,0 +1,87 @@
+package gameserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/castaneai/mashimaro/pkg/gstpipeline"
+	"github.com/castaneai/mashimaro/pkg/transport"
+)
+
+func TestVideoEncoderPipeline(t *testing.T) {
+	src := `ximagesrc display-name=:0 remote=true use-damage=false ! capsfilter name=framerate caps="video/x-raw,framerate=30/1"` +
+		` ! videocrop name=crop left=0 top=0 right=-1 bottom=-1 ! capsfilter name=cropsize caps="video/x-raw,width=640,height=480"` +
+		` ! videoscale add-borders=true ! capsfilter name=size caps="video/x-raw,width=640,height=480,pixel-aspect-ratio=1/1"`
+	tcs := []struct {
+		codec    transport.VideoCodec
+		element  string
+		expected string
+	}{
+		{
+			codec:    transport.VideoCodecH264,
+			element:  "vaapih264enc",
+			expected: src + " ! videoconvert ! video/x-raw,format=NV12 ! vaapih264enc name=encoder rate-control=cbr bitrate=1500 keyframe-period=120 ! video/x-h264,stream-format=byte-stream",
+		},
+		{
+			codec:    transport.VideoCodecH264,
+			element:  "nvh264enc",
+			expected: src + " ! videoconvert ! video/x-raw,format=NV12 ! nvh264enc name=encoder preset=low-latency-hq rc-mode=cbr zerolatency=true bitrate=1500 gop-size=120 ! video/x-h264,stream-format=byte-stream",
+		},
+		{
+			codec:    transport.VideoCodecH264,
+			element:  "x264enc",
+			expected: src + " ! videoconvert ! video/x-raw,format=I420 ! x264enc name=encoder speed-preset=veryfast tune=zerolatency byte-stream=true bitrate=1500 key-int-max=120",
+		},
+		{
+			codec:    transport.VideoCodecH264,
+			element:  "openh264enc",
+			expected: src + " ! videoconvert ! video/x-raw,format=I420 ! openh264enc name=encoder usage-type=screen complexity=low rate-control=bitrate bitrate=1500000 gop-size=120 ! video/x-h264,stream-format=byte-stream",
+		},
+		{
+			codec:    transport.VideoCodecVP8,
+			element:  "vp8enc",
+			expected: src + " ! videoconvert ! video/x-raw,format=I420 ! vp8enc name=encoder deadline=1 cpu-used=8 end-usage=cbr error-resilient=partitions target-bitrate=1500000 keyframe-max-dist=120",
+		},
+		{
+			codec:    transport.VideoCodecVP9,
+			element:  "vp9enc",
+			expected: src + " ! videoconvert ! video/x-raw,format=I420 ! vp9enc name=encoder deadline=1 cpu-used=8 end-usage=cbr error-resilient=default row-mt=true target-bitrate=1500000 keyframe-max-dist=120",
+		},
+		{
+			codec:    transport.VideoCodecAV1,
+			element:  "av1enc",
+			expected: src + " ! videoconvert ! video/x-raw,format=I420 ! av1enc name=encoder cpu-used=8 end-usage=cbr target-bitrate=1500 keyframe-max-dist=120 ! video/x-av1,stream-format=obu-stream,alignment=tu",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.element, func(t *testing.T) {
+			// only the element under test is available
+			candidate, err := newVideoEncoderRegistry([]string{tc.element}).Select(tc.codec)
+			assert.NoError(t, err)
+			video := candidate.newEncoder(NewX11ScreenCapturer(":0", &ScreenRect{StartX: 0, StartY: 0, EndX: 640, EndY: 480}, 30), videoEncoderParams{
+				BitrateKbps:      1500,
+				Preset:           "veryfast",
+				KeyframeInterval: 120,
+			})
+			pipeline, err := CompileGstPipeline(video)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, pipeline)
+		})
+	}
+
+	// the keyframe interval is optional
+	candidate, err := newVideoEncoderRegistry([]string{"x264enc"}).Select(transport.VideoCodecH264)
+	assert.NoError(t, err)
+	video := candidate.newEncoder(NewX11ScreenCapturer(":0", &ScreenRect{StartX: 0, StartY: 0, EndX: 640, EndY: 480}, 30), videoEncoderParams{BitrateKbps: 1500, Preset: "ultrafast"})
+	pipeline, err := CompileGstPipeline(video)
+	assert.NoError(t, err)
+	assert.Equal(t, src+" ! videoconvert ! video/x-raw,format=I420 ! x264enc name=encoder speed-preset=ultrafast tune=zerolatency byte-stream=true bitrate=1500", pipeline)
+}
+
+func TestAudioEncoderPipeline(t *testing.T) {
+	audio := NewOpusEncoder(NewPulseAudioCapturer("localhost:4713"), 1, []gstpipeline.Property{gstpipeline.Prop("bitrate", 64000)})
+	pipeline, err := CompileGstPipeline(audio)
+	assert.NoError(t, err)
+	assert.Equal(t, "pulsesrc server=localhost:4713 device=game.monitor provide-clock=false ! audioconvert ! audio/x-raw,channels=1 ! opusenc name=encoder bitrate=64000", pipeline)
+}
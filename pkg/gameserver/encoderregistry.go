@@ -0,0 +1,173 @@
+package gameserver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/castaneai/mashimaro/pkg/gstpipeline"
+	"github.com/castaneai/mashimaro/pkg/proto"
+	"github.com/castaneai/mashimaro/pkg/transport"
+)
+
+var (
+	// no intra-refresh, with which x264enc never emits an IDR frame on force-key-unit
+	defaultX264Props = []gstpipeline.Property{
+		gstpipeline.Prop("tune", "zerolatency"),
+		gstpipeline.Prop("byte-stream", true),
+	}
+	defaultVAAPIH264Props = []gstpipeline.Property{
+		gstpipeline.Prop("rate-control", "cbr"),
+	}
+	defaultNVH264Props = []gstpipeline.Property{
+		gstpipeline.Prop("preset", "low-latency-hq"),
+		gstpipeline.Prop("rc-mode", "cbr"),
+		gstpipeline.Prop("zerolatency", true),
+	}
+	defaultOpenH264Props = []gstpipeline.Property{
+		gstpipeline.Prop("usage-type", "screen"),
+		gstpipeline.Prop("complexity", "low"),
+		gstpipeline.Prop("rate-control", "bitrate"),
+	}
+	defaultVP8Props = []gstpipeline.Property{
+		gstpipeline.Prop("deadline", 1),
+		gstpipeline.Prop("cpu-used", 8),
+		gstpipeline.Prop("end-usage", "cbr"),
+		gstpipeline.Prop("error-resilient", "partitions"),
+	}
+	defaultVP9Props = []gstpipeline.Property{
+		gstpipeline.Prop("deadline", 1),
+		gstpipeline.Prop("cpu-used", 8),
+		gstpipeline.Prop("end-usage", "cbr"),
+		gstpipeline.Prop("error-resilient", "default"),
+		gstpipeline.Prop("row-mt", true),
+	}
+	defaultAV1Props = []gstpipeline.Property{
+		gstpipeline.Prop("cpu-used", 8),
+		gstpipeline.Prop("end-usage", "cbr"),
+	}
+)
+
+type videoEncoderParams struct {
+	BitrateKbps int
+	// speed preset of x264
+	Preset string
+	// 0 means the encoder's default
+	KeyframeInterval int
+}
+
+type videoEncoderCandidate struct {
+	// name of the GStreamer element
+	element    string
+	newEncoder func(src GstPipeliner, params videoEncoderParams) GstPipeliner
+}
+
+// videoEncoderCandidates are the video encoders for each codec in order of preference.
+// Hardware encoders come first and software encoders are the fallback.
+var videoEncoderCandidates = map[transport.VideoCodec][]videoEncoderCandidate{
+	transport.VideoCodecH264: {
+		{element: "vaapih264enc", newEncoder: func(src GstPipeliner, p videoEncoderParams) GstPipeliner {
+			return NewVAAPIH264Encoder(src, encoderProps(defaultVAAPIH264Props, gstpipeline.Prop("bitrate", p.BitrateKbps), "keyframe-period", p.KeyframeInterval))
+		}},
+		{element: "nvh264enc", newEncoder: func(src GstPipeliner, p videoEncoderParams) GstPipeliner {
+			return NewNVH264Encoder(src, encoderProps(defaultNVH264Props, gstpipeline.Prop("bitrate", p.BitrateKbps), "gop-size", p.KeyframeInterval))
+		}},
+		{element: "x264enc", newEncoder: func(src GstPipeliner, p videoEncoderParams) GstPipeliner {
+			return NewX264Encoder(src, encoderProps(append([]gstpipeline.Property{gstpipeline.Prop("speed-preset", p.Preset)}, defaultX264Props...), gstpipeline.Prop("bitrate", p.BitrateKbps), "key-int-max", p.KeyframeInterval))
+		}},
+		{element: "openh264enc", newEncoder: func(src GstPipeliner, p videoEncoderParams) GstPipeliner {
+			// bitrate of openh264enc is in bits per second
+			return NewOpenH264Encoder(src, encoderProps(defaultOpenH264Props, gstpipeline.Prop("bitrate", p.BitrateKbps*1000), "gop-size", p.KeyframeInterval))
+		}},
+	},
+	transport.VideoCodecVP8: {
+		{element: "vp8enc", newEncoder: func(src GstPipeliner, p videoEncoderParams) GstPipeliner {
+			// target-bitrate of vpxenc is in bits per second
+			return NewVP8Encoder(src, encoderProps(defaultVP8Props, gstpipeline.Prop("target-bitrate", p.BitrateKbps*1000), "keyframe-max-dist", p.KeyframeInterval))
+		}},
+	},
+	transport.VideoCodecVP9: {
+		{element: "vp9enc", newEncoder: func(src GstPipeliner, p videoEncoderParams) GstPipeliner {
+			return NewVP9Encoder(src, encoderProps(defaultVP9Props, gstpipeline.Prop("target-bitrate", p.BitrateKbps*1000), "keyframe-max-dist", p.KeyframeInterval))
+		}},
+	},
+	transport.VideoCodecAV1: {
+		{element: "av1enc", newEncoder: func(src GstPipeliner, p videoEncoderParams) GstPipeliner {
+			return NewAV1Encoder(src, encoderProps(defaultAV1Props, gstpipeline.Prop("target-bitrate", p.BitrateKbps), "keyframe-max-dist", p.KeyframeInterval))
+		}},
+	},
+}
+
+// encoderProps returns the encoder properties with the bitrate and the keyframe interval.
+// The keyframe interval is omitted when it is 0 to use the encoder's default.
+func encoderProps(defaults []gstpipeline.Property, bitrate gstpipeline.Property, keyframeIntervalKey string, keyframeInterval int) []gstpipeline.Property {
+	props := append(append([]gstpipeline.Property{}, defaults...), bitrate)
+	if keyframeInterval > 0 {
+		props = append(props, gstpipeline.Prop(keyframeIntervalKey, keyframeInterval))
+	}
+	return props
+}
+
+// videoEncoderRegistry selects the best video encoder available in the encoder service.
+type videoEncoderRegistry struct {
+	available map[string]struct{}
+	failed    map[string]struct{}
+	mu        sync.Mutex
+}
+
+func newVideoEncoderRegistry(availableElements []string) *videoEncoderRegistry {
+	available := make(map[string]struct{})
+	for _, e := range availableElements {
+		available[e] = struct{}{}
+	}
+	return &videoEncoderRegistry{
+		available: available,
+		failed:    make(map[string]struct{}),
+	}
+}
+
+// probeVideoEncoders asks the encoder service which encoder elements it has.
+func probeVideoEncoders(ctx context.Context, encoder proto.EncoderClient) (*videoEncoderRegistry, error) {
+	resp, err := encoder.GetCapabilities(ctx, &proto.GetCapabilitiesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encoder capabilities: %+v", err)
+	}
+	return newVideoEncoderRegistry(resp.EncoderElements), nil
+}
+
+// Select returns the most preferred encoder for the codec that is available and has not failed.
+func (r *videoEncoderRegistry) Select(codec transport.VideoCodec) (videoEncoderCandidate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range videoEncoderCandidates[codec] {
+		if _, ok := r.available[c.element]; !ok {
+			continue
+		}
+		if _, failed := r.failed[c.element]; failed {
+			continue
+		}
+		return c, nil
+	}
+	return videoEncoderCandidate{}, fmt.Errorf("no available encoder for %s", codec)
+}
+
+// Codecs returns the video codecs which have an available encoder.
+func (r *videoEncoderRegistry) Codecs() []transport.VideoCodec {
+	var codecs []transport.VideoCodec
+	for codec := range videoEncoderCandidates {
+		if _, err := r.Select(codec); err == nil {
+			codecs = append(codecs, codec)
+		}
+	}
+	sort.Slice(codecs, func(i, j int) bool { return codecs[i] < codecs[j] })
+	return codecs
+}
+
+// MarkFailed excludes the encoder from the next selection.
+// An encoder element can exist but fail to start, e.g. a hardware encoder without the device.
+func (r *videoEncoderRegistry) MarkFailed(element string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed[element] = struct{}{}
+}
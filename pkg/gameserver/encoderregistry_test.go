@@ -0,0 +1,42 @@
+package gameserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/castaneai/mashimaro/pkg/transport"
+)
+
+func TestVideoEncoderRegistry(t *testing.T) {
+	encoder := newFakeEncoderService("openh264enc", "x264enc", "nvh264enc", "vp8enc")
+	registry, err := probeVideoEncoders(context.Background(), encoder)
+	assert.NoError(t, err)
+	assert.Equal(t, []transport.VideoCodec{transport.VideoCodecH264, transport.VideoCodecVP8}, registry.Codecs())
+
+	// hardware encoder first
+	c, err := registry.Select(transport.VideoCodecH264)
+	assert.NoError(t, err)
+	assert.Equal(t, "nvh264enc", c.element)
+
+	// fallback to software encoders
+	registry.MarkFailed("nvh264enc")
+	c, err = registry.Select(transport.VideoCodecH264)
+	assert.NoError(t, err)
+	assert.Equal(t, "x264enc", c.element)
+	registry.MarkFailed("x264enc")
+	c, err = registry.Select(transport.VideoCodecH264)
+	assert.NoError(t, err)
+	assert.Equal(t, "openh264enc", c.element)
+	registry.MarkFailed("openh264enc")
+	_, err = registry.Select(transport.VideoCodecH264)
+	assert.Error(t, err)
+
+	// other codecs are not affected
+	c, err = registry.Select(transport.VideoCodecVP8)
+	assert.NoError(t, err)
+	assert.Equal(t, "vp8enc", c.element)
+	_, err = registry.Select(transport.VideoCodecVP9)
+	assert.Error(t, err)
+}
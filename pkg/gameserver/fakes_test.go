@@ -0,0 +1,439 @@
+package gameserver
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/castaneai/mashimaro/pkg/encoder/encoderproto"
+	"github.com/castaneai/mashimaro/pkg/gamemetadata"
+	"github.com/castaneai/mashimaro/pkg/proto"
+)
+
+// fakeBroker is a proto.BrokerClient holding at most one session.
+type fakeBroker struct {
+	metadata map[string]*gamemetadata.Metadata
+	session  *proto.Session
+	// IDs of the sessions deleted by the game server
+	deleted chan string
+	stats   []*proto.ReportConnectionStatsRequest
+	mu      sync.Mutex
+}
+
+func newFakeBroker(metadata ...*gamemetadata.Metadata) *fakeBroker {
+	b := &fakeBroker{
+		metadata: make(map[string]*gamemetadata.Metadata),
+		deleted:  make(chan string, 1),
+	}
+	for _, md := range metadata {
+		b.metadata[md.GameID] = md
+	}
+	return b
+}
+
+// newSession allocates a new session of the game to the server, as the matchmaker does.
+func (b *fakeBroker) newSession(sessionID, gameID, allocatedServerID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.session = &proto.Session{SessionId: sessionID, GameId: gameID, AllocatedServerId: allocatedServerID}
+}
+
+// deleteSession deletes the session without the game server (e.g. by the player leaving the lobby).
+func (b *fakeBroker) deleteSession() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.session = nil
+}
+
+func (b *fakeBroker) reportedStats() []*proto.ReportConnectionStatsRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*proto.ReportConnectionStatsRequest{}, b.stats...)
+}
+
+func (b *fakeBroker) FindSession(ctx context.Context, in *proto.FindSessionRequest, opts ...grpc.CallOption) (*proto.FindSessionResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.session == nil || b.session.AllocatedServerId != in.AllocatedServerId {
+		return &proto.FindSessionResponse{Found: false}, nil
+	}
+	session := *b.session
+	return &proto.FindSessionResponse{Found: true, Session: &session}, nil
+}
+
+func (b *fakeBroker) DeleteSession(ctx context.Context, in *proto.DeleteSessionRequest, opts ...grpc.CallOption) (*proto.DeleteSessionResponse, error) {
+	b.mu.Lock()
+	if b.session != nil && b.session.SessionId == in.SessionId {
+		b.session = nil
+	}
+	b.mu.Unlock()
+	select {
+	case b.deleted <- in.SessionId:
+	default:
+	}
+	return &proto.DeleteSessionResponse{}, nil
+}
+
+func (b *fakeBroker) GetGameMetadata(ctx context.Context, in *proto.GetGameMetadataRequest, opts ...grpc.CallOption) (*proto.GetGameMetadataResponse, error) {
+	b.mu.Lock()
+	md, ok := b.metadata[in.GameId]
+	b.mu.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "game metadata not found: %s", in.GameId)
+	}
+	body, err := gamemetadata.Marshal(md)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.GetGameMetadataResponse{GameMetadata: &proto.GameMetadata{Body: string(body)}}, nil
+}
+
+func (b *fakeBroker) SetRecording(ctx context.Context, in *proto.SetRecordingRequest, opts ...grpc.CallOption) (*proto.SetRecordingResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.session == nil || b.session.SessionId != in.SessionId {
+		return nil, status.Errorf(codes.NotFound, "session not found: %s", in.SessionId)
+	}
+	b.session.Recording = in.Recording
+	return &proto.SetRecordingResponse{}, nil
+}
+
+func (b *fakeBroker) UpdateGameThumbnail(ctx context.Context, in *proto.UpdateGameThumbnailRequest, opts ...grpc.CallOption) (*proto.UpdateGameThumbnailResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	md, ok := b.metadata[in.GameId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "game metadata not found: %s", in.GameId)
+	}
+	updated := *md
+	updated.Thumbnail = gamemetadata.ThumbnailDataURL(in.ContentType, in.Image)
+	b.metadata[in.GameId] = &updated
+	return &proto.UpdateGameThumbnailResponse{}, nil
+}
+
+func (b *fakeBroker) ReportConnectionStats(ctx context.Context, in *proto.ReportConnectionStatsRequest, opts ...grpc.CallOption) (*proto.ReportConnectionStatsResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stats = append(b.stats, in)
+	return &proto.ReportConnectionStatsResponse{}, nil
+}
+
+// fakeGameProcess is a proto.GameProcessClient which runs no games.
+type fakeGameProcess struct {
+	started chan *proto.StartGameRequest
+	exited  int
+	mu      sync.Mutex
+}
+
+func newFakeGameProcess() *fakeGameProcess {
+	return &fakeGameProcess{started: make(chan *proto.StartGameRequest, 1)}
+}
+
+// exitCount returns how many times the game has been requested to exit.
+func (p *fakeGameProcess) exitCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.exited
+}
+
+func (p *fakeGameProcess) StartGame(ctx context.Context, in *proto.StartGameRequest, opts ...grpc.CallOption) (*proto.StartGameResponse, error) {
+	select {
+	case p.started <- in:
+	default:
+		return nil, status.Error(codes.FailedPrecondition, "the game is already running")
+	}
+	return &proto.StartGameResponse{}, nil
+}
+
+func (p *fakeGameProcess) ExitGame(ctx context.Context, in *proto.ExitGameRequest, opts ...grpc.CallOption) (*proto.ExitGameResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.exited++
+	return &proto.ExitGameResponse{}, nil
+}
+
+// fakeEncoderService is a proto.EncoderClient whose pipelines send the same sample repeatedly on TCP, as the encoder service does.
+// Decoding pipelines discard the samples written by the game server.
+type fakeEncoderService struct {
+	elements       []string
+	sample         []byte
+	sampleInterval time.Duration
+	// events sent by WatchPipeline; the pipelines close the connection at once if they have ERROR or EOS
+	pipelineEvents []*proto.PipelineEvent
+	pipelines      map[string]*fakePipeline
+	// pipeline IDs of keyframe requests
+	keyframeRequested chan string
+	mu                sync.Mutex
+}
+
+type fakePipeline struct {
+	gstPipeline string
+	lis         net.Listener
+	conn        net.Conn
+	stopped     chan struct{}
+	mu          sync.Mutex
+}
+
+func newFakeEncoderService(elements ...string) *fakeEncoderService {
+	return &fakeEncoderService{
+		elements: elements,
+		// an IDR frame of H.264, which other codecs just packetize as bytes
+		sample:            []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, 0x00},
+		sampleInterval:    20 * time.Millisecond,
+		pipelines:         make(map[string]*fakePipeline),
+		keyframeRequested: make(chan string, 10),
+	}
+}
+
+// pipeline returns the last pipeline started with the ID.
+func (e *fakeEncoderService) pipeline(pipelineID string) (*fakePipeline, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.pipelines[pipelineID]
+	return p, ok
+}
+
+// running returns the IDs of the pipelines which the game server is receiving from.
+func (e *fakeEncoderService) running() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var ids []string
+	for id, p := range e.pipelines {
+		select {
+		case <-p.stopped:
+		default:
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Close stops all the pipelines.
+func (e *fakeEncoderService) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, p := range e.pipelines {
+		p.close()
+	}
+}
+
+func (e *fakeEncoderService) StartEncoding(ctx context.Context, in *proto.StartEncodingRequest, opts ...grpc.CallOption) (*proto.StartEncodingResponse, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := e.newPipeline(in.PipelineId, in.GstPipeline, lis)
+	go p.serve(func(conn net.Conn) {
+		if e.pipelineEnds() {
+			return
+		}
+		p.writeSamples(conn, e.sample, e.sampleInterval)
+	})
+	return &proto.StartEncodingResponse{ListenPort: uint32(lis.Addr().(*net.TCPAddr).Port)}, nil
+}
+
+func (e *fakeEncoderService) StartDecoding(ctx context.Context, in *proto.StartDecodingRequest, opts ...grpc.CallOption) (*proto.StartDecodingResponse, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := e.newPipeline(in.PipelineId, in.GstPipeline, lis)
+	go p.serve(func(conn net.Conn) {
+		// until the game server closes the connection
+		_, _ = io.Copy(ioutil.Discard, conn)
+	})
+	return &proto.StartDecodingResponse{ListenPort: uint32(lis.Addr().(*net.TCPAddr).Port)}, nil
+}
+
+// newPipeline replaces the pipeline of the ID, as pipeline IDs are shared by encoding and decoding.
+func (e *fakeEncoderService) newPipeline(pipelineID, gstPipeline string, lis net.Listener) *fakePipeline {
+	p := &fakePipeline{gstPipeline: gstPipeline, lis: lis, stopped: make(chan struct{})}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if prev, ok := e.pipelines[pipelineID]; ok {
+		prev.close()
+	}
+	e.pipelines[pipelineID] = p
+	return p
+}
+
+func (e *fakeEncoderService) pipelineEnds() bool {
+	for _, ev := range e.pipelineEvents {
+		if ev.Type == proto.PipelineEventType_PIPELINE_EVENT_ERROR || ev.Type == proto.PipelineEventType_PIPELINE_EVENT_EOS {
+			return true
+		}
+	}
+	return false
+}
+
+// serve handles the first connection from the game server.
+func (p *fakePipeline) serve(handle func(conn net.Conn)) {
+	defer close(p.stopped)
+	conn, err := p.lis.Accept()
+	_ = p.lis.Close()
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	p.conn = conn
+	p.mu.Unlock()
+	defer conn.Close()
+	handle(conn)
+}
+
+func (p *fakePipeline) writeSamples(conn net.Conn, sample []byte, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		// fails when the game server closes the connection
+		if err := encoderproto.WriteSamplePacket(conn, &encoderproto.SamplePacket{Data: sample, Duration: interval}); err != nil {
+			return
+		}
+	}
+}
+
+func (p *fakePipeline) close() {
+	_ = p.lis.Close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		_ = p.conn.Close()
+	}
+}
+
+func (e *fakeEncoderService) RequestKeyframe(ctx context.Context, in *proto.RequestKeyframeRequest, opts ...grpc.CallOption) (*proto.RequestKeyframeResponse, error) {
+	select {
+	case e.keyframeRequested <- in.PipelineId:
+	default:
+	}
+	return &proto.RequestKeyframeResponse{}, nil
+}
+
+func (e *fakeEncoderService) UpdateEncodingParams(ctx context.Context, in *proto.UpdateEncodingParamsRequest, opts ...grpc.CallOption) (*proto.UpdateEncodingParamsResponse, error) {
+	return &proto.UpdateEncodingParamsResponse{}, nil
+}
+
+func (e *fakeEncoderService) GetCapabilities(ctx context.Context, in *proto.GetCapabilitiesRequest, opts ...grpc.CallOption) (*proto.GetCapabilitiesResponse, error) {
+	return &proto.GetCapabilitiesResponse{EncoderElements: e.elements}, nil
+}
+
+func (e *fakeEncoderService) UpdateVideoGeometry(ctx context.Context, in *proto.UpdateVideoGeometryRequest, opts ...grpc.CallOption) (*proto.UpdateVideoGeometryResponse, error) {
+	if _, ok := e.pipeline(in.PipelineId); !ok {
+		return nil, status.Errorf(codes.NotFound, "pipeline not found: %s", in.PipelineId)
+	}
+	return &proto.UpdateVideoGeometryResponse{}, nil
+}
+
+func (e *fakeEncoderService) GetPipelineStatus(ctx context.Context, in *proto.GetPipelineStatusRequest, opts ...grpc.CallOption) (*proto.GetPipelineStatusResponse, error) {
+	p, ok := e.pipeline(in.PipelineId)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "pipeline not found: %s", in.PipelineId)
+	}
+	select {
+	case <-p.stopped:
+		return &proto.GetPipelineStatusResponse{State: proto.PipelineState_PIPELINE_STOPPED}, nil
+	default:
+		return &proto.GetPipelineStatusResponse{State: proto.PipelineState_PIPELINE_RUNNING}, nil
+	}
+}
+
+func (e *fakeEncoderService) WatchPipeline(ctx context.Context, in *proto.WatchPipelineRequest, opts ...grpc.CallOption) (proto.Encoder_WatchPipelineClient, error) {
+	return &fakeWatchPipelineClient{events: e.pipelineEvents}, nil
+}
+
+// fakeWatchPipelineClient receives the events, and then io.EOF.
+type fakeWatchPipelineClient struct {
+	proto.Encoder_WatchPipelineClient
+	events []*proto.PipelineEvent
+}
+
+func (c *fakeWatchPipelineClient) Recv() (*proto.PipelineEvent, error) {
+	if len(c.events) == 0 {
+		return nil, io.EOF
+	}
+	ev := c.events[0]
+	c.events = c.events[1:]
+	return ev, nil
+}
+
+// fakeDisplay is the screen with the window of a game, which records the inputs.
+type fakeDisplay struct {
+	// nil means no windows
+	window *ScreenRect
+	inputs chan string
+	opened int
+	mu     sync.Mutex
+}
+
+func newFakeDisplay(window *ScreenRect) *fakeDisplay {
+	return &fakeDisplay{
+		window: window,
+		inputs: make(chan string, 100),
+	}
+}
+
+// open is passed to WithDisplay.
+func (d *fakeDisplay) open() (Display, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.opened++
+	return &fakeDisplayConn{display: d}, nil
+}
+
+// openCount returns the number of displays not closed yet.
+func (d *fakeDisplay) openCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.opened
+}
+
+type fakeDisplayConn struct {
+	display *fakeDisplay
+	closed  bool
+}
+
+func (c *fakeDisplayConn) MainWindowRect() (*ScreenRect, error) {
+	c.display.mu.Lock()
+	defer c.display.mu.Unlock()
+	if c.display.window == nil {
+		return nil, errNoWindows
+	}
+	rect := *c.display.window
+	return &rect, nil
+}
+
+func (c *fakeDisplayConn) CaptureScreen(rect *ScreenRect) (*image.RGBA, error) {
+	return image.NewRGBA(image.Rect(0, 0, rect.Width(), rect.Height())), nil
+}
+
+func (c *fakeDisplayConn) Move(x, y int) {
+	c.display.inputs <- fmt.Sprintf("move %d %d", x, y)
+}
+
+func (c *fakeDisplayConn) SendButton(button xproto.Button, isPress bool) {
+	c.display.inputs <- fmt.Sprintf("button %d %t", button, isPress)
+}
+
+func (c *fakeDisplayConn) SendKey(keycode xproto.Keycode, isPress bool) {
+	c.display.inputs <- fmt.Sprintf("key %d %t", keycode, isPress)
+}
+
+func (c *fakeDisplayConn) Close() error {
+	c.display.mu.Lock()
+	defer c.display.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.display.opened--
+	}
+	return nil
+}
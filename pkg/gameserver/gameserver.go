@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/castaneai/mashimaro/pkg/gamemetadata"
+	"github.com/castaneai/mashimaro/pkg/iceserver"
+	"github.com/castaneai/mashimaro/pkg/recorder"
 
 	"github.com/castaneai/mashimaro/pkg/allocator"
 
@@ -23,18 +25,13 @@ import (
 )
 
 const (
-	receivedMessageBufferSize = 50
-	connectTimeout            = 10 * time.Second
+	receivedMessageBufferSize  = 50
+	connectTimeout             = 10 * time.Second
+	defaultSessionPollInterval = 1 * time.Second
 )
 
 var (
-	defaultWebRTCConfiguration = webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{"stun:stun.l.google.com:19302"},
-			},
-		},
-	}
+	errNotPlaying = errors.New("not playing")
 )
 
 type GameServer struct {
@@ -42,19 +39,156 @@ type GameServer struct {
 	broker          proto.BrokerClient
 	gameProcess     proto.GameProcessClient
 	encoder         proto.EncoderClient
-	signaler        transport.WebRTCSignaler
+	opts            *options
 	onShutdown      func()
 	callbackMu      sync.Mutex
+
+	// the game playing now, which is used by screenshots
+	playingGameID string
+	captureRect   *ScreenRect
+	playingMu     sync.Mutex
+}
+
+type options struct {
+	videoCodecs        []transport.VideoCodec
+	recording          *recorder.Config
+	lowResolutionVideo *VideoSize
+	iceServers         iceserver.Config
+	transportFactory   transport.Factory
+	openDisplay        func() (Display, error)
+	// how often to ask the broker for the session of the server
+	sessionPollInterval time.Duration
+}
+
+type VideoSize struct {
+	Width  int
+	Height int
+}
+
+func defaultOptions() *options {
+	return &options{
+		iceServers:          iceserver.DefaultConfig,
+		openDisplay:         openX11Display,
+		sessionPollInterval: defaultSessionPollInterval,
+	}
+}
+
+type GameServerOption interface {
+	apply(opts *options)
+}
+
+type GameServerOptionFunc func(*options)
+
+func (f GameServerOptionFunc) apply(opts *options) {
+	f(opts)
+}
+
+// WithVideoCodecs restricts the video codecs to stream in order of preference.
+// By default, the video codec is selected in order of the player's preference.
+func WithVideoCodecs(codecs ...transport.VideoCodec) GameServerOption {
+	return GameServerOptionFunc(func(opts *options) {
+		opts.videoCodecs = codecs
+	})
+}
+
+// WithRecording enables recording of play sessions into files.
+// Recording starts and stops by data channel messages or Broker.SetRecording.
+func WithRecording(conf recorder.Config) GameServerOption {
+	return GameServerOptionFunc(func(opts *options) {
+		opts.recording = &conf
+	})
+}
+
+// WithLowResolutionVideo streams a low-resolution video track (transport.TrackIDVideoLow) in addition to the main video,
+// which is for thumbnails and spectators. The game window is scaled into the size with black borders.
+func WithLowResolutionVideo(size VideoSize) GameServerOption {
+	return GameServerOptionFunc(func(opts *options) {
+		opts.lowResolutionVideo = &size
+	})
+}
+
+// WithICEServers replaces the ICE servers of the game server.
+// The ICE servers from the signaling server (e.g. Ayame Labo) are used in addition to them.
+func WithICEServers(conf iceserver.Config) GameServerOption {
+	return GameServerOptionFunc(func(opts *options) {
+		opts.iceServers = conf
+	})
 }
 
-func NewGameServer(allocatedServer *allocator.AllocatedServer, broker proto.BrokerClient, gameProcess proto.GameProcessClient, encoder proto.EncoderClient, signaler transport.WebRTCSignaler) *GameServer {
-	return &GameServer{
+// WithTransportFactory replaces WebRTC by the signaler with another transport to the player
+// (e.g. transport.WebSocketTransport where WebRTC is blocked, or transport.PipeTransport for tests).
+// The signaler and the ICE servers are not used with it.
+func WithTransportFactory(factory transport.Factory) GameServerOption {
+	return GameServerOptionFunc(func(opts *options) {
+		opts.transportFactory = factory
+	})
+}
+
+// WithDisplay replaces the X server of $DISPLAY where the game runs (e.g. with a fake display for tests).
+// The display is opened for each use and closed after it.
+func WithDisplay(open func() (Display, error)) GameServerOption {
+	return GameServerOptionFunc(func(opts *options) {
+		opts.openDisplay = open
+	})
+}
+
+// WithSessionPollInterval sets how often the game server asks the broker for the session of the server (1s by default).
+func WithSessionPollInterval(interval time.Duration) GameServerOption {
+	return GameServerOptionFunc(func(opts *options) {
+		opts.sessionPollInterval = interval
+	})
+}
+
+func NewGameServer(allocatedServer *allocator.AllocatedServer, broker proto.BrokerClient, gameProcess proto.GameProcessClient, encoder proto.EncoderClient, signaler transport.WebRTCSignaler, options ...GameServerOption) *GameServer {
+	opts := defaultOptions()
+	for _, opt := range options {
+		opt.apply(opts)
+	}
+	s := &GameServer{
 		allocatedServer: allocatedServer,
 		broker:          broker,
 		gameProcess:     gameProcess,
 		encoder:         encoder,
-		signaler:        signaler,
+		opts:            opts,
+	}
+	if opts.transportFactory == nil {
+		opts.transportFactory = transport.NewWebRTCFactory(signaler, s.webRTCConfiguration)
+	}
+	return s
+}
+
+func (s *GameServer) streamerOptions(metadata *gamemetadata.Metadata, videoEncoders *videoEncoderRegistry) []transport.StreamerOption {
+	opts := []transport.StreamerOption{
+		transport.WithVideoCodecs(s.opts.videoCodecs...),
+		// the player may prefer a codec without an encoder
+		transport.WithSupportedVideoCodecs(videoEncoders.Codecs()...),
+	}
+	if s.opts.lowResolutionVideo != nil {
+		opts = append(opts, transport.WithSendTracks(
+			transport.TrackSpec{ID: transport.TrackIDVideo, Kind: transport.TrackKindVideo},
+			transport.TrackSpec{ID: transport.TrackIDVideoLow, Kind: transport.TrackKindVideo},
+			transport.TrackSpec{ID: transport.TrackIDAudio, Kind: transport.TrackKindAudio},
+		))
+	}
+	if metadata.MicrophonePermitted() {
+		opts = append(opts, transport.WithRecvTracks(
+			transport.TrackSpec{ID: transport.TrackIDMicrophone, Kind: transport.TrackKindAudio},
+		))
+	}
+	return opts
+}
+
+// webRTCConfiguration configures the peer connection for the room of the session.
+func (s *GameServer) webRTCConfiguration(roomID string) webrtc.Configuration {
+	var conf webrtc.Configuration
+	for _, server := range s.opts.iceServers.Servers(fmt.Sprintf("%s-streamer", roomID), time.Now()) {
+		conf.ICEServers = append(conf.ICEServers, webrtc.ICEServer{
+			URLs:       server.URLs,
+			Username:   server.Username,
+			Credential: server.Credential,
+		})
 	}
+	return conf
 }
 
 func (s *GameServer) OnShutdown(f func()) {
@@ -71,8 +205,9 @@ func (s *GameServer) Serve(ctx context.Context) error {
 	errCh := make(chan error)
 	sessionCreated := make(chan *gamesession.Session)
 	sessionDeleted := make(chan struct{})
+	recordingRequested := make(chan bool, 1)
 	go func() {
-		errCh <- s.startWatchSession(ctx, sessionCreated, sessionDeleted)
+		errCh <- s.startWatchSession(ctx, sessionCreated, sessionDeleted, recordingRequested)
 	}()
 
 	log.Printf("waiting for new session for allocated server: %v", s.allocatedServer)
@@ -93,10 +228,25 @@ func (s *GameServer) Serve(ctx context.Context) error {
 		}
 	}()
 
+	// the tracks to negotiate depend on the game
+	metadata, err := s.getGameMetadata(ctx, session.GameID)
+	if err != nil {
+		return err
+	}
+	profile, err := metadata.EncodingProfile()
+	if err != nil {
+		return err
+	}
+	videoEncoders, err := probeVideoEncoders(ctx, s.encoder)
+	if err != nil {
+		return err
+	}
+
 	log.Printf("--- initializing connection...")
-	conn, err := transport.NewWebRTCStreamerConn(defaultWebRTCConfiguration)
+	roomID := string(session.SessionID)
+	conn, connector, err := s.opts.transportFactory.NewStreamerConn(roomID, s.streamerOptions(metadata, videoEncoders)...)
 	if err != nil {
-		return errors.Wrap(err, "failed to new webrtc streamer conn")
+		return errors.Wrap(err, "failed to new streamer conn")
 	}
 	// TODO: reconnect
 	connected := make(chan struct{})
@@ -112,9 +262,32 @@ func (s *GameServer) Serve(ctx context.Context) error {
 	conn.OnMessage(func(data []byte) {
 		messageReceived <- data
 	})
+	if pointer, ok := conn.DataChannel(transport.DataChannelPointer); ok {
+		pointer.OnMessage(func(data []byte) {
+			// pointer motion is dropped rather than blocking the channel, as the next position follows soon
+			select {
+			case messageReceived <- data:
+			default:
+			}
+		})
+	}
+	if bulk, ok := conn.DataChannel(transport.DataChannelBulk); ok {
+		bulk.OnMessage(func(data []byte) {
+			messageReceived <- data
+		})
+	}
+	conn.OnRecvTrack(func(track transport.RecvTrack) {
+		if track.ID() != transport.TrackIDMicrophone {
+			return
+		}
+		go func() {
+			// the game keeps running without the microphone
+			if err := s.startMicrophone(ctx, track); err != nil {
+				log.Printf("failed to route microphone input: %+v", err)
+			}
+		}()
+	})
 
-	roomID := string(session.SessionID)
-	connector := transport.NewWebRTCConnector(s.signaler, roomID, "streamer")
 	if err := connector.Connect(ctx, conn); err != nil {
 		return err
 	}
@@ -129,8 +302,21 @@ func (s *GameServer) Serve(ctx context.Context) error {
 	}
 	log.Printf("connected!")
 
+	rec, err := s.newRecorder(session.SessionID, conn, profile)
+	if err != nil {
+		// the game is still playable without recording
+		log.Printf("recording is disabled for the session: %+v", err)
+	}
+	if rec != nil {
+		defer func() {
+			if err := rec.Stop(); err != nil {
+				log.Printf("failed to stop recording: %+v", err)
+			}
+		}()
+	}
+
 	log.Printf("start game process")
-	if err := s.startGame(ctx, session.GameID); err != nil {
+	if err := s.startGame(ctx, metadata); err != nil {
 		return err
 	}
 	defer func() {
@@ -142,10 +328,20 @@ func (s *GameServer) Serve(ctx context.Context) error {
 		}
 	}()
 
+	s.setPlayingGame(session.GameID)
+	defer s.setPlayingGame("")
+
 	captureRectChanged := newCaptureRectPubSub()
 	go func() { captureRectChanged.Start(ctx) }()
-	go func() { errCh <- s.startStreaming(ctx, conn, captureRectChanged.Subscribe()) }()
-	go func() { errCh <- s.startController(ctx, messageReceived, captureRectChanged.Subscribe()) }()
+	go s.startTrackingCaptureRect(ctx, captureRectChanged.Subscribe())
+	go s.startReportingConnStats(ctx, session.SessionID, conn)
+	go func() {
+		errCh <- s.startStreaming(ctx, conn, profile, videoEncoders, captureRectChanged.Subscribe(), rec)
+	}()
+	go func() {
+		errCh <- s.startController(ctx, conn, profile, messageReceived, captureRectChanged.Subscribe(), recordingRequested)
+	}()
+	go func() { errCh <- s.startRecordingControl(ctx, rec, recordingRequested) }()
 	go func() { errCh <- s.startWatchGame(ctx, captureRectChanged) }()
 	for {
 		select {
@@ -161,15 +357,19 @@ func (s *GameServer) Serve(ctx context.Context) error {
 	}
 }
 
-func (s *GameServer) startGame(ctx context.Context, gameID string) error {
+func (s *GameServer) getGameMetadata(ctx context.Context, gameID string) (*gamemetadata.Metadata, error) {
 	resp, err := s.broker.GetGameMetadata(ctx, &proto.GetGameMetadataRequest{GameId: gameID})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	var metadata gamemetadata.Metadata
 	if err := gamemetadata.Unmarshal([]byte(resp.GameMetadata.Body), &metadata); err != nil {
-		return err
+		return nil, err
 	}
+	return &metadata, nil
+}
+
+func (s *GameServer) startGame(ctx context.Context, metadata *gamemetadata.Metadata) error {
 	cmd, args, err := metadata.ParseCommand()
 	if err != nil {
 		return err
@@ -184,6 +384,37 @@ func (s *GameServer) startGame(ctx context.Context, gameID string) error {
 	return nil
 }
 
+func (s *GameServer) setPlayingGame(gameID string) {
+	s.playingMu.Lock()
+	defer s.playingMu.Unlock()
+	s.playingGameID = gameID
+	s.captureRect = nil
+}
+
+func (s *GameServer) startTrackingCaptureRect(ctx context.Context, captureRectChanged <-chan ScreenRect) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case rect := <-captureRectChanged:
+			s.playingMu.Lock()
+			s.captureRect = &rect
+			s.playingMu.Unlock()
+		}
+	}
+}
+
+// playingGame returns the game ID and the capture rect of the playing game.
+func (s *GameServer) playingGame() (string, *ScreenRect, error) {
+	s.playingMu.Lock()
+	defer s.playingMu.Unlock()
+	if s.playingGameID == "" || s.captureRect == nil {
+		return "", nil, errNotPlaying
+	}
+	rect := *s.captureRect
+	return s.playingGameID, &rect, nil
+}
+
 func (s *GameServer) shutdown() {
 	s.callbackMu.Lock()
 	onExit := s.onShutdown
@@ -193,43 +424,67 @@ func (s *GameServer) shutdown() {
 	}
 }
 
+// captureRectPubSub passes the capture rect to the subscribers.
+// A subscriber receives the latest rect even if it subscribes after the rect is published or is busy when it is,
+// so that no one misses the rect of the window, which is published only when it changes.
 type captureRectPubSub struct {
 	publishCh   chan ScreenRect
 	subscribeCh chan chan ScreenRect
+	// closed when Start returns, so that publishers and subscribers don't block after the session
+	done chan struct{}
 }
 
 func newCaptureRectPubSub() *captureRectPubSub {
 	return &captureRectPubSub{
 		publishCh:   make(chan ScreenRect),
 		subscribeCh: make(chan chan ScreenRect),
+		done:        make(chan struct{}),
 	}
 }
 
 func (b *captureRectPubSub) Start(ctx context.Context) {
+	defer close(b.done)
 	subscribers := make(map[chan ScreenRect]struct{})
+	var latest *ScreenRect
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case rect := <-b.publishCh:
+			latest = &rect
 			for sub := range subscribers {
-				select {
-				case sub <- rect:
-				default:
-				}
+				sendLatestRect(sub, rect)
 			}
 		case ch := <-b.subscribeCh:
 			subscribers[ch] = struct{}{}
+			if latest != nil {
+				sendLatestRect(ch, *latest)
+			}
 		}
 	}
 }
 
+// sendLatestRect replaces the rect not received yet with the new one.
+func sendLatestRect(ch chan ScreenRect, rect ScreenRect) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- rect
+}
+
 func (b *captureRectPubSub) Subscribe() <-chan ScreenRect {
-	ch := make(chan ScreenRect)
-	b.subscribeCh <- ch
+	ch := make(chan ScreenRect, 1)
+	select {
+	case b.subscribeCh <- ch:
+	case <-b.done:
+	}
 	return ch
 }
 
 func (b *captureRectPubSub) Publish(rect ScreenRect) {
-	b.publishCh <- rect
+	select {
+	case b.publishCh <- rect:
+	case <-b.done:
+	}
 }
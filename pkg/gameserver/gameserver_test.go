@@ -3,8 +3,11 @@ package gameserver
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -26,7 +29,9 @@ import (
 	"github.com/castaneai/mashimaro/pkg/broker"
 	"github.com/castaneai/mashimaro/pkg/gameprocess"
 	"github.com/castaneai/mashimaro/pkg/gamesession"
+	"github.com/castaneai/mashimaro/pkg/iceserver"
 	"github.com/castaneai/mashimaro/pkg/proto"
+	"github.com/castaneai/mashimaro/pkg/signaling"
 	"github.com/castaneai/mashimaro/pkg/testutils"
 	"google.golang.org/grpc"
 )
@@ -64,7 +69,11 @@ func sendMoveMessage(t *testing.T, conn transport.PlayerConn, msg *MoveMessage)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := conn.SendMessage(context.Background(), b); err != nil {
+	pointer, ok := conn.DataChannel(transport.DataChannelPointer)
+	if !ok {
+		t.Fatal("pointer data channel not found")
+	}
+	if err := pointer.Send(context.Background(), b); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -125,15 +134,19 @@ func sendExitGameMessage(t *testing.T, conn transport.PlayerConn) {
 	}
 }
 
+// newTestSignalingServer returns the URL of the signaling server compatible with Ayame.
+func newTestSignalingServer(t *testing.T) string {
+	hs := httptest.NewServer(signaling.NewServer().HTTPHandler())
+	t.Cleanup(hs.Close)
+	return "ws" + strings.TrimPrefix(hs.URL, "http")
+}
+
 func TestGameServerLifecycle(t *testing.T) {
-	ayameURL := os.Getenv("AYAME_URL")
-	if ayameURL == "" {
-		t.Skip("Set AYAME_URL to run this test")
-	}
 	encoderAddr := os.Getenv("ENCODER_ADDR")
 	if encoderAddr == "" {
 		t.Skip("Set ENCODER_ADDR to run this test")
 	}
+	ayameURL := newTestSignalingServer(t)
 
 	ctx := context.Background()
 	allocatedServer := &allocator.AllocatedServer{
@@ -210,3 +223,296 @@ func TestGameServerLifecycle(t *testing.T) {
 	_, err = sstore.GetSession(ctx, ss.SessionID)
 	assert.True(t, errors.Is(err, gamesession.ErrSessionNotFound))
 }
+
+func TestGameServerOverPipe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pipe := transport.NewPipeTransport()
+	s := newTestGameServer(nil, WithTransportFactory(pipe))
+	defer s.encoder.Close()
+	s.serve(ctx)
+
+	s.broker.newSession("session1", "notepad", "test-gs")
+	connectCtx, cancelConnect := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelConnect()
+	conn, err := pipe.Player(connectCtx, "session1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s.waitGameStarted(t)
+	readCtx, cancelRead := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelRead()
+	sample, err := conn.ReadSample(readCtx, transport.TrackIDVideo)
+	assert.NoError(t, err)
+	assert.Equal(t, s.encoder.sample, sample.Data)
+
+	for i := 0; i < 10; i++ {
+		sendMoveMessage(t, conn, &MoveMessage{X: i * 10, Y: i * 10})
+		assert.Equal(t, fmt.Sprintf("move %d %d", 100+i*10, 100+i*10), receiveInput(t, s.display))
+	}
+	sendMouseMessage(t, conn, xproto.ButtonIndex3, true)
+	assert.Equal(t, "button 3 true", receiveInput(t, s.display))
+	sendMouseMessage(t, conn, xproto.ButtonIndex3, false)
+	assert.Equal(t, "button 3 false", receiveInput(t, s.display))
+	sendExitGameMessage(t, conn)
+	assert.Equal(t, errGameExited, s.waitServed(t, "session1"))
+}
+
+// testGameServer is a GameServer with fakes of the broker, the game process, the encoder and the display.
+type testGameServer struct {
+	*GameServer
+	broker      *fakeBroker
+	gameProcess *fakeGameProcess
+	encoder     *fakeEncoderService
+	display     *fakeDisplay
+	served      chan error
+	shutdown    chan struct{}
+}
+
+func newTestGameServer(signaler transport.WebRTCSignaler, opts ...GameServerOption) *testGameServer {
+	s := &testGameServer{
+		broker:      newFakeBroker(&gamemetadata.Metadata{GameID: "notepad", Command: "wine notepad"}),
+		gameProcess: newFakeGameProcess(),
+		encoder:     newFakeEncoderService("x264enc", "vp8enc"),
+		display:     newFakeDisplay(&ScreenRect{StartX: 100, StartY: 100, EndX: 740, EndY: 580}),
+		served:      make(chan error, 1),
+		shutdown:    make(chan struct{}),
+	}
+	opts = append([]GameServerOption{
+		// no STUN servers outside
+		WithICEServers(iceserver.Config{}),
+		WithDisplay(s.display.open),
+		WithSessionPollInterval(10 * time.Millisecond),
+	}, opts...)
+	s.GameServer = NewGameServer(&allocator.AllocatedServer{ID: "test-gs"}, s.broker, s.gameProcess, s.encoder, signaler, opts...)
+	s.OnShutdown(func() {
+		close(s.shutdown)
+	})
+	return s
+}
+
+func (s *testGameServer) serve(ctx context.Context) {
+	go func() {
+		s.served <- s.Serve(ctx)
+	}()
+}
+
+func (s *testGameServer) waitGameStarted(t *testing.T) *proto.StartGameRequest {
+	t.Helper()
+	select {
+	case req := <-s.gameProcess.started:
+		return req
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the game to start")
+		return nil
+	}
+}
+
+// waitServed returns the error of Serve, after checking that the session is cleaned up.
+func (s *testGameServer) waitServed(t *testing.T, sessionID string) error {
+	t.Helper()
+	var err error
+	select {
+	case err = <-s.served:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the session to end")
+	}
+	select {
+	case <-s.shutdown:
+	default:
+		t.Error("OnShutdown is not called")
+	}
+	if sessionID != "" {
+		select {
+		case deleted := <-s.broker.deleted:
+			assert.Equal(t, sessionID, deleted)
+		default:
+			t.Error("the session is not deleted")
+		}
+	}
+	// the goroutines of the session stop after Serve returns
+	waitUntil(t, func() bool { return len(s.encoder.running()) == 0 }, "all the pipelines stop")
+	waitUntil(t, func() bool { return s.display.openCount() == 0 }, "all the displays are closed")
+	return err
+}
+
+func waitUntil(t *testing.T, cond func() bool, what string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func receiveInput(t *testing.T, display *fakeDisplay) string {
+	t.Helper()
+	select {
+	case input := <-display.inputs:
+		return input
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for input")
+		return ""
+	}
+}
+
+func TestServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signaler := transport.NewInMemorySignaler()
+	s := newTestGameServer(signaler)
+	defer s.encoder.Close()
+	s.serve(ctx)
+
+	player, err := transport.NewWebRTCPlayerConn(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.PeerConnection().Close()
+	connected := make(chan struct{})
+	player.OnConnect(func() {
+		close(connected)
+	})
+	videoReceived := make(chan struct{})
+	var videoOnce sync.Once
+	player.PeerConnection().OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		if track.Kind() != webrtc.RTPCodecTypeVideo {
+			return
+		}
+		if _, _, err := track.ReadRTP(); err == nil {
+			videoOnce.Do(func() { close(videoReceived) })
+		}
+	})
+
+	// the player joins the room of the session allocated to the server
+	s.broker.newSession("session1", "notepad", "test-gs")
+	if _, err := signaler.Signaling(ctx, player.PeerConnection(), "session1", "player"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-connected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for connection")
+	}
+	req := s.waitGameStarted(t)
+	assert.Equal(t, "wine", req.Command)
+	assert.Equal(t, []string{"notepad"}, req.Args)
+	select {
+	case <-videoReceived:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for video")
+	}
+	pipeline, ok := s.encoder.pipeline(videoPipelineID)
+	assert.True(t, ok)
+	assert.Contains(t, pipeline.gstPipeline, "ximagesrc")
+
+	// inputs on the video are sent to the game window
+	sendMoveMessage(t, player, &MoveMessage{X: 10, Y: 20})
+	assert.Equal(t, "move 110 120", receiveInput(t, s.display))
+	sendMouseMessage(t, player, xproto.ButtonIndex1, true)
+	assert.Equal(t, "button 1 true", receiveInput(t, s.display))
+	sendMouseMessage(t, player, xproto.ButtonIndex1, false)
+	assert.Equal(t, "button 1 false", receiveInput(t, s.display))
+	sendKeyMessage(t, player, 38, true)
+	assert.Equal(t, "key 38 true", receiveInput(t, s.display))
+	sendKeyMessage(t, player, 38, false)
+	assert.Equal(t, "key 38 false", receiveInput(t, s.display))
+
+	// the screenshot is of the game window
+	resp, err := s.TakeScreenshot(ctx, &proto.TakeScreenshotRequest{Format: proto.ImageFormat_PNG})
+	assert.NoError(t, err)
+	if resp != nil {
+		assert.Equal(t, "image/png", resp.ContentType)
+		assert.Equal(t, uint32(640), resp.Width)
+		assert.Equal(t, uint32(480), resp.Height)
+	}
+
+	sendExitGameMessage(t, player)
+	assert.Equal(t, errGameExited, s.waitServed(t, "session1"))
+	// by the message and the clean-up
+	assert.Equal(t, 2, s.gameProcess.exitCount())
+	_, err = s.TakeScreenshot(ctx, &proto.TakeScreenshotRequest{Format: proto.ImageFormat_PNG})
+	assert.Error(t, err, "no game is playing")
+}
+
+func TestServeDisconnected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pipe := transport.NewPipeTransport()
+	s := newTestGameServer(nil, WithTransportFactory(pipe))
+	defer s.encoder.Close()
+	s.serve(ctx)
+
+	s.broker.newSession("session1", "notepad", "test-gs")
+	player, err := pipe.Player(ctx, "session1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.waitGameStarted(t)
+	sample, err := player.ReadSample(ctx, transport.TrackIDVideo)
+	assert.NoError(t, err)
+	assert.Equal(t, s.encoder.sample, sample.Data)
+
+	assert.NoError(t, player.Close())
+	assert.EqualError(t, s.waitServed(t, "session1"), "disconnected")
+	assert.Equal(t, 1, s.gameProcess.exitCount())
+}
+
+func TestServeSessionDeleted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pipe := transport.NewPipeTransport()
+	s := newTestGameServer(nil, WithTransportFactory(pipe))
+	defer s.encoder.Close()
+	s.serve(ctx)
+
+	s.broker.newSession("session1", "notepad", "test-gs")
+	player, err := pipe.Player(ctx, "session1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.Close()
+	s.waitGameStarted(t)
+
+	s.broker.deleteSession()
+	assert.EqualError(t, s.waitServed(t, "session1"), "session deleted")
+	assert.Equal(t, 1, s.gameProcess.exitCount())
+}
+
+func TestServeCanceledWhileWaiting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newTestGameServer(nil, WithTransportFactory(transport.NewPipeTransport()))
+	defer s.encoder.Close()
+	s.serve(ctx)
+
+	// no session is allocated to the server
+	s.broker.newSession("session1", "notepad", "another-gs")
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	assert.Equal(t, context.Canceled, s.waitServed(t, ""))
+	assert.Equal(t, 0, s.gameProcess.exitCount())
+	assert.Empty(t, s.gameProcess.started)
+}
+
+func TestCaptureRectPubSub(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pubsub := newCaptureRectPubSub()
+	go pubsub.Start(ctx)
+
+	early := pubsub.Subscribe()
+	pubsub.Publish(ScreenRect{EndX: 640, EndY: 480})
+	pubsub.Publish(ScreenRect{EndX: 800, EndY: 600})
+	// a subscriber receives the latest rect even if it subscribes late
+	late := pubsub.Subscribe()
+	assert.Equal(t, ScreenRect{EndX: 800, EndY: 600}, <-early)
+	assert.Equal(t, ScreenRect{EndX: 800, EndY: 600}, <-late)
+
+	// nothing blocks after the session
+	cancel()
+	<-pubsub.done
+	pubsub.Publish(ScreenRect{EndX: 1280, EndY: 720})
+	pubsub.Subscribe()
+}
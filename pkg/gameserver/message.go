@@ -11,6 +11,13 @@ const (
 	MessageTypeKeyDown   MessageType = "keydown"
 	MessageTypeKeyUp     MessageType = "keyup"
 	MessageTypeExitGame  MessageType = "exitGame"
+
+	MessageTypeStartRecording MessageType = "startRecording"
+	MessageTypeStopRecording  MessageType = "stopRecording"
+	MessageTypeScreenshot     MessageType = "screenshot"
+
+	// MessageTypeConnectionStats is sent to the player periodically.
+	MessageTypeConnectionStats MessageType = "connectionStats"
 )
 
 type Message struct {
@@ -38,3 +45,35 @@ type KeyDownMessage struct {
 type KeyUpMessage struct {
 	Key int `json:"key"`
 }
+
+type ScreenshotMessage struct {
+	// Format is "png" (default) or "jpeg".
+	Format          string `json:"format"`
+	MaxWidth        int    `json:"maxWidth"`
+	UpdateThumbnail bool   `json:"updateThumbnail"`
+}
+
+// ScreenshotResultMessage is sent back to the player for ScreenshotMessage.
+type ScreenshotResultMessage struct {
+	ContentType string `json:"contentType"`
+	// Data is encoded in base64 in JSON.
+	Data   []byte `json:"data"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// ConnectionStatsMessage is a summary of the quality of the connection sent to the player.
+type ConnectionStatsMessage struct {
+	RoundTripTimeMs float64 `json:"roundTripTimeMs"`
+	JitterMs        float64 `json:"jitterMs"`
+	// PacketLoss is the fraction of lost packets (0.0 - 1.0).
+	PacketLoss float64 `json:"packetLoss"`
+	// Bitrate is the total bits per second sent to the player.
+	Bitrate    int64   `json:"bitrate"`
+	Framerate  float64 `json:"framerate"`
+	FramesSent uint64  `json:"framesSent"`
+	NACKCount  uint64  `json:"nackCount"`
+	PLICount   uint64  `json:"pliCount"`
+	// CandidateType is the local candidate type of the selected candidate pair ("relay" means through TURN).
+	CandidateType string `json:"candidateType"`
+}
@@ -0,0 +1,101 @@
+package gameserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pkg/errors"
+
+	"github.com/castaneai/mashimaro/pkg/encoder/encoderproto"
+	"github.com/castaneai/mashimaro/pkg/gstpipeline"
+	"github.com/castaneai/mashimaro/pkg/proto"
+	"github.com/castaneai/mashimaro/pkg/transport"
+)
+
+const (
+	microphonePipelineID = transport.TrackIDMicrophone
+	// the null sink whose monitor is the default source of PulseAudio (see services/gameserver/pulseaudio/default.pa)
+	microphoneSinkName = "microphone"
+	// Opus from WebRTC is mono or stereo without a channel mapping table
+	microphoneCaps = "audio/x-opus,channel-mapping-family=0"
+)
+
+// PulseAudioMicrophone decodes Opus and plays it into the PulseAudio sink which the game records from.
+type PulseAudioMicrophone struct {
+	PulseServer string
+	Device      string
+}
+
+func NewPulseAudioMicrophone(pulseServer string) *PulseAudioMicrophone {
+	return &PulseAudioMicrophone{
+		PulseServer: pulseServer,
+		Device:      microphoneSinkName,
+	}
+}
+
+func (m *PulseAudioMicrophone) GstPipeline() (*gstpipeline.Pipeline, error) {
+	return gstpipeline.New(
+		gstpipeline.NewElement("opusdec"),
+		gstpipeline.NewElement("audioconvert"),
+		gstpipeline.NewElement("audioresample"),
+		gstpipeline.NewElement("pulsesink",
+			gstpipeline.Prop("server", m.PulseServer),
+			gstpipeline.Prop("device", m.Device),
+		),
+	), nil
+}
+
+// startMicrophone routes the microphone input of the player into the game until the track or the context ends.
+func (s *GameServer) startMicrophone(ctx context.Context, track transport.RecvTrack) error {
+	if !strings.EqualFold(track.Codec(), webrtc.MimeTypeOpus) {
+		return fmt.Errorf("unsupported microphone codec: %s", track.Codec())
+	}
+	log.Printf("start microphone input")
+	gstPipeline, err := CompileGstPipeline(NewPulseAudioMicrophone(os.Getenv("PULSE_SERVER")))
+	if err != nil {
+		return err
+	}
+	resp, err := s.encoder.StartDecoding(ctx, &proto.StartDecodingRequest{
+		PipelineId:  microphonePipelineID,
+		GstPipeline: gstPipeline,
+		Caps:        microphoneCaps,
+		Port:        0, // random port allocation
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to start decoding")
+	}
+	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", getEncoderHost(), resp.ListenPort))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	for {
+		sample, err := track.ReadSample()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return errors.Wrap(err, "failed to read microphone sample")
+		}
+		packet := encoderproto.SamplePacket{
+			Data:     sample.Data,
+			Duration: sample.Duration,
+		}
+		if err := encoderproto.WriteSamplePacket(conn, &packet); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package gameserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMicrophonePipeline(t *testing.T) {
+	pipeline, err := CompileGstPipeline(NewPulseAudioMicrophone("localhost:4713"))
+	assert.NoError(t, err)
+	assert.Equal(t, "opusdec ! audioconvert ! audioresample ! pulsesink server=localhost:4713 device=microphone", pipeline)
+}
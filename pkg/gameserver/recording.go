@@ -0,0 +1,81 @@
+package gameserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/castaneai/mashimaro/pkg/gamemetadata"
+	"github.com/castaneai/mashimaro/pkg/gamesession"
+	"github.com/castaneai/mashimaro/pkg/recorder"
+	"github.com/castaneai/mashimaro/pkg/transport"
+)
+
+var recordingVideoCodecs = map[transport.VideoCodec]recorder.Codec{
+	transport.VideoCodecH264: recorder.CodecH264,
+	transport.VideoCodecVP8:  recorder.CodecVP8,
+	transport.VideoCodecVP9:  recorder.CodecVP9,
+	transport.VideoCodecAV1:  recorder.CodecAV1,
+}
+
+// newRecorder returns a recorder of the session, or nil if recording is disabled.
+func (s *GameServer) newRecorder(sessionID gamesession.SessionID, conn transport.StreamerConn, profile gamemetadata.EncodingProfile) (*recorder.Recorder, error) {
+	if s.opts.recording == nil {
+		return nil, nil
+	}
+	track, ok := conn.SendTrack(transport.TrackIDVideo)
+	if !ok {
+		return nil, fmt.Errorf("no video track to record")
+	}
+	mimeType, err := track.Codec()
+	if err != nil {
+		return nil, err
+	}
+	videoCodec, err := transport.VideoCodecFromMimeType(mimeType)
+	if err != nil {
+		return nil, err
+	}
+	codec, ok := recordingVideoCodecs[videoCodec]
+	if !ok {
+		return nil, fmt.Errorf("recording %s is not supported", videoCodec)
+	}
+	return recorder.New(*s.opts.recording, string(sessionID),
+		recorder.VideoTrack{Codec: codec},
+		recorder.AudioTrack{Codec: recorder.CodecOpus, Channels: profile.AudioChannels},
+	), nil
+}
+
+// startRecordingControl starts and stops recording on request.
+func (s *GameServer) startRecordingControl(ctx context.Context, rec *recorder.Recorder, requested <-chan bool) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case recording := <-requested:
+			if rec == nil {
+				log.Printf("recording is requested, but disabled")
+				continue
+			}
+			if !recording {
+				if err := rec.Stop(); err != nil {
+					log.Printf("failed to stop recording: %+v", err)
+				}
+				continue
+			}
+			rec.Start()
+		}
+	}
+}
+
+// requestRecording requests to start or stop recording.
+// Only the latest request is kept when the previous one has not been handled.
+func requestRecording(requested chan bool, recording bool) {
+	select {
+	case <-requested:
+	default:
+	}
+	select {
+	case requested <- recording:
+	default:
+	}
+}
@@ -0,0 +1,50 @@
+package gameserver
+
+import (
+	"testing"
+
+	"github.com/castaneai/mashimaro/pkg/gamemetadata"
+	"github.com/castaneai/mashimaro/pkg/recorder"
+	"github.com/castaneai/mashimaro/pkg/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRecorder(t *testing.T) {
+	s := &GameServer{opts: defaultOptions()}
+	newConn := func(mimeType string) transport.StreamerConn {
+		return &fakeStreamerConn{tracks: []transport.SendTrack{
+			&fakeSendTrack{id: transport.TrackIDVideo, kind: transport.TrackKindVideo, mimeType: mimeType},
+		}}
+	}
+	profile := gamemetadata.DefaultEncodingProfile
+
+	// recording is disabled
+	rec, err := s.newRecorder("session1", newConn("video/VP8"), profile)
+	assert.NoError(t, err)
+	assert.Nil(t, rec)
+
+	// every video codec we can send is recorded
+	WithRecording(recorder.Config{}).apply(s.opts)
+	for _, codec := range []transport.VideoCodec{transport.VideoCodecH264, transport.VideoCodecVP8, transport.VideoCodecVP9, transport.VideoCodecAV1} {
+		rec, err := s.newRecorder("session1", newConn("video/"+string(codec)), profile)
+		assert.NoError(t, err, codec)
+		assert.NotNil(t, rec, codec)
+	}
+
+	// no video track
+	_, err = s.newRecorder("session1", &fakeStreamerConn{}, profile)
+	assert.Error(t, err)
+}
+
+func TestRequestRecording(t *testing.T) {
+	requested := make(chan bool, 1)
+	requestRecording(requested, true)
+	requestRecording(requested, false)
+	// only the latest request is kept
+	assert.False(t, <-requested)
+	select {
+	case <-requested:
+		t.Fatalf("the older request must be dropped")
+	default:
+	}
+}
@@ -0,0 +1,209 @@
+package gameserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/castaneai/mashimaro/pkg/proto"
+	"github.com/castaneai/mashimaro/pkg/transport"
+)
+
+const (
+	thumbnailWidth = 320
+	jpegQuality    = 90
+
+	// A data channel message is limited to 64 KiB, and base64 makes the image 4/3 larger.
+	maxDataChannelImageSize = 45 * 1024
+)
+
+type screenshot struct {
+	Image       []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// TakeScreenshot implements proto.GameServerServer.
+func (s *GameServer) TakeScreenshot(ctx context.Context, req *proto.TakeScreenshotRequest) (*proto.TakeScreenshotResponse, error) {
+	ss, err := s.takeScreenshot(ctx, req.Format, int(req.MaxWidth), req.UpdateThumbnail)
+	if err == errNotPlaying {
+		return nil, status.Error(codes.FailedPrecondition, "no game is playing")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &proto.TakeScreenshotResponse{
+		Image:       ss.Image,
+		ContentType: ss.ContentType,
+		Width:       uint32(ss.Width),
+		Height:      uint32(ss.Height),
+	}, nil
+}
+
+// takeScreenshot captures the current capture rect of the playing game.
+func (s *GameServer) takeScreenshot(ctx context.Context, format proto.ImageFormat, maxWidth int, updateThumbnail bool) (*screenshot, error) {
+	gameID, rect, err := s.playingGame()
+	if err != nil {
+		return nil, err
+	}
+	img, err := s.captureScreenRect(rect)
+	if err != nil {
+		return nil, err
+	}
+	if updateThumbnail {
+		if err := s.updateThumbnail(ctx, gameID, img); err != nil {
+			return nil, err
+		}
+	}
+	return encodeScreenshot(resizeImage(img, maxWidth), format)
+}
+
+func (s *GameServer) updateThumbnail(ctx context.Context, gameID string, img *image.RGBA) error {
+	thumbnail, err := encodeScreenshot(resizeImage(img, thumbnailWidth), proto.ImageFormat_JPEG)
+	if err != nil {
+		return err
+	}
+	if _, err := s.broker.UpdateGameThumbnail(ctx, &proto.UpdateGameThumbnailRequest{
+		GameId:      gameID,
+		Image:       thumbnail.Image,
+		ContentType: thumbnail.ContentType,
+	}); err != nil {
+		return fmt.Errorf("failed to update thumbnail: %+v", err)
+	}
+	log.Printf("updated thumbnail of %s", gameID)
+	return nil
+}
+
+func (s *GameServer) captureScreenRect(rect *ScreenRect) (*image.RGBA, error) {
+	display, err := s.opts.openDisplay()
+	if err != nil {
+		return nil, err
+	}
+	defer display.Close()
+	return display.CaptureScreen(rect)
+}
+
+func encodeScreenshot(img *image.RGBA, format proto.ImageFormat) (*screenshot, error) {
+	var buf bytes.Buffer
+	var contentType string
+	switch format {
+	case proto.ImageFormat_PNG:
+		contentType = "image/png"
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	case proto.ImageFormat_JPEG:
+		contentType = "image/jpeg"
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown image format: %s", format)
+	}
+	return &screenshot{
+		Image:       buf.Bytes(),
+		ContentType: contentType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+	}, nil
+}
+
+// resizeImage scales down the image to the width keeping the aspect ratio.
+// Each pixel is the average of the source pixels it covers.
+func resizeImage(src *image.RGBA, maxWidth int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if maxWidth <= 0 || sw <= maxWidth {
+		return src
+	}
+	dw := maxWidth
+	dh := sh * dw / sw
+	if dh < 1 {
+		dh = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		sy0, sy1 := y*sh/dh, (y+1)*sh/dh
+		for x := 0; x < dw; x++ {
+			sx0, sx1 := x*sw/dw, (x+1)*sw/dw
+			var sum [4]int
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					p := src.PixOffset(src.Bounds().Min.X+sx, src.Bounds().Min.Y+sy)
+					for i := 0; i < 4; i++ {
+						sum[i] += int(src.Pix[p+i])
+					}
+				}
+			}
+			n := (sy1 - sy0) * (sx1 - sx0)
+			q := dst.PixOffset(x, y)
+			for i := 0; i < 4; i++ {
+				dst.Pix[q+i] = uint8(sum[i] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// parseImageFormat parses the format of ScreenshotMessage.
+// The default is PNG as well as TakeScreenshotRequest.
+func parseImageFormat(format string) (proto.ImageFormat, error) {
+	switch format {
+	case "", "png":
+		return proto.ImageFormat_PNG, nil
+	case "jpeg":
+		return proto.ImageFormat_JPEG, nil
+	default:
+		return 0, fmt.Errorf("unknown image format: %s", format)
+	}
+}
+
+// sendScreenshot sends a screenshot to the player via the bulk data channel.
+func (s *GameServer) sendScreenshot(ctx context.Context, conn transport.Conn, req *ScreenshotMessage) error {
+	format, err := parseImageFormat(req.Format)
+	if err != nil {
+		return err
+	}
+	ss, err := s.takeScreenshot(ctx, format, req.MaxWidth, req.UpdateThumbnail)
+	if err != nil {
+		return err
+	}
+	if len(ss.Image) > maxDataChannelImageSize {
+		return fmt.Errorf("too large screenshot for data channel (size: %d, max: %d); use smaller maxWidth or the gRPC API", len(ss.Image), maxDataChannelImageSize)
+	}
+	body, err := json.Marshal(&ScreenshotResultMessage{
+		ContentType: ss.ContentType,
+		Data:        ss.Image,
+		Width:       ss.Width,
+		Height:      ss.Height,
+	})
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(&Message{Type: MessageTypeScreenshot, Body: body})
+	if err != nil {
+		return err
+	}
+	return sendBulkMessage(ctx, conn, msg)
+}
+
+// sendBulkMessage sends a large message on the bulk data channel not to block the control channel,
+// or on the control channel for players which don't open the bulk channel.
+func sendBulkMessage(ctx context.Context, conn transport.Conn, msg []byte) error {
+	if bulk, ok := conn.DataChannel(transport.DataChannelBulk); ok {
+		err := bulk.Send(ctx, msg)
+		if !errors.Is(err, transport.ErrDataChannelNotOpen) {
+			return err
+		}
+	}
+	return conn.SendMessage(ctx, msg)
+}
@@ -0,0 +1,58 @@
+package gameserver
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/castaneai/mashimaro/pkg/proto"
+)
+
+func TestResizeImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		src.SetRGBA(x, 0, color.RGBA{R: 100, A: 255})
+		src.SetRGBA(x, 1, color.RGBA{R: 200, A: 255})
+	}
+	dst := resizeImage(src, 2)
+	assert.Equal(t, image.Rect(0, 0, 2, 1), dst.Bounds())
+	assert.Equal(t, color.RGBA{R: 150, A: 255}, dst.RGBAAt(0, 0))
+
+	// not scaled up
+	assert.Equal(t, src, resizeImage(src, 8))
+	assert.Equal(t, src, resizeImage(src, 0))
+}
+
+func TestEncodeScreenshot(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	ss, err := encodeScreenshot(img, proto.ImageFormat_PNG)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", ss.ContentType)
+	assert.Equal(t, 8, ss.Width)
+	assert.Equal(t, 6, ss.Height)
+	decoded, err := png.Decode(bytes.NewReader(ss.Image))
+	assert.NoError(t, err)
+	assert.Equal(t, img.Bounds(), decoded.Bounds())
+
+	ss, err = encodeScreenshot(img, proto.ImageFormat_JPEG)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", ss.ContentType)
+}
+
+func TestParseImageFormat(t *testing.T) {
+	for s, expected := range map[string]proto.ImageFormat{
+		"":     proto.ImageFormat_PNG,
+		"png":  proto.ImageFormat_PNG,
+		"jpeg": proto.ImageFormat_JPEG,
+	} {
+		format, err := parseImageFormat(s)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, format)
+	}
+	_, err := parseImageFormat("gif")
+	assert.Error(t, err)
+}
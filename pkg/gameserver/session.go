@@ -9,9 +9,10 @@ import (
 	"github.com/castaneai/mashimaro/pkg/proto"
 )
 
-func (s *GameServer) startWatchSession(ctx context.Context, created chan<- *gamesession.Session, deleted chan<- struct{}) error {
-	ticker := time.NewTicker(1 * time.Second)
+func (s *GameServer) startWatchSession(ctx context.Context, created chan<- *gamesession.Session, deleted chan<- struct{}, recordingRequested chan bool) error {
+	ticker := time.NewTicker(s.opts.sessionPollInterval)
 	sessionFound := false
+	recording := false
 	for {
 		select {
 		case <-ctx.Done():
@@ -28,11 +29,17 @@ func (s *GameServer) startWatchSession(ctx context.Context, created chan<- *game
 					// TODO: State
 					GameID:            resp.Session.GameId,
 					AllocatedServerID: resp.Session.AllocatedServerId,
+					Recording:         resp.Session.Recording,
 				}
 			} else if sessionFound && !resp.Found {
 				sessionFound = false
 				deleted <- struct{}{}
 			}
+			// recording is requested via Broker.SetRecording
+			if resp.Found && resp.Session.Recording != recording {
+				recording = resp.Session.Recording
+				requestRecording(recordingRequested, recording)
+			}
 		}
 	}
 }
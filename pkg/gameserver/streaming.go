@@ -8,10 +8,14 @@ import (
 	"net"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/tevino/abool"
 
 	"github.com/castaneai/mashimaro/pkg/encoder/encoderproto"
+	"github.com/castaneai/mashimaro/pkg/gamemetadata"
+	"github.com/castaneai/mashimaro/pkg/gstpipeline"
+	"github.com/castaneai/mashimaro/pkg/recorder"
 
 	"github.com/castaneai/mashimaro/pkg/proto"
 
@@ -19,18 +23,131 @@ import (
 )
 
 const (
-	defaultX264Params = "speed-preset=ultrafast tune=zerolatency byte-stream=true intra-refresh=true"
+	// video pipelines are named after their tracks
+	videoPipelineID = transport.TrackIDVideo
+	audioPipelineID = "audio"
+
+	// The player may send PLI/FIR for every lost packet, but too many keyframes increase the bitrate.
+	keyframeRequestInterval = 500 * time.Millisecond
+
+	// The capture rect changes many times while the window is being resized.
+	captureRectDebounce = 300 * time.Millisecond
+
+	// how long to wait for the ERROR or EOS explaining the closed connection of a pipeline
+	pipelineEndEventWait = time.Second
 )
 
-func (s *GameServer) startStreaming(ctx context.Context, conn transport.StreamerConn, captureRectChanged <-chan ScreenRect) error {
-	errCh := make(chan error, 2)
-	go func() {
-		if err := s.startAudioStreaming(ctx, conn); err != nil {
-			errCh <- fmt.Errorf("failed to start audio streaming: %+v", err)
+// videoStream is an encoder pipeline streaming video to a track.
+type videoStream struct {
+	pipelineID string
+	track      transport.SendTrack
+	codec      transport.VideoCodec
+	// 0 means the size of the capture rect
+	outputWidth  int
+	outputHeight int
+	framerate    int
+	params       videoEncoderParams
+	// the main stream follows the adaptive bitrate and is recorded
+	main              bool
+	keyframeRequested chan struct{}
+	stop              context.CancelFunc
+}
+
+func (v *videoStream) requestKeyframe() {
+	select {
+	case v.keyframeRequested <- struct{}{}:
+	default:
+	}
+}
+
+// newVideoStreams returns the streams of the video tracks of the conn, whose pipeline IDs are the track IDs.
+// The track of TrackIDVideo is the main stream and the others are low-resolution streams.
+func (s *GameServer) newVideoStreams(conn transport.StreamerConn, profile gamemetadata.EncodingProfile) ([]*videoStream, error) {
+	var streams []*videoStream
+	for _, track := range conn.SendTracks() {
+		if track.Kind() != transport.TrackKindVideo {
+			continue
 		}
-	}()
+		mimeType, err := track.Codec()
+		if err != nil {
+			return nil, err
+		}
+		codec, err := transport.VideoCodecFromMimeType(mimeType)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("video codec of track %s: %s", track.ID(), codec)
+		stream := &videoStream{
+			pipelineID:        track.ID(),
+			track:             track,
+			codec:             codec,
+			outputWidth:       profile.OutputWidth,
+			outputHeight:      profile.OutputHeight,
+			framerate:         profile.Framerate,
+			params:            videoEncoderParams{BitrateKbps: profile.VideoBitrate, Preset: profile.Preset, KeyframeInterval: profile.KeyframeInterval},
+			main:              track.ID() == transport.TrackIDVideo,
+			keyframeRequested: make(chan struct{}, 1),
+		}
+		if !stream.main {
+			if s.opts.lowResolutionVideo == nil {
+				return nil, fmt.Errorf("size of low-resolution video track %s is not configured", track.ID())
+			}
+			stream.outputWidth = s.opts.lowResolutionVideo.Width
+			stream.outputHeight = s.opts.lowResolutionVideo.Height
+			stream.framerate = profile.MinFramerate
+			stream.params.BitrateKbps = profile.MinVideoBitrate
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
+
+// startStreaming streams video and audio to the player, and to the recorder if not nil.
+func (s *GameServer) startStreaming(ctx context.Context, conn transport.StreamerConn, profile gamemetadata.EncodingProfile, videoEncoders *videoEncoderRegistry, captureRectChanged <-chan ScreenRect, rec *recorder.Recorder) error {
+	videoStreams, err := s.newVideoStreams(conn, profile)
+	if err != nil {
+		return err
+	}
+
+	errCh := make(chan error, 1+len(videoStreams))
+	if audio, ok := conn.SendTrack(transport.TrackIDAudio); ok {
+		go func() {
+			if err := s.startAudioStreaming(ctx, audio, profile, rec); err != nil {
+				errCh <- fmt.Errorf("failed to start audio streaming: %+v", err)
+			}
+		}()
+	}
+
+	streamsByTrack := make(map[string]*videoStream)
+	for _, stream := range videoStreams {
+		streamsByTrack[stream.track.ID()] = stream
+		if stream.main && rec != nil {
+			rec.OnKeyframeNeeded(stream.requestKeyframe)
+		}
+		go s.startForwardingKeyframeRequests(ctx, stream.pipelineID, stream.keyframeRequested, keyframeRequestInterval)
+	}
+	conn.OnKeyframeRequest(func(trackID string) {
+		if stream, ok := streamsByTrack[trackID]; ok {
+			stream.requestKeyframe()
+		}
+	})
 
-	var videoConn *encoderConn
+	bitrate := newBitrateController(newAdaptiveBitrateConfig(profile))
+	bandwidthEstimated := make(chan transport.BandwidthEstimate, 1)
+	conn.OnBandwidthEstimate(func(estimate transport.BandwidthEstimate) {
+		// keep only the latest estimate
+		select {
+		case <-bandwidthEstimated:
+		default:
+		}
+		select {
+		case bandwidthEstimated <- estimate:
+		default:
+		}
+	})
+	go s.startAdaptingBitrate(ctx, bitrate, bandwidthEstimated, bitrateUpdateInterval)
+
+	captureRects := debounceCaptureRect(ctx, captureRectChanged, captureRectDebounce)
 	log.Printf("waiting for capture rect")
 	for {
 		select {
@@ -39,62 +156,208 @@ func (s *GameServer) startStreaming(ctx context.Context, conn transport.Streamer
 		case err := <-errCh:
 			// TODO: retry streaming
 			return err
-		case rect := <-captureRectChanged:
+		case rect := <-captureRects:
 			log.Printf("capture rect detected(%s)", &rect)
-			if videoConn != nil {
-				videoConn.Stop()
-			}
-			vc, err := s.newVideoEncoderConn(ctx, conn, &rect)
-			if err != nil {
-				return err
+			if rec != nil {
+				width, height := newVideoTransform(rect, profile.OutputWidth, profile.OutputHeight).OutputSize()
+				if err := rec.SetVideoSize(width, height); err != nil {
+					log.Printf("failed to change the video size of recording: %+v", err)
+				}
 			}
-			videoConn = vc
-			go func() {
-				if err := vc.start(ctx, func(ctx context.Context, packet *encoderproto.SamplePacket) error {
-					return conn.SendVideoSample(ctx, transport.MediaSample{
-						Data:     packet.Data,
-						Duration: packet.Duration,
-					})
-				}); err != nil {
-					errCh <- fmt.Errorf("failed to start video streaming: %+v", err)
+			for _, stream := range videoStreams {
+				if stream.stop != nil {
+					// change the rect of the running pipeline, or restart it if the encoder cannot
+					err := s.updateVideoGeometry(ctx, stream, rect)
+					if err == nil {
+						stream.requestKeyframe()
+						continue
+					}
+					log.Printf("failed to update video geometry of %s, restarting video streaming: %+v", stream.pipelineID, err)
+					stream.stop()
 				}
-			}()
+				videoCtx, cancel := context.WithCancel(ctx)
+				stream.stop = cancel
+				framerate, params := stream.framerate, stream.params
+				if stream.main {
+					current := bitrate.Current()
+					framerate, params.BitrateKbps = current.Framerate, current.BitrateKbps
+				}
+				var streamRec *recorder.Recorder
+				if stream.main {
+					streamRec = rec
+				}
+				stream, rect := stream, rect
+				go func() {
+					if err := s.startVideoStreaming(videoCtx, stream, streamRec, videoEncoders, &rect, framerate, params); err != nil {
+						errCh <- fmt.Errorf("failed to start video streaming of %s: %+v", stream.pipelineID, err)
+					}
+				}()
+			}
 		}
 	}
 }
 
-func (s *GameServer) newVideoEncoderConn(ctx context.Context, conn transport.StreamerConn, rect *ScreenRect) (*encoderConn, error) {
-	log.Printf("start video streaming")
-	video := NewX264Encoder(
-		NewX11ScreenCapturer(os.Getenv("DISPLAY"), rect),
-		defaultX264Params,
-	)
-	gstPipeline, err := video.CompileGstPipeline()
-	if err != nil {
-		return nil, err
+// updateVideoGeometry changes the capture rect of the running video pipeline without restarting it.
+func (s *GameServer) updateVideoGeometry(ctx context.Context, stream *videoStream, rect ScreenRect) error {
+	r := rect.clamped()
+	outputWidth, outputHeight := newVideoTransform(r, stream.outputWidth, stream.outputHeight).OutputSize()
+	_, err := s.encoder.UpdateVideoGeometry(ctx, &proto.UpdateVideoGeometryRequest{
+		PipelineId:   stream.pipelineID,
+		CropX:        uint32(r.StartX),
+		CropY:        uint32(r.StartY),
+		CropWidth:    uint32(r.Width()),
+		CropHeight:   uint32(r.Height()),
+		OutputWidth:  uint32(outputWidth),
+		OutputHeight: uint32(outputHeight),
+	})
+	return err
+}
+
+// debounceCaptureRect passes a capture rect after it stays unchanged for the delay,
+// so that transient sizes while resizing the window do not reach the encoder.
+func debounceCaptureRect(ctx context.Context, changed <-chan ScreenRect, delay time.Duration) <-chan ScreenRect {
+	debounced := make(chan ScreenRect, 1)
+	go func() {
+		var pending ScreenRect
+		var timer *time.Timer
+		var fired <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			case rect := <-changed:
+				pending = rect
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.NewTimer(delay)
+				fired = timer.C
+			case <-fired:
+				fired = nil
+				// keep only the latest rect
+				select {
+				case <-debounced:
+				default:
+				}
+				debounced <- pending
+			}
+		}
+	}()
+	return debounced
+}
+
+// startVideoStreaming streams video with the best available encoder.
+// When the encoder fails before sending the first sample, it falls back to the next encoder.
+func (s *GameServer) startVideoStreaming(ctx context.Context, stream *videoStream, rec *recorder.Recorder, encoders *videoEncoderRegistry, rect *ScreenRect, framerate int, params videoEncoderParams) error {
+	log.Printf("start video streaming (pipelineID: %s)", stream.pipelineID)
+	for {
+		candidate, err := encoders.Select(stream.codec)
+		if err != nil {
+			return err
+		}
+		capturer := NewX11ScreenCapturer(os.Getenv("DISPLAY"), rect, framerate).WithOutputSize(stream.outputWidth, stream.outputHeight)
+		video := candidate.newEncoder(capturer, params)
+		gstPipeline, err := CompileGstPipeline(video)
+		if err != nil {
+			return err
+		}
+		vc := newEncoderConn(s.encoder, stream.pipelineID, gstPipeline)
+		// stops the encoder when ctx is done during this attempt
+		attemptDone := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				vc.Stop()
+			case <-attemptDone:
+			}
+		}()
+		started := abool.New()
+		err = vc.start(ctx, func(ctx context.Context, packet *encoderproto.SamplePacket) error {
+			started.Set()
+			if rec != nil {
+				if err := rec.WriteVideo(packet.Data, packet.PTS, packet.Duration); err != nil {
+					log.Printf("failed to record video: %+v", err)
+				}
+			}
+			return stream.track.WriteSample(ctx, transport.MediaSample{
+				Data:     packet.Data,
+				Duration: packet.Duration,
+				PTS:      packet.PTS,
+			})
+		})
+		close(attemptDone)
+		if ctx.Err() != nil {
+			// stopped by the capture rect change
+			return nil
+		}
+		if err == nil || started.IsSet() {
+			return err
+		}
+		log.Printf("failed to start video encoder %s, falling back to the next one: %+v", candidate.element, err)
+		// the connection to the failed encoder is not needed anymore
+		vc.Stop()
+		encoders.MarkFailed(candidate.element)
 	}
-	st := newEncoderConn(s.encoder, "video", gstPipeline)
-	return st, nil
 }
 
-func (s *GameServer) startAudioStreaming(ctx context.Context, conn transport.StreamerConn) error {
+func (s *GameServer) startAudioStreaming(ctx context.Context, track transport.SendTrack, profile gamemetadata.EncodingProfile, rec *recorder.Recorder) error {
 	log.Printf("start audio streaming")
 	audio := NewOpusEncoder(
 		NewPulseAudioCapturer(os.Getenv("PULSE_SERVER")),
+		profile.AudioChannels,
+		// bitrate of opusenc is in bits per second
+		[]gstpipeline.Property{gstpipeline.Prop("bitrate", profile.AudioBitrate*1000)},
 	)
-	gstPipeline, err := audio.CompileGstPipeline()
+	gstPipeline, err := CompileGstPipeline(audio)
 	if err != nil {
 		return err
 	}
-	st := newEncoderConn(s.encoder, "audio", gstPipeline)
+	st := newEncoderConn(s.encoder, audioPipelineID, gstPipeline)
+	go func() {
+		<-ctx.Done()
+		st.Stop()
+	}()
 	return st.start(ctx, func(ctx context.Context, packet *encoderproto.SamplePacket) error {
-		return conn.SendAudioSample(ctx, transport.MediaSample{
+		if rec != nil {
+			if err := rec.WriteAudio(packet.Data, packet.PTS, packet.Duration); err != nil {
+				log.Printf("failed to record audio: %+v", err)
+			}
+		}
+		return track.WriteSample(ctx, transport.MediaSample{
 			Data:     packet.Data,
 			Duration: packet.Duration,
+			PTS:      packet.PTS,
 		})
 	})
 }
 
+// startForwardingKeyframeRequests forwards keyframe requests from the player to the video pipeline.
+// Requests arriving within the interval are coalesced into one.
+func (s *GameServer) startForwardingKeyframeRequests(ctx context.Context, pipelineID string, requested <-chan struct{}, interval time.Duration) {
+	var lastRequested time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-requested:
+			if wait := interval - time.Since(lastRequested); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(wait):
+				}
+			}
+			lastRequested = time.Now()
+			if _, err := s.encoder.RequestKeyframe(ctx, &proto.RequestKeyframeRequest{PipelineId: pipelineID}); err != nil {
+				log.Printf("failed to request keyframe: %+v", err)
+			}
+		}
+	}
+}
+
 func getEncoderHost() string {
 	if h := os.Getenv("ENCODER_HOST"); h != "" {
 		return h
@@ -129,6 +392,9 @@ func (s *encoderConn) start(ctx context.Context, onPacket func(ctx context.Conte
 	if err != nil {
 		return err
 	}
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	defer cancelWatch()
+	ended := s.watchPipelineEnd(watchCtx)
 	serverAddr := fmt.Sprintf("%s:%d", getEncoderHost(), resp.ListenPort)
 	if err := s.startReceivingMedia(serverAddr, func(packet *encoderproto.SamplePacket) error {
 		return onPacket(ctx, packet)
@@ -136,11 +402,50 @@ func (s *encoderConn) start(ctx context.Context, onPacket func(ctx context.Conte
 		if s.stopped.IsSet() {
 			return nil
 		}
-		return err
+		// the connection is closed before the event of the cause arrives
+		select {
+		case ev := <-ended:
+			return pipelineEndError(s.pipelineID, ev)
+		case <-time.After(pipelineEndEventWait):
+			return err
+		}
 	}
 	return nil
 }
 
+// watchPipelineEnd returns a channel receiving the ERROR or EOS which ended the pipeline.
+// Warnings are logged.
+func (s *encoderConn) watchPipelineEnd(ctx context.Context) <-chan *proto.PipelineEvent {
+	ended := make(chan *proto.PipelineEvent, 1)
+	stream, err := s.client.WatchPipeline(ctx, &proto.WatchPipelineRequest{PipelineId: s.pipelineID})
+	if err != nil {
+		log.Printf("failed to watch pipeline (pipelineID: %s): %+v", s.pipelineID, err)
+		return ended
+	}
+	go func() {
+		for {
+			ev, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			if ev.Type == proto.PipelineEventType_PIPELINE_EVENT_WARNING {
+				log.Printf("[%s] warning from %s: %s", s.pipelineID, ev.Source, ev.Message)
+				continue
+			}
+			ended <- ev
+			return
+		}
+	}()
+	return ended
+}
+
+func pipelineEndError(pipelineID string, ev *proto.PipelineEvent) error {
+	if ev.Type == proto.PipelineEventType_PIPELINE_EVENT_EOS {
+		return fmt.Errorf("pipeline ended by EOS from %s (pipelineID: %s)", ev.Source, pipelineID)
+	}
+	return fmt.Errorf("pipeline error from %s: %s (pipelineID: %s, debug: %s)", ev.Source, ev.Message, pipelineID, ev.Debug)
+}
+
 func (s *encoderConn) startReceivingMedia(serverAddr string, onPacket func(packet *encoderproto.SamplePacket) error) error {
 	conn, err := net.Dial("tcp", serverAddr)
 	if err != nil {
@@ -0,0 +1,130 @@
+package gameserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/castaneai/mashimaro/pkg/encoder/encoderproto"
+	"github.com/castaneai/mashimaro/pkg/gamemetadata"
+	"github.com/castaneai/mashimaro/pkg/proto"
+	"github.com/castaneai/mashimaro/pkg/transport"
+)
+
+func TestForwardingKeyframeRequests(t *testing.T) {
+	encoder := newFakeEncoderService()
+	s := &GameServer{encoder: encoder}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requested := make(chan struct{}, 1)
+	go s.startForwardingKeyframeRequests(ctx, videoPipelineID, requested, 200*time.Millisecond)
+
+	for i := 0; i < 20; i++ {
+		select {
+		case requested <- struct{}{}:
+		default:
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(300 * time.Millisecond)
+	n := len(encoder.keyframeRequested)
+	assert.True(t, n >= 1 && n <= 3, "keyframe requests should be rate limited (got: %d)", n)
+}
+
+func TestEncoderConnPipelineError(t *testing.T) {
+	// the encoder service closes the connection of the failed pipeline
+	encoder := newFakeEncoderService()
+	defer encoder.Close()
+	encoder.pipelineEvents = []*proto.PipelineEvent{
+		{Type: proto.PipelineEventType_PIPELINE_EVENT_WARNING, Source: "ximagesrc0", Message: "slow"},
+		{Type: proto.PipelineEventType_PIPELINE_EVENT_ERROR, Source: "ximagesrc0", Message: "Could not open X display for reading"},
+	}
+	ec := newEncoderConn(encoder, videoPipelineID, "ximagesrc")
+	err := ec.start(context.Background(), func(ctx context.Context, packet *encoderproto.SamplePacket) error {
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Could not open X display for reading")
+}
+
+func TestDebounceCaptureRect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan ScreenRect)
+	debounced := debounceCaptureRect(ctx, changed, 100*time.Millisecond)
+
+	// transient sizes while resizing
+	for i := 1; i <= 5; i++ {
+		changed <- ScreenRect{EndX: 100 * i, EndY: 100 * i}
+		time.Sleep(20 * time.Millisecond)
+	}
+	select {
+	case rect := <-debounced:
+		assert.Equal(t, ScreenRect{EndX: 500, EndY: 500}, rect)
+	case <-time.After(time.Second):
+		t.Fatal("debounced rect not received")
+	}
+	select {
+	case rect := <-debounced:
+		t.Fatalf("unexpected rect: %s", &rect)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+type fakeSendTrack struct {
+	id       string
+	kind     transport.TrackKind
+	mimeType string
+}
+
+func (t *fakeSendTrack) ID() string                { return t.id }
+func (t *fakeSendTrack) Kind() transport.TrackKind { return t.kind }
+func (t *fakeSendTrack) Codec() (string, error)    { return t.mimeType, nil }
+func (t *fakeSendTrack) WriteSample(ctx context.Context, sample transport.MediaSample) error {
+	return nil
+}
+
+type fakeStreamerConn struct {
+	transport.StreamerConn
+	tracks []transport.SendTrack
+}
+
+func (c *fakeStreamerConn) SendTracks() []transport.SendTrack { return c.tracks }
+
+func (c *fakeStreamerConn) SendTrack(id string) (transport.SendTrack, bool) {
+	for _, track := range c.tracks {
+		if track.ID() == id {
+			return track, true
+		}
+	}
+	return nil, false
+}
+
+func TestNewVideoStreams(t *testing.T) {
+	conn := &fakeStreamerConn{tracks: []transport.SendTrack{
+		&fakeSendTrack{id: transport.TrackIDVideo, kind: transport.TrackKindVideo, mimeType: "video/VP8"},
+		&fakeSendTrack{id: transport.TrackIDVideoLow, kind: transport.TrackKindVideo, mimeType: "video/VP8"},
+		&fakeSendTrack{id: transport.TrackIDAudio, kind: transport.TrackKindAudio, mimeType: "audio/opus"},
+	}}
+	profile := gamemetadata.DefaultEncodingProfile
+
+	// the size of low-resolution video is required
+	s := &GameServer{opts: defaultOptions()}
+	_, err := s.newVideoStreams(conn, profile)
+	assert.Error(t, err)
+
+	WithLowResolutionVideo(VideoSize{Width: 320, Height: 180}).apply(s.opts)
+	streams, err := s.newVideoStreams(conn, profile)
+	assert.NoError(t, err)
+	assert.Len(t, streams, 2)
+	assert.True(t, streams[0].main)
+	assert.Equal(t, videoPipelineID, streams[0].pipelineID)
+	assert.Equal(t, transport.VideoCodecVP8, streams[0].codec)
+	assert.False(t, streams[1].main)
+	assert.Equal(t, transport.TrackIDVideoLow, streams[1].pipelineID)
+	assert.Equal(t, 320, streams[1].outputWidth)
+	assert.Equal(t, 180, streams[1].outputHeight)
+	assert.Equal(t, profile.MinVideoBitrate, streams[1].params.BitrateKbps)
+}
@@ -0,0 +1,72 @@
+package gameserver
+
+// videoTransform maps between the capture rect on the screen and the video frame.
+// With a fixed output size, the rect is scaled keeping its aspect ratio and centered with black borders,
+// in the same way as videoscale with add-borders.
+type videoTransform struct {
+	rect          ScreenRect
+	outputWidth   int
+	outputHeight  int
+	contentX      int
+	contentY      int
+	contentWidth  int
+	contentHeight int
+}
+
+// newVideoTransform returns the transform of the rect into the output size.
+// The output size of 0 means the size of the rect.
+func newVideoTransform(rect ScreenRect, outputWidth, outputHeight int) *videoTransform {
+	rect = rect.clamped()
+	if outputWidth <= 0 || outputHeight <= 0 {
+		outputWidth, outputHeight = rect.Width(), rect.Height()
+	}
+	t := &videoTransform{
+		rect:          rect,
+		outputWidth:   outputWidth,
+		outputHeight:  outputHeight,
+		contentWidth:  outputWidth,
+		contentHeight: outputHeight,
+	}
+	if rect.Width() <= 0 || rect.Height() <= 0 {
+		return t
+	}
+	if outputWidth*rect.Height() < outputHeight*rect.Width() {
+		// wider than the output: borders at the top and bottom
+		t.contentHeight = rect.Height() * outputWidth / rect.Width()
+		t.contentY = (outputHeight - t.contentHeight) / 2
+	} else {
+		// taller than the output: borders at the left and right
+		t.contentWidth = rect.Width() * outputHeight / rect.Height()
+		t.contentX = (outputWidth - t.contentWidth) / 2
+	}
+	return t
+}
+
+func (t *videoTransform) OutputSize() (width, height int) {
+	return t.outputWidth, t.outputHeight
+}
+
+// ToScreen maps a point on the video to the screen.
+// Points on the borders are clamped to the edge of the capture rect.
+func (t *videoTransform) ToScreen(x, y int) (int, int) {
+	sx := t.rect.StartX + t.scale(x-t.contentX, t.rect.Width(), t.contentWidth)
+	sy := t.rect.StartY + t.scale(y-t.contentY, t.rect.Height(), t.contentHeight)
+	return clamp(sx, t.rect.StartX, t.rect.EndX-1), clamp(sy, t.rect.StartY, t.rect.EndY-1)
+}
+
+func (t *videoTransform) scale(v, screenSize, contentSize int) int {
+	if contentSize <= 0 {
+		return v
+	}
+	return v * screenSize / contentSize
+}
+
+func clamp(v, min, max int) int {
+	if v > max {
+		v = max
+	}
+	if v < min {
+		v = min
+	}
+	return v
+}
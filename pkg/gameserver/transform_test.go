@@ -0,0 +1,46 @@
+package gameserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVideoTransform(t *testing.T) {
+	// the output size follows the rect
+	tf := newVideoTransform(ScreenRect{StartX: 100, StartY: 50, EndX: 740, EndY: 530}, 0, 0)
+	w, h := tf.OutputSize()
+	assert.Equal(t, 640, w)
+	assert.Equal(t, 480, h)
+	x, y := tf.ToScreen(10, 20)
+	assert.Equal(t, 110, x)
+	assert.Equal(t, 70, y)
+
+	// 4:3 into 16:9 has borders at the left and right
+	tf = newVideoTransform(ScreenRect{StartX: 100, StartY: 50, EndX: 740, EndY: 530}, 1280, 720)
+	w, h = tf.OutputSize()
+	assert.Equal(t, 1280, w)
+	assert.Equal(t, 720, h)
+	x, y = tf.ToScreen(160, 0)
+	assert.Equal(t, 100, x)
+	assert.Equal(t, 50, y)
+	x, y = tf.ToScreen(640, 360)
+	assert.Equal(t, 420, x)
+	assert.Equal(t, 290, y)
+	// on the borders
+	x, y = tf.ToScreen(0, 0)
+	assert.Equal(t, 100, x)
+	assert.Equal(t, 50, y)
+	x, y = tf.ToScreen(1279, 719)
+	assert.Equal(t, 739, x)
+	assert.Equal(t, 529, y)
+
+	// 2:1 into 16:9 has borders at the top and bottom
+	tf = newVideoTransform(ScreenRect{StartX: 0, StartY: 0, EndX: 800, EndY: 400}, 1280, 720)
+	x, y = tf.ToScreen(640, 40)
+	assert.Equal(t, 400, x)
+	assert.Equal(t, 0, y)
+	x, y = tf.ToScreen(1280, 360)
+	assert.Equal(t, 799, x)
+	assert.Equal(t, 200, y)
+}
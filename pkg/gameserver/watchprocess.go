@@ -6,9 +6,6 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
-
-	"github.com/BurntSushi/xgbutil"
-	"github.com/castaneai/mashimaro/pkg/x11"
 )
 
 var (
@@ -20,10 +17,11 @@ func (s *GameServer) startWatchGame(ctx context.Context, pub *captureRectPubSub)
 }
 
 func (s *GameServer) startWatchCaptureRect(ctx context.Context, pub *captureRectPubSub) error {
-	xu, err := xgbutil.NewConn()
+	display, err := s.opts.openDisplay()
 	if err != nil {
 		return err
 	}
+	defer display.Close()
 	var currentRect ScreenRect
 	ticker := time.NewTicker(100 * time.Millisecond)
 	for {
@@ -31,7 +29,7 @@ func (s *GameServer) startWatchCaptureRect(ctx context.Context, pub *captureRect
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-ticker.C:
-			rect, err := getMainWindowRect(xu)
+			rect, err := display.MainWindowRect()
 			if err == errNoWindows {
 				continue
 			}
@@ -47,34 +45,6 @@ func (s *GameServer) startWatchCaptureRect(ctx context.Context, pub *captureRect
 	}
 }
 
-func getMainWindowRect(xu *xgbutil.XUtil) (*ScreenRect, error) {
-	windows, err := x11.EnumWindows(xu, xu.RootWin(), true)
-	if err != nil {
-		return nil, err
-	}
-	if len(windows) == 0 {
-		return nil, errNoWindows
-	}
-	mainWindow, err := x11.GetMainWindow(xu, windows)
-	if err != nil {
-		return nil, err
-	}
-	x, y, err := x11.GetWindowPositionOnScreen(xu, xu.Screen(), mainWindow)
-	if err != nil {
-		return nil, err
-	}
-	width, height, err := x11.GetWindowSize(xu, mainWindow)
-	if err != nil {
-		return nil, err
-	}
-	return &ScreenRect{
-		StartX: x,
-		StartY: y,
-		EndX:   x + width,
-		EndY:   y + height,
-	}, nil
-}
-
 func rectHasChanged(a1, a2 *ScreenRect) bool {
 	return a1.StartX != a2.StartX ||
 		a1.StartY != a2.StartY ||
@@ -98,6 +98,44 @@ func (s *FirestoreStore) UpdateSessionState(ctx context.Context, sid SessionID,
 	return nil
 }
 
+func (s *FirestoreStore) UpdateSessionRecording(ctx context.Context, sid SessionID, recording bool) error {
+	ds, err := s.c.Collection(s.collection).Where("sessionId", "==", sid).Documents(ctx).Next()
+	if err == iterator.Done {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !ds.Exists() {
+		return ErrSessionNotFound
+	}
+	if _, err := ds.Ref.Update(ctx, []firestore.Update{
+		{Path: "recording", Value: recording},
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *FirestoreStore) UpdateSessionConnectionStats(ctx context.Context, sid SessionID, stats *ConnectionStats) error {
+	ds, err := s.c.Collection(s.collection).Where("sessionId", "==", sid).Documents(ctx).Next()
+	if err == iterator.Done {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !ds.Exists() {
+		return ErrSessionNotFound
+	}
+	if _, err := ds.Ref.Update(ctx, []firestore.Update{
+		{Path: "connectionStats", Value: stats},
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (s *FirestoreStore) DeleteSession(ctx context.Context, sid SessionID) error {
 	ds, err := s.c.Collection(s.collection).Where("sessionId", "==", sid).Documents(ctx).Next()
 	if err == iterator.Done {
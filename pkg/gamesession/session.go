@@ -1,10 +1,29 @@
 package gamesession
 
+import "time"
+
 type SessionID string
 
 type Session struct {
-	SessionID         SessionID `firestore:"sessionId"`
-	State             State     `firestore:"state"`
-	GameID            string    `firestore:"gameId"`
-	AllocatedServerID string    `firestore:"allocatedServerId"`
+	SessionID         SessionID        `firestore:"sessionId"`
+	State             State            `firestore:"state"`
+	GameID            string           `firestore:"gameId"`
+	AllocatedServerID string           `firestore:"allocatedServerId"`
+	Recording         bool             `firestore:"recording"`
+	ConnectionStats   *ConnectionStats `firestore:"connectionStats,omitempty"`
+}
+
+// ConnectionStats is the latest summary of the quality of the connection to the player reported by the game server.
+// The counters are int64 because Firestore does not support uint64.
+type ConnectionStats struct {
+	RoundTripTimeMs float64   `firestore:"roundTripTimeMs"`
+	JitterMs        float64   `firestore:"jitterMs"`
+	PacketLoss      float64   `firestore:"packetLoss"`
+	Bitrate         int64     `firestore:"bitrate"`
+	Framerate       float64   `firestore:"framerate"`
+	FramesSent      int64     `firestore:"framesSent"`
+	NACKCount       int64     `firestore:"nackCount"`
+	PLICount        int64     `firestore:"pliCount"`
+	CandidateType   string    `firestore:"candidateType"`
+	UpdatedAt       time.Time `firestore:"updatedAt"`
 }
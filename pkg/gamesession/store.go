@@ -14,6 +14,8 @@ type Store interface {
 	GetSession(ctx context.Context, sid SessionID) (*Session, error)
 	GetSessionByAllocatedServerID(ctx context.Context, allocatedServerID string) (*Session, error)
 	UpdateSessionState(ctx context.Context, sid SessionID, newState State) error
+	UpdateSessionRecording(ctx context.Context, sid SessionID, recording bool) error
+	UpdateSessionConnectionStats(ctx context.Context, sid SessionID, stats *ConnectionStats) error
 	DeleteSession(ctx context.Context, sid SessionID) error
 }
 
@@ -86,6 +88,28 @@ func (s *InMemoryStore) UpdateSessionState(ctx context.Context, sid SessionID, n
 	return ErrSessionNotFound
 }
 
+func (s *InMemoryStore) UpdateSessionRecording(ctx context.Context, sid SessionID, recording bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss, ok := s.sessions[sid]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	ss.Recording = recording
+	return nil
+}
+
+func (s *InMemoryStore) UpdateSessionConnectionStats(ctx context.Context, sid SessionID, stats *ConnectionStats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss, ok := s.sessions[sid]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	ss.ConnectionStats = stats
+	return nil
+}
+
 func (s *InMemoryStore) DeleteSession(ctx context.Context, sid SessionID) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -0,0 +1,247 @@
+// Package gstpipeline builds GStreamer pipeline descriptions (the syntax of gst-launch-1.0)
+// from typed elements instead of formatting strings, so that a property value cannot break the description.
+package gstpipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// names of element factories, elements, properties and caps fields
+	identifierPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+	// names of pads (e.g. "sink_0", "video_%u")
+	padPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_%]*$`)
+	// media types of caps (e.g. "video/x-raw")
+	mediaTypePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*/[A-Za-z0-9_.+-]+$`)
+	// string values that need no quotes
+	bareValuePattern = regexp.MustCompile(`^[A-Za-z0-9_.:/+-]+$`)
+)
+
+// Node is a part of a chain in a pipeline: an element, caps or a reference to a pad of a named element.
+type Node interface {
+	describe() (string, error)
+}
+
+type Property struct {
+	Key   string
+	Value interface{}
+}
+
+func Prop(key string, value interface{}) Property {
+	return Property{Key: key, Value: value}
+}
+
+// Fraction is a fractional value such as a framerate.
+type Fraction struct {
+	Numerator   int
+	Denominator int
+}
+
+func (f Fraction) String() string {
+	return fmt.Sprintf("%d/%d", f.Numerator, f.Denominator)
+}
+
+type Element struct {
+	Factory    string
+	Name       string
+	Properties []Property
+}
+
+func NewElement(factory string, props ...Property) *Element {
+	return &Element{Factory: factory, Properties: props}
+}
+
+// WithName names the element so that it can be referred by name (e.g. gst_bin_get_by_name, Pad).
+func (e *Element) WithName(name string) *Element {
+	e.Name = name
+	return e
+}
+
+// Set appends a property.
+func (e *Element) Set(key string, value interface{}) *Element {
+	e.Properties = append(e.Properties, Prop(key, value))
+	return e
+}
+
+func (e *Element) describe() (string, error) {
+	if !identifierPattern.MatchString(e.Factory) {
+		return "", fmt.Errorf("invalid element factory name: %q", e.Factory)
+	}
+	parts := []string{e.Factory}
+	if e.Name != "" {
+		if !identifierPattern.MatchString(e.Name) {
+			return "", fmt.Errorf("invalid element name: %q", e.Name)
+		}
+		parts = append(parts, "name="+e.Name)
+	}
+	for _, p := range e.Properties {
+		if !identifierPattern.MatchString(p.Key) {
+			return "", fmt.Errorf("invalid property name of %s: %q", e.Factory, p.Key)
+		}
+		v, err := describeValue(p.Value)
+		if err != nil {
+			return "", fmt.Errorf("invalid property value of %s.%s: %+v", e.Factory, p.Key, err)
+		}
+		parts = append(parts, p.Key+"="+v)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// Caps restricts the format between elements.
+type Caps struct {
+	MediaType string
+	Fields    []Property
+}
+
+func NewCaps(mediaType string, fields ...Property) *Caps {
+	return &Caps{MediaType: mediaType, Fields: fields}
+}
+
+func (c *Caps) describe() (string, error) {
+	if !mediaTypePattern.MatchString(c.MediaType) {
+		return "", fmt.Errorf("invalid media type of caps: %q", c.MediaType)
+	}
+	parts := []string{c.MediaType}
+	for _, f := range c.Fields {
+		if !identifierPattern.MatchString(f.Key) {
+			return "", fmt.Errorf("invalid caps field name: %q", f.Key)
+		}
+		v, err := describeValue(f.Value)
+		if err != nil {
+			return "", fmt.Errorf("invalid caps field value of %s: %+v", f.Key, err)
+		}
+		parts = append(parts, f.Key+"="+v)
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// CapsFilter returns a capsfilter element, which can be named unlike caps in a chain.
+func CapsFilter(caps *Caps) *Element {
+	return NewElement("capsfilter", Prop("caps", caps))
+}
+
+// Pad refers to a pad of a named element (e.g. "mux.video_0"), or any pad of it when the pad is empty.
+type Pad struct {
+	Element string
+	Pad     string
+}
+
+func (p Pad) describe() (string, error) {
+	if !identifierPattern.MatchString(p.Element) {
+		return "", fmt.Errorf("invalid element name of pad: %q", p.Element)
+	}
+	if p.Pad == "" {
+		return p.Element + ".", nil
+	}
+	if !padPattern.MatchString(p.Pad) {
+		return "", fmt.Errorf("invalid pad name: %q", p.Pad)
+	}
+	return p.Element + "." + p.Pad, nil
+}
+
+// Pipeline is a set of chains of linked nodes.
+type Pipeline struct {
+	chains [][]Node
+}
+
+// New returns a pipeline with a chain of the nodes.
+func New(nodes ...Node) *Pipeline {
+	return &Pipeline{chains: [][]Node{nodes}}
+}
+
+// Link appends the nodes to the last chain.
+func (p *Pipeline) Link(nodes ...Node) *Pipeline {
+	if len(p.chains) == 0 {
+		p.chains = append(p.chains, nil)
+	}
+	last := len(p.chains) - 1
+	p.chains[last] = append(p.chains[last], nodes...)
+	return p
+}
+
+// Branch starts a new chain, which usually starts from a Pad of a named element.
+func (p *Pipeline) Branch(nodes ...Node) *Pipeline {
+	p.chains = append(p.chains, nodes)
+	return p
+}
+
+// Elements returns all elements in the pipeline.
+func (p *Pipeline) Elements() []*Element {
+	var elements []*Element
+	for _, chain := range p.chains {
+		for _, node := range chain {
+			if e, ok := node.(*Element); ok {
+				elements = append(elements, e)
+			}
+		}
+	}
+	return elements
+}
+
+// Compile returns the pipeline description for gst_parse_launch.
+func (p *Pipeline) Compile() (string, error) {
+	var chains []string
+	for _, chain := range p.chains {
+		if len(chain) == 0 {
+			continue
+		}
+		var descs []string
+		for _, node := range chain {
+			desc, err := node.describe()
+			if err != nil {
+				return "", err
+			}
+			descs = append(descs, desc)
+		}
+		chains = append(chains, strings.Join(descs, " ! "))
+	}
+	if len(chains) == 0 {
+		return "", fmt.Errorf("empty pipeline")
+	}
+	return strings.Join(chains, " "), nil
+}
+
+func describeValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return quoteString(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case Fraction:
+		if v.Denominator == 0 {
+			return "", fmt.Errorf("zero denominator")
+		}
+		return v.String(), nil
+	case *Caps:
+		desc, err := v.describe()
+		if err != nil {
+			return "", err
+		}
+		return quoteString(desc), nil
+	default:
+		return "", fmt.Errorf("unsupported value type: %T", v)
+	}
+}
+
+func quoteString(s string) string {
+	if bareValuePattern.MatchString(s) {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,69 @@
+package gstpipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	p := New(
+		NewElement("ximagesrc", Prop("display-name", ":0"), Prop("use-damage", false), Prop("startx", 0)),
+		CapsFilter(NewCaps("video/x-raw", Prop("framerate", Fraction{60, 1}))).WithName("framerate"),
+		NewElement("videoconvert"),
+		NewCaps("video/x-raw", Prop("format", "I420")),
+	).Link(
+		NewElement("x264enc", Prop("bitrate", uint32(2000))).WithName("encoder"),
+		NewElement("matroskamux").WithName("mux"),
+		NewElement("filesink", Prop("location", "/tmp/my video.mkv")),
+	).Branch(
+		NewElement("audiotestsrc"),
+		NewElement("opusenc"),
+		Pad{Element: "mux", Pad: "audio_%u"},
+	)
+	desc, err := p.Compile()
+	assert.NoError(t, err)
+	assert.Equal(t, `ximagesrc display-name=:0 use-damage=false startx=0`+
+		` ! capsfilter name=framerate caps="video/x-raw,framerate=60/1"`+
+		` ! videoconvert ! video/x-raw,format=I420`+
+		` ! x264enc name=encoder bitrate=2000 ! matroskamux name=mux ! filesink location="/tmp/my video.mkv"`+
+		` audiotestsrc ! opusenc ! mux.audio_%u`, desc)
+
+	var factories []string
+	for _, e := range p.Elements() {
+		factories = append(factories, e.Factory)
+	}
+	assert.Equal(t, []string{"ximagesrc", "capsfilter", "videoconvert", "x264enc", "matroskamux", "filesink", "audiotestsrc", "opusenc"}, factories)
+}
+
+func TestEscaping(t *testing.T) {
+	// an injected value stays in the property
+	desc, err := New(NewElement("ximagesrc", Prop("display-name", `:0 ! filesink location=/etc/passwd`))).Compile()
+	assert.NoError(t, err)
+	assert.Equal(t, `ximagesrc display-name=":0 ! filesink location=/etc/passwd"`, desc)
+
+	desc, err = New(NewElement("textoverlay", Prop("text", `say "hello" \o/`))).Compile()
+	assert.NoError(t, err)
+	assert.Equal(t, `textoverlay text="say \"hello\" \\o/"`, desc)
+
+	desc, err = New(NewElement("textoverlay", Prop("text", ""))).Compile()
+	assert.NoError(t, err)
+	assert.Equal(t, `textoverlay text=""`, desc)
+}
+
+func TestInvalid(t *testing.T) {
+	invalids := []*Pipeline{
+		New(),
+		New(NewElement("videotestsrc ! filesink")),
+		New(NewElement("videotestsrc").WithName("a b")),
+		New(NewElement("videotestsrc", Prop("pattern=0 ! filesink", 0))),
+		New(NewElement("videotestsrc", Prop("pattern", []string{"a"}))),
+		New(NewElement("videotestsrc"), NewCaps("video")),
+		New(NewElement("videotestsrc"), NewCaps("video/x-raw", Prop("framerate", Fraction{60, 0}))),
+		New(NewElement("videotestsrc"), Pad{Element: "mux", Pad: "sink !"}),
+	}
+	for _, p := range invalids {
+		_, err := p.Compile()
+		assert.Error(t, err)
+	}
+}
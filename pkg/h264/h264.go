@@ -0,0 +1,288 @@
+// Package h264 reads H.264 byte-streams (Annex B) from the encoder for the containers (e.g. Matroska and MP4).
+package h264
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	NALTypeIDR = 5
+	NALTypeSPS = 7
+	NALTypePPS = 8
+)
+
+// NALType returns the type of the NAL unit without the start code.
+func NALType(nalu []byte) int {
+	if len(nalu) == 0 {
+		return 0
+	}
+	return int(nalu[0] & 0x1F)
+}
+
+// SplitAnnexB splits a byte-stream into NAL units without start codes.
+func SplitAnnexB(stream []byte) [][]byte {
+	var nalus [][]byte
+	start := -1
+	for i := 0; i+2 < len(stream); i++ {
+		if stream[i] != 0 || stream[i+1] != 0 || stream[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			nalus = appendNALU(nalus, stream[start:i])
+		}
+		start = i + 3
+		i += 2
+	}
+	if start >= 0 {
+		nalus = appendNALU(nalus, stream[start:])
+	}
+	return nalus
+}
+
+func appendNALU(nalus [][]byte, nalu []byte) [][]byte {
+	// the zero before a 4-byte start code belongs to the start code
+	nalu = bytes.TrimRight(nalu, "\x00")
+	if len(nalu) == 0 {
+		return nalus
+	}
+	return append(nalus, nalu)
+}
+
+// IsKeyframe returns whether the frame has an IDR picture, which can be decoded by itself.
+func IsKeyframe(frame []byte) bool {
+	for _, nalu := range SplitAnnexB(frame) {
+		if NALType(nalu) == NALTypeIDR {
+			return true
+		}
+	}
+	return false
+}
+
+// AnnexBToAVC converts a byte-stream to NAL units with 4-byte length prefixes, which Matroska and MP4 require.
+func AnnexBToAVC(stream []byte) []byte {
+	var buf []byte
+	for _, nalu := range SplitAnnexB(stream) {
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint32(size, uint32(len(nalu)))
+		buf = append(append(buf, size...), nalu...)
+	}
+	return buf
+}
+
+// ParameterSets returns SPS and PPS in a keyframe.
+func ParameterSets(keyframe []byte) (sps, pps []byte, err error) {
+	for _, nalu := range SplitAnnexB(keyframe) {
+		switch NALType(nalu) {
+		case NALTypeSPS:
+			sps = nalu
+		case NALTypePPS:
+			pps = nalu
+		}
+	}
+	if len(sps) < 4 || len(pps) == 0 {
+		return nil, nil, fmt.Errorf("SPS or PPS not found in the keyframe")
+	}
+	return sps, pps, nil
+}
+
+// DecoderConfig returns AVCDecoderConfigurationRecord (ISO/IEC 14496-15) from SPS and PPS in a keyframe.
+func DecoderConfig(keyframe []byte) ([]byte, error) {
+	sps, pps, err := ParameterSets(keyframe)
+	if err != nil {
+		return nil, err
+	}
+	buf := []byte{
+		1,      // configurationVersion
+		sps[1], // AVCProfileIndication
+		sps[2], // profile_compatibility
+		sps[3], // AVCLevelIndication
+		0xFF,   // lengthSizeMinusOne: 3
+		0xE1,   // numOfSequenceParameterSets: 1
+	}
+	buf = append(buf, byte(len(sps)>>8), byte(len(sps)))
+	buf = append(buf, sps...)
+	buf = append(buf, 1, byte(len(pps)>>8), byte(len(pps)))
+	buf = append(buf, pps...)
+	return buf, nil
+}
+
+// PictureSize returns the width and height of the pictures in pixels from SPS (ITU-T H.264 7.3.2.1.1),
+// excluding the cropped edges.
+func PictureSize(sps []byte) (width, height int, err error) {
+	if NALType(sps) != NALTypeSPS {
+		return 0, 0, errors.New("not an SPS")
+	}
+	r := &bitReader{data: unescapeRBSP(sps[1:])}
+	profileIDC := r.readBits(8)
+	r.skipBits(16) // constraint_set flags and level_idc
+	r.readUE()     // seq_parameter_set_id
+	chromaFormatIDC := uint32(1)
+	separateColourPlane := false
+	switch profileIDC {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormatIDC = r.readUE()
+		if chromaFormatIDC == 3 {
+			separateColourPlane = r.readBits(1) == 1
+		}
+		r.readUE()    // bit_depth_luma_minus8
+		r.readUE()    // bit_depth_chroma_minus8
+		r.skipBits(1) // qpprime_y_zero_transform_bypass_flag
+		scalingMatrixPresent := r.readBits(1) == 1
+		if scalingMatrixPresent {
+			lists := 8
+			if chromaFormatIDC == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				listPresent := r.readBits(1) == 1
+				if !listPresent {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				r.skipScalingList(size)
+			}
+		}
+	}
+	r.readUE() // log2_max_frame_num_minus4
+	picOrderCntType := r.readUE()
+	switch picOrderCntType {
+	case 0:
+		r.readUE() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.skipBits(1) // delta_pic_order_always_zero_flag
+		r.readSE()    // offset_for_non_ref_pic
+		r.readSE()    // offset_for_top_to_bottom_field
+		cycle := r.readUE()
+		for i := uint32(0); i < cycle && r.err == nil; i++ {
+			r.readSE() // offset_for_ref_frame
+		}
+	}
+	r.readUE()    // max_num_ref_frames
+	r.skipBits(1) // gaps_in_frame_num_value_allowed_flag
+	widthInMBs := int(r.readUE()) + 1
+	heightInMapUnits := int(r.readUE()) + 1
+	frameMBsOnly := int(r.readBits(1))
+	if frameMBsOnly == 0 {
+		r.skipBits(1) // mb_adaptive_frame_field_flag
+	}
+	r.skipBits(1) // direct_8x8_inference_flag
+	var cropLeft, cropRight, cropTop, cropBottom int
+	frameCropping := r.readBits(1) == 1
+	if frameCropping {
+		cropLeft = int(r.readUE())
+		cropRight = int(r.readUE())
+		cropTop = int(r.readUE())
+		cropBottom = int(r.readUE())
+	}
+	if r.err != nil {
+		return 0, 0, errors.Wrap(r.err, "failed to parse SPS")
+	}
+
+	// the units of cropping depend on the chroma subsampling (Table 6-1)
+	cropUnitX, cropUnitY := 1, 2-frameMBsOnly
+	if !separateColourPlane {
+		switch chromaFormatIDC {
+		case 1:
+			cropUnitX, cropUnitY = 2, 2*(2-frameMBsOnly)
+		case 2:
+			cropUnitX, cropUnitY = 2, 2-frameMBsOnly
+		}
+	}
+	width = widthInMBs*16 - cropUnitX*(cropLeft+cropRight)
+	height = (2-frameMBsOnly)*heightInMapUnits*16 - cropUnitY*(cropTop+cropBottom)
+	if width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid picture size in SPS: %dx%d", width, height)
+	}
+	return width, height, nil
+}
+
+// unescapeRBSP removes emulation prevention bytes (0x03 of 0x000003).
+func unescapeRBSP(data []byte) []byte {
+	buf := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
+
+var errShortRBSP = errors.New("unexpected end of RBSP")
+
+// bitReader reads RBSP bit by bit, and keeps the first error to be checked after reading.
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *bitReader) readBits(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = errShortRBSP
+			return 0
+		}
+		bit := (r.data[r.pos/8] >> (7 - uint(r.pos%8))) & 1
+		v = v<<1 | uint32(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) skipBits(n int) {
+	r.readBits(n)
+}
+
+// readUE reads an Exp-Golomb code.
+func (r *bitReader) readUE() uint32 {
+	zeros := 0
+	for r.readBits(1) == 0 {
+		if r.err != nil {
+			return 0
+		}
+		zeros++
+		if zeros > 31 {
+			r.err = errors.New("invalid Exp-Golomb code")
+			return 0
+		}
+	}
+	return (1<<uint(zeros) - 1) + r.readBits(zeros)
+}
+
+// readSE reads a signed Exp-Golomb code.
+func (r *bitReader) readSE() int32 {
+	v := r.readUE()
+	if v%2 == 1 {
+		return int32((v + 1) / 2)
+	}
+	return -int32(v / 2)
+}
+
+func (r *bitReader) skipScalingList(size int) {
+	lastScale, nextScale := int32(8), int32(8)
+	for i := 0; i < size && r.err == nil; i++ {
+		if nextScale != 0 {
+			delta := r.readSE()
+			nextScale = (lastScale + delta + 256) % 256
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package h264
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bitWriter writes RBSP of SPS for tests.
+type bitWriter struct {
+	bits []byte
+}
+
+func (w *bitWriter) writeBits(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.bits = append(w.bits, byte(v>>uint(i))&1)
+	}
+}
+
+func (w *bitWriter) writeUE(v uint32) {
+	v++
+	n := 0
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+	w.writeBits(0, n)
+	w.writeBits(v, n+1)
+}
+
+func (w *bitWriter) bytes() []byte {
+	// rbsp_trailing_bits
+	w.writeBits(1, 1)
+	for len(w.bits)%8 != 0 {
+		w.writeBits(0, 1)
+	}
+	buf := make([]byte, len(w.bits)/8)
+	for i, bit := range w.bits {
+		buf[i/8] |= bit << (7 - uint(i%8))
+	}
+	return buf
+}
+
+func newSPS(profileIDC uint32, widthInMBs, heightInMapUnits uint32, frameMBsOnly bool, crop [4]uint32) []byte {
+	w := &bitWriter{}
+	w.writeBits(profileIDC, 8)
+	w.writeBits(0, 8)  // constraint_set flags
+	w.writeBits(31, 8) // level_idc
+	w.writeUE(0)       // seq_parameter_set_id
+	if profileIDC == 100 {
+		w.writeUE(1)      // chroma_format_idc
+		w.writeUE(0)      // bit_depth_luma_minus8
+		w.writeUE(0)      // bit_depth_chroma_minus8
+		w.writeBits(0, 1) // qpprime_y_zero_transform_bypass_flag
+		w.writeBits(0, 1) // seq_scaling_matrix_present_flag
+	}
+	w.writeUE(0)      // log2_max_frame_num_minus4
+	w.writeUE(2)      // pic_order_cnt_type
+	w.writeUE(1)      // max_num_ref_frames
+	w.writeBits(0, 1) // gaps_in_frame_num_value_allowed_flag
+	w.writeUE(widthInMBs - 1)
+	w.writeUE(heightInMapUnits - 1)
+	if frameMBsOnly {
+		w.writeBits(1, 1)
+	} else {
+		w.writeBits(0, 2) // and mb_adaptive_frame_field_flag
+	}
+	w.writeBits(1, 1) // direct_8x8_inference_flag
+	if crop == [4]uint32{} {
+		w.writeBits(0, 1)
+	} else {
+		w.writeBits(1, 1)
+		for _, c := range crop {
+			w.writeUE(c)
+		}
+	}
+	w.writeBits(0, 1) // vui_parameters_present_flag
+	return append([]byte{0x67}, w.bytes()...)
+}
+
+func TestPictureSize(t *testing.T) {
+	testCases := []struct {
+		name   string
+		sps    []byte
+		width  int
+		height int
+	}{
+		{name: "baseline 1280x720", sps: newSPS(66, 80, 45, true, [4]uint32{}), width: 1280, height: 720},
+		{name: "cropped 1920x1080", sps: newSPS(66, 120, 68, true, [4]uint32{0, 0, 0, 4}), width: 1920, height: 1080},
+		{name: "high profile 854x480", sps: newSPS(100, 54, 30, true, [4]uint32{0, 5, 0, 0}), width: 854, height: 480},
+		{name: "interlaced 720x576", sps: newSPS(66, 45, 18, false, [4]uint32{}), width: 720, height: 576},
+		{
+			// encoded by x264 with emulation prevention bytes
+			name:   "x264 1920x1080",
+			sps:    []byte{0x67, 0x64, 0x00, 0x28, 0xac, 0xd9, 0x40, 0x78, 0x02, 0x27, 0xe5, 0xc0, 0x44, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc6, 0x58},
+			width:  1920,
+			height: 1080,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			width, height, err := PictureSize(tc.sps)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.width, width)
+			assert.Equal(t, tc.height, height)
+		})
+	}
+
+	_, _, err := PictureSize([]byte{0x68, 0xce, 0x38, 0x80})
+	assert.Error(t, err)
+	_, _, err = PictureSize([]byte{0x67, 0x42})
+	assert.Error(t, err)
+}
+
+func TestKeyframe(t *testing.T) {
+	sps := newSPS(66, 80, 45, true, [4]uint32{})
+	pps := []byte{0x68, 0xce, 0x38, 0x80}
+	idr := []byte{0x65, 0x88, 0x84}
+	keyframe := bytes.Join([][]byte{{}, sps, pps, idr}, []byte{0, 0, 0, 1})
+	assert.True(t, IsKeyframe(keyframe))
+	assert.False(t, IsKeyframe([]byte{0, 0, 1, 0x41, 0x9a}))
+	assert.Equal(t, [][]byte{sps, pps, idr}, SplitAnnexB(keyframe))
+
+	config, err := DecoderConfig(keyframe)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, sps[1], sps[2], sps[3], 0xff, 0xe1, 0, byte(len(sps))}, config[:8])
+	_, err = DecoderConfig([]byte{0, 0, 1, 0x65, 0x88})
+	assert.Error(t, err)
+
+	avc := AnnexBToAVC(keyframe)
+	assert.Equal(t, []byte{0, 0, 0, byte(len(sps))}, avc[:4])
+	assert.Len(t, avc, 12+len(sps)+len(pps)+len(idr))
+}
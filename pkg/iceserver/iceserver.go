@@ -0,0 +1,62 @@
+package iceserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+const DefaultTURNCredentialTTL = 12 * time.Hour
+
+// DefaultConfig uses the public STUN server of Google, which is not enough for players behind symmetric NAT.
+var DefaultConfig = Config{
+	STUNURLs: []string{"stun:stun.l.google.com:19302"},
+}
+
+// Server is an ICE server in the same form as RTCIceServer of browsers.
+type Server struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// Config is the ICE servers for the game server and players.
+type Config struct {
+	STUNURLs []string
+	// e.g. "turn:turn.example.com:3478?transport=udp", "turns:turn.example.com:5349?transport=tcp"
+	TURNURLs []string
+	// TURNSecret is the secret shared with the TURN server (e.g. static-auth-secret of coturn).
+	// Time-limited credentials are generated with it.
+	TURNSecret string
+	// DefaultTURNCredentialTTL is used if zero.
+	TURNCredentialTTL time.Duration
+}
+
+// Servers returns the ICE servers with TURN credentials for the user, which expire after the TTL from now.
+func (c Config) Servers(user string, now time.Time) []Server {
+	var servers []Server
+	if len(c.STUNURLs) > 0 {
+		servers = append(servers, Server{URLs: c.STUNURLs})
+	}
+	if len(c.TURNURLs) > 0 {
+		ttl := c.TURNCredentialTTL
+		if ttl <= 0 {
+			ttl = DefaultTURNCredentialTTL
+		}
+		username, credential := TURNCredential(c.TURNSecret, user, now.Add(ttl))
+		servers = append(servers, Server{URLs: c.TURNURLs, Username: username, Credential: credential})
+	}
+	return servers
+}
+
+// TURNCredential generates a credential valid until the expiry in the TURN REST API style
+// (https://tools.ietf.org/html/draft-uberti-behave-turn-rest-00).
+// The username is "<expiry unix time>:<user>" and the password is base64(HMAC-SHA1(secret, username)).
+func TURNCredential(secret, user string, expiresAt time.Time) (username, password string) {
+	username = fmt.Sprintf("%d:%s", expiresAt.Unix(), user)
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
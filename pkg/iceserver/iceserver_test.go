@@ -0,0 +1,35 @@
+package iceserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTURNCredential(t *testing.T) {
+	username, password := TURNCredential("secret", "session1-player", time.Unix(1600000000, 0))
+	assert.Equal(t, "1600000000:session1-player", username)
+	// echo -n "1600000000:session1-player" | openssl dgst -sha1 -hmac secret -binary | base64
+	assert.Equal(t, "GSUFEcR5jCz7A//1Cyy/+aVX7hU=", password)
+}
+
+func TestServers(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	assert.Equal(t, []Server{{URLs: []string{"stun:stun.l.google.com:19302"}}}, DefaultConfig.Servers("session1-player", now))
+
+	conf := Config{
+		STUNURLs:          []string{"stun:turn.example.com:3478"},
+		TURNURLs:          []string{"turn:turn.example.com:3478?transport=udp", "turns:turn.example.com:5349?transport=tcp"},
+		TURNSecret:        "secret",
+		TURNCredentialTTL: time.Hour,
+	}
+	assert.Equal(t, []Server{
+		{URLs: []string{"stun:turn.example.com:3478"}},
+		{
+			URLs:       []string{"turn:turn.example.com:3478?transport=udp", "turns:turn.example.com:5349?transport=tcp"},
+			Username:   "1600003600:session1-player",
+			Credential: "iNVdXKfg5taiEUCCktO5Cc8rY1g=",
+		},
+	}, conf.Servers("session1-player", now))
+}
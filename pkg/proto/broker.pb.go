@@ -8,6 +8,7 @@ It is generated from these files:
 	proto/broker.proto
 	proto/encoder.proto
 	proto/gameprocess.proto
+	proto/gameserver.proto
 
 It has these top-level messages:
 	FindSessionRequest
@@ -18,12 +19,36 @@ It has these top-level messages:
 	GetGameMetadataRequest
 	GetGameMetadataResponse
 	GameMetadata
+	SetRecordingRequest
+	SetRecordingResponse
+	UpdateGameThumbnailRequest
+	UpdateGameThumbnailResponse
+	ConnectionStats
+	ReportConnectionStatsRequest
+	ReportConnectionStatsResponse
 	StartEncodingRequest
 	StartEncodingResponse
+	RequestKeyframeRequest
+	RequestKeyframeResponse
+	UpdateEncodingParamsRequest
+	UpdateEncodingParamsResponse
+	GetCapabilitiesRequest
+	GetCapabilitiesResponse
+	UpdateVideoGeometryRequest
+	UpdateVideoGeometryResponse
+	StartDecodingRequest
+	StartDecodingResponse
+	GetPipelineStatusRequest
+	GetPipelineStatusResponse
+	PipelineRestart
+	WatchPipelineRequest
+	PipelineEvent
 	StartGameRequest
 	StartGameResponse
 	ExitGameRequest
 	ExitGameResponse
+	TakeScreenshotRequest
+	TakeScreenshotResponse
 */
 package proto
 
@@ -123,6 +148,7 @@ type Session struct {
 	SessionId         string `protobuf:"bytes,1,opt,name=session_id,json=sessionId" json:"session_id,omitempty"`
 	AllocatedServerId string `protobuf:"bytes,2,opt,name=allocated_server_id,json=allocatedServerId" json:"allocated_server_id,omitempty"`
 	GameId            string `protobuf:"bytes,3,opt,name=game_id,json=gameId" json:"game_id,omitempty"`
+	Recording         bool   `protobuf:"varint,4,opt,name=recording" json:"recording,omitempty"`
 }
 
 func (m *Session) Reset()                    { *m = Session{} }
@@ -151,6 +177,13 @@ func (m *Session) GetGameId() string {
 	return ""
 }
 
+func (m *Session) GetRecording() bool {
+	if m != nil {
+		return m.Recording
+	}
+	return false
+}
+
 type GetGameMetadataRequest struct {
 	GameId string `protobuf:"bytes,1,opt,name=game_id,json=gameId" json:"game_id,omitempty"`
 }
@@ -199,6 +232,194 @@ func (m *GameMetadata) GetBody() string {
 	return ""
 }
 
+type SetRecordingRequest struct {
+	SessionId string `protobuf:"bytes,1,opt,name=session_id,json=sessionId" json:"session_id,omitempty"`
+	Recording bool   `protobuf:"varint,2,opt,name=recording" json:"recording,omitempty"`
+}
+
+func (m *SetRecordingRequest) Reset()                    { *m = SetRecordingRequest{} }
+func (m *SetRecordingRequest) String() string            { return proto1.CompactTextString(m) }
+func (*SetRecordingRequest) ProtoMessage()               {}
+func (*SetRecordingRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *SetRecordingRequest) GetSessionId() string {
+	if m != nil {
+		return m.SessionId
+	}
+	return ""
+}
+
+func (m *SetRecordingRequest) GetRecording() bool {
+	if m != nil {
+		return m.Recording
+	}
+	return false
+}
+
+type SetRecordingResponse struct {
+}
+
+func (m *SetRecordingResponse) Reset()                    { *m = SetRecordingResponse{} }
+func (m *SetRecordingResponse) String() string            { return proto1.CompactTextString(m) }
+func (*SetRecordingResponse) ProtoMessage()               {}
+func (*SetRecordingResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+type UpdateGameThumbnailRequest struct {
+	GameId      string `protobuf:"bytes,1,opt,name=game_id,json=gameId" json:"game_id,omitempty"`
+	Image       []byte `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	ContentType string `protobuf:"bytes,3,opt,name=content_type,json=contentType" json:"content_type,omitempty"`
+}
+
+func (m *UpdateGameThumbnailRequest) Reset()                    { *m = UpdateGameThumbnailRequest{} }
+func (m *UpdateGameThumbnailRequest) String() string            { return proto1.CompactTextString(m) }
+func (*UpdateGameThumbnailRequest) ProtoMessage()               {}
+func (*UpdateGameThumbnailRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *UpdateGameThumbnailRequest) GetGameId() string {
+	if m != nil {
+		return m.GameId
+	}
+	return ""
+}
+
+func (m *UpdateGameThumbnailRequest) GetImage() []byte {
+	if m != nil {
+		return m.Image
+	}
+	return nil
+}
+
+func (m *UpdateGameThumbnailRequest) GetContentType() string {
+	if m != nil {
+		return m.ContentType
+	}
+	return ""
+}
+
+type UpdateGameThumbnailResponse struct {
+}
+
+func (m *UpdateGameThumbnailResponse) Reset()                    { *m = UpdateGameThumbnailResponse{} }
+func (m *UpdateGameThumbnailResponse) String() string            { return proto1.CompactTextString(m) }
+func (*UpdateGameThumbnailResponse) ProtoMessage()               {}
+func (*UpdateGameThumbnailResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+// ConnectionStats is a summary of the quality of the connection to the player.
+type ConnectionStats struct {
+	RoundTripTimeMs float64 `protobuf:"fixed64,1,opt,name=round_trip_time_ms,json=roundTripTimeMs" json:"round_trip_time_ms,omitempty"`
+	JitterMs        float64 `protobuf:"fixed64,2,opt,name=jitter_ms,json=jitterMs" json:"jitter_ms,omitempty"`
+	// the fraction of lost packets (0.0 - 1.0)
+	PacketLoss float64 `protobuf:"fixed64,3,opt,name=packet_loss,json=packetLoss" json:"packet_loss,omitempty"`
+	// bits per second
+	Bitrate    int64   `protobuf:"varint,4,opt,name=bitrate" json:"bitrate,omitempty"`
+	Framerate  float64 `protobuf:"fixed64,5,opt,name=framerate" json:"framerate,omitempty"`
+	FramesSent uint64  `protobuf:"varint,6,opt,name=frames_sent,json=framesSent" json:"frames_sent,omitempty"`
+	NackCount  uint64  `protobuf:"varint,7,opt,name=nack_count,json=nackCount" json:"nack_count,omitempty"`
+	PliCount   uint64  `protobuf:"varint,8,opt,name=pli_count,json=pliCount" json:"pli_count,omitempty"`
+	// the local candidate type of the selected candidate pair (host, srflx, prflx or relay)
+	CandidateType string `protobuf:"bytes,9,opt,name=candidate_type,json=candidateType" json:"candidate_type,omitempty"`
+}
+
+func (m *ConnectionStats) Reset()                    { *m = ConnectionStats{} }
+func (m *ConnectionStats) String() string            { return proto1.CompactTextString(m) }
+func (*ConnectionStats) ProtoMessage()               {}
+func (*ConnectionStats) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *ConnectionStats) GetRoundTripTimeMs() float64 {
+	if m != nil {
+		return m.RoundTripTimeMs
+	}
+	return 0
+}
+
+func (m *ConnectionStats) GetJitterMs() float64 {
+	if m != nil {
+		return m.JitterMs
+	}
+	return 0
+}
+
+func (m *ConnectionStats) GetPacketLoss() float64 {
+	if m != nil {
+		return m.PacketLoss
+	}
+	return 0
+}
+
+func (m *ConnectionStats) GetBitrate() int64 {
+	if m != nil {
+		return m.Bitrate
+	}
+	return 0
+}
+
+func (m *ConnectionStats) GetFramerate() float64 {
+	if m != nil {
+		return m.Framerate
+	}
+	return 0
+}
+
+func (m *ConnectionStats) GetFramesSent() uint64 {
+	if m != nil {
+		return m.FramesSent
+	}
+	return 0
+}
+
+func (m *ConnectionStats) GetNackCount() uint64 {
+	if m != nil {
+		return m.NackCount
+	}
+	return 0
+}
+
+func (m *ConnectionStats) GetPliCount() uint64 {
+	if m != nil {
+		return m.PliCount
+	}
+	return 0
+}
+
+func (m *ConnectionStats) GetCandidateType() string {
+	if m != nil {
+		return m.CandidateType
+	}
+	return ""
+}
+
+type ReportConnectionStatsRequest struct {
+	SessionId string           `protobuf:"bytes,1,opt,name=session_id,json=sessionId" json:"session_id,omitempty"`
+	Stats     *ConnectionStats `protobuf:"bytes,2,opt,name=stats" json:"stats,omitempty"`
+}
+
+func (m *ReportConnectionStatsRequest) Reset()                    { *m = ReportConnectionStatsRequest{} }
+func (m *ReportConnectionStatsRequest) String() string            { return proto1.CompactTextString(m) }
+func (*ReportConnectionStatsRequest) ProtoMessage()               {}
+func (*ReportConnectionStatsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+func (m *ReportConnectionStatsRequest) GetSessionId() string {
+	if m != nil {
+		return m.SessionId
+	}
+	return ""
+}
+
+func (m *ReportConnectionStatsRequest) GetStats() *ConnectionStats {
+	if m != nil {
+		return m.Stats
+	}
+	return nil
+}
+
+type ReportConnectionStatsResponse struct {
+}
+
+func (m *ReportConnectionStatsResponse) Reset()                    { *m = ReportConnectionStatsResponse{} }
+func (m *ReportConnectionStatsResponse) String() string            { return proto1.CompactTextString(m) }
+func (*ReportConnectionStatsResponse) ProtoMessage()               {}
+func (*ReportConnectionStatsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
 func init() {
 	proto1.RegisterType((*FindSessionRequest)(nil), "FindSessionRequest")
 	proto1.RegisterType((*FindSessionResponse)(nil), "FindSessionResponse")
@@ -208,6 +429,13 @@ func init() {
 	proto1.RegisterType((*GetGameMetadataRequest)(nil), "GetGameMetadataRequest")
 	proto1.RegisterType((*GetGameMetadataResponse)(nil), "GetGameMetadataResponse")
 	proto1.RegisterType((*GameMetadata)(nil), "GameMetadata")
+	proto1.RegisterType((*SetRecordingRequest)(nil), "SetRecordingRequest")
+	proto1.RegisterType((*SetRecordingResponse)(nil), "SetRecordingResponse")
+	proto1.RegisterType((*UpdateGameThumbnailRequest)(nil), "UpdateGameThumbnailRequest")
+	proto1.RegisterType((*UpdateGameThumbnailResponse)(nil), "UpdateGameThumbnailResponse")
+	proto1.RegisterType((*ConnectionStats)(nil), "ConnectionStats")
+	proto1.RegisterType((*ReportConnectionStatsRequest)(nil), "ReportConnectionStatsRequest")
+	proto1.RegisterType((*ReportConnectionStatsResponse)(nil), "ReportConnectionStatsResponse")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -224,6 +452,9 @@ type BrokerClient interface {
 	FindSession(ctx context.Context, in *FindSessionRequest, opts ...grpc.CallOption) (*FindSessionResponse, error)
 	DeleteSession(ctx context.Context, in *DeleteSessionRequest, opts ...grpc.CallOption) (*DeleteSessionResponse, error)
 	GetGameMetadata(ctx context.Context, in *GetGameMetadataRequest, opts ...grpc.CallOption) (*GetGameMetadataResponse, error)
+	SetRecording(ctx context.Context, in *SetRecordingRequest, opts ...grpc.CallOption) (*SetRecordingResponse, error)
+	UpdateGameThumbnail(ctx context.Context, in *UpdateGameThumbnailRequest, opts ...grpc.CallOption) (*UpdateGameThumbnailResponse, error)
+	ReportConnectionStats(ctx context.Context, in *ReportConnectionStatsRequest, opts ...grpc.CallOption) (*ReportConnectionStatsResponse, error)
 }
 
 type brokerClient struct {
@@ -261,12 +492,42 @@ func (c *brokerClient) GetGameMetadata(ctx context.Context, in *GetGameMetadataR
 	return out, nil
 }
 
+func (c *brokerClient) SetRecording(ctx context.Context, in *SetRecordingRequest, opts ...grpc.CallOption) (*SetRecordingResponse, error) {
+	out := new(SetRecordingResponse)
+	err := grpc.Invoke(ctx, "/Broker/SetRecording", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokerClient) UpdateGameThumbnail(ctx context.Context, in *UpdateGameThumbnailRequest, opts ...grpc.CallOption) (*UpdateGameThumbnailResponse, error) {
+	out := new(UpdateGameThumbnailResponse)
+	err := grpc.Invoke(ctx, "/Broker/UpdateGameThumbnail", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *brokerClient) ReportConnectionStats(ctx context.Context, in *ReportConnectionStatsRequest, opts ...grpc.CallOption) (*ReportConnectionStatsResponse, error) {
+	out := new(ReportConnectionStatsResponse)
+	err := grpc.Invoke(ctx, "/Broker/ReportConnectionStats", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Broker service
 
 type BrokerServer interface {
 	FindSession(context.Context, *FindSessionRequest) (*FindSessionResponse, error)
 	DeleteSession(context.Context, *DeleteSessionRequest) (*DeleteSessionResponse, error)
 	GetGameMetadata(context.Context, *GetGameMetadataRequest) (*GetGameMetadataResponse, error)
+	SetRecording(context.Context, *SetRecordingRequest) (*SetRecordingResponse, error)
+	UpdateGameThumbnail(context.Context, *UpdateGameThumbnailRequest) (*UpdateGameThumbnailResponse, error)
+	ReportConnectionStats(context.Context, *ReportConnectionStatsRequest) (*ReportConnectionStatsResponse, error)
 }
 
 func RegisterBrokerServer(s *grpc.Server, srv BrokerServer) {
@@ -327,6 +588,60 @@ func _Broker_GetGameMetadata_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Broker_SetRecording_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRecordingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokerServer).SetRecording(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Broker/SetRecording",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokerServer).SetRecording(ctx, req.(*SetRecordingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Broker_UpdateGameThumbnail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateGameThumbnailRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokerServer).UpdateGameThumbnail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Broker/UpdateGameThumbnail",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokerServer).UpdateGameThumbnail(ctx, req.(*UpdateGameThumbnailRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Broker_ReportConnectionStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReportConnectionStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BrokerServer).ReportConnectionStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Broker/ReportConnectionStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BrokerServer).ReportConnectionStats(ctx, req.(*ReportConnectionStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Broker_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "Broker",
 	HandlerType: (*BrokerServer)(nil),
@@ -343,6 +658,18 @@ var _Broker_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetGameMetadata",
 			Handler:    _Broker_GetGameMetadata_Handler,
 		},
+		{
+			MethodName: "SetRecording",
+			Handler:    _Broker_SetRecording_Handler,
+		},
+		{
+			MethodName: "UpdateGameThumbnail",
+			Handler:    _Broker_UpdateGameThumbnail_Handler,
+		},
+		{
+			MethodName: "ReportConnectionStats",
+			Handler:    _Broker_ReportConnectionStats_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/broker.proto",
@@ -351,27 +678,50 @@ var _Broker_serviceDesc = grpc.ServiceDesc{
 func init() { proto1.RegisterFile("proto/broker.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 344 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x53, 0x4d, 0x4f, 0xc2, 0x40,
-	0x10, 0xa5, 0x28, 0x14, 0x06, 0x88, 0x71, 0xf8, 0x28, 0x21, 0x31, 0x21, 0x7b, 0xe2, 0xb4, 0xc6,
-	0x7a, 0xf3, 0x64, 0x08, 0x81, 0x70, 0x20, 0x26, 0x70, 0xf3, 0x42, 0x16, 0x77, 0x24, 0x44, 0xe8,
-	0x42, 0x77, 0x31, 0xf1, 0x4f, 0xfa, 0x9b, 0x0c, 0xdb, 0xa2, 0x2d, 0x94, 0x9b, 0xa7, 0x76, 0xf6,
-	0xbd, 0xd7, 0x79, 0xfb, 0x66, 0x0a, 0xb8, 0x0d, 0x95, 0x51, 0xf7, 0x8b, 0x50, 0x7d, 0x50, 0xc8,
-	0x6d, 0xc1, 0x06, 0x80, 0xc3, 0x55, 0x20, 0x67, 0xa4, 0xf5, 0x4a, 0x05, 0x53, 0xda, 0xed, 0x49,
-	0x1b, 0xe4, 0x50, 0x17, 0xeb, 0xb5, 0x7a, 0x13, 0x86, 0xe4, 0x5c, 0x53, 0xf8, 0x49, 0xe1, 0x7c,
-	0x25, 0xdb, 0x4e, 0xd7, 0xe9, 0x95, 0xa7, 0xb7, 0xbf, 0xd0, 0xcc, 0x22, 0x63, 0xc9, 0x5e, 0xa0,
-	0x9e, 0xfa, 0x8a, 0xde, 0xaa, 0x40, 0x13, 0x36, 0xa0, 0xf0, 0xae, 0xf6, 0x41, 0x24, 0x2c, 0x4d,
-	0xa3, 0x02, 0x19, 0xb8, 0x3a, 0x22, 0xb6, 0xf3, 0x5d, 0xa7, 0x57, 0xf1, 0x4b, 0xfc, 0x28, 0x3c,
-	0x02, 0x8c, 0xa0, 0x31, 0xa0, 0x35, 0x19, 0x3a, 0x31, 0x76, 0x07, 0x10, 0x53, 0xfe, 0xfc, 0x94,
-	0xe3, 0x93, 0xb1, 0xbc, 0xe4, 0x3b, 0x7f, 0xc9, 0xb7, 0x07, 0xcd, 0x93, 0x36, 0x91, 0x73, 0xb6,
-	0x03, 0x37, 0x3e, 0xfa, 0xe7, 0x96, 0xe8, 0x81, 0xbb, 0x14, 0x1b, 0x3a, 0x70, 0xae, 0x2c, 0xa7,
-	0x78, 0x28, 0xc7, 0x92, 0x3d, 0x40, 0x6b, 0x44, 0x66, 0x24, 0x36, 0x34, 0x21, 0x23, 0xa4, 0x30,
-	0xe2, 0x78, 0xe9, 0x84, 0xc4, 0x49, 0x49, 0x26, 0xe0, 0x9d, 0x49, 0xe2, 0xe8, 0x7d, 0xa8, 0x59,
-	0xcd, 0x26, 0x06, 0xac, 0xb2, 0xe2, 0xd7, 0x78, 0x8a, 0x5d, 0x5d, 0x26, 0x2a, 0xc6, 0xa0, 0x9a,
-	0x44, 0x11, 0xe1, 0x7a, 0xa1, 0xe4, 0x57, 0xdc, 0xd4, 0xbe, 0xfb, 0xdf, 0x0e, 0x14, 0xfb, 0x76,
-	0x81, 0xf0, 0x09, 0x2a, 0x89, 0xa1, 0x63, 0x9d, 0x9f, 0x2f, 0x52, 0xa7, 0xc1, 0x33, 0xf6, 0x82,
-	0xe5, 0xf0, 0x19, 0x6a, 0xa9, 0xe0, 0xb1, 0xc9, 0xb3, 0xe6, 0xdd, 0x69, 0xf1, 0xec, 0xf9, 0xe4,
-	0x70, 0x08, 0x37, 0x27, 0x77, 0x47, 0x8f, 0x67, 0x07, 0xd8, 0x69, 0xf3, 0x0b, 0x31, 0xb1, 0x5c,
-	0xdf, 0x7d, 0x2d, 0xd8, 0x3f, 0x61, 0x51, 0xb4, 0x8f, 0xc7, 0x9f, 0x00, 0x00, 0x00, 0xff, 0xff,
-	0xb3, 0xb8, 0x6f, 0x57, 0x26, 0x03, 0x00, 0x00,
+	// 708 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x55, 0x6d, 0x6b, 0x1a, 0x4b,
+	0x14, 0x76, 0x4d, 0x7c, 0x3b, 0xea, 0xcd, 0xbd, 0xa3, 0x46, 0x31, 0xf1, 0x26, 0x77, 0xe0, 0x96,
+	0x40, 0x61, 0x4a, 0xed, 0xb7, 0x42, 0xa1, 0x24, 0x21, 0x21, 0x50, 0x29, 0xac, 0x16, 0x4a, 0xbf,
+	0x2c, 0xe3, 0xee, 0x89, 0x9d, 0xc6, 0x9d, 0xd9, 0xee, 0x8c, 0x85, 0xfc, 0x8a, 0xfe, 0x9d, 0x42,
+	0xff, 0x5c, 0xd9, 0xd9, 0x35, 0x51, 0xb3, 0xa6, 0xf9, 0xd0, 0x4f, 0xc9, 0x79, 0x9e, 0x33, 0xe7,
+	0x3c, 0x7b, 0xde, 0x04, 0x12, 0xc5, 0xca, 0xa8, 0x17, 0xd3, 0x58, 0xdd, 0x60, 0xcc, 0xac, 0x41,
+	0xcf, 0x81, 0x5c, 0x08, 0x19, 0x8c, 0x51, 0x6b, 0xa1, 0xa4, 0x8b, 0x5f, 0x17, 0xa8, 0x0d, 0x61,
+	0xd0, 0xe2, 0xf3, 0xb9, 0xf2, 0xb9, 0xc1, 0xc0, 0xd3, 0x18, 0x7f, 0xc3, 0xd8, 0x13, 0x41, 0xcf,
+	0x39, 0x76, 0x4e, 0x6a, 0xee, 0x3f, 0x77, 0xd4, 0xd8, 0x32, 0x57, 0x01, 0x7d, 0x0f, 0xad, 0xb5,
+	0x28, 0x3a, 0x52, 0x52, 0x23, 0x69, 0x43, 0xe9, 0x5a, 0x2d, 0x64, 0xfa, 0xb0, 0xea, 0xa6, 0x06,
+	0xa1, 0x50, 0xd1, 0xa9, 0x63, 0xaf, 0x78, 0xec, 0x9c, 0xd4, 0x87, 0x55, 0xb6, 0x7c, 0xb8, 0x24,
+	0x28, 0x42, 0xfb, 0x1c, 0xe7, 0x68, 0x70, 0x43, 0xd8, 0x00, 0x20, 0x73, 0xb9, 0xd7, 0x53, 0xcb,
+	0x90, 0xab, 0x60, 0x9b, 0xee, 0xe2, 0x36, 0xdd, 0x5d, 0xe8, 0x6c, 0xa4, 0x49, 0x95, 0xd3, 0xef,
+	0x0e, 0x54, 0x32, 0xec, 0x0f, 0xe7, 0x24, 0x5d, 0xa8, 0xcc, 0x78, 0x88, 0x89, 0xcf, 0x8e, 0xf5,
+	0x29, 0x27, 0xe6, 0x55, 0x40, 0x0e, 0xa1, 0x16, 0xa3, 0xaf, 0xe2, 0x40, 0xc8, 0x59, 0x6f, 0xd7,
+	0x56, 0xec, 0x1e, 0xa0, 0x2f, 0x61, 0xff, 0x12, 0xcd, 0x25, 0x0f, 0x71, 0x84, 0x86, 0x07, 0xdc,
+	0xf0, 0x65, 0x4d, 0x56, 0x02, 0x3a, 0xab, 0x01, 0xe9, 0x08, 0xba, 0x0f, 0x9e, 0x64, 0x9d, 0x19,
+	0x42, 0xd3, 0xbe, 0x09, 0x33, 0xc2, 0xbe, 0xac, 0x0f, 0x9b, 0x6c, 0xcd, 0xbb, 0x31, 0x5b, 0xb1,
+	0x28, 0x85, 0xc6, 0x2a, 0x4b, 0x08, 0xec, 0x4e, 0x55, 0x70, 0x9b, 0x25, 0xb5, 0xff, 0x53, 0x17,
+	0x5a, 0x63, 0x34, 0xee, 0x52, 0xf5, 0x13, 0xdb, 0xb6, 0xf6, 0xe5, 0xc5, 0xcd, 0x2f, 0xdf, 0x87,
+	0xf6, 0x7a, 0xcc, 0xac, 0x47, 0x12, 0xfa, 0x1f, 0xa2, 0x80, 0x1b, 0x4c, 0x54, 0x4d, 0x3e, 0x2f,
+	0xc2, 0xa9, 0xe4, 0x62, 0xfe, 0xbb, 0xaa, 0x24, 0x43, 0x29, 0x42, 0x3e, 0x43, 0x9b, 0xa8, 0xe1,
+	0xa6, 0x06, 0xf9, 0x0f, 0x1a, 0xbe, 0x92, 0x06, 0xa5, 0xf1, 0xcc, 0x6d, 0x84, 0x59, 0x6b, 0xea,
+	0x19, 0x36, 0xb9, 0x8d, 0x90, 0x0e, 0xe0, 0x20, 0x37, 0x5f, 0x26, 0xe7, 0x47, 0x11, 0xf6, 0xce,
+	0x94, 0x94, 0xe8, 0x1b, 0xa1, 0xe4, 0xd8, 0x70, 0xa3, 0xc9, 0x73, 0x20, 0x71, 0x32, 0xf3, 0x9e,
+	0x89, 0x45, 0xe4, 0x19, 0x91, 0x54, 0x5c, 0x5b, 0x3d, 0x8e, 0xbb, 0x67, 0x99, 0x49, 0x2c, 0xa2,
+	0x89, 0x08, 0x71, 0xa4, 0xc9, 0x01, 0xd4, 0xbe, 0x08, 0x63, 0x30, 0x4e, 0x7c, 0x8a, 0xd6, 0xa7,
+	0x9a, 0x02, 0x23, 0x4d, 0x8e, 0xa0, 0x1e, 0x71, 0xff, 0x06, 0x8d, 0x37, 0x57, 0x5a, 0x5b, 0x79,
+	0x8e, 0x0b, 0x29, 0xf4, 0x4e, 0x69, 0x4d, 0x7a, 0x50, 0x99, 0x0a, 0x13, 0x73, 0x83, 0x76, 0x76,
+	0x76, 0xdc, 0xa5, 0x99, 0x54, 0xf7, 0x3a, 0xe6, 0x21, 0x5a, 0xae, 0x64, 0x1f, 0xde, 0x03, 0x49,
+	0x60, 0x6b, 0x68, 0x4f, 0xa3, 0x34, 0xbd, 0xf2, 0xb1, 0x73, 0xb2, 0xeb, 0x42, 0x0a, 0x8d, 0x51,
+	0xda, 0xde, 0x49, 0xee, 0xdf, 0x78, 0xbe, 0x5a, 0x48, 0xd3, 0xab, 0x58, 0xbe, 0x96, 0x20, 0x67,
+	0x09, 0x90, 0xa8, 0x8e, 0xe6, 0x22, 0x63, 0xab, 0x96, 0xad, 0x46, 0x73, 0x91, 0x92, 0xff, 0xc3,
+	0x5f, 0x3e, 0x97, 0x81, 0x48, 0xaa, 0x96, 0xd6, 0xb5, 0x66, 0xeb, 0xda, 0xbc, 0x43, 0x6d, 0x65,
+	0x11, 0x0e, 0x5d, 0x8c, 0x54, 0x6c, 0x36, 0xea, 0xf7, 0xc4, 0xf1, 0x79, 0x06, 0x25, 0x9d, 0xb8,
+	0x67, 0xe7, 0xe4, 0x6f, 0xb6, 0x19, 0x26, 0xa5, 0xe9, 0x11, 0x0c, 0xb6, 0xa4, 0x49, 0x5b, 0x38,
+	0xfc, 0xb9, 0x03, 0xe5, 0x53, 0x7b, 0x1d, 0xc9, 0x6b, 0xa8, 0xaf, 0x5c, 0x34, 0xd2, 0x62, 0x0f,
+	0xaf, 0x64, 0xbf, 0xcd, 0x72, 0x8e, 0x1e, 0x2d, 0x90, 0xb7, 0xd0, 0x5c, 0xbb, 0x2a, 0xa4, 0xc3,
+	0xf2, 0x8e, 0x59, 0x7f, 0x9f, 0xe5, 0x1f, 0x9f, 0x02, 0xb9, 0x80, 0xbd, 0x8d, 0xcd, 0x25, 0x5d,
+	0x96, 0xbf, 0xfe, 0xfd, 0x1e, 0xdb, 0xb2, 0xe4, 0xb4, 0x40, 0xde, 0x40, 0x63, 0x75, 0x75, 0x48,
+	0x9b, 0xe5, 0x6c, 0x67, 0xbf, 0xc3, 0x72, 0xf7, 0xab, 0x40, 0x5c, 0x68, 0xe5, 0x4c, 0x3c, 0x39,
+	0x60, 0xdb, 0xf7, 0xae, 0x7f, 0xc8, 0x1e, 0x5b, 0x92, 0x02, 0xf9, 0x08, 0x9d, 0xdc, 0x26, 0x90,
+	0x01, 0x7b, 0x6c, 0x06, 0xfa, 0xff, 0xb2, 0x47, 0x7b, 0x47, 0x0b, 0xa7, 0x95, 0x4f, 0x25, 0xfb,
+	0x9b, 0x36, 0x2d, 0xdb, 0x3f, 0xaf, 0x7e, 0x05, 0x00, 0x00, 0xff, 0xff, 0xad, 0xc4, 0x47, 0xfc,
+	0xf0, 0x06, 0x00, 0x00,
 }
@@ -17,6 +17,64 @@ var _ = proto1.Marshal
 var _ = fmt.Errorf
 var _ = math.Inf
 
+type PipelineState int32
+
+const (
+	PipelineState_PIPELINE_STATE_UNSPECIFIED PipelineState = 0
+	PipelineState_PIPELINE_RUNNING           PipelineState = 1
+	// The process of the pipeline failed and is waiting for the restart.
+	PipelineState_PIPELINE_RESTARTING PipelineState = 2
+	// The client disconnected or the pipeline was replaced.
+	PipelineState_PIPELINE_STOPPED PipelineState = 3
+)
+
+var PipelineState_name = map[int32]string{
+	0: "PIPELINE_STATE_UNSPECIFIED",
+	1: "PIPELINE_RUNNING",
+	2: "PIPELINE_RESTARTING",
+	3: "PIPELINE_STOPPED",
+}
+var PipelineState_value = map[string]int32{
+	"PIPELINE_STATE_UNSPECIFIED": 0,
+	"PIPELINE_RUNNING":           1,
+	"PIPELINE_RESTARTING":        2,
+	"PIPELINE_STOPPED":           3,
+}
+
+func (x PipelineState) String() string {
+	return proto1.EnumName(PipelineState_name, int32(x))
+}
+func (PipelineState) EnumDescriptor() ([]byte, []int) { return fileDescriptor1, []int{0} }
+
+type PipelineEventType int32
+
+const (
+	PipelineEventType_PIPELINE_EVENT_UNSPECIFIED PipelineEventType = 0
+	// The pipeline stops after an error.
+	PipelineEventType_PIPELINE_EVENT_ERROR   PipelineEventType = 1
+	PipelineEventType_PIPELINE_EVENT_WARNING PipelineEventType = 2
+	// The source ended and the pipeline stops.
+	PipelineEventType_PIPELINE_EVENT_EOS PipelineEventType = 3
+)
+
+var PipelineEventType_name = map[int32]string{
+	0: "PIPELINE_EVENT_UNSPECIFIED",
+	1: "PIPELINE_EVENT_ERROR",
+	2: "PIPELINE_EVENT_WARNING",
+	3: "PIPELINE_EVENT_EOS",
+}
+var PipelineEventType_value = map[string]int32{
+	"PIPELINE_EVENT_UNSPECIFIED": 0,
+	"PIPELINE_EVENT_ERROR":       1,
+	"PIPELINE_EVENT_WARNING":     2,
+	"PIPELINE_EVENT_EOS":         3,
+}
+
+func (x PipelineEventType) String() string {
+	return proto1.EnumName(PipelineEventType_name, int32(x))
+}
+func (PipelineEventType) EnumDescriptor() ([]byte, []int) { return fileDescriptor1, []int{1} }
+
 type StartEncodingRequest struct {
 	// Pipelines with the same ID will not run at the same time.
 	// If you make a request to a running pipeline ID, the running pipeline will stop and a new pipeline will start.
@@ -68,9 +126,406 @@ func (m *StartEncodingResponse) GetListenPort() uint32 {
 	return 0
 }
 
+type RequestKeyframeRequest struct {
+	PipelineId string `protobuf:"bytes,1,opt,name=pipeline_id,json=pipelineId" json:"pipeline_id,omitempty"`
+}
+
+func (m *RequestKeyframeRequest) Reset()                    { *m = RequestKeyframeRequest{} }
+func (m *RequestKeyframeRequest) String() string            { return proto1.CompactTextString(m) }
+func (*RequestKeyframeRequest) ProtoMessage()               {}
+func (*RequestKeyframeRequest) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{2} }
+
+func (m *RequestKeyframeRequest) GetPipelineId() string {
+	if m != nil {
+		return m.PipelineId
+	}
+	return ""
+}
+
+type RequestKeyframeResponse struct {
+}
+
+func (m *RequestKeyframeResponse) Reset()                    { *m = RequestKeyframeResponse{} }
+func (m *RequestKeyframeResponse) String() string            { return proto1.CompactTextString(m) }
+func (*RequestKeyframeResponse) ProtoMessage()               {}
+func (*RequestKeyframeResponse) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{3} }
+
+type UpdateEncodingParamsRequest struct {
+	PipelineId string `protobuf:"bytes,1,opt,name=pipeline_id,json=pipelineId" json:"pipeline_id,omitempty"`
+	// Target bitrate of the element named "encoder" in the pipeline.
+	// Use 0 to keep the current bitrate.
+	BitrateKbps uint32 `protobuf:"varint,2,opt,name=bitrate_kbps,json=bitrateKbps" json:"bitrate_kbps,omitempty"`
+	// Framerate of the capsfilter named "framerate" in the pipeline.
+	// Use 0 to keep the current framerate.
+	Framerate uint32 `protobuf:"varint,3,opt,name=framerate" json:"framerate,omitempty"`
+}
+
+func (m *UpdateEncodingParamsRequest) Reset()                    { *m = UpdateEncodingParamsRequest{} }
+func (m *UpdateEncodingParamsRequest) String() string            { return proto1.CompactTextString(m) }
+func (*UpdateEncodingParamsRequest) ProtoMessage()               {}
+func (*UpdateEncodingParamsRequest) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{4} }
+
+func (m *UpdateEncodingParamsRequest) GetPipelineId() string {
+	if m != nil {
+		return m.PipelineId
+	}
+	return ""
+}
+
+func (m *UpdateEncodingParamsRequest) GetBitrateKbps() uint32 {
+	if m != nil {
+		return m.BitrateKbps
+	}
+	return 0
+}
+
+func (m *UpdateEncodingParamsRequest) GetFramerate() uint32 {
+	if m != nil {
+		return m.Framerate
+	}
+	return 0
+}
+
+type UpdateEncodingParamsResponse struct {
+}
+
+func (m *UpdateEncodingParamsResponse) Reset()                    { *m = UpdateEncodingParamsResponse{} }
+func (m *UpdateEncodingParamsResponse) String() string            { return proto1.CompactTextString(m) }
+func (*UpdateEncodingParamsResponse) ProtoMessage()               {}
+func (*UpdateEncodingParamsResponse) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{5} }
+
+type GetCapabilitiesRequest struct {
+}
+
+func (m *GetCapabilitiesRequest) Reset()                    { *m = GetCapabilitiesRequest{} }
+func (m *GetCapabilitiesRequest) String() string            { return proto1.CompactTextString(m) }
+func (*GetCapabilitiesRequest) ProtoMessage()               {}
+func (*GetCapabilitiesRequest) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{6} }
+
+type GetCapabilitiesResponse struct {
+	// Names of the encoder elements installed in the encoder service (e.g. "x264enc").
+	EncoderElements []string `protobuf:"bytes,1,rep,name=encoder_elements,json=encoderElements" json:"encoder_elements,omitempty"`
+}
+
+func (m *GetCapabilitiesResponse) Reset()                    { *m = GetCapabilitiesResponse{} }
+func (m *GetCapabilitiesResponse) String() string            { return proto1.CompactTextString(m) }
+func (*GetCapabilitiesResponse) ProtoMessage()               {}
+func (*GetCapabilitiesResponse) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{7} }
+
+func (m *GetCapabilitiesResponse) GetEncoderElements() []string {
+	if m != nil {
+		return m.EncoderElements
+	}
+	return nil
+}
+
+// UpdateVideoGeometryRequest changes the capture rect and the output size of a running video pipeline.
+// The pipeline renegotiates its caps without restarting, and the encoder starts with a keyframe in the new size.
+type UpdateVideoGeometryRequest struct {
+	PipelineId string `protobuf:"bytes,1,opt,name=pipeline_id,json=pipelineId" json:"pipeline_id,omitempty"`
+	// Rect cropped from the source by the videocrop named "crop" in the pipeline.
+	CropX      uint32 `protobuf:"varint,2,opt,name=crop_x,json=cropX" json:"crop_x,omitempty"`
+	CropY      uint32 `protobuf:"varint,3,opt,name=crop_y,json=cropY" json:"crop_y,omitempty"`
+	CropWidth  uint32 `protobuf:"varint,4,opt,name=crop_width,json=cropWidth" json:"crop_width,omitempty"`
+	CropHeight uint32 `protobuf:"varint,5,opt,name=crop_height,json=cropHeight" json:"crop_height,omitempty"`
+	// Size of the capsfilter named "size" which the cropped video is scaled to.
+	// The aspect ratio is kept with black borders.
+	// Use 0 to keep the crop size.
+	OutputWidth  uint32 `protobuf:"varint,6,opt,name=output_width,json=outputWidth" json:"output_width,omitempty"`
+	OutputHeight uint32 `protobuf:"varint,7,opt,name=output_height,json=outputHeight" json:"output_height,omitempty"`
+}
+
+func (m *UpdateVideoGeometryRequest) Reset()                    { *m = UpdateVideoGeometryRequest{} }
+func (m *UpdateVideoGeometryRequest) String() string            { return proto1.CompactTextString(m) }
+func (*UpdateVideoGeometryRequest) ProtoMessage()               {}
+func (*UpdateVideoGeometryRequest) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{8} }
+
+func (m *UpdateVideoGeometryRequest) GetPipelineId() string {
+	if m != nil {
+		return m.PipelineId
+	}
+	return ""
+}
+
+func (m *UpdateVideoGeometryRequest) GetCropX() uint32 {
+	if m != nil {
+		return m.CropX
+	}
+	return 0
+}
+
+func (m *UpdateVideoGeometryRequest) GetCropY() uint32 {
+	if m != nil {
+		return m.CropY
+	}
+	return 0
+}
+
+func (m *UpdateVideoGeometryRequest) GetCropWidth() uint32 {
+	if m != nil {
+		return m.CropWidth
+	}
+	return 0
+}
+
+func (m *UpdateVideoGeometryRequest) GetCropHeight() uint32 {
+	if m != nil {
+		return m.CropHeight
+	}
+	return 0
+}
+
+func (m *UpdateVideoGeometryRequest) GetOutputWidth() uint32 {
+	if m != nil {
+		return m.OutputWidth
+	}
+	return 0
+}
+
+func (m *UpdateVideoGeometryRequest) GetOutputHeight() uint32 {
+	if m != nil {
+		return m.OutputHeight
+	}
+	return 0
+}
+
+type UpdateVideoGeometryResponse struct {
+}
+
+func (m *UpdateVideoGeometryResponse) Reset()                    { *m = UpdateVideoGeometryResponse{} }
+func (m *UpdateVideoGeometryResponse) String() string            { return proto1.CompactTextString(m) }
+func (*UpdateVideoGeometryResponse) ProtoMessage()               {}
+func (*UpdateVideoGeometryResponse) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{9} }
+
+// StartDecodingRequest starts a pipeline which consumes samples instead of producing them (e.g. microphone input of a player).
+// The client writes samples to the listen port in the same format as StartEncoding.
+type StartDecodingRequest struct {
+	// Pipeline IDs are shared with StartEncoding.
+	PipelineId string `protobuf:"bytes,1,opt,name=pipeline_id,json=pipelineId" json:"pipeline_id,omitempty"`
+	// The encoder service prepends an appsrc with the caps to the pipeline.
+	// e.g. "opusdec ! audioconvert ! pulsesink"
+	GstPipeline string `protobuf:"bytes,2,opt,name=gst_pipeline,json=gstPipeline" json:"gst_pipeline,omitempty"`
+	// Caps of the samples written by the client (e.g. "audio/x-opus,channel-mapping-family=0").
+	Caps string `protobuf:"bytes,3,opt,name=caps" json:"caps,omitempty"`
+	// Use 0 to allocate random port
+	Port int32 `protobuf:"varint,4,opt,name=port" json:"port,omitempty"`
+}
+
+func (m *StartDecodingRequest) Reset()                    { *m = StartDecodingRequest{} }
+func (m *StartDecodingRequest) String() string            { return proto1.CompactTextString(m) }
+func (*StartDecodingRequest) ProtoMessage()               {}
+func (*StartDecodingRequest) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{10} }
+
+func (m *StartDecodingRequest) GetPipelineId() string {
+	if m != nil {
+		return m.PipelineId
+	}
+	return ""
+}
+
+func (m *StartDecodingRequest) GetGstPipeline() string {
+	if m != nil {
+		return m.GstPipeline
+	}
+	return ""
+}
+
+func (m *StartDecodingRequest) GetCaps() string {
+	if m != nil {
+		return m.Caps
+	}
+	return ""
+}
+
+func (m *StartDecodingRequest) GetPort() int32 {
+	if m != nil {
+		return m.Port
+	}
+	return 0
+}
+
+type StartDecodingResponse struct {
+	ListenPort uint32 `protobuf:"varint,1,opt,name=listen_port,json=listenPort" json:"listen_port,omitempty"`
+}
+
+func (m *StartDecodingResponse) Reset()                    { *m = StartDecodingResponse{} }
+func (m *StartDecodingResponse) String() string            { return proto1.CompactTextString(m) }
+func (*StartDecodingResponse) ProtoMessage()               {}
+func (*StartDecodingResponse) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{11} }
+
+func (m *StartDecodingResponse) GetListenPort() uint32 {
+	if m != nil {
+		return m.ListenPort
+	}
+	return 0
+}
+
+type GetPipelineStatusRequest struct {
+	PipelineId string `protobuf:"bytes,1,opt,name=pipeline_id,json=pipelineId" json:"pipeline_id,omitempty"`
+}
+
+func (m *GetPipelineStatusRequest) Reset()                    { *m = GetPipelineStatusRequest{} }
+func (m *GetPipelineStatusRequest) String() string            { return proto1.CompactTextString(m) }
+func (*GetPipelineStatusRequest) ProtoMessage()               {}
+func (*GetPipelineStatusRequest) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{12} }
+
+func (m *GetPipelineStatusRequest) GetPipelineId() string {
+	if m != nil {
+		return m.PipelineId
+	}
+	return ""
+}
+
+type GetPipelineStatusResponse struct {
+	State PipelineState `protobuf:"varint,1,opt,name=state,enum=PipelineState" json:"state,omitempty"`
+	// Number of restarts after failures since StartEncoding or StartDecoding.
+	// Pipelines restart only if the encoder service runs them in child processes.
+	RestartCount uint32 `protobuf:"varint,2,opt,name=restart_count,json=restartCount" json:"restart_count,omitempty"`
+	// Recent restarts in chronological order.
+	Restarts []*PipelineRestart `protobuf:"bytes,3,rep,name=restarts" json:"restarts,omitempty"`
+}
+
+func (m *GetPipelineStatusResponse) Reset()                    { *m = GetPipelineStatusResponse{} }
+func (m *GetPipelineStatusResponse) String() string            { return proto1.CompactTextString(m) }
+func (*GetPipelineStatusResponse) ProtoMessage()               {}
+func (*GetPipelineStatusResponse) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{13} }
+
+func (m *GetPipelineStatusResponse) GetState() PipelineState {
+	if m != nil {
+		return m.State
+	}
+	return PipelineState_PIPELINE_STATE_UNSPECIFIED
+}
+
+func (m *GetPipelineStatusResponse) GetRestartCount() uint32 {
+	if m != nil {
+		return m.RestartCount
+	}
+	return 0
+}
+
+func (m *GetPipelineStatusResponse) GetRestarts() []*PipelineRestart {
+	if m != nil {
+		return m.Restarts
+	}
+	return nil
+}
+
+type PipelineRestart struct {
+	TimeUnixMillis int64 `protobuf:"varint,1,opt,name=time_unix_millis,json=timeUnixMillis" json:"time_unix_millis,omitempty"`
+	// Why the previous process failed (e.g. "signal: segmentation fault").
+	Reason string `protobuf:"bytes,2,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *PipelineRestart) Reset()                    { *m = PipelineRestart{} }
+func (m *PipelineRestart) String() string            { return proto1.CompactTextString(m) }
+func (*PipelineRestart) ProtoMessage()               {}
+func (*PipelineRestart) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{14} }
+
+func (m *PipelineRestart) GetTimeUnixMillis() int64 {
+	if m != nil {
+		return m.TimeUnixMillis
+	}
+	return 0
+}
+
+func (m *PipelineRestart) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+type WatchPipelineRequest struct {
+	PipelineId string `protobuf:"bytes,1,opt,name=pipeline_id,json=pipelineId" json:"pipeline_id,omitempty"`
+}
+
+func (m *WatchPipelineRequest) Reset()                    { *m = WatchPipelineRequest{} }
+func (m *WatchPipelineRequest) String() string            { return proto1.CompactTextString(m) }
+func (*WatchPipelineRequest) ProtoMessage()               {}
+func (*WatchPipelineRequest) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{15} }
+
+func (m *WatchPipelineRequest) GetPipelineId() string {
+	if m != nil {
+		return m.PipelineId
+	}
+	return ""
+}
+
+// PipelineEvent is an ERROR, WARNING or EOS message on the GStreamer bus of a pipeline.
+// WatchPipeline sends recent events first, so that an error before watching is not missed.
+// The stream ends when the pipeline stops.
+type PipelineEvent struct {
+	Type PipelineEventType `protobuf:"varint,1,opt,name=type,enum=PipelineEventType" json:"type,omitempty"`
+	// Name of the element that posted the message (e.g. "ximagesrc0").
+	Source string `protobuf:"bytes,2,opt,name=source" json:"source,omitempty"`
+	// e.g. "Could not open X display for reading"
+	Message string `protobuf:"bytes,3,opt,name=message" json:"message,omitempty"`
+	// Debug info with the location in the source code of GStreamer.
+	Debug          string `protobuf:"bytes,4,opt,name=debug" json:"debug,omitempty"`
+	TimeUnixMillis int64  `protobuf:"varint,5,opt,name=time_unix_millis,json=timeUnixMillis" json:"time_unix_millis,omitempty"`
+}
+
+func (m *PipelineEvent) Reset()                    { *m = PipelineEvent{} }
+func (m *PipelineEvent) String() string            { return proto1.CompactTextString(m) }
+func (*PipelineEvent) ProtoMessage()               {}
+func (*PipelineEvent) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{16} }
+
+func (m *PipelineEvent) GetType() PipelineEventType {
+	if m != nil {
+		return m.Type
+	}
+	return PipelineEventType_PIPELINE_EVENT_UNSPECIFIED
+}
+
+func (m *PipelineEvent) GetSource() string {
+	if m != nil {
+		return m.Source
+	}
+	return ""
+}
+
+func (m *PipelineEvent) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *PipelineEvent) GetDebug() string {
+	if m != nil {
+		return m.Debug
+	}
+	return ""
+}
+
+func (m *PipelineEvent) GetTimeUnixMillis() int64 {
+	if m != nil {
+		return m.TimeUnixMillis
+	}
+	return 0
+}
+
 func init() {
 	proto1.RegisterType((*StartEncodingRequest)(nil), "StartEncodingRequest")
 	proto1.RegisterType((*StartEncodingResponse)(nil), "StartEncodingResponse")
+	proto1.RegisterType((*RequestKeyframeRequest)(nil), "RequestKeyframeRequest")
+	proto1.RegisterType((*RequestKeyframeResponse)(nil), "RequestKeyframeResponse")
+	proto1.RegisterType((*UpdateEncodingParamsRequest)(nil), "UpdateEncodingParamsRequest")
+	proto1.RegisterType((*UpdateEncodingParamsResponse)(nil), "UpdateEncodingParamsResponse")
+	proto1.RegisterType((*GetCapabilitiesRequest)(nil), "GetCapabilitiesRequest")
+	proto1.RegisterType((*GetCapabilitiesResponse)(nil), "GetCapabilitiesResponse")
+	proto1.RegisterType((*UpdateVideoGeometryRequest)(nil), "UpdateVideoGeometryRequest")
+	proto1.RegisterType((*UpdateVideoGeometryResponse)(nil), "UpdateVideoGeometryResponse")
+	proto1.RegisterType((*StartDecodingRequest)(nil), "StartDecodingRequest")
+	proto1.RegisterType((*StartDecodingResponse)(nil), "StartDecodingResponse")
+	proto1.RegisterType((*GetPipelineStatusRequest)(nil), "GetPipelineStatusRequest")
+	proto1.RegisterType((*GetPipelineStatusResponse)(nil), "GetPipelineStatusResponse")
+	proto1.RegisterType((*PipelineRestart)(nil), "PipelineRestart")
+	proto1.RegisterType((*WatchPipelineRequest)(nil), "WatchPipelineRequest")
+	proto1.RegisterType((*PipelineEvent)(nil), "PipelineEvent")
+	proto1.RegisterEnum("PipelineState", PipelineState_name, PipelineState_value)
+	proto1.RegisterEnum("PipelineEventType", PipelineEventType_name, PipelineEventType_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -85,6 +540,13 @@ const _ = grpc.SupportPackageIsVersion4
 
 type EncoderClient interface {
 	StartEncoding(ctx context.Context, in *StartEncodingRequest, opts ...grpc.CallOption) (*StartEncodingResponse, error)
+	RequestKeyframe(ctx context.Context, in *RequestKeyframeRequest, opts ...grpc.CallOption) (*RequestKeyframeResponse, error)
+	UpdateEncodingParams(ctx context.Context, in *UpdateEncodingParamsRequest, opts ...grpc.CallOption) (*UpdateEncodingParamsResponse, error)
+	GetCapabilities(ctx context.Context, in *GetCapabilitiesRequest, opts ...grpc.CallOption) (*GetCapabilitiesResponse, error)
+	UpdateVideoGeometry(ctx context.Context, in *UpdateVideoGeometryRequest, opts ...grpc.CallOption) (*UpdateVideoGeometryResponse, error)
+	StartDecoding(ctx context.Context, in *StartDecodingRequest, opts ...grpc.CallOption) (*StartDecodingResponse, error)
+	GetPipelineStatus(ctx context.Context, in *GetPipelineStatusRequest, opts ...grpc.CallOption) (*GetPipelineStatusResponse, error)
+	WatchPipeline(ctx context.Context, in *WatchPipelineRequest, opts ...grpc.CallOption) (Encoder_WatchPipelineClient, error)
 }
 
 type encoderClient struct {
@@ -104,10 +566,103 @@ func (c *encoderClient) StartEncoding(ctx context.Context, in *StartEncodingRequ
 	return out, nil
 }
 
+func (c *encoderClient) RequestKeyframe(ctx context.Context, in *RequestKeyframeRequest, opts ...grpc.CallOption) (*RequestKeyframeResponse, error) {
+	out := new(RequestKeyframeResponse)
+	err := grpc.Invoke(ctx, "/Encoder/RequestKeyframe", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *encoderClient) UpdateEncodingParams(ctx context.Context, in *UpdateEncodingParamsRequest, opts ...grpc.CallOption) (*UpdateEncodingParamsResponse, error) {
+	out := new(UpdateEncodingParamsResponse)
+	err := grpc.Invoke(ctx, "/Encoder/UpdateEncodingParams", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *encoderClient) GetCapabilities(ctx context.Context, in *GetCapabilitiesRequest, opts ...grpc.CallOption) (*GetCapabilitiesResponse, error) {
+	out := new(GetCapabilitiesResponse)
+	err := grpc.Invoke(ctx, "/Encoder/GetCapabilities", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *encoderClient) UpdateVideoGeometry(ctx context.Context, in *UpdateVideoGeometryRequest, opts ...grpc.CallOption) (*UpdateVideoGeometryResponse, error) {
+	out := new(UpdateVideoGeometryResponse)
+	err := grpc.Invoke(ctx, "/Encoder/UpdateVideoGeometry", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *encoderClient) StartDecoding(ctx context.Context, in *StartDecodingRequest, opts ...grpc.CallOption) (*StartDecodingResponse, error) {
+	out := new(StartDecodingResponse)
+	err := grpc.Invoke(ctx, "/Encoder/StartDecoding", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *encoderClient) GetPipelineStatus(ctx context.Context, in *GetPipelineStatusRequest, opts ...grpc.CallOption) (*GetPipelineStatusResponse, error) {
+	out := new(GetPipelineStatusResponse)
+	err := grpc.Invoke(ctx, "/Encoder/GetPipelineStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *encoderClient) WatchPipeline(ctx context.Context, in *WatchPipelineRequest, opts ...grpc.CallOption) (Encoder_WatchPipelineClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Encoder_serviceDesc.Streams[0], c.cc, "/Encoder/WatchPipeline", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &encoderWatchPipelineClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Encoder_WatchPipelineClient interface {
+	Recv() (*PipelineEvent, error)
+	grpc.ClientStream
+}
+
+type encoderWatchPipelineClient struct {
+	grpc.ClientStream
+}
+
+func (x *encoderWatchPipelineClient) Recv() (*PipelineEvent, error) {
+	m := new(PipelineEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for Encoder service
 
 type EncoderServer interface {
 	StartEncoding(context.Context, *StartEncodingRequest) (*StartEncodingResponse, error)
+	RequestKeyframe(context.Context, *RequestKeyframeRequest) (*RequestKeyframeResponse, error)
+	UpdateEncodingParams(context.Context, *UpdateEncodingParamsRequest) (*UpdateEncodingParamsResponse, error)
+	GetCapabilities(context.Context, *GetCapabilitiesRequest) (*GetCapabilitiesResponse, error)
+	UpdateVideoGeometry(context.Context, *UpdateVideoGeometryRequest) (*UpdateVideoGeometryResponse, error)
+	StartDecoding(context.Context, *StartDecodingRequest) (*StartDecodingResponse, error)
+	GetPipelineStatus(context.Context, *GetPipelineStatusRequest) (*GetPipelineStatusResponse, error)
+	WatchPipeline(*WatchPipelineRequest, Encoder_WatchPipelineServer) error
 }
 
 func RegisterEncoderServer(s *grpc.Server, srv EncoderServer) {
@@ -132,6 +687,135 @@ func _Encoder_StartEncoding_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Encoder_RequestKeyframe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RequestKeyframeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EncoderServer).RequestKeyframe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Encoder/RequestKeyframe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EncoderServer).RequestKeyframe(ctx, req.(*RequestKeyframeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Encoder_UpdateEncodingParams_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateEncodingParamsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EncoderServer).UpdateEncodingParams(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Encoder/UpdateEncodingParams",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EncoderServer).UpdateEncodingParams(ctx, req.(*UpdateEncodingParamsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Encoder_GetCapabilities_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCapabilitiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EncoderServer).GetCapabilities(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Encoder/GetCapabilities",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EncoderServer).GetCapabilities(ctx, req.(*GetCapabilitiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Encoder_UpdateVideoGeometry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateVideoGeometryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EncoderServer).UpdateVideoGeometry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Encoder/UpdateVideoGeometry",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EncoderServer).UpdateVideoGeometry(ctx, req.(*UpdateVideoGeometryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Encoder_StartDecoding_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartDecodingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EncoderServer).StartDecoding(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Encoder/StartDecoding",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EncoderServer).StartDecoding(ctx, req.(*StartDecodingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Encoder_GetPipelineStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPipelineStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EncoderServer).GetPipelineStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Encoder/GetPipelineStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EncoderServer).GetPipelineStatus(ctx, req.(*GetPipelineStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Encoder_WatchPipeline_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchPipelineRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EncoderServer).WatchPipeline(m, &encoderWatchPipelineServer{stream})
+}
+
+type Encoder_WatchPipelineServer interface {
+	Send(*PipelineEvent) error
+	grpc.ServerStream
+}
+
+type encoderWatchPipelineServer struct {
+	grpc.ServerStream
+}
+
+func (x *encoderWatchPipelineServer) Send(m *PipelineEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _Encoder_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "Encoder",
 	HandlerType: (*EncoderServer)(nil),
@@ -140,26 +824,100 @@ var _Encoder_serviceDesc = grpc.ServiceDesc{
 			MethodName: "StartEncoding",
 			Handler:    _Encoder_StartEncoding_Handler,
 		},
+		{
+			MethodName: "RequestKeyframe",
+			Handler:    _Encoder_RequestKeyframe_Handler,
+		},
+		{
+			MethodName: "UpdateEncodingParams",
+			Handler:    _Encoder_UpdateEncodingParams_Handler,
+		},
+		{
+			MethodName: "GetCapabilities",
+			Handler:    _Encoder_GetCapabilities_Handler,
+		},
+		{
+			MethodName: "UpdateVideoGeometry",
+			Handler:    _Encoder_UpdateVideoGeometry_Handler,
+		},
+		{
+			MethodName: "StartDecoding",
+			Handler:    _Encoder_StartDecoding_Handler,
+		},
+		{
+			MethodName: "GetPipelineStatus",
+			Handler:    _Encoder_GetPipelineStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchPipeline",
+			Handler:       _Encoder_WatchPipeline_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/encoder.proto",
 }
 
 func init() { proto1.RegisterFile("proto/encoder.proto", fileDescriptor1) }
 
 var fileDescriptor1 = []byte{
-	// 200 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x2e, 0x28, 0xca, 0x2f,
-	0xc9, 0xd7, 0x4f, 0xcd, 0x4b, 0xce, 0x4f, 0x49, 0x2d, 0xd2, 0x03, 0xf3, 0x94, 0xf2, 0xb8, 0x44,
-	0x82, 0x4b, 0x12, 0x8b, 0x4a, 0x5c, 0x41, 0xa2, 0x99, 0x79, 0xe9, 0x41, 0xa9, 0x85, 0xa5, 0xa9,
-	0xc5, 0x25, 0x42, 0xf2, 0x5c, 0xdc, 0x05, 0x99, 0x05, 0xa9, 0x39, 0x99, 0x79, 0xa9, 0xf1, 0x99,
-	0x29, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x9c, 0x41, 0x5c, 0x30, 0x21, 0xcf, 0x14, 0x21, 0x45, 0x2e,
-	0x9e, 0xf4, 0xe2, 0x92, 0x78, 0x98, 0x88, 0x04, 0x13, 0x58, 0x05, 0x77, 0x7a, 0x71, 0x49, 0x00,
-	0x54, 0x48, 0x48, 0x88, 0x8b, 0xa5, 0x20, 0xbf, 0xa8, 0x44, 0x82, 0x59, 0x81, 0x51, 0x83, 0x35,
-	0x08, 0xcc, 0x56, 0xb2, 0xe0, 0x12, 0x45, 0xb3, 0xaf, 0xb8, 0x20, 0x3f, 0xaf, 0x38, 0x15, 0x64,
-	0x61, 0x4e, 0x66, 0x71, 0x49, 0x6a, 0x5e, 0x3c, 0x58, 0x0f, 0xc8, 0x42, 0xde, 0x20, 0x2e, 0x88,
-	0x50, 0x40, 0x7e, 0x51, 0x89, 0x91, 0x37, 0x17, 0xbb, 0x2b, 0xc4, 0xe9, 0x42, 0x0e, 0x5c, 0xbc,
-	0x28, 0x86, 0x08, 0x89, 0xea, 0x61, 0xf3, 0x84, 0x94, 0x98, 0x1e, 0x56, 0xbb, 0x94, 0x18, 0x9c,
-	0xd8, 0xa3, 0x58, 0xc1, 0xfe, 0x4f, 0x62, 0x03, 0x53, 0xc6, 0x80, 0x00, 0x00, 0x00, 0xff, 0xff,
-	0x14, 0x93, 0x49, 0x0a, 0x1d, 0x01, 0x00, 0x00,
+	// 910 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x56, 0xdd, 0x72, 0x22, 0x45,
+	0x14, 0x66, 0x16, 0x48, 0xe4, 0x64, 0x49, 0x66, 0x3b, 0x04, 0x26, 0x93, 0x64, 0x8d, 0xa3, 0x65,
+	0xe1, 0x96, 0x35, 0x5a, 0xf1, 0xc2, 0xbf, 0x1b, 0x63, 0x98, 0x8d, 0xd4, 0xae, 0x84, 0x6a, 0x20,
+	0x51, 0x6f, 0xa6, 0x06, 0x38, 0x92, 0x29, 0x61, 0x66, 0x9c, 0x6e, 0x34, 0x5c, 0x59, 0xfa, 0x0c,
+	0xbe, 0x84, 0xaf, 0xe3, 0xab, 0xf8, 0x02, 0x56, 0xf7, 0x34, 0x20, 0xc3, 0x90, 0xc2, 0x8b, 0xbd,
+	0x62, 0xfa, 0x3b, 0x7d, 0xfa, 0x7c, 0xfd, 0xf5, 0xf9, 0x01, 0x0e, 0xa3, 0x38, 0xe4, 0xe1, 0x47,
+	0x18, 0x0c, 0xc2, 0x21, 0xc6, 0xb6, 0x5c, 0x59, 0x01, 0x54, 0x3a, 0xdc, 0x8b, 0xb9, 0x23, 0x50,
+	0x3f, 0x18, 0x51, 0xfc, 0x79, 0x8a, 0x8c, 0x93, 0xb7, 0x61, 0x2f, 0xf2, 0x23, 0x1c, 0xfb, 0x01,
+	0xba, 0xfe, 0xd0, 0xd0, 0xce, 0xb5, 0x7a, 0x89, 0xc2, 0x1c, 0x6a, 0x0e, 0xc9, 0x3b, 0xf0, 0x74,
+	0xc4, 0xb8, 0x3b, 0x47, 0x8c, 0x27, 0x72, 0xc7, 0xde, 0x88, 0xf1, 0xb6, 0x82, 0x08, 0x81, 0x42,
+	0x14, 0xc6, 0xdc, 0xc8, 0x9f, 0x6b, 0xf5, 0x22, 0x95, 0xdf, 0xd6, 0x67, 0x70, 0x94, 0x8a, 0xc7,
+	0xa2, 0x30, 0x60, 0x28, 0x02, 0x8e, 0x7d, 0xc6, 0x31, 0x70, 0xa5, 0x8f, 0x08, 0x58, 0xa6, 0x90,
+	0x40, 0x6d, 0xe1, 0xf9, 0x39, 0x54, 0x15, 0xb9, 0x57, 0x38, 0xfb, 0x31, 0xf6, 0x26, 0xb8, 0x2d,
+	0x57, 0xeb, 0x18, 0x6a, 0x6b, 0xae, 0x49, 0x58, 0xeb, 0x37, 0x38, 0xe9, 0x45, 0x43, 0x8f, 0xe3,
+	0x9c, 0x50, 0xdb, 0x8b, 0xbd, 0x09, 0xfb, 0x3f, 0x32, 0xf4, 0x7d, 0x1e, 0x7b, 0x1c, 0xdd, 0x9f,
+	0xfa, 0x11, 0x93, 0x32, 0x94, 0xe9, 0x9e, 0xc2, 0x5e, 0xf5, 0x23, 0x46, 0x4e, 0xa1, 0x24, 0x63,
+	0x0a, 0x40, 0x6a, 0x51, 0xa6, 0x4b, 0xc0, 0x7a, 0x0e, 0xa7, 0xd9, 0x04, 0x14, 0x41, 0x03, 0xaa,
+	0xd7, 0xc8, 0xaf, 0xbc, 0xc8, 0xeb, 0xfb, 0x63, 0x9f, 0xfb, 0x38, 0xe7, 0x66, 0x35, 0xa0, 0xb6,
+	0x66, 0x51, 0x62, 0x7e, 0x00, 0xba, 0x7a, 0x66, 0x17, 0xc7, 0x38, 0xc1, 0x80, 0x33, 0x43, 0x3b,
+	0xcf, 0xd7, 0x4b, 0xf4, 0x40, 0xe1, 0x8e, 0x82, 0xad, 0x7f, 0x34, 0x30, 0x13, 0x02, 0xb7, 0xfe,
+	0x10, 0xc3, 0x6b, 0x0c, 0x27, 0xc8, 0xe3, 0xd9, 0xd6, 0x02, 0x1c, 0xc1, 0xce, 0x20, 0x0e, 0x23,
+	0xf7, 0x41, 0x5d, 0xbd, 0x28, 0x56, 0xdf, 0x2d, 0xe0, 0x99, 0x91, 0x5f, 0xc2, 0xdf, 0x93, 0x33,
+	0x00, 0x09, 0xff, 0xea, 0x0f, 0xf9, 0xbd, 0x51, 0x48, 0xc4, 0x10, 0xc8, 0x9d, 0x00, 0x44, 0x34,
+	0x69, 0xbe, 0x47, 0x7f, 0x74, 0xcf, 0x8d, 0x62, 0x92, 0x04, 0x02, 0xfa, 0x46, 0x22, 0x42, 0xee,
+	0x70, 0xca, 0xa3, 0x29, 0x57, 0x27, 0xec, 0x24, 0x72, 0x27, 0x58, 0x72, 0xc6, 0xbb, 0x50, 0x56,
+	0x5b, 0xd4, 0x29, 0xbb, 0x72, 0x8f, 0xf2, 0x4b, 0xce, 0xb1, 0xce, 0xe0, 0x24, 0xf3, 0xd2, 0x4a,
+	0xf4, 0x3f, 0x34, 0x55, 0x16, 0x0d, 0x7c, 0x23, 0x65, 0x31, 0xf0, 0x22, 0x26, 0x85, 0x29, 0x51,
+	0xf9, 0xbd, 0x28, 0x95, 0x42, 0x46, 0xa9, 0x2c, 0x39, 0x6c, 0x5b, 0x2a, 0x5f, 0x82, 0x71, 0x8d,
+	0x8b, 0x80, 0x1d, 0xee, 0xf1, 0xe9, 0xd6, 0x19, 0x6d, 0xfd, 0xa9, 0xc1, 0x71, 0x86, 0xb7, 0x8a,
+	0xfd, 0x1e, 0x14, 0x19, 0x17, 0x89, 0x2c, 0x1c, 0xf7, 0x2f, 0xf6, 0xed, 0xff, 0xee, 0x43, 0x9a,
+	0x18, 0xc5, 0x1b, 0xc4, 0xc8, 0x04, 0x79, 0x77, 0x10, 0x4e, 0x03, 0xae, 0x72, 0xe3, 0xa9, 0x02,
+	0xaf, 0x04, 0x46, 0x3e, 0x84, 0xb7, 0xd4, 0x5a, 0x68, 0x91, 0xaf, 0xef, 0x5d, 0xe8, 0x8b, 0xd3,
+	0x68, 0x62, 0xa0, 0x8b, 0x1d, 0x56, 0x07, 0x0e, 0x52, 0x46, 0x52, 0x07, 0x9d, 0xfb, 0x13, 0x74,
+	0xa7, 0x81, 0xff, 0xe0, 0x4e, 0xfc, 0xf1, 0xd8, 0x67, 0x92, 0x56, 0x9e, 0xee, 0x0b, 0xbc, 0x17,
+	0xf8, 0x0f, 0xdf, 0x4a, 0x94, 0x54, 0x61, 0x27, 0x46, 0x8f, 0x85, 0x81, 0x7a, 0x0f, 0xb5, 0xb2,
+	0x3e, 0x85, 0xca, 0x9d, 0xc7, 0x07, 0xf7, 0xcb, 0x93, 0xb7, 0x14, 0xe9, 0x2f, 0x0d, 0xca, 0x73,
+	0x27, 0xe7, 0x17, 0x0c, 0x38, 0x79, 0x1f, 0x0a, 0x7c, 0x16, 0xcd, 0x75, 0x21, 0xf6, 0x8a, 0xb5,
+	0x3b, 0x8b, 0x90, 0x4a, 0xbb, 0xa0, 0xc2, 0xc2, 0x69, 0x3c, 0x98, 0xa7, 0x86, 0x5a, 0x11, 0x03,
+	0x76, 0x27, 0xc8, 0x98, 0x37, 0x42, 0x95, 0x18, 0xf3, 0x25, 0xa9, 0x40, 0x71, 0x88, 0xfd, 0xe9,
+	0x48, 0x26, 0x47, 0x89, 0x26, 0x8b, 0xcc, 0xcb, 0x17, 0xb3, 0x2e, 0xff, 0x82, 0x43, 0x79, 0xe5,
+	0x91, 0xc8, 0x73, 0x30, 0xdb, 0xcd, 0xb6, 0xf3, 0xba, 0xd9, 0x72, 0xdc, 0x4e, 0xf7, 0xb2, 0xeb,
+	0xb8, 0xbd, 0x56, 0xa7, 0xed, 0x5c, 0x35, 0x5f, 0x36, 0x9d, 0x86, 0x9e, 0x23, 0x15, 0xd0, 0x17,
+	0x76, 0xda, 0x6b, 0xb5, 0x9a, 0xad, 0x6b, 0x5d, 0x23, 0x35, 0x38, 0x5c, 0xa2, 0x4e, 0xa7, 0x7b,
+	0x49, 0xbb, 0xc2, 0xf0, 0x64, 0x65, 0x7b, 0xa7, 0x7b, 0xd3, 0x6e, 0x3b, 0x0d, 0x3d, 0xff, 0xe2,
+	0x77, 0x0d, 0x9e, 0xad, 0x69, 0xb0, 0x12, 0xda, 0xb9, 0x75, 0x5a, 0xdd, 0x54, 0x68, 0x03, 0x2a,
+	0x29, 0xbb, 0x43, 0xe9, 0x0d, 0xd5, 0x35, 0x62, 0x42, 0x35, 0x65, 0xb9, 0xbb, 0xa4, 0xad, 0x84,
+	0x41, 0x15, 0x48, 0xda, 0xeb, 0xa6, 0xa3, 0xe7, 0x2f, 0xfe, 0x2e, 0xc0, 0xae, 0x93, 0xf4, 0x3b,
+	0xf2, 0x15, 0x94, 0x57, 0x06, 0x0f, 0x39, 0xb2, 0xb3, 0x06, 0x9f, 0x59, 0xb5, 0x33, 0xe7, 0x93,
+	0x95, 0x23, 0x2f, 0xe1, 0x20, 0x35, 0x45, 0x48, 0xcd, 0xce, 0x1e, 0x49, 0xa6, 0x61, 0x6f, 0x1a,
+	0x38, 0x39, 0xd2, 0x83, 0x4a, 0x56, 0xc7, 0x27, 0xa7, 0xf6, 0x23, 0x93, 0xc8, 0x3c, 0xb3, 0x1f,
+	0x1d, 0x13, 0x92, 0x5e, 0x6a, 0x1c, 0x90, 0x9a, 0x9d, 0x3d, 0x3a, 0x4c, 0xc3, 0xde, 0x30, 0x39,
+	0xac, 0x1c, 0xa1, 0x70, 0x98, 0xd1, 0x1a, 0xc9, 0x89, 0xbd, 0x79, 0x4a, 0x98, 0xa7, 0xf6, 0x63,
+	0xdd, 0x34, 0xb7, 0x10, 0xbf, 0x81, 0xab, 0xe2, 0x37, 0x30, 0x53, 0xfc, 0x74, 0xc7, 0xb3, 0x72,
+	0xe4, 0x35, 0x3c, 0x5b, 0x6b, 0x4a, 0xe4, 0xd8, 0xde, 0xd4, 0xe6, 0x4c, 0xd3, 0xde, 0xd8, 0xc3,
+	0xac, 0x1c, 0xf9, 0x02, 0xca, 0x2b, 0x75, 0x4f, 0x8e, 0xec, 0xac, 0x3e, 0x60, 0xee, 0xaf, 0x96,
+	0xb1, 0x95, 0xfb, 0x58, 0xfb, 0x7a, 0xf7, 0x87, 0xa2, 0xfc, 0xeb, 0xd4, 0xdf, 0x91, 0x3f, 0x9f,
+	0xfc, 0x1b, 0x00, 0x00, 0xff, 0xff, 0x89, 0xd6, 0x91, 0x7e, 0x58, 0x09, 0x00, 0x00,
 }
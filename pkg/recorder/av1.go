@@ -0,0 +1,338 @@
+package recorder
+
+import (
+	"github.com/pkg/errors"
+)
+
+// https://aomediacodec.github.io/av1-spec/
+const (
+	av1OBUTypeSequenceHeader    = 1
+	av1OBUTypeTemporalDelimiter = 2
+	av1OBUTypeFrameHeader       = 3
+	av1OBUTypeFrame             = 6
+
+	av1OBUHeaderExtensionFlag    = 0x04
+	av1OBUHeaderHasSizeFieldFlag = 0x02
+)
+
+type av1OBU struct {
+	obuType byte
+	// raw is the whole OBU including the header
+	raw     []byte
+	payload []byte
+}
+
+// splitAV1OBUs splits a temporal unit of AV1 (the OBUs with obu_size, as av1enc outputs).
+func splitAV1OBUs(tu []byte) ([]av1OBU, error) {
+	var obus []av1OBU
+	for len(tu) > 0 {
+		header := tu[0]
+		headerSize := 1
+		if header&av1OBUHeaderExtensionFlag != 0 {
+			headerSize = 2
+		}
+		if len(tu) < headerSize {
+			return nil, errors.New("truncated OBU header")
+		}
+		// an OBU without obu_size lasts until the end
+		end := len(tu)
+		payloadStart := headerSize
+		if header&av1OBUHeaderHasSizeFieldFlag != 0 {
+			size, n, err := readLEB128(tu[headerSize:])
+			if err != nil {
+				return nil, err
+			}
+			if uint64(len(tu)-headerSize-n) < size {
+				return nil, errors.New("truncated OBU")
+			}
+			payloadStart = headerSize + n
+			end = payloadStart + int(size)
+		}
+		obus = append(obus, av1OBU{
+			obuType: (header >> 3) & 0x0f,
+			raw:     tu[:end],
+			payload: tu[payloadStart:end],
+		})
+		tu = tu[end:]
+	}
+	return obus, nil
+}
+
+func readLEB128(b []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < 8 && i < len(b); i++ {
+		v |= uint64(b[i]&0x7f) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("invalid leb128")
+}
+
+// av1BlockData drops the temporal delimiters, which must not be stored in Matroska.
+// https://github.com/ietf-wg-cellar/matroska-specification/blob/master/codec/av1.md
+func av1BlockData(tu []byte) []byte {
+	obus, err := splitAV1OBUs(tu)
+	if err != nil {
+		return tu
+	}
+	data := make([]byte, 0, len(tu))
+	for _, obu := range obus {
+		if obu.obuType != av1OBUTypeTemporalDelimiter {
+			data = append(data, obu.raw...)
+		}
+	}
+	return data
+}
+
+// isAV1Keyframe returns whether the temporal unit starts a coded video sequence,
+// that is, it has a sequence header and its first frame is a shown key frame.
+func isAV1Keyframe(tu []byte) bool {
+	obus, err := splitAV1OBUs(tu)
+	if err != nil {
+		return false
+	}
+	var seq *av1SequenceHeader
+	for _, obu := range obus {
+		switch obu.obuType {
+		case av1OBUTypeSequenceHeader:
+			seq, err = parseAV1SequenceHeader(obu.payload)
+			if err != nil {
+				return false
+			}
+		case av1OBUTypeFrameHeader, av1OBUTypeFrame:
+			if seq == nil {
+				return false
+			}
+			if seq.reducedStillPictureHeader {
+				return true
+			}
+			if len(obu.payload) < 1 {
+				return false
+			}
+			// show_existing_frame f(1), frame_type f(2): 0 is KEY_FRAME
+			b := obu.payload[0]
+			return b>>7 == 0 && (b>>5)&0x3 == 0
+		}
+	}
+	return false
+}
+
+// av1CodecConfig returns AV1CodecConfigurationRecord (av1C) of the key frame as CodecPrivate.
+// https://aomediacodec.github.io/av1-isobmff/#av1codecconfigurationbox-syntax
+func av1CodecConfig(keyframe []byte) ([]byte, error) {
+	obus, err := splitAV1OBUs(keyframe)
+	if err != nil {
+		return nil, err
+	}
+	for _, obu := range obus {
+		if obu.obuType != av1OBUTypeSequenceHeader {
+			continue
+		}
+		seq, err := parseAV1SequenceHeader(obu.payload)
+		if err != nil {
+			return nil, err
+		}
+		config := []byte{
+			0x81, // marker, version
+			seq.profile<<5 | seq.levelIdx0,
+			seq.tier0<<7 | boolBit(seq.highBitdepth)<<6 | boolBit(seq.twelveBit)<<5 | boolBit(seq.monochrome)<<4 |
+				seq.subsamplingX<<3 | seq.subsamplingY<<2 | seq.chromaSamplePosition,
+			0, // initial_presentation_delay_present = 0
+		}
+		// configOBUs: the sequence header with obu_size
+		return append(config, obu.raw...), nil
+	}
+	return nil, errors.New("no sequence header in the AV1 key frame")
+}
+
+func boolBit(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type av1SequenceHeader struct {
+	profile                   byte
+	reducedStillPictureHeader bool
+	levelIdx0                 byte
+	tier0                     byte
+	highBitdepth              bool
+	twelveBit                 bool
+	monochrome                bool
+	subsamplingX              byte
+	subsamplingY              byte
+	chromaSamplePosition      byte
+}
+
+// parseAV1SequenceHeader reads sequence_header_obu() up to color_config().
+func parseAV1SequenceHeader(payload []byte) (*av1SequenceHeader, error) {
+	r := &bitReader{b: payload}
+	seq := &av1SequenceHeader{}
+	seq.profile = byte(r.read(3))
+	r.read(1) // still_picture
+	seq.reducedStillPictureHeader = r.flag()
+	if seq.reducedStillPictureHeader {
+		seq.levelIdx0 = byte(r.read(5))
+	} else {
+		decoderModelInfoPresent := false
+		bufferDelayLength := 0
+		timingInfoPresent := r.flag()
+		if timingInfoPresent {
+			r.read(32) // num_units_in_display_tick
+			r.read(32) // time_scale
+			equalPictureInterval := r.flag()
+			if equalPictureInterval {
+				r.uvlc() // num_ticks_per_picture_minus_1
+			}
+			decoderModelInfoPresent = r.flag()
+			if decoderModelInfoPresent {
+				bufferDelayLength = int(r.read(5)) + 1
+				r.read(32) // num_units_in_decoding_tick
+				r.read(5)  // buffer_removal_time_length_minus_1
+				r.read(5)  // frame_presentation_time_length_minus_1
+			}
+		}
+		initialDisplayDelayPresent := r.flag()
+		operatingPoints := int(r.read(5)) + 1
+		for i := 0; i < operatingPoints; i++ {
+			r.read(12) // operating_point_idc
+			level := byte(r.read(5))
+			var tier byte
+			if level > 7 {
+				tier = byte(r.read(1))
+			}
+			if i == 0 {
+				seq.levelIdx0, seq.tier0 = level, tier
+			}
+			if decoderModelInfoPresent && r.flag() { // decoder_model_present_for_this_op
+				r.read(bufferDelayLength) // decoder_buffer_delay
+				r.read(bufferDelayLength) // encoder_buffer_delay
+				r.read(1)                 // low_delay_mode_flag
+			}
+			if initialDisplayDelayPresent && r.flag() { // initial_display_delay_present_for_this_op
+				r.read(4) // initial_display_delay_minus_1
+			}
+		}
+	}
+	widthBits := int(r.read(4)) + 1
+	heightBits := int(r.read(4)) + 1
+	r.read(widthBits)  // max_frame_width_minus_1
+	r.read(heightBits) // max_frame_height_minus_1
+	frameIDNumbersPresent := !seq.reducedStillPictureHeader && r.flag()
+	if frameIDNumbersPresent {
+		r.read(4) // delta_frame_id_length_minus_2
+		r.read(3) // additional_frame_id_length_minus_1
+	}
+	r.read(1) // use_128x128_superblock
+	r.read(1) // enable_filter_intra
+	r.read(1) // enable_intra_edge_filter
+	if !seq.reducedStillPictureHeader {
+		r.read(1) // enable_interintra_compound
+		r.read(1) // enable_masked_compound
+		r.read(1) // enable_warped_motion
+		r.read(1) // enable_dual_filter
+		enableOrderHint := r.flag()
+		if enableOrderHint {
+			r.read(1) // enable_jnt_comp
+			r.read(1) // enable_ref_frame_mvs
+		}
+		forceScreenContentTools := uint32(2)
+		if !r.flag() { // seq_choose_screen_content_tools
+			forceScreenContentTools = r.read(1)
+		}
+		if forceScreenContentTools > 0 && !r.flag() { // seq_choose_integer_mv
+			r.read(1) // seq_force_integer_mv
+		}
+		if enableOrderHint {
+			r.read(3) // order_hint_bits_minus_1
+		}
+	}
+	r.read(1) // enable_superres
+	r.read(1) // enable_cdef
+	r.read(1) // enable_restoration
+
+	// color_config()
+	seq.highBitdepth = r.flag()
+	if seq.profile == 2 && seq.highBitdepth {
+		seq.twelveBit = r.flag()
+	}
+	if seq.profile != 1 {
+		seq.monochrome = r.flag()
+	}
+	colorPrimaries, transferCharacteristics, matrixCoefficients := uint32(2), uint32(2), uint32(2)
+	if r.flag() { // color_description_present_flag
+		colorPrimaries = r.read(8)
+		transferCharacteristics = r.read(8)
+		matrixCoefficients = r.read(8)
+	}
+	switch {
+	case seq.monochrome:
+		seq.subsamplingX, seq.subsamplingY = 1, 1
+	case colorPrimaries == 1 && transferCharacteristics == 13 && matrixCoefficients == 0:
+		// BT.709, sRGB and identity matrix
+		seq.subsamplingX, seq.subsamplingY = 0, 0
+	default:
+		r.read(1) // color_range
+		switch {
+		case seq.profile == 0:
+			seq.subsamplingX, seq.subsamplingY = 1, 1
+		case seq.profile == 1:
+			seq.subsamplingX, seq.subsamplingY = 0, 0
+		case seq.twelveBit:
+			seq.subsamplingX = byte(r.read(1))
+			if seq.subsamplingX == 1 {
+				seq.subsamplingY = byte(r.read(1))
+			}
+		default:
+			seq.subsamplingX, seq.subsamplingY = 1, 0
+		}
+		if seq.subsamplingX == 1 && seq.subsamplingY == 1 {
+			seq.chromaSamplePosition = byte(r.read(2))
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return seq, nil
+}
+
+// bitReader reads bits in MSB-first order. Reading beyond the end sets err and returns 0.
+type bitReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *bitReader) read(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.b)*8 {
+			r.err = errors.New("truncated AV1 sequence header")
+			return 0
+		}
+		bit := (r.b[r.pos/8] >> (7 - uint(r.pos%8))) & 0x1
+		v = v<<1 | uint32(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) flag() bool {
+	return r.read(1) == 1
+}
+
+func (r *bitReader) uvlc() uint32 {
+	leadingZeros := 0
+	for !r.flag() {
+		if r.err != nil {
+			return 0
+		}
+		leadingZeros++
+	}
+	if leadingZeros >= 32 {
+		return 1<<32 - 1
+	}
+	return r.read(leadingZeros) + (1<<uint(leadingZeros) - 1)
+}
@@ -0,0 +1,79 @@
+package recorder
+
+import (
+	"encoding/binary"
+
+	"github.com/castaneai/mashimaro/pkg/h264"
+)
+
+// Codec is a codec ID of Matroska.
+type Codec string
+
+const (
+	CodecH264 Codec = "V_MPEG4/ISO/AVC"
+	CodecVP8  Codec = "V_VP8"
+	CodecVP9  Codec = "V_VP9"
+	CodecAV1  Codec = "V_AV1"
+	CodecOpus Codec = "A_OPUS"
+)
+
+// isWebM returns whether the codec is allowed in WebM, a subset of Matroska.
+func (c Codec) isWebM() bool {
+	return c == CodecVP8 || c == CodecVP9 || c == CodecAV1 || c == CodecOpus
+}
+
+// isKeyframe returns whether the frame can be decoded by itself.
+func isKeyframe(codec Codec, frame []byte) bool {
+	switch codec {
+	case CodecH264:
+		return h264.IsKeyframe(frame)
+	case CodecVP8:
+		// https://tools.ietf.org/html/rfc6386#section-9.1
+		return len(frame) > 0 && frame[0]&0x01 == 0
+	case CodecVP9:
+		return isVP9Keyframe(frame)
+	case CodecAV1:
+		return isAV1Keyframe(frame)
+	default:
+		return true
+	}
+}
+
+// isVP9Keyframe reads the beginning of the uncompressed header of VP9.
+// https://storage.googleapis.com/downloads.webmproject.org/docs/vp9/vp9-bitstream-specification-v0.6-20160331-draft.pdf
+func isVP9Keyframe(frame []byte) bool {
+	if len(frame) < 1 {
+		return false
+	}
+	b := frame[0]
+	// frame_marker
+	if b>>6 != 0x2 {
+		return false
+	}
+	profile := (b>>5)&0x1 | ((b>>4)&0x1)<<1
+	pos := uint(4)
+	if profile == 3 {
+		// reserved_zero
+		pos++
+	}
+	showExistingFrame := (b>>(7-pos))&0x1 == 1
+	if showExistingFrame {
+		return false
+	}
+	pos++
+	// frame_type: 0 is KEY_FRAME
+	return (b>>(7-pos))&0x1 == 0
+}
+
+// opusHead returns the identification header of Opus (RFC 7845) as CodecPrivate.
+func opusHead(channels int) []byte {
+	buf := []byte("OpusHead")
+	buf = append(buf, 1, byte(channels))
+	buf = append(buf, 0, 0) // pre-skip
+	rate := make([]byte, 4)
+	binary.LittleEndian.PutUint32(rate, opusSampleRate)
+	buf = append(buf, rate...)
+	buf = append(buf, 0, 0) // output gain
+	buf = append(buf, 0)    // channel mapping family
+	return buf
+}
@@ -0,0 +1,237 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Matroska element IDs
+// https://www.matroska.org/technical/elements.html
+const (
+	idEBML               = 0x1A45DFA3
+	idEBMLVersion        = 0x4286
+	idEBMLReadVersion    = 0x42F7
+	idEBMLMaxIDLength    = 0x42F2
+	idEBMLMaxSizeLength  = 0x42F3
+	idDocType            = 0x4282
+	idDocTypeVersion     = 0x4287
+	idDocTypeReadVersion = 0x4285
+
+	idSegment          = 0x18538067
+	idInfo             = 0x1549A966
+	idTimestampScale   = 0x2AD7B1
+	idMuxingApp        = 0x4D80
+	idWritingApp       = 0x5741
+	idTracks           = 0x1654AE6B
+	idTrackEntry       = 0xAE
+	idTrackNumber      = 0xD7
+	idTrackUID         = 0x73C5
+	idTrackType        = 0x83
+	idFlagLacing       = 0x9C
+	idCodecID          = 0x86
+	idCodecPrivate     = 0x63A2
+	idSeekPreRoll      = 0x56BB
+	idVideo            = 0xE0
+	idPixelWidth       = 0xB0
+	idPixelHeight      = 0xBA
+	idAudio            = 0xE1
+	idSamplingFreq     = 0xB5
+	idChannels         = 0x9F
+	idCluster          = 0x1F43B675
+	idClusterTimestamp = 0xE7
+	idSimpleBlock      = 0xA3
+)
+
+const (
+	appName = "mashimaro"
+
+	trackTypeVideo = 1
+	trackTypeAudio = 2
+
+	// Block timestamps are relative to the cluster in int16 milliseconds.
+	maxClusterDuration = 5 * time.Second
+
+	opusSampleRate  = 48000
+	opusSeekPreRoll = 80 * time.Millisecond
+)
+
+// unknownSize is the size of an element written before its content is known.
+// Segment and clusters have unknown sizes so that a file can be written without seeking.
+var unknownSize = []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+type mkvTrack struct {
+	number       uint64
+	trackType    uint64
+	codec        Codec
+	codecPrivate []byte
+	width        int
+	height       int
+	channels     int
+}
+
+// mkvWriter writes a Matroska (or WebM) stream of SimpleBlocks.
+type mkvWriter struct {
+	w                io.Writer
+	tracks           map[uint64]*mkvTrack
+	clusterStarted   bool
+	clusterTimestamp time.Duration
+}
+
+func newMKVWriter(w io.Writer, docType string, tracks ...*mkvTrack) (*mkvWriter, error) {
+	m := &mkvWriter{w: w, tracks: make(map[uint64]*mkvTrack)}
+	header := element(idEBML,
+		uintElement(idEBMLVersion, 1),
+		uintElement(idEBMLReadVersion, 1),
+		uintElement(idEBMLMaxIDLength, 4),
+		uintElement(idEBMLMaxSizeLength, 8),
+		stringElement(idDocType, docType),
+		uintElement(idDocTypeVersion, 4),
+		uintElement(idDocTypeReadVersion, 2),
+	)
+	info := element(idInfo,
+		uintElement(idTimestampScale, uint64(time.Millisecond)),
+		stringElement(idMuxingApp, appName),
+		stringElement(idWritingApp, appName),
+	)
+	var entries [][]byte
+	for _, t := range tracks {
+		m.tracks[t.number] = t
+		entries = append(entries, t.entry())
+	}
+	buf := append(header, append(id(idSegment), unknownSize...)...)
+	buf = append(buf, info...)
+	buf = append(buf, element(idTracks, entries...)...)
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (t *mkvTrack) entry() []byte {
+	children := [][]byte{
+		uintElement(idTrackNumber, t.number),
+		uintElement(idTrackUID, t.number),
+		uintElement(idTrackType, t.trackType),
+		uintElement(idFlagLacing, 0),
+		stringElement(idCodecID, string(t.codec)),
+	}
+	if len(t.codecPrivate) > 0 {
+		children = append(children, element(idCodecPrivate, t.codecPrivate))
+	}
+	switch t.trackType {
+	case trackTypeVideo:
+		if t.width > 0 && t.height > 0 {
+			children = append(children, element(idVideo,
+				uintElement(idPixelWidth, uint64(t.width)),
+				uintElement(idPixelHeight, uint64(t.height)),
+			))
+		}
+	case trackTypeAudio:
+		if t.codec == CodecOpus {
+			children = append(children, uintElement(idSeekPreRoll, uint64(opusSeekPreRoll)))
+		}
+		children = append(children, element(idAudio,
+			floatElement(idSamplingFreq, opusSampleRate),
+			uintElement(idChannels, uint64(t.channels)),
+		))
+	}
+	return element(idTrackEntry, children...)
+}
+
+// WriteBlock writes a frame of the track at the timestamp from the beginning of the file.
+// A cluster starts at every video keyframe so that players can seek to it.
+func (m *mkvWriter) WriteBlock(trackNumber uint64, timestamp time.Duration, keyframe bool, data []byte) error {
+	t, ok := m.tracks[trackNumber]
+	if !ok {
+		return fmt.Errorf("unknown track: %d", trackNumber)
+	}
+	if timestamp < m.clusterTimestamp {
+		timestamp = m.clusterTimestamp
+	}
+	if !m.clusterStarted || (keyframe && t.trackType == trackTypeVideo) || timestamp-m.clusterTimestamp >= maxClusterDuration {
+		cluster := append(id(idCluster), unknownSize...)
+		cluster = append(cluster, uintElement(idClusterTimestamp, uint64(timestamp/time.Millisecond))...)
+		if _, err := m.w.Write(cluster); err != nil {
+			return err
+		}
+		m.clusterStarted = true
+		m.clusterTimestamp = timestamp - timestamp%time.Millisecond
+	}
+
+	block := make([]byte, 4, 4+len(data))
+	block[0] = 0x80 | byte(trackNumber)
+	binary.BigEndian.PutUint16(block[1:], uint16(int16((timestamp-m.clusterTimestamp)/time.Millisecond)))
+	if keyframe {
+		block[3] = 0x80
+	}
+	block = append(block, data...)
+	_, err := m.w.Write(element(idSimpleBlock, block))
+	return err
+}
+
+func id(v uint32) []byte {
+	switch {
+	case v > 0xFFFFFF:
+		return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	case v > 0xFFFF:
+		return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	case v > 0xFF:
+		return []byte{byte(v >> 8), byte(v)}
+	default:
+		return []byte{byte(v)}
+	}
+}
+
+// vint encodes an element size in the shortest form.
+// All ones are reserved for the unknown size, so the max value of each length is one less.
+func vint(n uint64) []byte {
+	for length := 1; length <= 8; length++ {
+		if n < (1<<(7*uint(length)))-1 {
+			buf := make([]byte, length)
+			for i := length - 1; i >= 0; i-- {
+				buf[i] = byte(n)
+				n >>= 8
+			}
+			buf[0] |= 0x80 >> uint(length-1)
+			return buf
+		}
+	}
+	panic(fmt.Sprintf("too large element size: %d", n))
+}
+
+func element(elementID uint32, children ...[]byte) []byte {
+	var size int
+	for _, c := range children {
+		size += len(c)
+	}
+	buf := append(id(elementID), vint(uint64(size))...)
+	for _, c := range children {
+		buf = append(buf, c...)
+	}
+	return buf
+}
+
+func uintElement(elementID uint32, v uint64) []byte {
+	var buf []byte
+	for v > 0 {
+		buf = append([]byte{byte(v)}, buf...)
+		v >>= 8
+	}
+	if len(buf) == 0 {
+		buf = []byte{0}
+	}
+	return element(elementID, buf)
+}
+
+func floatElement(elementID uint32, v float64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, math.Float64bits(v))
+	return element(elementID, buf)
+}
+
+func stringElement(elementID uint32, s string) []byte {
+	return element(elementID, []byte(s))
+}
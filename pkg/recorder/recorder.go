@@ -0,0 +1,343 @@
+// Package recorder records video and audio frames of a play session into Matroska (or WebM) files.
+package recorder
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/castaneai/mashimaro/pkg/h264"
+)
+
+const (
+	videoTrackNumber = 1
+	audioTrackNumber = 2
+)
+
+type Config struct {
+	// Dir is the directory to write files to.
+	Dir string
+	// MaxFileSize rotates the file when it exceeds the size in bytes. 0 means unlimited.
+	MaxFileSize int64
+	// MaxFileDuration rotates the file when it exceeds the duration. 0 means unlimited.
+	MaxFileDuration time.Duration
+}
+
+type VideoTrack struct {
+	Codec  Codec
+	Width  int
+	Height int
+}
+
+type AudioTrack struct {
+	Codec    Codec
+	Channels int
+}
+
+// Recorder writes frames into files while recording.
+// A file always starts with a video keyframe, so frames before the first keyframe are dropped.
+// Files are rotated at a keyframe by size and duration, and when the video size changes.
+// The timestamps of frames are given by their PTS and durations,
+// and video and audio are aligned at the beginning of a file.
+type Recorder struct {
+	conf  Config
+	name  string
+	video VideoTrack
+	audio AudioTrack
+	now   func() time.Time
+
+	recording  bool
+	file       *os.File
+	buf        *bufio.Writer
+	mkv        *mkvWriter
+	videoClock trackClock
+	audioClock trackClock
+	// timestamps of the tracks at the beginning of the file
+	videoBase time.Duration
+	audioBase time.Duration
+	// false until the first audio frame of the file when the file starts before audio
+	audioAligned      bool
+	lastVideoBlock    time.Duration
+	fileSize          int64
+	seq               int
+	keyframeRequested bool
+	mu                sync.Mutex
+
+	onKeyframeNeeded func()
+	callbackMu       sync.Mutex
+}
+
+// New returns a recorder writing files named after the name.
+func New(conf Config, name string, video VideoTrack, audio AudioTrack) *Recorder {
+	return &Recorder{
+		conf:  conf,
+		name:  name,
+		video: video,
+		audio: audio,
+		now:   time.Now,
+	}
+}
+
+// OnKeyframeNeeded sets the callback to request a keyframe from the video encoder,
+// which is called when the recorder is waiting for a keyframe to start a file.
+func (r *Recorder) OnKeyframeNeeded(f func()) {
+	r.callbackMu.Lock()
+	defer r.callbackMu.Unlock()
+	r.onKeyframeNeeded = f
+}
+
+func (r *Recorder) Recording() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.recording
+}
+
+func (r *Recorder) Start() {
+	r.mu.Lock()
+	if r.recording {
+		r.mu.Unlock()
+		return
+	}
+	log.Printf("start recording (name: %s)", r.name)
+	r.recording = true
+	r.mu.Unlock()
+	r.requestKeyframe()
+}
+
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.recording {
+		return nil
+	}
+	log.Printf("stop recording (name: %s)", r.name)
+	r.recording = false
+	return r.closeFileLocked()
+}
+
+// SetVideoSize changes the video size of the next file.
+// The current file is closed because the size of a track cannot change in a file.
+func (r *Recorder) SetVideoSize(width, height int) error {
+	r.mu.Lock()
+	if r.video.Width == width && r.video.Height == height {
+		r.mu.Unlock()
+		return nil
+	}
+	r.video.Width = width
+	r.video.Height = height
+	if r.mkv == nil {
+		r.mu.Unlock()
+		return nil
+	}
+	err := r.closeFileLocked()
+	r.mu.Unlock()
+	r.requestKeyframe()
+	return err
+}
+
+// WriteVideo writes a video frame.
+// pts is the presentation timestamp of the frame, and 0 means the end of the previous frame.
+func (r *Recorder) WriteVideo(frame []byte, pts, duration time.Duration) error {
+	r.mu.Lock()
+	timestamp := r.videoClock.timestamp(pts, duration)
+	if !r.recording {
+		r.mu.Unlock()
+		return nil
+	}
+	keyframe := isKeyframe(r.video.Codec, frame)
+	needKeyframe := false
+	if r.mkv != nil && r.shouldRotateLocked(timestamp) {
+		if keyframe {
+			if err := r.closeFileLocked(); err != nil {
+				return r.failLocked(err)
+			}
+		} else if !r.keyframeRequested {
+			r.keyframeRequested = true
+			needKeyframe = true
+		}
+	}
+	if r.mkv == nil {
+		if !keyframe {
+			r.mu.Unlock()
+			return nil
+		}
+		if err := r.openFileLocked(frame, timestamp); err != nil {
+			return r.failLocked(err)
+		}
+	}
+	switch r.video.Codec {
+	case CodecH264:
+		frame = h264.AnnexBToAVC(frame)
+	case CodecAV1:
+		frame = av1BlockData(frame)
+	}
+	r.lastVideoBlock = timestamp - r.videoBase
+	if err := r.mkv.WriteBlock(videoTrackNumber, r.lastVideoBlock, keyframe, frame); err != nil {
+		return r.failLocked(err)
+	}
+	r.mu.Unlock()
+	if needKeyframe {
+		r.requestKeyframe()
+	}
+	return nil
+}
+
+// WriteAudio writes an audio frame.
+// pts is the presentation timestamp of the frame, and 0 means the end of the previous frame.
+func (r *Recorder) WriteAudio(frame []byte, pts, duration time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	timestamp := r.audioClock.timestamp(pts, duration)
+	if !r.recording || r.mkv == nil {
+		return nil
+	}
+	if !r.audioAligned {
+		// the first audio frame of the file plays with the latest video frame
+		r.audioBase = timestamp - r.lastVideoBlock
+		r.audioAligned = true
+	}
+	if err := r.mkv.WriteBlock(audioTrackNumber, timestamp-r.audioBase, true, frame); err != nil {
+		r.recording = false
+		_ = r.closeFileLocked()
+		return err
+	}
+	return nil
+}
+
+// failLocked stops recording on a write error and unlocks.
+func (r *Recorder) failLocked(err error) error {
+	defer r.mu.Unlock()
+	r.recording = false
+	_ = r.closeFileLocked()
+	return err
+}
+
+func (r *Recorder) shouldRotateLocked(videoTimestamp time.Duration) bool {
+	if r.conf.MaxFileSize > 0 && r.fileSize >= r.conf.MaxFileSize {
+		return true
+	}
+	if r.conf.MaxFileDuration > 0 && videoTimestamp-r.videoBase >= r.conf.MaxFileDuration {
+		return true
+	}
+	return false
+}
+
+func (r *Recorder) openFileLocked(keyframe []byte, timestamp time.Duration) error {
+	video := &mkvTrack{
+		number:    videoTrackNumber,
+		trackType: trackTypeVideo,
+		codec:     r.video.Codec,
+		width:     r.video.Width,
+		height:    r.video.Height,
+	}
+	switch r.video.Codec {
+	case CodecH264:
+		config, err := h264.DecoderConfig(keyframe)
+		if err != nil {
+			return err
+		}
+		video.codecPrivate = config
+	case CodecAV1:
+		config, err := av1CodecConfig(keyframe)
+		if err != nil {
+			return err
+		}
+		video.codecPrivate = config
+	}
+	audio := &mkvTrack{
+		number:    audioTrackNumber,
+		trackType: trackTypeAudio,
+		codec:     r.audio.Codec,
+		channels:  r.audio.Channels,
+	}
+	if r.audio.Codec == CodecOpus {
+		audio.codecPrivate = opusHead(r.audio.Channels)
+	}
+	docType, ext := "matroska", ".mkv"
+	if r.video.Codec.isWebM() && r.audio.Codec.isWebM() {
+		docType, ext = "webm", ".webm"
+	}
+
+	if err := os.MkdirAll(r.conf.Dir, 0755); err != nil {
+		return err
+	}
+	started := r.now()
+	r.seq++
+	path := filepath.Join(r.conf.Dir, fmt.Sprintf("%s-%s-%03d%s", r.name, started.Format("20060102-150405"), r.seq, ext))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	r.fileSize = 0
+	buf := bufio.NewWriter(f)
+	mkv, err := newMKVWriter(&countingWriter{w: buf, n: &r.fileSize}, docType, video, audio)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	log.Printf("recording to %s", path)
+	r.file = f
+	r.buf = buf
+	r.mkv = mkv
+	r.videoBase = timestamp
+	r.lastVideoBlock = 0
+	// the next audio frame plays with the first video frame
+	r.audioBase = r.audioClock.next
+	r.audioAligned = r.audioClock.started
+	r.keyframeRequested = false
+	return nil
+}
+
+func (r *Recorder) closeFileLocked() error {
+	if r.file == nil {
+		return nil
+	}
+	f, buf := r.file, r.buf
+	r.file, r.buf, r.mkv = nil, nil, nil
+	if err := buf.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (r *Recorder) requestKeyframe() {
+	r.callbackMu.Lock()
+	f := r.onKeyframeNeeded
+	r.callbackMu.Unlock()
+	if f != nil {
+		f()
+	}
+}
+
+// trackClock gives the timestamps of the frames of a track.
+// Frames without PTS follow the previous frame by its duration.
+type trackClock struct {
+	next    time.Duration
+	started bool
+}
+
+func (c *trackClock) timestamp(pts, duration time.Duration) time.Duration {
+	if pts == 0 {
+		pts = c.next
+	}
+	c.next = pts + duration
+	c.started = true
+	return pts
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	*w.n += int64(n)
+	return n, err
+}
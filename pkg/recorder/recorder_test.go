@@ -0,0 +1,336 @@
+package recorder
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	vp8Keyframe   = []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a}
+	vp8Interframe = []byte{0x11, 0x02, 0x00}
+	opusFrame     = []byte{0xfc, 0xff, 0xfe}
+)
+
+const (
+	videoFrameDuration = 33 * time.Millisecond
+	audioFrameDuration = 20 * time.Millisecond
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestRecorder(t *testing.T, conf Config, video VideoTrack) (*Recorder, *fakeClock, func() int) {
+	dir, err := ioutil.TempDir("", "mashimaro-recorder")
+	assert.NoError(t, err)
+	conf.Dir = dir
+	clock := &fakeClock{t: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	r := New(conf, "test-session", video, AudioTrack{Codec: CodecOpus, Channels: 2})
+	r.now = clock.Now
+	keyframeRequests := 0
+	r.OnKeyframeNeeded(func() { keyframeRequests++ })
+	return r, clock, func() int { return keyframeRequests }
+}
+
+func recordedFiles(t *testing.T, r *Recorder) []string {
+	files, err := filepath.Glob(filepath.Join(r.conf.Dir, "*"))
+	assert.NoError(t, err)
+	return files
+}
+
+func TestRecorder(t *testing.T) {
+	r, clock, keyframeRequests := newTestRecorder(t, Config{}, VideoTrack{Codec: CodecVP8, Width: 640, Height: 480})
+	defer os.RemoveAll(r.conf.Dir)
+
+	// not recording
+	assert.NoError(t, r.WriteVideo(vp8Keyframe, 0, videoFrameDuration))
+	assert.Empty(t, recordedFiles(t, r))
+
+	r.Start()
+	assert.True(t, r.Recording())
+	assert.Equal(t, 1, keyframeRequests())
+
+	// frames before the first keyframe are dropped
+	assert.NoError(t, r.WriteVideo(vp8Interframe, 0, videoFrameDuration))
+	assert.NoError(t, r.WriteAudio(opusFrame, 0, audioFrameDuration))
+	assert.Empty(t, recordedFiles(t, r))
+
+	// timestamps are given by the durations of frames, not by the time they are written
+	assert.NoError(t, r.WriteVideo(vp8Keyframe, 0, videoFrameDuration))
+	clock.Advance(50 * time.Millisecond)
+	assert.NoError(t, r.WriteAudio(opusFrame, 0, audioFrameDuration))
+	assert.NoError(t, r.WriteAudio(opusFrame, 0, audioFrameDuration))
+	assert.NoError(t, r.WriteVideo(vp8Interframe, 0, videoFrameDuration))
+	assert.NoError(t, r.Stop())
+	assert.False(t, r.Recording())
+
+	files := recordedFiles(t, r)
+	assert.Equal(t, []string{filepath.Join(r.conf.Dir, "test-session-20210101-000000-001.webm")}, files)
+	data, err := ioutil.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}))
+	assert.Contains(t, string(data), "webm")
+	assert.Contains(t, string(data), "OpusHead")
+	assert.Equal(t, []testBlock{
+		{track: videoTrackNumber, timestamp: 0, keyframe: true},
+		{track: audioTrackNumber, timestamp: 0, keyframe: true},
+		{track: audioTrackNumber, timestamp: 20, keyframe: true},
+		{track: videoTrackNumber, timestamp: 33, keyframe: false},
+	}, readBlocks(t, data))
+}
+
+func TestRecorderTimestamps(t *testing.T) {
+	r, _, _ := newTestRecorder(t, Config{}, VideoTrack{Codec: CodecVP8, Width: 640, Height: 480})
+	defer os.RemoveAll(r.conf.Dir)
+	r.Start()
+
+	// the PTS of video and audio start from different origins
+	assert.NoError(t, r.WriteVideo(vp8Keyframe, 1000*time.Millisecond, videoFrameDuration))
+	assert.NoError(t, r.WriteVideo(vp8Interframe, 1033*time.Millisecond, videoFrameDuration))
+	// the audio starting after the file plays with the latest video frame
+	assert.NoError(t, r.WriteAudio(opusFrame, 5000*time.Millisecond, audioFrameDuration))
+	assert.NoError(t, r.WriteAudio(opusFrame, 5020*time.Millisecond, audioFrameDuration))
+	// a frame without PTS follows the previous frame
+	assert.NoError(t, r.WriteVideo(vp8Interframe, 0, videoFrameDuration))
+	assert.NoError(t, r.Stop())
+
+	files := recordedFiles(t, r)
+	assert.Len(t, files, 1)
+	data, err := ioutil.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []testBlock{
+		{track: videoTrackNumber, timestamp: 0, keyframe: true},
+		{track: videoTrackNumber, timestamp: 33, keyframe: false},
+		{track: audioTrackNumber, timestamp: 33, keyframe: true},
+		{track: audioTrackNumber, timestamp: 53, keyframe: true},
+		{track: videoTrackNumber, timestamp: 66, keyframe: false},
+	}, readBlocks(t, data))
+}
+
+func TestRecorderRotation(t *testing.T) {
+	r, _, keyframeRequests := newTestRecorder(t, Config{MaxFileDuration: 10 * time.Second}, VideoTrack{Codec: CodecVP8})
+	defer os.RemoveAll(r.conf.Dir)
+	r.Start()
+	assert.NoError(t, r.WriteVideo(vp8Keyframe, 0, 10*time.Second))
+
+	// the file is rotated at the next keyframe
+	assert.NoError(t, r.WriteVideo(vp8Interframe, 0, videoFrameDuration))
+	assert.NoError(t, r.WriteVideo(vp8Interframe, 0, videoFrameDuration))
+	assert.Equal(t, 2, keyframeRequests())
+	assert.Len(t, recordedFiles(t, r), 1)
+	assert.NoError(t, r.WriteVideo(vp8Keyframe, 0, videoFrameDuration))
+	assert.Len(t, recordedFiles(t, r), 2)
+
+	// by size
+	r.conf.MaxFileSize = 1
+	assert.NoError(t, r.WriteVideo(vp8Keyframe, 0, videoFrameDuration))
+	assert.Len(t, recordedFiles(t, r), 3)
+
+	// by video size
+	assert.NoError(t, r.SetVideoSize(1280, 720))
+	assert.Equal(t, 3, keyframeRequests())
+	assert.NoError(t, r.WriteVideo(vp8Interframe, 0, videoFrameDuration))
+	assert.Len(t, recordedFiles(t, r), 3)
+	assert.NoError(t, r.WriteVideo(vp8Keyframe, 0, videoFrameDuration))
+	assert.Len(t, recordedFiles(t, r), 4)
+	assert.NoError(t, r.Stop())
+}
+
+func TestRecorderH264(t *testing.T) {
+	r, _, _ := newTestRecorder(t, Config{}, VideoTrack{Codec: CodecH264, Width: 640, Height: 480})
+	defer os.RemoveAll(r.conf.Dir)
+	r.Start()
+	sps := []byte{0x67, 0x42, 0xc0, 0x1f, 0xda}
+	pps := []byte{0x68, 0xce, 0x3c, 0x80}
+	idr := []byte{0x65, 0x88, 0x84}
+	keyframe := bytes.Join([][]byte{{}, sps, pps, idr}, []byte{0, 0, 0, 1})
+	assert.NoError(t, r.WriteVideo([]byte{0, 0, 0, 1, 0x41, 0x9a}, 0, videoFrameDuration)) // non-IDR
+	assert.NoError(t, r.WriteVideo(keyframe, 0, videoFrameDuration))
+	assert.NoError(t, r.Stop())
+
+	files := recordedFiles(t, r)
+	assert.Equal(t, []string{filepath.Join(r.conf.Dir, "test-session-20210101-000000-001.mkv")}, files)
+	data, err := ioutil.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), string(CodecH264))
+	// AVCDecoderConfigurationRecord
+	assert.Contains(t, string(data), string(append([]byte{1, 0x42, 0xc0, 0x1f, 0xff, 0xe1, 0, 5}, sps...)))
+	// length-prefixed NAL units
+	assert.Contains(t, string(data), string(append([]byte{0, 0, 0, 3}, idr...)))
+	assert.Equal(t, []testBlock{{track: videoTrackNumber, timestamp: 0, keyframe: true}}, readBlocks(t, data))
+}
+
+// av1SequenceHeaderOBU is a sequence header of 1280x720, 8 bit 4:2:0 in profile 0 and level 4.0 (seq_level_idx=8).
+var av1SequenceHeaderOBU = av1OBUWithSize(0x08, packBits(
+	3, 0, // seq_profile
+	1, 0, // still_picture
+	1, 0, // reduced_still_picture_header
+	1, 0, // timing_info_present_flag
+	1, 0, // initial_display_delay_present_flag
+	5, 0, // operating_points_cnt_minus_1
+	12, 0, // operating_point_idc[0]
+	5, 8, // seq_level_idx[0]
+	1, 0, // seq_tier[0]
+	4, 10, // frame_width_bits_minus_1
+	4, 10, // frame_height_bits_minus_1
+	11, 1279, // max_frame_width_minus_1
+	11, 719, // max_frame_height_minus_1
+	1, 0, // frame_id_numbers_present_flag
+	1, 0, // use_128x128_superblock
+	1, 1, // enable_filter_intra
+	1, 1, // enable_intra_edge_filter
+	1, 0, // enable_interintra_compound
+	1, 0, // enable_masked_compound
+	1, 0, // enable_warped_motion
+	1, 0, // enable_dual_filter
+	1, 1, // enable_order_hint
+	1, 0, // enable_jnt_comp
+	1, 0, // enable_ref_frame_mvs
+	1, 1, // seq_choose_screen_content_tools
+	1, 1, // seq_choose_integer_mv
+	3, 6, // order_hint_bits_minus_1
+	1, 0, // enable_superres
+	1, 1, // enable_cdef
+	1, 1, // enable_restoration
+	1, 0, // high_bitdepth
+	1, 0, // mono_chrome
+	1, 0, // color_description_present_flag
+	1, 0, // color_range
+	2, 0, // chroma_sample_position
+	1, 0, // separate_uv_delta_q
+	1, 1, // trailing_one_bit
+))
+
+// av1OBUWithSize returns an OBU with obu_size of the short payload.
+func av1OBUWithSize(header byte, payload []byte) []byte {
+	return append([]byte{header | av1OBUHeaderHasSizeFieldFlag, byte(len(payload))}, payload...)
+}
+
+// packBits packs pairs of the number of bits and the value in MSB-first order.
+func packBits(fields ...uint) []byte {
+	var b []byte
+	pos := 0
+	for i := 0; i < len(fields); i += 2 {
+		for bit := int(fields[i]) - 1; bit >= 0; bit-- {
+			if pos%8 == 0 {
+				b = append(b, 0)
+			}
+			b[len(b)-1] |= byte((fields[i+1]>>uint(bit))&1) << uint(7-pos%8)
+			pos++
+		}
+	}
+	return b
+}
+
+func TestRecorderAV1(t *testing.T) {
+	r, _, _ := newTestRecorder(t, Config{}, VideoTrack{Codec: CodecAV1, Width: 1280, Height: 720})
+	defer os.RemoveAll(r.conf.Dir)
+	r.Start()
+	temporalDelimiter := []byte{0x12, 0x00}
+	keyFrame := []byte{0x32, 0x02, 0x10, 0xaa}   // frame OBU: show_existing_frame=0, frame_type=KEY_FRAME
+	interFrame := []byte{0x32, 0x02, 0x30, 0xbb} // frame_type=INTER_FRAME
+	keyframe := bytes.Join([][]byte{temporalDelimiter, av1SequenceHeaderOBU, keyFrame}, nil)
+	assert.NoError(t, r.WriteVideo(append(temporalDelimiter, interFrame...), 0, videoFrameDuration))
+	assert.NoError(t, r.WriteVideo(keyframe, 0, videoFrameDuration))
+	assert.NoError(t, r.Stop())
+
+	files := recordedFiles(t, r)
+	assert.Equal(t, []string{filepath.Join(r.conf.Dir, "test-session-20210101-000000-001.webm")}, files)
+	data, err := ioutil.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), string(CodecAV1))
+	// AV1CodecConfigurationRecord: profile 0, level 8, 4:2:0 and the sequence header
+	assert.Contains(t, string(data), string(append([]byte{0x81, 0x08, 0x0c, 0x00}, av1SequenceHeaderOBU...)))
+	// the temporal delimiter is dropped from the block
+	assert.Contains(t, string(data), string(append(av1SequenceHeaderOBU, keyFrame...)))
+	assert.NotContains(t, string(data), string(append(temporalDelimiter, av1SequenceHeaderOBU...)))
+	assert.Equal(t, []testBlock{{track: videoTrackNumber, timestamp: 0, keyframe: true}}, readBlocks(t, data))
+}
+
+func TestIsAV1Keyframe(t *testing.T) {
+	keyFrame := []byte{0x32, 0x02, 0x10, 0xaa}
+	assert.True(t, isAV1Keyframe(append(append([]byte{}, av1SequenceHeaderOBU...), keyFrame...)))
+	// no sequence header
+	assert.False(t, isAV1Keyframe(keyFrame))
+	// frame_type=INTRA_ONLY_FRAME
+	assert.False(t, isAV1Keyframe(append(append([]byte{}, av1SequenceHeaderOBU...), 0x32, 0x02, 0x50, 0xaa)))
+	// show_existing_frame=1
+	assert.False(t, isAV1Keyframe(append(append([]byte{}, av1SequenceHeaderOBU...), 0x1a, 0x01, 0x80)))
+}
+
+func TestIsVP9Keyframe(t *testing.T) {
+	// frame_marker=2, profile=0, show_existing_frame=0, frame_type=0
+	assert.True(t, isVP9Keyframe([]byte{0x80}))
+	// frame_type=1
+	assert.False(t, isVP9Keyframe([]byte{0x84}))
+	// show_existing_frame=1
+	assert.False(t, isVP9Keyframe([]byte{0x88}))
+	// profile=3 has the reserved bit
+	assert.True(t, isVP9Keyframe([]byte{0xb0}))
+	assert.False(t, isVP9Keyframe([]byte{0xb2}))
+}
+
+type testBlock struct {
+	track     int
+	timestamp int
+	keyframe  bool
+}
+
+// readBlocks reads SimpleBlocks with absolute timestamps in milliseconds.
+func readBlocks(t *testing.T, data []byte) []testBlock {
+	var blocks []testBlock
+	clusterTimestamp := 0
+	for len(data) > 0 {
+		elementID, n := readVint(data, true)
+		data = data[n:]
+		size, n := readVint(data, false)
+		data = data[n:]
+		switch elementID {
+		case idSegment, idCluster:
+			// descend into the element with the unknown size
+			continue
+		case idClusterTimestamp:
+			clusterTimestamp = 0
+			for _, b := range data[:size] {
+				clusterTimestamp = clusterTimestamp<<8 | int(b)
+			}
+		case idSimpleBlock:
+			block := data[:size]
+			blocks = append(blocks, testBlock{
+				track:     int(block[0] & 0x7F),
+				timestamp: clusterTimestamp + int(int16(uint16(block[1])<<8|uint16(block[2]))),
+				keyframe:  block[3]&0x80 != 0,
+			})
+		}
+		if size > uint64(len(data)) {
+			t.Fatalf("invalid element size: %d (ID: %x)", size, elementID)
+		}
+		data = data[size:]
+	}
+	return blocks
+}
+
+func readVint(data []byte, keepMarker bool) (uint64, int) {
+	length := 1
+	for mask := byte(0x80); length <= 8 && data[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	v := uint64(data[0])
+	if !keepMarker {
+		v &= uint64(0xFF >> uint(length))
+	}
+	for _, b := range data[1:length] {
+		v = v<<8 | uint64(b)
+	}
+	return v, length
+}
@@ -0,0 +1,50 @@
+package signaling
+
+import (
+	"github.com/castaneai/mashimaro/pkg/iceserver"
+)
+
+// the messages of the Ayame protocol (https://github.com/OpenAyame/ayame/blob/develop/doc/PROTOCOL.md)
+const (
+	messageTypeRegister  = "register"
+	messageTypeAccept    = "accept"
+	messageTypeReject    = "reject"
+	messageTypeOffer     = "offer"
+	messageTypeAnswer    = "answer"
+	messageTypeCandidate = "candidate"
+	messageTypeBye       = "bye"
+	messageTypePing      = "ping"
+	messageTypePong      = "pong"
+)
+
+// the reasons of reject messages
+const (
+	RejectReasonInvalidRegister   = "INVALID-REGISTER-MESSAGE"
+	RejectReasonUnauthorized      = "AUTHN-FAILED"
+	RejectReasonTooManyUsers      = "TOO-MANY-USERS"
+	RejectReasonDuplicateClientID = "DUPLICATE-CLIENT-ID"
+)
+
+type typeMessage struct {
+	Type string `json:"type"`
+}
+
+type registerMessage struct {
+	Type         string `json:"type"`
+	RoomID       string `json:"roomId"`
+	ClientID     string `json:"clientId"`
+	SignalingKey string `json:"signalingKey,omitempty"`
+}
+
+type acceptMessage struct {
+	Type          string             `json:"type"`
+	IceServers    []iceserver.Server `json:"iceServers,omitempty"`
+	IsExistClient bool               `json:"isExistClient"`
+	// the older name of isExistClient for compatibility
+	IsExistUser bool `json:"isExistUser"`
+}
+
+type rejectMessage struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
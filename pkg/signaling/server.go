@@ -0,0 +1,293 @@
+package signaling
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+
+	"github.com/castaneai/mashimaro/pkg/iceserver"
+)
+
+const (
+	// a room has the game server and a player
+	maxClientsPerRoom   = 2
+	registerTimeout     = 10 * time.Second
+	defaultPingInterval = 5 * time.Second
+	// a client is disconnected without pong for this number of ping intervals
+	pongTimeoutIntervals = 3
+)
+
+// Server is a signaling server compatible with Ayame (https://github.com/OpenAyame/ayame).
+// Two clients in the same room exchange offer, answer and candidate messages through the server.
+type Server struct {
+	rooms map[string]*room
+	opts  *serverOptions
+	mu    sync.Mutex
+}
+
+type serverOptions struct {
+	authenticator Authenticator
+	iceServers    *iceserver.Config
+	pingInterval  time.Duration
+}
+
+func defaultServerOptions() *serverOptions {
+	return &serverOptions{
+		pingInterval: defaultPingInterval,
+	}
+}
+
+type ServerOption interface {
+	apply(opts *serverOptions)
+}
+
+type ServerOptionFunc func(*serverOptions)
+
+func (f ServerOptionFunc) apply(opts *serverOptions) {
+	f(opts)
+}
+
+// WithAuthenticator rejects clients failing the authentication (e.g. NewJoinTokenAuthenticator).
+// By default, any client can join any room.
+func WithAuthenticator(a Authenticator) ServerOption {
+	return ServerOptionFunc(func(opts *serverOptions) {
+		opts.authenticator = a
+	})
+}
+
+// WithICEServers hands the ICE servers to clients in the accept message,
+// with TURN credentials issued for "<room ID>-<client ID>".
+func WithICEServers(conf iceserver.Config) ServerOption {
+	return ServerOptionFunc(func(opts *serverOptions) {
+		opts.iceServers = &conf
+	})
+}
+
+// WithPingInterval sets the interval of ping messages to detect dead clients.
+func WithPingInterval(interval time.Duration) ServerOption {
+	return ServerOptionFunc(func(opts *serverOptions) {
+		opts.pingInterval = interval
+	})
+}
+
+func NewServer(options ...ServerOption) *Server {
+	opts := defaultServerOptions()
+	for _, opt := range options {
+		opt.apply(opts)
+	}
+	return &Server{
+		rooms: make(map[string]*room),
+		opts:  opts,
+	}
+}
+
+// HTTPHandler returns the WebSocket endpoint of signaling (e.g. mounted on "/signaling").
+func (s *Server) HTTPHandler() http.Handler {
+	// websocket.Handler rejects requests from other origins than the host, but players are served on other origins
+	return websocket.Server{Handler: s.serveConn}
+}
+
+type room struct {
+	id      string
+	clients []*client
+}
+
+type client struct {
+	id      string
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+func (c *client) send(msg interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return websocket.JSON.Send(c.conn, msg)
+}
+
+func (c *client) sendRaw(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return websocket.Message.Send(c.conn, string(data))
+}
+
+func (s *Server) serveConn(ws *websocket.Conn) {
+	defer ws.Close()
+	r, c, err := s.register(ws)
+	if err != nil {
+		log.Printf("failed to register signaling client: %+v", err)
+		return
+	}
+	defer s.leave(r, c)
+	log.Printf("signaling client registered (room: %s, client: %s)", r.id, c.id)
+
+	pong := make(chan struct{}, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go s.ping(c, pong, done)
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			return
+		}
+		var msg typeMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Printf("failed to unmarshal signaling message (room: %s, client: %s): %+v", r.id, c.id, err)
+			continue
+		}
+		switch msg.Type {
+		case messageTypePong:
+			select {
+			case pong <- struct{}{}:
+			default:
+			}
+		case messageTypeOffer, messageTypeAnswer, messageTypeCandidate:
+			peer := s.peerOf(r, c)
+			if peer == nil {
+				log.Printf("dropped %s message without peer (room: %s, client: %s)", msg.Type, r.id, c.id)
+				continue
+			}
+			if err := peer.sendRaw(data); err != nil {
+				log.Printf("failed to forward %s message (room: %s, client: %s): %+v", msg.Type, r.id, peer.id, err)
+			}
+		default:
+			log.Printf("unknown type of signaling message (room: %s, client: %s): %s", r.id, c.id, msg.Type)
+		}
+	}
+}
+
+// register reads the register message and joins the room, or sends a reject message.
+func (s *Server) register(ws *websocket.Conn) (*room, *client, error) {
+	if err := ws.SetReadDeadline(time.Now().Add(registerTimeout)); err != nil {
+		return nil, nil, err
+	}
+	var msg registerMessage
+	if err := websocket.JSON.Receive(ws, &msg); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to receive register message")
+	}
+	if err := ws.SetReadDeadline(time.Time{}); err != nil {
+		return nil, nil, err
+	}
+	c := &client{id: msg.ClientID, conn: ws}
+	reject := func(reason string, err error) (*room, *client, error) {
+		if serr := c.send(&rejectMessage{Type: messageTypeReject, Reason: reason}); serr != nil {
+			log.Printf("failed to send reject message: %+v", serr)
+		}
+		return nil, nil, errors.Wrapf(err, "rejected (room: %s, client: %s, reason: %s)", msg.RoomID, msg.ClientID, reason)
+	}
+	if msg.Type != messageTypeRegister || msg.RoomID == "" || msg.ClientID == "" {
+		return reject(RejectReasonInvalidRegister, fmt.Errorf("invalid register message: %+v", msg))
+	}
+	if s.opts.authenticator != nil {
+		if err := s.opts.authenticator.Authenticate(&RegisterRequest{RoomID: msg.RoomID, ClientID: msg.ClientID, SignalingKey: msg.SignalingKey}); err != nil {
+			return reject(RejectReasonUnauthorized, err)
+		}
+	}
+	r, existing, reason := s.join(msg.RoomID, c)
+	if reason != "" {
+		return reject(reason, errors.New("failed to join room"))
+	}
+	accept := &acceptMessage{Type: messageTypeAccept, IsExistClient: existing, IsExistUser: existing}
+	if s.opts.iceServers != nil {
+		accept.IceServers = s.opts.iceServers.Servers(fmt.Sprintf("%s-%s", msg.RoomID, msg.ClientID), time.Now())
+	}
+	if err := c.send(accept); err != nil {
+		s.leave(r, c)
+		return nil, nil, errors.Wrap(err, "failed to send accept message")
+	}
+	return r, c, nil
+}
+
+// join adds the client to the room and reports whether another client is in the room, or returns the reason of reject.
+func (s *Server) join(roomID string, c *client) (*room, bool, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rooms[roomID]
+	if !ok {
+		r = &room{id: roomID}
+		s.rooms[roomID] = r
+	}
+	if len(r.clients) >= maxClientsPerRoom {
+		return nil, false, RejectReasonTooManyUsers
+	}
+	for _, other := range r.clients {
+		if other.id == c.id {
+			return nil, false, RejectReasonDuplicateClientID
+		}
+	}
+	r.clients = append(r.clients, c)
+	return r, len(r.clients) > 1, ""
+}
+
+// leave removes the client from the room and sends a bye message to the peer.
+func (s *Server) leave(r *room, c *client) {
+	s.mu.Lock()
+	var peer *client
+	clients := r.clients[:0]
+	for _, other := range r.clients {
+		if other == c {
+			continue
+		}
+		clients = append(clients, other)
+		peer = other
+	}
+	r.clients = clients
+	if len(r.clients) == 0 {
+		delete(s.rooms, r.id)
+	}
+	s.mu.Unlock()
+	if peer != nil {
+		if err := peer.send(&typeMessage{Type: messageTypeBye}); err != nil {
+			log.Printf("failed to send bye message (room: %s, client: %s): %+v", r.id, peer.id, err)
+		}
+	}
+	log.Printf("signaling client left (room: %s, client: %s)", r.id, c.id)
+}
+
+func (s *Server) peerOf(r *room, c *client) *client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range r.clients {
+		if other != c {
+			return other
+		}
+	}
+	return nil
+}
+
+// ping sends ping messages and closes the connection of the client which doesn't respond.
+func (s *Server) ping(c *client, pong <-chan struct{}, done <-chan struct{}) {
+	ticker := time.NewTicker(s.opts.pingInterval)
+	defer ticker.Stop()
+	lastPong := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case <-pong:
+			lastPong = time.Now()
+		case <-ticker.C:
+			if time.Since(lastPong) > pongTimeoutIntervals*s.opts.pingInterval {
+				log.Printf("signaling client timed out (client: %s)", c.id)
+				_ = c.conn.Close()
+				return
+			}
+			if err := c.send(&typeMessage{Type: messageTypePing}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// RoomCount returns the number of rooms having clients.
+func (s *Server) RoomCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.rooms)
+}
@@ -0,0 +1,150 @@
+package signaling
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+
+	"github.com/castaneai/mashimaro/pkg/iceserver"
+)
+
+func newTestServer(options ...ServerOption) (*Server, string, func()) {
+	s := NewServer(options...)
+	hs := httptest.NewServer(s.HTTPHandler())
+	return s, "ws" + strings.TrimPrefix(hs.URL, "http"), hs.Close
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	ws, err := websocket.Dial(url, "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+// receive returns the next message except ping.
+func receive(t *testing.T, ws *websocket.Conn) map[string]interface{} {
+	for {
+		assert.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+		var msg map[string]interface{}
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatalf("failed to receive message: %+v", err)
+		}
+		if msg["type"] != messageTypePing {
+			return msg
+		}
+	}
+}
+
+func register(t *testing.T, url, roomID, clientID, signalingKey string) (*websocket.Conn, map[string]interface{}) {
+	ws := dial(t, url)
+	assert.NoError(t, websocket.JSON.Send(ws, &registerMessage{
+		Type:         messageTypeRegister,
+		RoomID:       roomID,
+		ClientID:     clientID,
+		SignalingKey: signalingKey,
+	}))
+	return ws, receive(t, ws)
+}
+
+func TestSignaling(t *testing.T) {
+	s, url, closeServer := newTestServer(WithICEServers(iceserver.Config{
+		STUNURLs:   []string{"stun:stun.example.com:3478"},
+		TURNURLs:   []string{"turn:turn.example.com:3478"},
+		TURNSecret: "turn-secret",
+	}))
+	defer closeServer()
+
+	ws1, accept1 := register(t, url, "room1", "streamer", "")
+	defer ws1.Close()
+	assert.Equal(t, messageTypeAccept, accept1["type"])
+	assert.Equal(t, false, accept1["isExistClient"])
+	iceServers := accept1["iceServers"].([]interface{})
+	assert.Len(t, iceServers, 2)
+	assert.Contains(t, iceServers[1].(map[string]interface{})["username"], ":room1-streamer")
+
+	ws2, accept2 := register(t, url, "room1", "player", "")
+	defer ws2.Close()
+	assert.Equal(t, messageTypeAccept, accept2["type"])
+	assert.Equal(t, true, accept2["isExistClient"])
+	assert.Equal(t, 1, s.RoomCount())
+
+	// offer, answer and candidate messages are forwarded to the peer as they are
+	offer := map[string]interface{}{"type": "offer", "sdp": "v=0 offer"}
+	assert.NoError(t, websocket.JSON.Send(ws2, offer))
+	assert.Equal(t, offer, receive(t, ws1))
+	answer := map[string]interface{}{"type": "answer", "sdp": "v=0 answer"}
+	assert.NoError(t, websocket.JSON.Send(ws1, answer))
+	assert.Equal(t, answer, receive(t, ws2))
+	candidate := map[string]interface{}{"type": "candidate", "ice": map[string]interface{}{"candidate": "candidate:1 1 udp 1 127.0.0.1 5000 typ host", "sdpMid": "0"}}
+	assert.NoError(t, websocket.JSON.Send(ws1, candidate))
+	assert.Equal(t, candidate, receive(t, ws2))
+
+	// the room is full
+	ws3, reject := register(t, url, "room1", "intruder", "")
+	defer ws3.Close()
+	assert.Equal(t, messageTypeReject, reject["type"])
+	assert.Equal(t, RejectReasonTooManyUsers, reject["reason"])
+
+	// the peer receives bye when the player leaves
+	assert.NoError(t, ws2.Close())
+	assert.Equal(t, messageTypeBye, receive(t, ws1)["type"])
+	assert.NoError(t, ws1.Close())
+	assert.Eventually(t, func() bool { return s.RoomCount() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSignalingRejectsDuplicateClientID(t *testing.T) {
+	_, url, closeServer := newTestServer()
+	defer closeServer()
+
+	ws1, accept := register(t, url, "room1", "client", "")
+	defer ws1.Close()
+	assert.Equal(t, messageTypeAccept, accept["type"])
+	ws2, reject := register(t, url, "room1", "client", "")
+	defer ws2.Close()
+	assert.Equal(t, messageTypeReject, reject["type"])
+	assert.Equal(t, RejectReasonDuplicateClientID, reject["reason"])
+}
+
+func TestSignalingJoinToken(t *testing.T) {
+	_, url, closeServer := newTestServer(WithAuthenticator(NewJoinTokenAuthenticator("secret")))
+	defer closeServer()
+
+	ws1, reject := register(t, url, "room1", "player", "invalid")
+	defer ws1.Close()
+	assert.Equal(t, messageTypeReject, reject["type"])
+	assert.Equal(t, RejectReasonUnauthorized, reject["reason"])
+
+	// a token for another room
+	ws2, reject := register(t, url, "room1", "player", JoinToken("secret", "room2", time.Now().Add(time.Minute)))
+	defer ws2.Close()
+	assert.Equal(t, messageTypeReject, reject["type"])
+
+	ws3, accept := register(t, url, "room1", "player", JoinToken("secret", "room1", time.Now().Add(time.Minute)))
+	defer ws3.Close()
+	assert.Equal(t, messageTypeAccept, accept["type"])
+}
+
+func TestSignalingPing(t *testing.T) {
+	s, url, closeServer := newTestServer(WithPingInterval(50 * time.Millisecond))
+	defer closeServer()
+
+	ws, accept := register(t, url, "room1", "client", "")
+	defer ws.Close()
+	assert.Equal(t, messageTypeAccept, accept["type"])
+	// a client responding to ping stays connected
+	for i := 0; i < 5; i++ {
+		var msg typeMessage
+		assert.NoError(t, websocket.JSON.Receive(ws, &msg))
+		assert.Equal(t, messageTypePing, msg.Type)
+		assert.NoError(t, websocket.JSON.Send(ws, &typeMessage{Type: messageTypePong}))
+	}
+	assert.Equal(t, 1, s.RoomCount())
+
+	// and the one which doesn't respond is disconnected
+	assert.Eventually(t, func() bool { return s.RoomCount() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
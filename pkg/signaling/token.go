@@ -0,0 +1,72 @@
+package signaling
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidJoinToken = errors.New("invalid join token")
+
+// JoinToken generates a token to join the room until the expiry, which is sent as the signaling key of the register message.
+// The token is "<expiry unix time>:<base64url(HMAC-SHA256(secret, "<expiry unix time>:<room ID>"))>".
+func JoinToken(secret, roomID string, expiresAt time.Time) string {
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	return fmt.Sprintf("%s:%s", expiry, joinTokenMAC(secret, expiry, roomID))
+}
+
+// VerifyJoinToken returns ErrInvalidJoinToken unless the token is generated by JoinToken for the room and not expired at now.
+func VerifyJoinToken(secret, roomID, token string, now time.Time) error {
+	parts := strings.SplitN(token, ":", 2)
+	if len(parts) != 2 {
+		return ErrInvalidJoinToken
+	}
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return ErrInvalidJoinToken
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(joinTokenMAC(secret, parts[0], roomID))) {
+		return ErrInvalidJoinToken
+	}
+	if now.Unix() > expiry {
+		return errors.Wrap(ErrInvalidJoinToken, "expired")
+	}
+	return nil
+}
+
+func joinTokenMAC(secret, expiry, roomID string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%s:%s", expiry, roomID)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// RegisterRequest is the register message of a client joining a room.
+type RegisterRequest struct {
+	RoomID       string
+	ClientID     string
+	SignalingKey string
+}
+
+// Authenticator decides whether the client can join the room.
+type Authenticator interface {
+	Authenticate(req *RegisterRequest) error
+}
+
+type AuthenticatorFunc func(req *RegisterRequest) error
+
+func (f AuthenticatorFunc) Authenticate(req *RegisterRequest) error {
+	return f(req)
+}
+
+// NewJoinTokenAuthenticator authenticates clients with the signaling key generated by JoinToken with the secret.
+func NewJoinTokenAuthenticator(secret string) Authenticator {
+	return AuthenticatorFunc(func(req *RegisterRequest) error {
+		return VerifyJoinToken(secret, req.RoomID, req.SignalingKey, time.Now())
+	})
+}
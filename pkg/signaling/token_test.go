@@ -0,0 +1,22 @@
+package signaling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinToken(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	token := JoinToken("secret", "room1", now.Add(time.Hour))
+	assert.Regexp(t, `^1600003600:[A-Za-z0-9_-]+$`, token)
+
+	assert.NoError(t, VerifyJoinToken("secret", "room1", token, now))
+	assert.True(t, errors.Is(VerifyJoinToken("secret", "room2", token, now), ErrInvalidJoinToken))
+	assert.True(t, errors.Is(VerifyJoinToken("other", "room1", token, now), ErrInvalidJoinToken))
+	assert.True(t, errors.Is(VerifyJoinToken("secret", "room1", token, now.Add(2*time.Hour)), ErrInvalidJoinToken))
+	assert.True(t, errors.Is(VerifyJoinToken("secret", "room1", "", now), ErrInvalidJoinToken))
+	assert.True(t, errors.Is(VerifyJoinToken("secret", "room1", "1700000000:"+token[len("1600003600:"):], now), ErrInvalidJoinToken))
+}
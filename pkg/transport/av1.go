@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"github.com/pkg/errors"
+)
+
+// the RTP payload type of AV1, which is not registered by default in the pion version we use
+const av1PayloadType = 45
+
+const (
+	av1OBUTypeSequenceHeader     = 1
+	av1OBUTypeTemporalDelimiter  = 2
+	av1OBUTypeTileList           = 8
+	av1OBUTypePadding            = 15
+	av1OBUHeaderExtensionFlag    = 0x04
+	av1OBUHeaderHasSizeFieldFlag = 0x02
+
+	// bits of the aggregation header
+	av1AggregationZ = 0x80 // the first element continues the OBU of the previous packet
+	av1AggregationY = 0x40 // the last element continues in the next packet
+	av1AggregationN = 0x08 // the first packet of a coded video sequence
+)
+
+// av1Payloader packetizes a temporal unit of AV1 (the OBUs with obu_size, as av1enc outputs)
+// following the RTP payload format for AV1 (https://aomediacodec.github.io/av1-rtp-spec/).
+// Each OBU element has its length field (W = 0), and obu_size is removed as recommended.
+// The pion version we use has no payloader for AV1.
+type av1Payloader struct{}
+
+func (p *av1Payloader) Payload(mtu int, payload []byte) [][]byte {
+	// the aggregation header and the shortest element
+	if mtu < 3 {
+		return nil
+	}
+	obus, err := splitAV1OBUs(payload)
+	if err != nil {
+		return nil
+	}
+	var payloads [][]byte
+	newSequence := false
+	packet := []byte{0}
+	for _, obu := range obus {
+		if av1OBUType(obu) == av1OBUTypeSequenceHeader {
+			newSequence = true
+		}
+		for len(obu) > 0 {
+			space := mtu - len(packet)
+			size := len(obu)
+			if leb128Size(size)+size > space {
+				// the length field of the fragment is not longer than the one of the space
+				size = space - leb128Size(space)
+			}
+			if size <= 0 {
+				payloads = append(payloads, packet)
+				packet = []byte{0}
+				continue
+			}
+			packet = appendLEB128(packet, size)
+			packet = append(packet, obu[:size]...)
+			obu = obu[size:]
+			if len(obu) > 0 {
+				packet[0] |= av1AggregationY
+				payloads = append(payloads, packet)
+				packet = []byte{av1AggregationZ}
+			}
+		}
+	}
+	if len(packet) > 1 {
+		payloads = append(payloads, packet)
+	}
+	if newSequence && len(payloads) > 0 {
+		payloads[0][0] |= av1AggregationN
+	}
+	return payloads
+}
+
+// splitAV1OBUs returns the OBUs of the temporal unit to send, whose obu_size is removed.
+// Temporal delimiters, tile lists and padding are dropped as they must not be sent.
+func splitAV1OBUs(tu []byte) ([][]byte, error) {
+	var obus [][]byte
+	for len(tu) > 0 {
+		header := tu[0]
+		headerSize := 1
+		if header&av1OBUHeaderExtensionFlag != 0 {
+			headerSize = 2
+		}
+		if len(tu) < headerSize {
+			return nil, errors.New("truncated OBU header")
+		}
+		// an OBU without obu_size lasts until the end
+		body := tu[headerSize:]
+		var rest []byte
+		if header&av1OBUHeaderHasSizeFieldFlag != 0 {
+			size, n, err := readLEB128(tu[headerSize:])
+			if err != nil {
+				return nil, err
+			}
+			if uint64(len(tu)-headerSize-n) < size {
+				return nil, errors.New("truncated OBU")
+			}
+			body = tu[headerSize+n : headerSize+n+int(size)]
+			rest = tu[headerSize+n+int(size):]
+		}
+		switch av1OBUType(tu) {
+		case av1OBUTypeTemporalDelimiter, av1OBUTypeTileList, av1OBUTypePadding:
+		default:
+			obu := make([]byte, 0, headerSize+len(body))
+			obu = append(obu, header&^av1OBUHeaderHasSizeFieldFlag)
+			obu = append(obu, tu[1:headerSize]...)
+			obus = append(obus, append(obu, body...))
+		}
+		tu = rest
+	}
+	return obus, nil
+}
+
+func av1OBUType(obu []byte) byte {
+	return (obu[0] >> 3) & 0x0f
+}
+
+func readLEB128(b []byte) (uint64, int, error) {
+	var v uint64
+	for i := 0; i < 8 && i < len(b); i++ {
+		v |= uint64(b[i]&0x7f) << (7 * i)
+		if b[i]&0x80 == 0 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("invalid leb128")
+}
+
+func appendLEB128(b []byte, v int) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v&0x7f)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func leb128Size(v int) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// depacketizeAV1 returns the OBUs of the packets by joining the fragments.
+func depacketizeAV1(t *testing.T, packets [][]byte) [][]byte {
+	var obus [][]byte
+	var fragment []byte
+	for i, packet := range packets {
+		assert.Equal(t, i > 0, packet[0]&av1AggregationZ != 0, "Z of packet %d", i)
+		assert.Equal(t, i < len(packets)-1, packet[0]&av1AggregationY != 0, "Y of packet %d", i)
+		elements := packet[1:]
+		for len(elements) > 0 {
+			size, n, err := readLEB128(elements)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fragment = append(fragment, elements[n:n+int(size)]...)
+			elements = elements[n+int(size):]
+			// the last element of a packet with Y continues in the next packet
+			if len(elements) > 0 || packet[0]&av1AggregationY == 0 {
+				obus = append(obus, fragment)
+				fragment = nil
+			}
+		}
+	}
+	return obus
+}
+
+func TestAV1Payloader(t *testing.T) {
+	p := &av1Payloader{}
+	temporalDelimiter := []byte{0x12, 0x00}
+	sequenceHeader := []byte{0x0a, 0x03, 0x01, 0x02, 0x03}
+	frame := []byte{0x32, 0x05, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e}
+	tu := bytes.Join([][]byte{temporalDelimiter, sequenceHeader, frame}, nil)
+
+	// obu_size is removed, and the temporal delimiter is not sent
+	payloads := p.Payload(1200, tu)
+	assert.Equal(t, [][]byte{{
+		av1AggregationN,
+		0x04, 0x08, 0x01, 0x02, 0x03,
+		0x06, 0x30, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e,
+	}}, payloads)
+
+	// a large OBU is fragmented
+	largeFrame := append([]byte{0x32, 0xac, 0x02}, bytes.Repeat([]byte{0xff}, 300)...)
+	payloads = p.Payload(100, bytes.Join([][]byte{temporalDelimiter, largeFrame}, nil))
+	assert.Len(t, payloads, 4)
+	for _, payload := range payloads {
+		assert.True(t, len(payload) <= 100)
+		assert.Equal(t, byte(0), payload[0]&av1AggregationN, "no sequence header")
+	}
+	assert.Equal(t, [][]byte{append([]byte{0x30}, bytes.Repeat([]byte{0xff}, 300)...)}, depacketizeAV1(t, payloads))
+
+	// the extension header is kept, and the last OBU may have no obu_size
+	payloads = p.Payload(1200, []byte{0x36, 0x20, 0x02, 0x0a, 0x0b, 0x30, 0x0c})
+	assert.Equal(t, [][]byte{{0x34, 0x20, 0x0a, 0x0b}, {0x30, 0x0c}}, depacketizeAV1(t, payloads))
+
+	assert.Nil(t, p.Payload(1200, []byte{0x32, 0x05, 0x0a}), "truncated OBU")
+}
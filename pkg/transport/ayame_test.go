@@ -3,10 +3,13 @@ package transport
 import (
 	"context"
 	"fmt"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/castaneai/mashimaro/pkg/ayame"
+	"github.com/castaneai/mashimaro/pkg/signaling"
 
 	"github.com/pion/webrtc/v3"
 	"github.com/stretchr/testify/assert"
@@ -15,7 +18,10 @@ import (
 func TestSignaling(t *testing.T) {
 	ayameURL := os.Getenv("AYAME_URL")
 	if ayameURL == "" {
-		t.Skip("Set AYAME_URL to run this test")
+		// the self-hosted signaling server compatible with Ayame
+		hs := httptest.NewServer(signaling.NewServer().HTTPHandler())
+		defer hs.Close()
+		ayameURL = "ws" + strings.TrimPrefix(hs.URL, "http")
 	}
 
 	conn1, err := NewWebRTCStreamerConn(webrtc.Configuration{})
@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+)
+
+const (
+	initialBandwidthEstimate = 2 * 1000 * 1000
+	minBandwidthEstimate     = 100 * 1000
+	maxBandwidthEstimate     = 20 * 1000 * 1000
+)
+
+// BandwidthEstimate is the available bandwidth to the remote peer estimated from its RTCP feedback.
+type BandwidthEstimate struct {
+	// Bitrate is the estimated available bitrate in bits per second.
+	Bitrate int
+	// PacketLoss is the latest fraction of lost packets (0.0 - 1.0) reported by the remote peer.
+	PacketLoss float64
+}
+
+// bandwidthEstimator is a pion interceptor that estimates the available bandwidth from RTCP feedback.
+// TWCC feedback is not available in the pion version we use,
+// so it applies the loss-based controller of Google Congestion Control
+// (https://tools.ietf.org/html/draft-ietf-rmcat-gcc-02#section-6) to receiver reports
+// and caps the estimate by REMB of the remote peer (sent by Chrome).
+// Only the report blocks of video streams are used, as the audio is too sparse to tell the congestion.
+type bandwidthEstimator struct {
+	interceptor.NoOp
+	videoSSRCs map[uint32]struct{}
+	lossBased  float64
+	remb       float64
+	packetLoss float64
+	onEstimate func(estimate BandwidthEstimate)
+	mu         sync.Mutex
+}
+
+func newBandwidthEstimator() *bandwidthEstimator {
+	return &bandwidthEstimator{
+		videoSSRCs: make(map[uint32]struct{}),
+		lossBased:  initialBandwidthEstimate,
+	}
+}
+
+func (e *bandwidthEstimator) OnEstimate(f func(estimate BandwidthEstimate)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onEstimate = f
+}
+
+func (e *bandwidthEstimator) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	if strings.HasPrefix(strings.ToLower(info.MimeType), "video/") {
+		e.mu.Lock()
+		e.videoSSRCs[info.SSRC] = struct{}{}
+		e.mu.Unlock()
+	}
+	return writer
+}
+
+func (e *bandwidthEstimator) UnbindLocalStream(info *interceptor.StreamInfo) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.videoSSRCs, info.SSRC)
+}
+
+func (e *bandwidthEstimator) BindRTCPReader(reader interceptor.RTCPReader) interceptor.RTCPReader {
+	return interceptor.RTCPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		n, attr, err := reader.Read(b, a)
+		if err != nil {
+			return 0, nil, err
+		}
+		packets, err := rtcp.Unmarshal(b[:n])
+		if err != nil {
+			// leave broken packets to the following readers
+			return n, attr, nil
+		}
+		e.handleRTCP(packets)
+		return n, attr, nil
+	})
+}
+
+func (e *bandwidthEstimator) handleRTCP(packets []rtcp.Packet) {
+	e.mu.Lock()
+	updated := false
+	for _, packet := range packets {
+		switch p := packet.(type) {
+		case *rtcp.ReceiverEstimatedMaximumBitrate:
+			e.remb = float64(p.Bitrate)
+			updated = true
+		case *rtcp.ReceiverReport:
+			// a report has a block for each stream (e.g. video and video-low),
+			// so it updates the estimate once by the worst of them
+			fractionLost, ok := e.videoFractionLostLocked(p)
+			if ok {
+				e.updateLossBased(float64(fractionLost) / 256.0)
+				updated = true
+			}
+		}
+	}
+	if !updated {
+		e.mu.Unlock()
+		return
+	}
+	estimate := e.estimateLocked()
+	h := e.onEstimate
+	e.mu.Unlock()
+	if h != nil {
+		h(estimate)
+	}
+}
+
+func (e *bandwidthEstimator) videoFractionLostLocked(rr *rtcp.ReceiverReport) (uint8, bool) {
+	var fractionLost uint8
+	found := false
+	for _, report := range rr.Reports {
+		if _, ok := e.videoSSRCs[report.SSRC]; !ok {
+			continue
+		}
+		if !found || report.FractionLost > fractionLost {
+			fractionLost = report.FractionLost
+		}
+		found = true
+	}
+	return fractionLost, found
+}
+
+func (e *bandwidthEstimator) updateLossBased(packetLoss float64) {
+	e.packetLoss = packetLoss
+	switch {
+	case packetLoss > 0.1:
+		e.lossBased *= 1 - 0.5*packetLoss
+	case packetLoss < 0.02:
+		e.lossBased *= 1.05
+	}
+	// prevent the loss-based estimate from growing unbounded while the link is not congested
+	if e.remb > 0 && e.lossBased > e.remb {
+		e.lossBased = e.remb
+	}
+	e.lossBased = clampFloat(e.lossBased, minBandwidthEstimate, maxBandwidthEstimate)
+}
+
+func (e *bandwidthEstimator) estimateLocked() BandwidthEstimate {
+	bitrate := e.lossBased
+	if e.remb > 0 && e.remb < bitrate {
+		bitrate = e.remb
+	}
+	return BandwidthEstimate{
+		Bitrate:    int(clampFloat(bitrate, minBandwidthEstimate, maxBandwidthEstimate)),
+		PacketLoss: e.packetLoss,
+	}
+}
+
+func clampFloat(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,101 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testVideoSSRC    = 1
+	testVideoLowSSRC = 2
+	testAudioSSRC    = 3
+)
+
+func receiverReport(fractionLost uint8) *rtcp.ReceiverReport {
+	return &rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{{SSRC: testVideoSSRC, FractionLost: fractionLost}}}
+}
+
+func newTestBandwidthEstimator() *bandwidthEstimator {
+	bwe := newBandwidthEstimator()
+	bwe.BindLocalStream(&interceptor.StreamInfo{SSRC: testVideoSSRC, MimeType: "video/VP8"}, nil)
+	bwe.BindLocalStream(&interceptor.StreamInfo{SSRC: testVideoLowSSRC, MimeType: "video/VP8"}, nil)
+	bwe.BindLocalStream(&interceptor.StreamInfo{SSRC: testAudioSSRC, MimeType: "audio/opus"}, nil)
+	return bwe
+}
+
+func TestBandwidthEstimator(t *testing.T) {
+	bwe := newTestBandwidthEstimator()
+	var estimates []BandwidthEstimate
+	bwe.OnEstimate(func(estimate BandwidthEstimate) {
+		estimates = append(estimates, estimate)
+	})
+
+	// no loss: increase
+	bwe.handleRTCP([]rtcp.Packet{receiverReport(0)})
+	assert.Len(t, estimates, 1)
+	assert.True(t, estimates[0].Bitrate > initialBandwidthEstimate)
+
+	// 2% - 10% loss: keep
+	bwe.handleRTCP([]rtcp.Packet{receiverReport(13)})
+	assert.Len(t, estimates, 2)
+	assert.Equal(t, estimates[0].Bitrate, estimates[1].Bitrate)
+
+	// heavy loss: decrease
+	bwe.handleRTCP([]rtcp.Packet{receiverReport(128)})
+	assert.Len(t, estimates, 3)
+	assert.True(t, estimates[2].Bitrate < estimates[1].Bitrate)
+	assert.InDelta(t, 0.5, estimates[2].PacketLoss, 0.01)
+
+	// REMB caps the estimate
+	bwe.handleRTCP([]rtcp.Packet{&rtcp.ReceiverEstimatedMaximumBitrate{Bitrate: 500 * 1000}})
+	assert.Len(t, estimates, 4)
+	assert.Equal(t, 500*1000, estimates[3].Bitrate)
+
+	// never below the minimum
+	for i := 0; i < 100; i++ {
+		bwe.handleRTCP([]rtcp.Packet{receiverReport(255)})
+	}
+	assert.Equal(t, minBandwidthEstimate, estimates[len(estimates)-1].Bitrate)
+
+	// packets unrelated to bandwidth do not update the estimate
+	n := len(estimates)
+	bwe.handleRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{}})
+	assert.Len(t, estimates, n)
+}
+
+func TestBandwidthEstimatorReportBlocks(t *testing.T) {
+	bwe := newTestBandwidthEstimator()
+	var estimates []BandwidthEstimate
+	bwe.OnEstimate(func(estimate BandwidthEstimate) {
+		estimates = append(estimates, estimate)
+	})
+
+	// audio only: no update
+	bwe.handleRTCP([]rtcp.Packet{&rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{{SSRC: testAudioSSRC, FractionLost: 0}}}})
+	assert.Len(t, estimates, 0)
+
+	// a report of all the streams increases the estimate once
+	bwe.handleRTCP([]rtcp.Packet{&rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{
+		{SSRC: testVideoSSRC, FractionLost: 0},
+		{SSRC: testVideoLowSSRC, FractionLost: 0},
+		{SSRC: testAudioSSRC, FractionLost: 0},
+	}}})
+	assert.Len(t, estimates, 1)
+	assert.Equal(t, int(initialBandwidthEstimate*1.05), estimates[0].Bitrate)
+
+	// the worst of the video streams is used
+	bwe.handleRTCP([]rtcp.Packet{&rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{
+		{SSRC: testVideoSSRC, FractionLost: 0},
+		{SSRC: testVideoLowSSRC, FractionLost: 128},
+	}}})
+	assert.Len(t, estimates, 2)
+	assert.InDelta(t, 0.5, estimates[1].PacketLoss, 0.01)
+
+	// unbound streams are ignored
+	bwe.UnbindLocalStream(&interceptor.StreamInfo{SSRC: testVideoLowSSRC})
+	bwe.handleRTCP([]rtcp.Packet{&rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{{SSRC: testVideoLowSSRC, FractionLost: 0}}}})
+	assert.Len(t, estimates, 2)
+}
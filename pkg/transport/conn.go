@@ -9,19 +9,28 @@ type Conn interface {
 	ConnectionID() string
 	SendMessage(ctx context.Context, data []byte) error
 	OnMessage(f func(data []byte))
+	DataChannel(purpose DataChannelPurpose) (DataChannel, bool)
 	OnConnect(f func())
 	OnDisconnect(f func())
 }
 
 type StreamerConn interface {
 	Conn
-	SendVideoSample(ctx context.Context, sample MediaSample) error
-	SendAudioSample(ctx context.Context, sample MediaSample) error
+	SendTracks() []SendTrack
+	SendTrack(id string) (SendTrack, bool)
+	OnRecvTrack(f func(track RecvTrack))
+	OnKeyframeRequest(f func(trackID string))
+	OnBandwidthEstimate(f func(estimate BandwidthEstimate))
+	Stats() (ConnStats, bool)
+	SubscribeStats(ctx context.Context) <-chan ConnStats
 }
 
 type MediaSample struct {
 	Data     []byte
 	Duration time.Duration
+	// PTS is the presentation timestamp on the clock shared by video and audio.
+	// Zero means unknown, and the timestamp follows the previous sample.
+	PTS time.Duration
 }
 
 type PlayerConn interface {
@@ -27,9 +27,19 @@ func NewWebRTCConnector(signaler WebRTCSignaler, roomID, clientID string) *WebRT
 }
 
 func (l *WebRTCConnector) Connect(ctx context.Context, conn StreamerConn) error {
-	wconn, ok := conn.(interface{ PeerConnection() *webrtc.PeerConnection })
+	wconn, ok := conn.(interface {
+		PeerConnection() *webrtc.PeerConnection
+		SetRenegotiator(r Renegotiator)
+	})
 	if !ok {
 		return errors.New("failed to cast to WebRTCConn")
 	}
-	return l.signaler.Signaling(ctx, wconn.PeerConnection(), l.roomID, l.clientID)
+	r, err := l.signaler.Signaling(ctx, wconn.PeerConnection(), l.roomID, l.clientID)
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		wconn.SetRenegotiator(r)
+	}
+	return nil
 }
@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pkg/errors"
+)
+
+// DataChannelPurpose is the purpose of a data channel, which is also the label of it.
+type DataChannelPurpose string
+
+const (
+	// DataChannelControl is reliable and ordered for keys, buttons and control messages (e.g. exitGame).
+	// SendMessage and OnMessage of Conn use it.
+	// The label is "data" for players which open the control channel only.
+	DataChannelControl DataChannelPurpose = "data"
+	// DataChannelPointer is unordered without retransmission for pointer motion, where only the latest position matters.
+	// A lost packet doesn't block the following ones and the other channels.
+	DataChannelPointer DataChannelPurpose = "pointer"
+	// DataChannelBulk is reliable and ordered for large transfers (e.g. files, clipboard and screenshots),
+	// which don't block the control channel.
+	DataChannelBulk DataChannelPurpose = "bulk"
+)
+
+var (
+	dataChannelPurposes = []DataChannelPurpose{DataChannelControl, DataChannelPointer, DataChannelBulk}
+
+	ErrDataChannelNotOpen = errors.New("data channel not open")
+)
+
+func dataChannelInit(purpose DataChannelPurpose) *webrtc.DataChannelInit {
+	switch purpose {
+	case DataChannelPointer:
+		ordered := false
+		var maxRetransmits uint16
+		return &webrtc.DataChannelInit{Ordered: &ordered, MaxRetransmits: &maxRetransmits}
+	default:
+		return nil
+	}
+}
+
+// DataChannel is a data channel of Conn for the purpose.
+// A handler of messages can be set before the channel opens.
+type DataChannel interface {
+	Purpose() DataChannelPurpose
+	// Send returns ErrDataChannelNotOpen if the channel is not open (e.g. the remote peer doesn't open it).
+	Send(ctx context.Context, data []byte) error
+	OnMessage(f func(data []byte))
+}
+
+type webRTCDataChannel struct {
+	purpose   DataChannelPurpose
+	dc        *webrtc.DataChannel
+	onMessage func([]byte)
+	mu        sync.Mutex
+}
+
+func newWebRTCDataChannel(purpose DataChannelPurpose) *webRTCDataChannel {
+	return &webRTCDataChannel{purpose: purpose}
+}
+
+func (c *webRTCDataChannel) attach(dc *webrtc.DataChannel) {
+	c.mu.Lock()
+	c.dc = dc
+	c.mu.Unlock()
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		c.mu.Lock()
+		h := c.onMessage
+		c.mu.Unlock()
+		if h != nil {
+			h(msg.Data)
+		}
+	})
+}
+
+func (c *webRTCDataChannel) Purpose() DataChannelPurpose {
+	return c.purpose
+}
+
+func (c *webRTCDataChannel) Send(ctx context.Context, data []byte) error {
+	c.mu.Lock()
+	dc := c.dc
+	c.mu.Unlock()
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return ErrDataChannelNotOpen
+	}
+	return dc.Send(data)
+}
+
+func (c *webRTCDataChannel) OnMessage(f func(data []byte)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onMessage = f
+}
@@ -0,0 +1,114 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func mustDataChannel(t *testing.T, conn Conn, purpose DataChannelPurpose) DataChannel {
+	ch, ok := conn.DataChannel(purpose)
+	if !ok {
+		t.Fatalf("data channel not found: %s", purpose)
+	}
+	return ch
+}
+
+// sendUntilOpen retries sending until the channel opens, since the connection is ready when the control channel opens.
+func sendUntilOpen(t *testing.T, ch DataChannel, data []byte) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := ch.Send(context.Background(), data)
+		if err == nil {
+			return
+		}
+		if err != ErrDataChannelNotOpen || time.Now().After(deadline) {
+			t.Fatalf("failed to send on %s: %+v", ch.Purpose(), err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDataChannels(t *testing.T) {
+	tcs := []struct {
+		name          string
+		isPlayerOffer bool
+	}{
+		{name: "OfferByPlayer", isPlayerOffer: true},
+		{name: "OfferByStreamer", isPlayerOffer: false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			streamer, player := signalStreamerPlayer(t, webrtc.Configuration{}, tc.isPlayerOffer)
+			defer streamer.PeerConnection().Close()
+			defer player.PeerConnection().Close()
+
+			received := make(map[DataChannelPurpose]chan []byte)
+			for _, purpose := range dataChannelPurposes {
+				ch := make(chan []byte, 1)
+				received[purpose] = ch
+				mustDataChannel(t, streamer, purpose).OnMessage(func(data []byte) { ch <- data })
+			}
+			for _, purpose := range dataChannelPurposes {
+				sendUntilOpen(t, mustDataChannel(t, player, purpose), []byte(purpose))
+				select {
+				case data := <-received[purpose]:
+					assert.Equal(t, []byte(purpose), data)
+				case <-time.After(5 * time.Second):
+					t.Fatalf("timed out waiting for a message on %s", purpose)
+				}
+			}
+			// messages on the control channel are not delivered to the other channels
+			assert.NoError(t, player.SendMessage(context.Background(), []byte("control")))
+			assert.Equal(t, []byte("control"), <-received[DataChannelControl])
+			assert.Empty(t, received[DataChannelPointer])
+			assert.Empty(t, received[DataChannelBulk])
+
+			for _, conn := range []*WebRTCConn{streamer.WebRTCConn, player.WebRTCConn} {
+				pointer := conn.channels[DataChannelPointer].dc
+				assert.False(t, pointer.Ordered())
+				if assert.NotNil(t, pointer.MaxRetransmits()) {
+					assert.Equal(t, uint16(0), *pointer.MaxRetransmits())
+				}
+				assert.True(t, conn.channels[DataChannelBulk].dc.Ordered())
+			}
+		})
+	}
+	_, ok := newStreamerConn(t, webrtc.Configuration{}).DataChannel("unknown")
+	assert.False(t, ok)
+}
+
+func TestControlChannelOnly(t *testing.T) {
+	// a player which opens the control channel only
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	dc, err := pc.CreateDataChannel(string(DataChannelControl), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playerReceived := make(chan []byte, 1)
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) { playerReceived <- msg.Data })
+
+	streamer := newStreamerConn(t, webrtc.Configuration{})
+	defer streamer.PeerConnection().Close()
+	streamerConnected := make(chan struct{})
+	streamer.OnConnect(func() { close(streamerConnected) })
+	if err := signalPair(pc, streamer.PeerConnection()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-streamerConnected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for connection")
+	}
+
+	assert.NoError(t, streamer.SendMessage(context.Background(), []byte("hello")))
+	assert.Equal(t, []byte("hello"), <-playerReceived)
+	assert.Equal(t, ErrDataChannelNotOpen, mustDataChannel(t, streamer, DataChannelBulk).Send(context.Background(), []byte("bulk")))
+}
@@ -0,0 +1,33 @@
+package transport
+
+import (
+	"github.com/pion/webrtc/v3"
+)
+
+// Factory creates a StreamerConn for the room with the Connector connecting it to the player.
+// Handlers of the conn are set before connecting, so that no callback is missed.
+type Factory interface {
+	NewStreamerConn(roomID string, options ...StreamerOption) (StreamerConn, Connector, error)
+}
+
+// WebRTCFactory creates WebRTCStreamerConn connected by the signaler.
+type WebRTCFactory struct {
+	signaler      WebRTCSignaler
+	configuration func(roomID string) webrtc.Configuration
+}
+
+// NewWebRTCFactory returns a Factory of WebRTC, whose peer connections are configured per room (e.g. for TURN credentials).
+func NewWebRTCFactory(signaler WebRTCSignaler, configuration func(roomID string) webrtc.Configuration) *WebRTCFactory {
+	return &WebRTCFactory{
+		signaler:      signaler,
+		configuration: configuration,
+	}
+}
+
+func (f *WebRTCFactory) NewStreamerConn(roomID string, options ...StreamerOption) (StreamerConn, Connector, error) {
+	conn, err := NewWebRTCStreamerConn(f.configuration(roomID), options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, NewWebRTCConnector(f.signaler, roomID, "streamer"), nil
+}
@@ -1,17 +1,182 @@
 package transport
 
-import "github.com/pion/webrtc/v3"
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
-func newVideoTrack() (*webrtc.TrackLocalStaticSample, error) {
-	return webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{
-		MimeType:  webrtc.MimeTypeH264,
-		ClockRate: 90000, // why?
-	}, "video", "mashimaro")
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pkg/errors"
+)
+
+// streamID is the media stream of all tracks, so that the remote peer plays them in sync.
+const streamID = "mashimaro"
+
+type VideoCodec string
+
+const (
+	VideoCodecH264 VideoCodec = "H264"
+	VideoCodecVP8  VideoCodec = "VP8"
+	VideoCodecVP9  VideoCodec = "VP9"
+	VideoCodecAV1  VideoCodec = "AV1"
+)
+
+// supportedVideoCodecs are the video codecs we can send in order of our preference.
+var supportedVideoCodecs = []VideoCodec{VideoCodecH264, VideoCodecVP8, VideoCodecVP9, VideoCodecAV1}
+
+func ParseVideoCodec(s string) (VideoCodec, error) {
+	for _, codec := range []VideoCodec{VideoCodecH264, VideoCodecVP8, VideoCodecVP9, VideoCodecAV1} {
+		if strings.EqualFold(s, string(codec)) {
+			return codec, nil
+		}
+	}
+	return "", fmt.Errorf("unknown video codec: %s", s)
+}
+
+func (c VideoCodec) mimeType() string {
+	return "video/" + string(c)
+}
+
+func containsVideoCodec(codecs []VideoCodec, codec VideoCodec) bool {
+	for _, c := range codecs {
+		if c == codec {
+			return true
+		}
+	}
+	return false
+}
+
+// selectVideoCodec selects the video codec to send from the negotiated codecs.
+// The negotiated codecs are in order of the remote peer's preference,
+// and the preferred codecs (if any) take priority over it.
+// Codecs not in sendable are never selected, even if the remote peer prefers them.
+func selectVideoCodec(preferred, sendable []VideoCodec, negotiated []webrtc.RTPCodecParameters) (VideoCodec, error) {
+	isNegotiated := func(codec VideoCodec) bool {
+		for _, params := range negotiated {
+			if strings.EqualFold(params.MimeType, codec.mimeType()) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, codec := range preferred {
+		if containsVideoCodec(sendable, codec) && isNegotiated(codec) {
+			return codec, nil
+		}
+	}
+	if len(preferred) > 0 {
+		return "", fmt.Errorf("none of preferred video codecs %v is negotiated", preferred)
+	}
+	for _, params := range negotiated {
+		for _, codec := range sendable {
+			if strings.EqualFold(params.MimeType, codec.mimeType()) {
+				return codec, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("none of sendable video codecs %v is negotiated", sendable)
+}
+
+// videoTrack is a video track sending samples in the codec selected when it is bound to a negotiated transceiver.
+type videoTrack struct {
+	id              string
+	preferredCodecs []VideoCodec
+	sendableCodecs  []VideoCodec
+	track           *sampleTrack
+	codec           VideoCodec
+	mu              sync.RWMutex
+}
+
+func newVideoTrack(id string, preferredCodecs, sendableCodecs []VideoCodec) *videoTrack {
+	return &videoTrack{id: id, preferredCodecs: preferredCodecs, sendableCodecs: sendableCodecs}
+}
+
+func (t *videoTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	codec, err := selectVideoCodec(t.preferredCodecs, t.sendableCodecs, ctx.CodecParameters())
+	if err != nil {
+		return webrtc.RTPCodecParameters{}, err
+	}
+	track, err := newSampleTrack(webrtc.RTPCodecCapability{
+		MimeType:  codec.mimeType(),
+		ClockRate: 90000,
+	}, t.ID(), t.StreamID())
+	if err != nil {
+		return webrtc.RTPCodecParameters{}, err
+	}
+	params, err := track.Bind(ctx)
+	if err != nil {
+		return webrtc.RTPCodecParameters{}, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.track = track
+	t.codec = codec
+	return params, nil
+}
+
+func (t *videoTrack) Unbind(ctx webrtc.TrackLocalContext) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.track == nil {
+		return nil
+	}
+	return t.track.Unbind(ctx)
+}
+
+func (t *videoTrack) ID() string {
+	return t.id
+}
+
+func (t *videoTrack) StreamID() string {
+	return streamID
+}
+
+func (t *videoTrack) Kind() webrtc.RTPCodecType {
+	return webrtc.RTPCodecTypeVideo
+}
+
+// Codec returns the codec selected by negotiation.
+func (t *videoTrack) Codec() (VideoCodec, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.track == nil {
+		return "", errors.New("video codec is not negotiated yet")
+	}
+	return t.codec, nil
+}
+
+func (t *videoTrack) mimeType() (string, error) {
+	codec, err := t.Codec()
+	if err != nil {
+		return "", err
+	}
+	return codec.mimeType(), nil
+}
+
+func (t *videoTrack) WriteSample(sample MediaSample) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.track == nil {
+		// samples are dropped until negotiated
+		return nil
+	}
+	return t.track.WriteSample(sample)
+}
+
+func (t *videoTrack) senderReport(clock *mediaClock, now time.Time) (rtcp.SenderReport, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.track == nil {
+		return rtcp.SenderReport{}, false
+	}
+	return t.track.senderReport(clock, now)
 }
 
-func newAudioTrack() (*webrtc.TrackLocalStaticSample, error) {
-	return webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{
+func newAudioTrack(id string) (*sampleTrack, error) {
+	return newSampleTrack(webrtc.RTPCodecCapability{
 		MimeType:  webrtc.MimeTypeOpus,
-		ClockRate: 48000, // why?
-	}, "audio", "mashimaro")
+		ClockRate: 48000,
+	}, id, streamID)
 }
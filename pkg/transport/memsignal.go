@@ -0,0 +1,111 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// InMemorySignaler pairs the peer connections joining the same room in the process, which is for tests without a signaling server.
+// As with Ayame, the peer joining later sends the offer to the one waiting in the room.
+type InMemorySignaler struct {
+	rooms map[string][]*webrtc.PeerConnection
+	mu    sync.Mutex
+}
+
+func NewInMemorySignaler() *InMemorySignaler {
+	return &InMemorySignaler{
+		rooms: make(map[string][]*webrtc.PeerConnection),
+	}
+}
+
+// Signaling joins the room, and negotiates with the peer if it is already in the room.
+// The returned Renegotiator offers to the other peer of the room.
+func (s *InMemorySignaler) Signaling(ctx context.Context, pc *webrtc.PeerConnection, roomID, clientID string) (Renegotiator, error) {
+	s.mu.Lock()
+	// the closed peers have left the room
+	var peers []*webrtc.PeerConnection
+	for _, peer := range s.rooms[roomID] {
+		if peer.ConnectionState() != webrtc.PeerConnectionStateClosed {
+			peers = append(peers, peer)
+		}
+	}
+	if len(peers) >= 2 {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("room %s is full", roomID)
+	}
+	s.rooms[roomID] = append(peers, pc)
+	s.mu.Unlock()
+
+	r := &inMemoryRenegotiator{signaler: s, roomID: roomID, local: pc}
+	if len(peers) == 0 {
+		return r, nil
+	}
+	if err := negotiateInMemory(ctx, pc, peers[0], nil); err != nil {
+		return nil, fmt.Errorf("failed to negotiate (room: %s, client: %s): %+v", roomID, clientID, err)
+	}
+	return r, nil
+}
+
+// remote returns the other peer of the room.
+func (s *InMemorySignaler) remote(roomID string, local *webrtc.PeerConnection) (*webrtc.PeerConnection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, peer := range s.rooms[roomID] {
+		if peer != local {
+			return peer, nil
+		}
+	}
+	return nil, fmt.Errorf("no remote peer in room %s", roomID)
+}
+
+type inMemoryRenegotiator struct {
+	signaler *InMemorySignaler
+	roomID   string
+	local    *webrtc.PeerConnection
+}
+
+func (r *inMemoryRenegotiator) Renegotiate(ctx context.Context, options *webrtc.OfferOptions) error {
+	remote, err := r.signaler.remote(r.roomID, r.local)
+	if err != nil {
+		return err
+	}
+	return negotiateInMemory(ctx, r.local, remote, options)
+}
+
+// negotiateInMemory exchanges the offer and answer with all the ICE candidates, as nothing trickles them.
+func negotiateInMemory(ctx context.Context, pcOffer, pcAnswer *webrtc.PeerConnection, options *webrtc.OfferOptions) error {
+	offer, err := pcOffer.CreateOffer(options)
+	if err != nil {
+		return err
+	}
+	if err := setLocalDescriptionAndGather(ctx, pcOffer, offer); err != nil {
+		return err
+	}
+	if err := pcAnswer.SetRemoteDescription(*pcOffer.LocalDescription()); err != nil {
+		return err
+	}
+	answer, err := pcAnswer.CreateAnswer(nil)
+	if err != nil {
+		return err
+	}
+	if err := setLocalDescriptionAndGather(ctx, pcAnswer, answer); err != nil {
+		return err
+	}
+	return pcOffer.SetRemoteDescription(*pcAnswer.LocalDescription())
+}
+
+func setLocalDescriptionAndGather(ctx context.Context, pc *webrtc.PeerConnection, desc webrtc.SessionDescription) error {
+	gatheringComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(desc); err != nil {
+		return err
+	}
+	select {
+	case <-gatheringComplete:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,48 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemorySignaler(t *testing.T) {
+	ctx := context.Background()
+	signaler := NewInMemorySignaler()
+
+	streamer := newStreamerConn(t, webrtc.Configuration{})
+	defer streamer.PeerConnection().Close()
+	streamerConnected := make(chan struct{})
+	streamer.OnConnect(func() { close(streamerConnected) })
+	r, err := signaler.Signaling(ctx, streamer.PeerConnection(), "room1", "streamer")
+	assert.NoError(t, err)
+	assert.Error(t, r.Renegotiate(ctx, nil), "no player in the room yet")
+
+	// the player joining later offers
+	player := newPlayerConn(t, webrtc.Configuration{})
+	defer player.PeerConnection().Close()
+	playerConnected := make(chan struct{})
+	player.OnConnect(func() { close(playerConnected) })
+	_, err = signaler.Signaling(ctx, player.PeerConnection(), "room1", "player")
+	assert.NoError(t, err)
+	for _, connected := range []chan struct{}{streamerConnected, playerConnected} {
+		select {
+		case <-connected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for connection")
+		}
+	}
+	assertMessaging(t, player.WebRTCConn, streamer.WebRTCConn)
+
+	other := newPlayerConn(t, webrtc.Configuration{})
+	defer other.PeerConnection().Close()
+	_, err = signaler.Signaling(ctx, other.PeerConnection(), "room1", "other")
+	assert.Error(t, err, "the room is full")
+
+	// the streamer restarts ICE through the signaler
+	assert.NoError(t, r.Renegotiate(ctx, &webrtc.OfferOptions{ICERestart: true}))
+	assertMessaging(t, streamer.WebRTCConn, player.WebRTCConn)
+}
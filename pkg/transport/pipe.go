@@ -0,0 +1,504 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pkg/errors"
+	"github.com/tevino/abool"
+)
+
+const (
+	pipeMessageBufferSize = 64
+	pipeSampleBufferSize  = 64
+)
+
+// PipeTransport is a Factory connecting the streamer to a player in the same process without networking,
+// which is for testing the game server end to end.
+type PipeTransport struct {
+	rooms map[string]*pipeRoom
+	mu    sync.Mutex
+}
+
+type pipeRoom struct {
+	streamer *PipeStreamerConn
+	// closed when the streamer connects to the room
+	ready chan struct{}
+}
+
+func NewPipeTransport() *PipeTransport {
+	return &PipeTransport{
+		rooms: make(map[string]*pipeRoom),
+	}
+}
+
+func (t *PipeTransport) room(roomID string) *pipeRoom {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	room, ok := t.rooms[roomID]
+	if !ok {
+		room = &pipeRoom{ready: make(chan struct{})}
+		t.rooms[roomID] = room
+	}
+	return room
+}
+
+// NewStreamerConn returns a conn whose tracks are read and written by the player of PipeTransport.Player.
+// The video codec is the most preferred one of WithVideoCodecs, or the first supported one (H.264 by default).
+func (t *PipeTransport) NewStreamerConn(roomID string, options ...StreamerOption) (StreamerConn, Connector, error) {
+	opts := defaultStreamerOptions()
+	for _, opt := range options {
+		opt.apply(opts)
+	}
+	if err := validateTrackSpecs(append(append([]TrackSpec{}, opts.sendTracks...), opts.recvTracks...)); err != nil {
+		return nil, nil, err
+	}
+	sendable := opts.sendableVideoCodecs()
+	if len(sendable) == 0 {
+		return nil, nil, errors.New("no video codec is supported")
+	}
+	videoCodec := sendable[0]
+	for _, codec := range opts.videoCodecs {
+		if containsVideoCodec(sendable, codec) {
+			videoCodec = codec
+			break
+		}
+	}
+	conn := &PipeStreamerConn{pipeConn: newPipeConn("streamer")}
+	for _, spec := range opts.sendTracks {
+		conn.sendTracks = append(conn.sendTracks, newPipeTrack(spec, videoCodec, conn.closed))
+	}
+	for _, spec := range opts.recvTracks {
+		conn.recvTracks = append(conn.recvTracks, newPipeTrack(spec, videoCodec, conn.closed))
+	}
+	return conn, &pipeConnector{transport: t, roomID: roomID}, nil
+}
+
+type pipeConnector struct {
+	transport *PipeTransport
+	roomID    string
+}
+
+// Connect lets the player of the room connect in the background.
+func (c *pipeConnector) Connect(ctx context.Context, conn StreamerConn) error {
+	pconn, ok := conn.(*PipeStreamerConn)
+	if !ok {
+		return errors.New("failed to cast to PipeStreamerConn")
+	}
+	room := c.transport.room(c.roomID)
+	c.transport.mu.Lock()
+	defer c.transport.mu.Unlock()
+	if room.streamer != nil {
+		return errors.Errorf("another streamer is connected to the room: %s", c.roomID)
+	}
+	room.streamer = pconn
+	close(room.ready)
+	return nil
+}
+
+// Player waits for the streamer to connect to the room, and connects a player to it.
+// OnConnect of both conns is called before returning.
+func (t *PipeTransport) Player(ctx context.Context, roomID string) (*PipePlayerConn, error) {
+	room := t.room(roomID)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-room.ready:
+	}
+	t.mu.Lock()
+	streamer := room.streamer
+	// the room is for a player, and another player waits for the next streamer
+	delete(t.rooms, roomID)
+	t.mu.Unlock()
+
+	player := &PipePlayerConn{pipeConn: newPipeConn("player"), streamer: streamer}
+	player.peer = streamer.pipeConn
+	streamer.peer = player.pipeConn
+	// the conns are closed together
+	player.closed = streamer.closed
+	player.closeOnce = streamer.closeOnce
+	player.connect()
+	streamer.connect()
+	return player, nil
+}
+
+// pipeConn is an end of the pipe, whose messages are delivered to the other end (peer) in order of each data channel.
+type pipeConn struct {
+	cid          string
+	peer         *pipeConn
+	channels     map[DataChannelPurpose]*pipeDataChannel
+	connected    *abool.AtomicBool
+	onConnect    func()
+	onDisconnect func()
+	callbackMu   sync.Mutex
+	closeOnce    *sync.Once
+	closed       chan struct{}
+}
+
+func newPipeConn(cid string) *pipeConn {
+	conn := &pipeConn{
+		cid:       cid,
+		channels:  make(map[DataChannelPurpose]*pipeDataChannel),
+		connected: abool.New(),
+		closeOnce: &sync.Once{},
+		closed:    make(chan struct{}),
+	}
+	for _, purpose := range dataChannelPurposes {
+		conn.channels[purpose] = &pipeDataChannel{
+			purpose: purpose,
+			conn:    conn,
+			inbox:   make(chan []byte, pipeMessageBufferSize),
+		}
+	}
+	return conn
+}
+
+func (c *pipeConn) connect() {
+	for _, ch := range c.channels {
+		go ch.deliver()
+	}
+	c.connected.Set()
+	c.callbackMu.Lock()
+	h := c.onConnect
+	c.callbackMu.Unlock()
+	if h != nil {
+		h()
+	}
+}
+
+// Close disconnects both ends of the pipe, and OnDisconnect of both is called.
+func (c *pipeConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		for _, conn := range []*pipeConn{c, c.peer} {
+			if conn == nil {
+				continue
+			}
+			conn.callbackMu.Lock()
+			h := conn.onDisconnect
+			conn.callbackMu.Unlock()
+			if h != nil {
+				h()
+			}
+		}
+	})
+	return nil
+}
+
+func (c *pipeConn) ConnectionID() string {
+	return c.cid
+}
+
+// SendMessage sends the message on the control channel.
+func (c *pipeConn) SendMessage(ctx context.Context, data []byte) error {
+	if c.connected.IsNotSet() {
+		return errors.New("not connected")
+	}
+	return c.channels[DataChannelControl].Send(ctx, data)
+}
+
+// OnMessage sets a handler of messages on the control channel.
+func (c *pipeConn) OnMessage(f func(data []byte)) {
+	c.channels[DataChannelControl].OnMessage(f)
+}
+
+func (c *pipeConn) DataChannel(purpose DataChannelPurpose) (DataChannel, bool) {
+	ch, ok := c.channels[purpose]
+	if !ok {
+		return nil, false
+	}
+	return ch, true
+}
+
+func (c *pipeConn) OnConnect(f func()) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.onConnect = f
+}
+
+func (c *pipeConn) OnDisconnect(f func()) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.onDisconnect = f
+}
+
+type pipeDataChannel struct {
+	purpose   DataChannelPurpose
+	conn      *pipeConn
+	inbox     chan []byte
+	onMessage func(data []byte)
+	mu        sync.Mutex
+}
+
+func (c *pipeDataChannel) Purpose() DataChannelPurpose {
+	return c.purpose
+}
+
+// Send blocks while the buffer of the remote end is full.
+func (c *pipeDataChannel) Send(ctx context.Context, data []byte) error {
+	if c.conn.connected.IsNotSet() || c.conn.peer == nil {
+		return ErrDataChannelNotOpen
+	}
+	inbox := c.conn.peer.channels[c.purpose].inbox
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.conn.closed:
+		return ErrDataChannelNotOpen
+	case inbox <- append([]byte{}, data...):
+		return nil
+	}
+}
+
+func (c *pipeDataChannel) OnMessage(f func(data []byte)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onMessage = f
+}
+
+func (c *pipeDataChannel) deliver() {
+	for {
+		select {
+		case <-c.conn.closed:
+			return
+		case data := <-c.inbox:
+			c.mu.Lock()
+			h := c.onMessage
+			c.mu.Unlock()
+			if h != nil {
+				h(data)
+			}
+		}
+	}
+}
+
+// PipeStreamerConn is the streamer end of PipeTransport.
+type PipeStreamerConn struct {
+	*pipeConn
+	sendTracks          []*pipeTrack
+	recvTracks          []*pipeTrack
+	onRecvTrack         func(track RecvTrack)
+	onKeyframeRequest   func(trackID string)
+	onBandwidthEstimate func(estimate BandwidthEstimate)
+}
+
+// SendTracks returns the tracks read by the player in order of WithSendTracks.
+func (c *PipeStreamerConn) SendTracks() []SendTrack {
+	tracks := make([]SendTrack, len(c.sendTracks))
+	for i, t := range c.sendTracks {
+		tracks[i] = &pipeSendTrack{track: t, connected: c.connected}
+	}
+	return tracks
+}
+
+func (c *PipeStreamerConn) SendTrack(id string) (SendTrack, bool) {
+	for _, t := range c.sendTracks {
+		if t.spec.ID == id {
+			return &pipeSendTrack{track: t, connected: c.connected}, true
+		}
+	}
+	return nil, false
+}
+
+// OnRecvTrack sets a handler called when the player starts writing a track declared by WithRecvTracks.
+func (c *PipeStreamerConn) OnRecvTrack(f func(track RecvTrack)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.onRecvTrack = f
+}
+
+// OnKeyframeRequest sets a handler called by PipePlayerConn.RequestKeyframe.
+func (c *PipeStreamerConn) OnKeyframeRequest(f func(trackID string)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.onKeyframeRequest = f
+}
+
+// OnBandwidthEstimate sets a handler called by PipePlayerConn.EstimateBandwidth.
+func (c *PipeStreamerConn) OnBandwidthEstimate(f func(estimate BandwidthEstimate)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.onBandwidthEstimate = f
+}
+
+// Stats returns false, as the stats are not collected on the pipe.
+func (c *PipeStreamerConn) Stats() (ConnStats, bool) {
+	return ConnStats{}, false
+}
+
+// SubscribeStats returns a channel receiving nothing, which is closed when the context is done or the pipe is closed.
+func (c *PipeStreamerConn) SubscribeStats(ctx context.Context) <-chan ConnStats {
+	ch := make(chan ConnStats)
+	go func() {
+		defer close(ch)
+		select {
+		case <-ctx.Done():
+		case <-c.closed:
+		}
+	}()
+	return ch
+}
+
+// PipePlayerConn is the player end of PipeTransport.
+type PipePlayerConn struct {
+	*pipeConn
+	streamer *PipeStreamerConn
+}
+
+// ReadSample reads a sample written to the track of the streamer.
+// Samples are dropped rather than blocking the streamer when the player doesn't read them.
+func (c *PipePlayerConn) ReadSample(ctx context.Context, trackID string) (MediaSample, error) {
+	for _, t := range c.streamer.sendTracks {
+		if t.spec.ID == trackID {
+			return t.read(ctx)
+		}
+	}
+	return MediaSample{}, errors.Errorf("unknown track: %s", trackID)
+}
+
+// SendTrack returns the track for the ID declared by WithRecvTracks of the streamer.
+// OnRecvTrack of the streamer is called on the first sample.
+func (c *PipePlayerConn) SendTrack(id string) (SendTrack, bool) {
+	for _, t := range c.streamer.recvTracks {
+		if t.spec.ID != id {
+			continue
+		}
+		t := t
+		return &pipeSendTrack{track: t, connected: c.connected, onFirstSample: func() {
+			c.streamer.callbackMu.Lock()
+			h := c.streamer.onRecvTrack
+			c.streamer.callbackMu.Unlock()
+			if h != nil {
+				h(&pipeRecvTrack{track: t})
+			}
+		}}, true
+	}
+	return nil, false
+}
+
+// RequestKeyframe requests the streamer to send a keyframe of the track.
+func (c *PipePlayerConn) RequestKeyframe(trackID string) {
+	c.streamer.callbackMu.Lock()
+	h := c.streamer.onKeyframeRequest
+	c.streamer.callbackMu.Unlock()
+	if h != nil {
+		h(trackID)
+	}
+}
+
+// EstimateBandwidth notifies the streamer of the estimate, as RTCP feedback does.
+func (c *PipePlayerConn) EstimateBandwidth(estimate BandwidthEstimate) {
+	c.streamer.callbackMu.Lock()
+	h := c.streamer.onBandwidthEstimate
+	c.streamer.callbackMu.Unlock()
+	if h != nil {
+		h(estimate)
+	}
+}
+
+// pipeTrack buffers samples from the writer end to the reader end.
+type pipeTrack struct {
+	spec          TrackSpec
+	codec         string
+	samples       chan MediaSample
+	closed        chan struct{}
+	firstSampleMu sync.Mutex
+	started       bool
+}
+
+func newPipeTrack(spec TrackSpec, videoCodec VideoCodec, closed chan struct{}) *pipeTrack {
+	codec := videoCodec.mimeType()
+	if spec.Kind == TrackKindAudio {
+		codec = webrtc.MimeTypeOpus
+	}
+	return &pipeTrack{
+		spec:    spec,
+		codec:   codec,
+		samples: make(chan MediaSample, pipeSampleBufferSize),
+		closed:  closed,
+	}
+}
+
+func (t *pipeTrack) write(sample MediaSample) {
+	sample.Data = append([]byte{}, sample.Data...)
+	select {
+	case t.samples <- sample:
+	default:
+		// dropped like a lossy network
+	}
+}
+
+func (t *pipeTrack) read(ctx context.Context) (MediaSample, error) {
+	select {
+	case <-ctx.Done():
+		return MediaSample{}, ctx.Err()
+	case <-t.closed:
+		return MediaSample{}, io.EOF
+	case sample := <-t.samples:
+		return sample, nil
+	}
+}
+
+type pipeSendTrack struct {
+	track         *pipeTrack
+	connected     *abool.AtomicBool
+	onFirstSample func()
+}
+
+func (t *pipeSendTrack) ID() string {
+	return t.track.spec.ID
+}
+
+func (t *pipeSendTrack) Kind() TrackKind {
+	return t.track.spec.Kind
+}
+
+func (t *pipeSendTrack) Codec() (string, error) {
+	return t.track.codec, nil
+}
+
+func (t *pipeSendTrack) WriteSample(ctx context.Context, sample MediaSample) error {
+	select {
+	case <-t.track.closed:
+		return io.ErrClosedPipe
+	default:
+	}
+	if t.connected.IsNotSet() {
+		// samples are dropped until connected
+		return nil
+	}
+	if t.onFirstSample != nil {
+		t.track.firstSampleMu.Lock()
+		first := !t.track.started
+		t.track.started = true
+		t.track.firstSampleMu.Unlock()
+		if first {
+			t.onFirstSample()
+		}
+	}
+	t.track.write(sample)
+	return nil
+}
+
+type pipeRecvTrack struct {
+	track *pipeTrack
+}
+
+func (t *pipeRecvTrack) ID() string {
+	return t.track.spec.ID
+}
+
+func (t *pipeRecvTrack) Kind() TrackKind {
+	return t.track.spec.Kind
+}
+
+func (t *pipeRecvTrack) Codec() string {
+	return t.track.codec
+}
+
+// ReadSample blocks until a sample arrives or the pipe is closed.
+func (t *pipeRecvTrack) ReadSample() (MediaSample, error) {
+	return t.track.read(context.Background())
+}
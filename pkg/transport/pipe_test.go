@@ -0,0 +1,167 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeTransport(t *testing.T) {
+	ctx := context.Background()
+	pipe := NewPipeTransport()
+	conn, connector, err := pipe.NewStreamerConn("room1",
+		WithVideoCodecs(VideoCodecVP8),
+		WithRecvTracks(TrackSpec{ID: TrackIDMicrophone, Kind: TrackKindAudio}))
+	assert.NoError(t, err)
+	streamerConnected := make(chan struct{})
+	conn.OnConnect(func() { close(streamerConnected) })
+	streamerDisconnected := make(chan struct{})
+	conn.OnDisconnect(func() { close(streamerDisconnected) })
+	received := make(chan []byte, 1)
+	conn.OnMessage(func(data []byte) { received <- data })
+	pointerReceived := make(chan []byte, 1)
+	mustDataChannel(t, conn, DataChannelPointer).OnMessage(func(data []byte) { pointerReceived <- data })
+	keyframeRequested := make(chan string, 1)
+	conn.OnKeyframeRequest(func(trackID string) { keyframeRequested <- trackID })
+	estimated := make(chan BandwidthEstimate, 1)
+	conn.OnBandwidthEstimate(func(estimate BandwidthEstimate) { estimated <- estimate })
+	recvTrack := make(chan RecvTrack, 1)
+	conn.OnRecvTrack(func(track RecvTrack) { recvTrack <- track })
+
+	// samples are dropped until connected
+	video, ok := conn.SendTrack(TrackIDVideo)
+	assert.True(t, ok)
+	codec, err := video.Codec()
+	assert.NoError(t, err)
+	assert.Equal(t, "video/VP8", codec)
+	assert.NoError(t, video.WriteSample(ctx, MediaSample{Data: []byte("dropped")}))
+
+	// the player waits for the streamer
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, connector.Connect(ctx, conn))
+	}()
+	player, err := pipe.Player(ctx, "room1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-streamerConnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for connection")
+	}
+	playerDisconnected := make(chan struct{})
+	player.OnDisconnect(func() { close(playerDisconnected) })
+
+	// messages in both directions
+	playerReceived := make(chan []byte, 1)
+	player.OnMessage(func(data []byte) { playerReceived <- data })
+	assert.NoError(t, conn.SendMessage(ctx, []byte("to player")))
+	assert.Equal(t, []byte("to player"), receiveMessage(t, playerReceived))
+	assert.NoError(t, player.SendMessage(ctx, []byte("to streamer")))
+	assert.Equal(t, []byte("to streamer"), receiveMessage(t, received))
+	assert.NoError(t, mustDataChannel(t, player, DataChannelPointer).Send(ctx, []byte("pointer")))
+	assert.Equal(t, []byte("pointer"), receiveMessage(t, pointerReceived))
+
+	// media and feedback from the player
+	assert.NoError(t, video.WriteSample(ctx, MediaSample{Data: []byte("frame"), Duration: time.Second / 30}))
+	sample, err := player.ReadSample(ctx, TrackIDVideo)
+	assert.NoError(t, err)
+	assert.Equal(t, MediaSample{Data: []byte("frame"), Duration: time.Second / 30}, sample)
+	_, err = player.ReadSample(ctx, TrackIDVideoLow)
+	assert.Error(t, err)
+	player.RequestKeyframe(TrackIDVideo)
+	assert.Equal(t, TrackIDVideo, <-keyframeRequested)
+	player.EstimateBandwidth(BandwidthEstimate{Bitrate: 1000000})
+	assert.Equal(t, BandwidthEstimate{Bitrate: 1000000}, <-estimated)
+
+	// the microphone of the player
+	_, ok = player.SendTrack(TrackIDAudio)
+	assert.False(t, ok)
+	microphone, ok := player.SendTrack(TrackIDMicrophone)
+	assert.True(t, ok)
+	assert.NoError(t, microphone.WriteSample(ctx, MediaSample{Data: []byte("voice")}))
+	var track RecvTrack
+	select {
+	case track = <-recvTrack:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for recv track")
+	}
+	assert.Equal(t, TrackIDMicrophone, track.ID())
+	assert.Equal(t, "audio/opus", track.Codec())
+	sample, err = track.ReadSample()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("voice"), sample.Data)
+
+	// both ends are disconnected
+	assert.NoError(t, player.Close())
+	for _, disconnected := range []chan struct{}{streamerDisconnected, playerDisconnected} {
+		select {
+		case <-disconnected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for disconnection")
+		}
+	}
+	_, err = track.ReadSample()
+	assert.Equal(t, io.EOF, err)
+	assert.Error(t, video.WriteSample(ctx, MediaSample{Data: []byte("closed")}))
+	_, ok = <-conn.SubscribeStats(ctx)
+	assert.False(t, ok)
+}
+
+func TestPipeTransportTimeout(t *testing.T) {
+	pipe := NewPipeTransport()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := pipe.Player(ctx, "unknown")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	_, _, err = pipe.NewStreamerConn("room1", WithSendTracks(
+		TrackSpec{ID: TrackIDVideo, Kind: TrackKindVideo},
+		TrackSpec{ID: TrackIDVideo, Kind: TrackKindAudio},
+	))
+	assert.Error(t, err)
+}
+
+func receiveMessage(t *testing.T, ch chan []byte) []byte {
+	t.Helper()
+	select {
+	case data := <-ch:
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+		return nil
+	}
+}
+
+func TestPipeTransportSupportedVideoCodecs(t *testing.T) {
+	pipe := NewPipeTransport()
+	tcs := []struct {
+		name      string
+		options   []StreamerOption
+		expected  string
+		expectErr bool
+	}{
+		{name: "OurPreference", options: []StreamerOption{WithSupportedVideoCodecs(VideoCodecVP9, VideoCodecVP8)}, expected: "video/VP8"},
+		{name: "StreamerPreference", options: []StreamerOption{WithVideoCodecs(VideoCodecH264, VideoCodecVP9), WithSupportedVideoCodecs(VideoCodecVP9, VideoCodecVP8)}, expected: "video/VP9"},
+		{name: "NoSupportedCodecs", options: []StreamerOption{WithSupportedVideoCodecs()}, expectErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, _, err := pipe.NewStreamerConn(tc.name, tc.options...)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			video, ok := conn.SendTrack(TrackIDVideo)
+			assert.True(t, ok)
+			codec, err := video.Codec()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, codec)
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package transport
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v3"
+)
+
+// same as TrackLocalStaticSample
+const rtpOutboundMTU = 1200
+
+// sampleTrack is a track writing samples as RTP packets whose timestamps are derived from the PTS of the samples,
+// so that video and audio encoded on the same clock are played in sync.
+type sampleTrack struct {
+	*webrtc.TrackLocalStaticRTP
+	packetizer  rtp.Packetizer
+	timestamper *rtpTimestamper
+
+	// for RTCP sender reports
+	ssrc        uint32
+	lastPTS     time.Duration
+	lastWritten time.Time
+	packetCount uint32
+	octetCount  uint32
+	mu          sync.Mutex
+}
+
+func newSampleTrack(codec webrtc.RTPCodecCapability, id, streamID string) (*sampleTrack, error) {
+	payloader, err := payloaderForCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+	track, err := webrtc.NewTrackLocalStaticRTP(codec, id, streamID)
+	if err != nil {
+		return nil, err
+	}
+	return &sampleTrack{
+		TrackLocalStaticRTP: track,
+		// SSRC and payload type are replaced by TrackLocalStaticRTP for each binding
+		packetizer:  rtp.NewPacketizer(rtpOutboundMTU, 0, 0, payloader, rtp.NewRandomSequencer(), codec.ClockRate),
+		timestamper: newRTPTimestamper(codec.ClockRate, rand.Uint32()),
+	}, nil
+}
+
+func (t *sampleTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	params, err := t.TrackLocalStaticRTP.Bind(ctx)
+	if err != nil {
+		return webrtc.RTPCodecParameters{}, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ssrc = uint32(ctx.SSRC())
+	return params, nil
+}
+
+func (t *sampleTrack) WriteSample(sample MediaSample) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timestamp := t.timestamper.Timestamp(sample)
+	for _, p := range t.packetizer.Packetize(sample.Data, 0) {
+		p.Timestamp = timestamp
+		if err := t.WriteRTP(p); err != nil {
+			return err
+		}
+		t.packetCount++
+		t.octetCount += uint32(len(p.Payload))
+	}
+	t.lastPTS = t.timestamper.last
+	t.lastWritten = time.Now()
+	return nil
+}
+
+// senderReport returns the RTCP sender report at now, which maps the RTP timestamp to the wall clock through the PTS.
+// It returns false until a packet is sent.
+func (t *sampleTrack) senderReport(clock *mediaClock, now time.Time) (rtcp.SenderReport, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.packetCount == 0 {
+		return rtcp.SenderReport{}, false
+	}
+	// the PTS of a sample which would be sent now
+	pts := t.lastPTS + now.Sub(t.lastWritten)
+	return rtcp.SenderReport{
+		SSRC:        t.ssrc,
+		NTPTime:     ntpTime(clock.wallTime(pts, now)),
+		RTPTime:     t.timestamper.rtpTime(pts),
+		PacketCount: t.packetCount,
+		OctetCount:  t.octetCount,
+	}, true
+}
+
+func (t *sampleTrack) mimeType() (string, error) {
+	return t.TrackLocalStaticRTP.Codec().MimeType, nil
+}
+
+func payloaderForCodec(codec webrtc.RTPCodecCapability) (rtp.Payloader, error) {
+	switch strings.ToLower(codec.MimeType) {
+	case strings.ToLower(webrtc.MimeTypeH264):
+		return &codecs.H264Payloader{}, nil
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		return &codecs.VP8Payloader{}, nil
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		return &codecs.VP9Payloader{}, nil
+	case strings.ToLower(VideoCodecAV1.mimeType()):
+		return &av1Payloader{}, nil
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		return &codecs.OpusPayloader{}, nil
+	default:
+		return nil, fmt.Errorf("no payloader for %s", codec.MimeType)
+	}
+}
+
+// rtpTimestamper converts the PTS of samples to RTP timestamps.
+// Samples without PTS advance the timestamp by the duration of the previous sample.
+type rtpTimestamper struct {
+	clockRate uint32
+	offset    uint32
+	last      time.Duration
+	next      time.Duration
+}
+
+func newRTPTimestamper(clockRate, offset uint32) *rtpTimestamper {
+	return &rtpTimestamper{clockRate: clockRate, offset: offset}
+}
+
+func (t *rtpTimestamper) Timestamp(sample MediaSample) uint32 {
+	pts := sample.PTS
+	if pts == 0 {
+		pts = t.next
+	}
+	t.last = pts
+	t.next = pts + sample.Duration
+	return t.rtpTime(pts)
+}
+
+func (t *rtpTimestamper) rtpTime(pts time.Duration) uint32 {
+	// split into seconds and the rest not to overflow
+	sec := uint64(pts / time.Second)
+	rest := uint64(pts % time.Second)
+	ticks := sec*uint64(t.clockRate) + rest*uint64(t.clockRate)/uint64(time.Second)
+	// RTP timestamps wrap around
+	return t.offset + uint32(ticks)
+}
+
+// mediaClock maps the PTS of samples to the wall clock.
+// The tracks of a connection share it so that the remote peer can synchronize them by the sender reports.
+type mediaClock struct {
+	origin time.Time
+	mu     sync.Mutex
+}
+
+// wallTime returns the wall clock time of the PTS. The first call maps the PTS to now.
+func (c *mediaClock) wallTime(pts time.Duration, now time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.origin.IsZero() {
+		c.origin = now.Add(-pts)
+	}
+	return c.origin.Add(pts)
+}
+
+// seconds from 1900 (the NTP epoch) to 1970 (the Unix epoch)
+const ntpEpochOffset = 2208988800
+
+// ntpTime returns the 64-bit NTP timestamp of the time.
+func ntpTime(t time.Time) uint64 {
+	nsec := uint64(t.UnixNano())
+	sec := nsec/uint64(time.Second) + ntpEpochOffset
+	frac := (nsec % uint64(time.Second)) << 32 / uint64(time.Second)
+	return sec<<32 | frac
+}
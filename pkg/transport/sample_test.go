@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRTPTimestamper(t *testing.T) {
+	ts := newRTPTimestamper(90000, 1000)
+	assert.Equal(t, uint32(1000+90000), ts.Timestamp(MediaSample{PTS: 1 * time.Second, Duration: 33 * time.Millisecond}))
+	assert.Equal(t, uint32(1000+90000+4500), ts.Timestamp(MediaSample{PTS: 1050 * time.Millisecond, Duration: 33 * time.Millisecond}))
+	// without PTS, the timestamp follows the previous sample
+	assert.Equal(t, uint32(1000+90000+4500+2970), ts.Timestamp(MediaSample{Duration: 33 * time.Millisecond}))
+
+	// wraps around
+	ts = newRTPTimestamper(48000, 0xFFFFFFFF)
+	assert.Equal(t, uint32(479), ts.Timestamp(MediaSample{PTS: 10 * time.Millisecond}))
+	// no overflow with large PTS
+	ts = newRTPTimestamper(90000, 0)
+	pts := 100 * 24 * time.Hour
+	assert.Equal(t, uint32(uint64(pts/time.Second)*90000), ts.Timestamp(MediaSample{PTS: pts}))
+}
+
+func TestNTPTime(t *testing.T) {
+	assert.Equal(t, uint64(ntpEpochOffset)<<32, ntpTime(time.Unix(0, 0)))
+	assert.Equal(t, uint64(ntpEpochOffset+1)<<32|1<<31, ntpTime(time.Unix(1, 500*int64(time.Millisecond))))
+}
+
+func TestSampleTrackSenderReport(t *testing.T) {
+	video, err := newSampleTrack(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000}, TrackIDVideo, streamID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, err := newAudioTrack(TrackIDAudio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &mediaClock{}
+	_, ok := video.senderReport(clock, time.Now())
+	assert.False(t, ok, "no report before sending")
+
+	pts := 10 * time.Second
+	assert.NoError(t, video.WriteSample(MediaSample{Data: []byte{0x00, 0x01, 0x02}, PTS: pts, Duration: 33 * time.Millisecond}))
+	assert.NoError(t, audio.WriteSample(MediaSample{Data: []byte{0xfc, 0xff, 0xfe}, PTS: pts, Duration: 20 * time.Millisecond}))
+
+	now := time.Now().Add(500 * time.Millisecond)
+	videoSR, ok := video.senderReport(clock, now)
+	assert.True(t, ok)
+	audioSR, ok := audio.senderReport(clock, now)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(1), videoSR.PacketCount)
+	// the payload descriptor of VP8 and the sample
+	assert.Equal(t, uint32(1+3), videoSR.OctetCount)
+	assert.Equal(t, uint32(3), audioSR.OctetCount)
+
+	// the RTP timestamps advance by the elapsed time since the last sample
+	assert.Equal(t, video.timestamper.rtpTime(pts+now.Sub(video.lastWritten)), videoSR.RTPTime)
+	assert.Equal(t, audio.timestamper.rtpTime(pts+now.Sub(audio.lastWritten)), audioSR.RTPTime)
+
+	// the NTP time of each report is the PTS on the shared clock
+	assert.Equal(t, ntpTime(clock.origin.Add(pts+now.Sub(video.lastWritten))), videoSR.NTPTime)
+	assert.Equal(t, ntpTime(clock.origin.Add(pts+now.Sub(audio.lastWritten))), audioSR.NTPTime)
+}
@@ -0,0 +1,347 @@
+package transport
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+const defaultStatsInterval = 2 * time.Second
+
+// ConnStats is a snapshot of the quality of the connection.
+type ConnStats struct {
+	Timestamp time.Time
+	// LocalCandidateType and RemoteCandidateType are the types of the selected candidate pair (host, srflx, prflx or relay).
+	LocalCandidateType  string
+	RemoteCandidateType string
+	// RoundTripTime is the latest RTT measured by STUN on the selected candidate pair.
+	RoundTripTime time.Duration
+	// BytesSent and BytesReceived are the totals on the selected candidate pair.
+	BytesSent     uint64
+	BytesReceived uint64
+	// SendBitrate and RecvBitrate are in bits per second since the previous snapshot.
+	SendBitrate int
+	RecvBitrate int
+	// Streams are the RTP streams sent to the remote peer, which are collected by WebRTCStreamerConn only.
+	Streams []RTPStreamStats
+}
+
+// RTPStreamStats is the statistics of an RTP stream sent to the remote peer.
+type RTPStreamStats struct {
+	SSRC        uint32
+	Kind        TrackKind
+	MimeType    string
+	PacketsSent uint64
+	BytesSent   uint64
+	// FramesSent is counted by the marker bit of video packets, and zero for audio.
+	FramesSent uint64
+	// Bitrate in bits per second and Framerate are since the previous snapshot.
+	Bitrate   int
+	Framerate float64
+	// PacketsLost is the cumulative number reported by the remote peer.
+	PacketsLost uint32
+	// FractionLost is the latest fraction of lost packets (0.0 - 1.0) reported by the remote peer.
+	FractionLost float64
+	Jitter       time.Duration
+	NACKCount    uint64
+	PLICount     uint64
+	FIRCount     uint64
+}
+
+// PacketLoss returns the worst fraction of lost packets of the streams.
+func (s ConnStats) PacketLoss() float64 {
+	var loss float64
+	for _, stream := range s.Streams {
+		if stream.FractionLost > loss {
+			loss = stream.FractionLost
+		}
+	}
+	return loss
+}
+
+// newConnStats makes a snapshot from the stats of the peer connection and the RTP streams,
+// and the rates since the previous snapshot if any.
+func newConnStats(now time.Time, report webrtc.StatsReport, streams []RTPStreamStats, prev *ConnStats) ConnStats {
+	stats := ConnStats{Timestamp: now, Streams: streams}
+	if pair, ok := selectedCandidatePair(report); ok {
+		stats.RoundTripTime = time.Duration(pair.CurrentRoundTripTime * float64(time.Second))
+		stats.BytesSent = pair.BytesSent
+		stats.BytesReceived = pair.BytesReceived
+		if local, ok := report[pair.LocalCandidateID].(webrtc.ICECandidateStats); ok {
+			stats.LocalCandidateType = local.CandidateType.String()
+		}
+		if remote, ok := report[pair.RemoteCandidateID].(webrtc.ICECandidateStats); ok {
+			stats.RemoteCandidateType = remote.CandidateType.String()
+		}
+	}
+	if prev == nil {
+		return stats
+	}
+	elapsed := now.Sub(prev.Timestamp).Seconds()
+	stats.SendBitrate = bitrate(prev.BytesSent, stats.BytesSent, elapsed)
+	stats.RecvBitrate = bitrate(prev.BytesReceived, stats.BytesReceived, elapsed)
+	prevStreams := make(map[uint32]RTPStreamStats)
+	for _, stream := range prev.Streams {
+		prevStreams[stream.SSRC] = stream
+	}
+	for i := range stats.Streams {
+		p, ok := prevStreams[stats.Streams[i].SSRC]
+		if !ok {
+			continue
+		}
+		stats.Streams[i].Bitrate = bitrate(p.BytesSent, stats.Streams[i].BytesSent, elapsed)
+		if elapsed > 0 && stats.Streams[i].FramesSent >= p.FramesSent {
+			stats.Streams[i].Framerate = float64(stats.Streams[i].FramesSent-p.FramesSent) / elapsed
+		}
+	}
+	return stats
+}
+
+// selectedCandidatePair returns the nominated candidate pair, or a succeeded one before nomination.
+func selectedCandidatePair(report webrtc.StatsReport) (webrtc.ICECandidatePairStats, bool) {
+	var succeeded *webrtc.ICECandidatePairStats
+	for _, s := range report {
+		pair, ok := s.(webrtc.ICECandidatePairStats)
+		if !ok {
+			continue
+		}
+		if pair.Nominated {
+			return pair, true
+		}
+		if pair.State == webrtc.StatsICECandidatePairStateSucceeded && succeeded == nil {
+			succeeded = &pair
+		}
+	}
+	if succeeded != nil {
+		return *succeeded, true
+	}
+	return webrtc.ICECandidatePairStats{}, false
+}
+
+func bitrate(prevBytes, bytes uint64, elapsed float64) int {
+	if elapsed <= 0 || bytes < prevBytes {
+		return 0
+	}
+	return int(float64(bytes-prevBytes) * 8 / elapsed)
+}
+
+// WithStatsInterval sets the interval of collecting ConnStats while connected.
+func WithStatsInterval(interval time.Duration) ConnOption {
+	return ConnOptionFunc(func(opts *connOptions) {
+		opts.statsInterval = interval
+	})
+}
+
+// Stats returns the latest snapshot of the connection quality, or false before the first one is collected.
+func (c *WebRTCConn) Stats() (ConnStats, bool) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	if c.stats == nil {
+		return ConnStats{}, false
+	}
+	return *c.stats, true
+}
+
+// SubscribeStats returns a channel receiving every snapshot of the connection quality,
+// which is closed when the context is done or the connection is disconnected.
+// A slow subscriber receives the latest snapshot and misses the older ones.
+func (c *WebRTCConn) SubscribeStats(ctx context.Context) <-chan ConnStats {
+	ch := make(chan ConnStats, 1)
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	if c.statsClosed {
+		close(ch)
+		return ch
+	}
+	c.statsSubscribers[ch] = struct{}{}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.disconnected:
+			return
+		}
+		c.statsMu.Lock()
+		defer c.statsMu.Unlock()
+		if _, ok := c.statsSubscribers[ch]; ok {
+			delete(c.statsSubscribers, ch)
+			close(ch)
+		}
+	}()
+	return ch
+}
+
+func (c *WebRTCConn) collectStats() {
+	ticker := time.NewTicker(c.opts.statsInterval)
+	defer ticker.Stop()
+	var prev *ConnStats
+	for {
+		select {
+		case <-c.disconnected:
+			c.closeStats()
+			return
+		case now := <-ticker.C:
+			var streams []RTPStreamStats
+			if c.rtpStats != nil {
+				streams = c.rtpStats.Streams()
+			}
+			stats := newConnStats(now, c.pc.GetStats(), streams, prev)
+			prev = &stats
+			c.publishStats(stats)
+		}
+	}
+}
+
+func (c *WebRTCConn) publishStats(stats ConnStats) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.stats = &stats
+	for ch := range c.statsSubscribers {
+		// replace the stale snapshot not received yet
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- stats
+	}
+}
+
+func (c *WebRTCConn) closeStats() {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.statsClosed = true
+	for ch := range c.statsSubscribers {
+		delete(c.statsSubscribers, ch)
+		close(ch)
+	}
+}
+
+type rtpStream struct {
+	stats     RTPStreamStats
+	clockRate uint32
+}
+
+// rtpStatsInterceptor is a pion interceptor that counts RTP packets sent to the remote peer and RTCP feedback on them.
+// GetStats of the pion version we use reports the transport only, not the RTP streams.
+type rtpStatsInterceptor struct {
+	interceptor.NoOp
+	streams map[uint32]*rtpStream
+	mu      sync.Mutex
+}
+
+func newRTPStatsInterceptor() *rtpStatsInterceptor {
+	return &rtpStatsInterceptor{
+		streams: make(map[uint32]*rtpStream),
+	}
+}
+
+func (i *rtpStatsInterceptor) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	kind := TrackKindAudio
+	if strings.HasPrefix(strings.ToLower(info.MimeType), "video/") {
+		kind = TrackKindVideo
+	}
+	i.mu.Lock()
+	i.streams[info.SSRC] = &rtpStream{
+		stats:     RTPStreamStats{SSRC: info.SSRC, Kind: kind, MimeType: info.MimeType},
+		clockRate: info.ClockRate,
+	}
+	i.mu.Unlock()
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		n, err := writer.Write(header, payload, attributes)
+		if err != nil {
+			return n, err
+		}
+		i.mu.Lock()
+		if s, ok := i.streams[header.SSRC]; ok {
+			s.stats.PacketsSent++
+			s.stats.BytesSent += uint64(n)
+			if s.stats.Kind == TrackKindVideo && header.Marker {
+				s.stats.FramesSent++
+			}
+		}
+		i.mu.Unlock()
+		return n, nil
+	})
+}
+
+func (i *rtpStatsInterceptor) UnbindLocalStream(info *interceptor.StreamInfo) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.streams, info.SSRC)
+}
+
+func (i *rtpStatsInterceptor) BindRTCPReader(reader interceptor.RTCPReader) interceptor.RTCPReader {
+	return interceptor.RTCPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		n, attr, err := reader.Read(b, a)
+		if err != nil {
+			return 0, nil, err
+		}
+		packets, err := rtcp.Unmarshal(b[:n])
+		if err != nil {
+			// leave broken packets to the following readers
+			return n, attr, nil
+		}
+		i.handleRTCP(packets)
+		return n, attr, nil
+	})
+}
+
+func (i *rtpStatsInterceptor) handleRTCP(packets []rtcp.Packet) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, packet := range packets {
+		switch p := packet.(type) {
+		case *rtcp.ReceiverReport:
+			i.handleReceptionReports(p.Reports)
+		case *rtcp.SenderReport:
+			i.handleReceptionReports(p.Reports)
+		case *rtcp.TransportLayerNack:
+			if s, ok := i.streams[p.MediaSSRC]; ok {
+				s.stats.NACKCount++
+			}
+		case *rtcp.PictureLossIndication:
+			if s, ok := i.streams[p.MediaSSRC]; ok {
+				s.stats.PLICount++
+			}
+		case *rtcp.FullIntraRequest:
+			for _, entry := range p.FIR {
+				if s, ok := i.streams[entry.SSRC]; ok {
+					s.stats.FIRCount++
+				}
+			}
+		}
+	}
+}
+
+func (i *rtpStatsInterceptor) handleReceptionReports(reports []rtcp.ReceptionReport) {
+	for _, report := range reports {
+		s, ok := i.streams[report.SSRC]
+		if !ok {
+			continue
+		}
+		s.stats.PacketsLost = report.TotalLost
+		s.stats.FractionLost = float64(report.FractionLost) / 256.0
+		if s.clockRate > 0 {
+			// jitter is reported in the unit of RTP timestamps
+			s.stats.Jitter = time.Duration(float64(report.Jitter) / float64(s.clockRate) * float64(time.Second))
+		}
+	}
+}
+
+// Streams returns the statistics of the RTP streams in order of SSRC.
+func (i *rtpStatsInterceptor) Streams() []RTPStreamStats {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	streams := make([]RTPStreamStats, 0, len(i.streams))
+	for _, s := range i.streams {
+		streams = append(streams, s.stats)
+	}
+	sort.Slice(streams, func(a, b int) bool { return streams[a].SSRC < streams[b].SSRC })
+	return streams
+}
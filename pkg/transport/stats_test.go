@@ -0,0 +1,179 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewConnStats(t *testing.T) {
+	report := webrtc.StatsReport{
+		"pair-failed": webrtc.ICECandidatePairStats{ID: "pair-failed", State: webrtc.StatsICECandidatePairStateFailed},
+		"pair": webrtc.ICECandidatePairStats{
+			ID:                   "pair",
+			LocalCandidateID:     "local",
+			RemoteCandidateID:    "remote",
+			State:                webrtc.StatsICECandidatePairStateSucceeded,
+			Nominated:            true,
+			BytesSent:            30000,
+			BytesReceived:        2000,
+			CurrentRoundTripTime: 0.025,
+		},
+		"local":  webrtc.ICECandidateStats{ID: "local", CandidateType: webrtc.ICECandidateTypeRelay},
+		"remote": webrtc.ICECandidateStats{ID: "remote", CandidateType: webrtc.ICECandidateTypeSrflx},
+	}
+	now := time.Now()
+	streams := []RTPStreamStats{{SSRC: 1, Kind: TrackKindVideo, BytesSent: 25000, FramesSent: 60, FractionLost: 0.05}}
+	prev := &ConnStats{
+		Timestamp: now.Add(-2 * time.Second),
+		BytesSent: 10000,
+		Streams:   []RTPStreamStats{{SSRC: 1, Kind: TrackKindVideo, BytesSent: 5000, FramesSent: 0}},
+	}
+
+	stats := newConnStats(now, report, streams, prev)
+	assert.Equal(t, "relay", stats.LocalCandidateType)
+	assert.Equal(t, "srflx", stats.RemoteCandidateType)
+	assert.Equal(t, 25*time.Millisecond, stats.RoundTripTime)
+	assert.Equal(t, uint64(30000), stats.BytesSent)
+	assert.Equal(t, 80000, stats.SendBitrate)
+	assert.Equal(t, 8000, stats.RecvBitrate)
+	assert.Equal(t, 80000, stats.Streams[0].Bitrate)
+	assert.Equal(t, 30.0, stats.Streams[0].Framerate)
+	assert.Equal(t, 0.05, stats.PacketLoss())
+
+	// no rates without the previous snapshot
+	stats = newConnStats(now, report, nil, nil)
+	assert.Equal(t, 0, stats.SendBitrate)
+	assert.Equal(t, 0.0, stats.PacketLoss())
+
+	// no candidate pair before connected
+	stats = newConnStats(now, webrtc.StatsReport{}, nil, prev)
+	assert.Equal(t, "", stats.LocalCandidateType)
+	assert.Equal(t, 0, stats.SendBitrate)
+}
+
+func TestRTPStatsInterceptor(t *testing.T) {
+	i := newRTPStatsInterceptor()
+	sink := interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		return header.MarshalSize() + len(payload), nil
+	})
+	writer := i.BindLocalStream(&interceptor.StreamInfo{SSRC: 1, MimeType: "video/VP8", ClockRate: 90000}, sink)
+	i.BindLocalStream(&interceptor.StreamInfo{SSRC: 2, MimeType: "audio/opus", ClockRate: 48000}, sink)
+
+	for seq := 0; seq < 6; seq++ {
+		// a frame in 2 packets
+		_, err := writer.Write(&rtp.Header{SSRC: 1, SequenceNumber: uint16(seq), Marker: seq%2 == 1}, make([]byte, 100), nil)
+		assert.NoError(t, err)
+	}
+	i.handleRTCP([]rtcp.Packet{
+		&rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{
+			{SSRC: 1, FractionLost: 64, TotalLost: 3, Jitter: 900},
+			{SSRC: 3, FractionLost: 128},
+		}},
+		&rtcp.TransportLayerNack{MediaSSRC: 1, Nacks: []rtcp.NackPair{{PacketID: 1}}},
+		&rtcp.PictureLossIndication{MediaSSRC: 1},
+		&rtcp.PictureLossIndication{MediaSSRC: 1},
+		&rtcp.FullIntraRequest{FIR: []rtcp.FIREntry{{SSRC: 1}}},
+	})
+
+	streams := i.Streams()
+	if assert.Len(t, streams, 2) {
+		video := streams[0]
+		assert.Equal(t, uint32(1), video.SSRC)
+		assert.Equal(t, TrackKindVideo, video.Kind)
+		assert.Equal(t, uint64(6), video.PacketsSent)
+		assert.Equal(t, uint64(6*112), video.BytesSent)
+		assert.Equal(t, uint64(3), video.FramesSent)
+		assert.Equal(t, uint32(3), video.PacketsLost)
+		assert.Equal(t, 0.25, video.FractionLost)
+		assert.Equal(t, 10*time.Millisecond, video.Jitter)
+		assert.Equal(t, uint64(1), video.NACKCount)
+		assert.Equal(t, uint64(2), video.PLICount)
+		assert.Equal(t, uint64(1), video.FIRCount)
+		assert.Equal(t, TrackKindAudio, streams[1].Kind)
+	}
+
+	i.UnbindLocalStream(&interceptor.StreamInfo{SSRC: 2})
+	assert.Len(t, i.Streams(), 1)
+}
+
+func TestSubscribeStats(t *testing.T) {
+	streamer := newStreamerConn(t, webrtc.Configuration{})
+	streamer.opts.statsInterval = 100 * time.Millisecond
+	streamerConnected := make(chan struct{})
+	streamer.OnConnect(func() { close(streamerConnected) })
+	player := newPlayerConn(t, webrtc.Configuration{})
+	defer player.PeerConnection().Close()
+	if err := signalPair(player.PeerConnection(), streamer.PeerConnection()); err != nil {
+		t.Fatal(err)
+	}
+	<-streamerConnected
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	video := mustSendTrack(t, streamer, TrackIDVideo)
+	go func() {
+		ticker := time.NewTicker(33 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = video.WriteSample(ctx, MediaSample{Data: []byte{0x65, 0x88, 0x84, 0x00}, Duration: 33 * time.Millisecond})
+			}
+		}
+	}()
+
+	statsCh := streamer.SubscribeStats(ctx)
+	timeout := time.After(10 * time.Second)
+	for {
+		var stats ConnStats
+		select {
+		case stats = <-statsCh:
+		case <-timeout:
+			t.Fatal("timed out waiting for stats of the video stream")
+		}
+		var framesSent uint64
+		for _, stream := range stats.Streams {
+			if stream.Kind == TrackKindVideo {
+				framesSent += stream.FramesSent
+			}
+		}
+		if framesSent > 0 && stats.BytesSent > 0 {
+			assert.Equal(t, "host", stats.LocalCandidateType)
+			break
+		}
+	}
+	latest, ok := streamer.Stats()
+	assert.True(t, ok)
+	assert.False(t, latest.Timestamp.IsZero())
+
+	// the subscription ends with the connection
+	assert.NoError(t, streamer.PeerConnection().Close())
+	select {
+	case _, ok := <-drain(statsCh):
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the subscription to be closed")
+	}
+	_, ok = <-streamer.SubscribeStats(context.Background())
+	assert.False(t, ok)
+}
+
+// drain returns a channel closed when the stats channel is closed.
+func drain(ch <-chan ConnStats) <-chan ConnStats {
+	done := make(chan ConnStats)
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	return done
+}
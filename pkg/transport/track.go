@@ -0,0 +1,159 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+)
+
+type TrackKind string
+
+const (
+	TrackKindVideo TrackKind = "video"
+	TrackKindAudio TrackKind = "audio"
+)
+
+const (
+	// TrackIDVideo is the main video of the game.
+	TrackIDVideo = "video"
+	// TrackIDAudio is the main audio of the game.
+	TrackIDAudio = "audio"
+	// TrackIDVideoLow is a low-resolution video for thumbnails and spectators.
+	// It is an independent track rather than a simulcast layer of the main video, and nothing switches players between them.
+	// Simulcast is not supported because the pion version we use cannot send RID-based simulcast.
+	TrackIDVideoLow = "video-low"
+	// TrackIDMicrophone is the audio from the microphone of the player.
+	TrackIDMicrophone = "microphone"
+)
+
+// TrackSpec declares a track of a stream.
+// Tracks are declared before the negotiation, because they cannot be added to a negotiated stream.
+type TrackSpec struct {
+	ID   string
+	Kind TrackKind
+}
+
+var defaultSendTracks = []TrackSpec{
+	{ID: TrackIDVideo, Kind: TrackKindVideo},
+	{ID: TrackIDAudio, Kind: TrackKindAudio},
+}
+
+// SendTrack is a track sending media samples to the remote peer.
+type SendTrack interface {
+	ID() string
+	Kind() TrackKind
+	// Codec returns the MIME type of the codec negotiated with the remote peer (e.g. "video/VP8").
+	Codec() (string, error)
+	WriteSample(ctx context.Context, sample MediaSample) error
+}
+
+// RecvTrack is a track receiving media samples from the remote peer.
+type RecvTrack interface {
+	ID() string
+	Kind() TrackKind
+	// Codec returns the MIME type of the codec (e.g. "audio/opus").
+	Codec() string
+	// ReadSample blocks until a sample arrives or the connection is closed.
+	ReadSample() (MediaSample, error)
+}
+
+// VideoCodecFromMimeType returns the video codec of the MIME type returned by SendTrack.Codec.
+func VideoCodecFromMimeType(mimeType string) (VideoCodec, error) {
+	if !strings.HasPrefix(strings.ToLower(mimeType), "video/") {
+		return "", fmt.Errorf("not a video codec: %s", mimeType)
+	}
+	return ParseVideoCodec(mimeType[len("video/"):])
+}
+
+func trackKind(kind webrtc.RTPCodecType) TrackKind {
+	if kind == webrtc.RTPCodecTypeVideo {
+		return TrackKindVideo
+	}
+	return TrackKindAudio
+}
+
+// localSampleTrack is a local track of pion writing samples.
+type localSampleTrack interface {
+	webrtc.TrackLocal
+	WriteSample(sample MediaSample) error
+	mimeType() (string, error)
+	senderReport(clock *mediaClock, now time.Time) (rtcp.SenderReport, bool)
+}
+
+// sendTrack adapts a local track of pion to SendTrack.
+type sendTrack struct {
+	local localSampleTrack
+}
+
+func (t *sendTrack) ID() string {
+	return t.local.ID()
+}
+
+func (t *sendTrack) Kind() TrackKind {
+	return trackKind(t.local.Kind())
+}
+
+func (t *sendTrack) Codec() (string, error) {
+	return t.local.mimeType()
+}
+
+func (t *sendTrack) WriteSample(ctx context.Context, sample MediaSample) error {
+	return t.local.WriteSample(sample)
+}
+
+// recvTrack reads samples from a remote track of pion.
+// Only Opus is supported, whose RTP packet carries exactly one sample.
+type recvTrack struct {
+	id            string
+	remote        *webrtc.TrackRemote
+	lastTimestamp uint32
+	started       bool
+	mu            sync.Mutex
+}
+
+func newRecvTrack(id string, remote *webrtc.TrackRemote) *recvTrack {
+	return &recvTrack{id: id, remote: remote}
+}
+
+func (t *recvTrack) ID() string {
+	return t.id
+}
+
+func (t *recvTrack) Kind() TrackKind {
+	return trackKind(t.remote.Kind())
+}
+
+func (t *recvTrack) Codec() string {
+	return t.remote.Codec().MimeType
+}
+
+func (t *recvTrack) ReadSample() (MediaSample, error) {
+	codec := t.remote.Codec()
+	if !strings.EqualFold(codec.MimeType, webrtc.MimeTypeOpus) {
+		return MediaSample{}, fmt.Errorf("reading samples of %s is not supported", codec.MimeType)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		p, _, err := t.remote.ReadRTP()
+		if err != nil {
+			return MediaSample{}, err
+		}
+		if len(p.Payload) == 0 {
+			continue
+		}
+		// the duration is known from the previous packet
+		var duration time.Duration
+		if t.started && codec.ClockRate > 0 {
+			duration = time.Duration(p.Timestamp-t.lastTimestamp) * time.Second / time.Duration(codec.ClockRate)
+		}
+		t.started = true
+		t.lastTimestamp = p.Timestamp
+		return MediaSample{Data: p.Payload, Duration: duration}, nil
+	}
+}
@@ -2,72 +2,122 @@ package transport
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
 	"github.com/pkg/errors"
 
 	"github.com/tevino/abool"
 
 	"github.com/pion/webrtc/v3"
-	"github.com/pion/webrtc/v3/pkg/media"
 )
 
 type WebRTCConn struct {
 	cid          string
 	pc           *webrtc.PeerConnection
-	dc           *webrtc.DataChannel
-	dcMu         sync.Mutex
-	onMessage    func([]byte)
+	opts         *connOptions
+	channels     map[DataChannelPurpose]*webRTCDataChannel
 	onConnect    func()
 	onDisconnect func()
 	connected    *abool.AtomicBool
 	callbackMu   sync.Mutex
-}
 
-type dataChannelFactory struct {
-	onOpen func(dc *webrtc.DataChannel)
-	mu     sync.Mutex
+	// whether the local peer sent the first offer
+	weOffer        bool
+	renegotiator   Renegotiator
+	restartAttempt int
+	restartTimer   *time.Timer
+	restartMu      sync.Mutex
+	disconnectOnce sync.Once
+	disconnected   chan struct{}
+
+	// rtpStats and senderReports are nil without RTP streams to send
+	rtpStats         *rtpStatsInterceptor
+	senderReports    func(now time.Time) []rtcp.Packet
+	stats            *ConnStats
+	statsSubscribers map[chan ConnStats]struct{}
+	statsClosed      bool
+	statsMu          sync.Mutex
 }
 
-func (f *dataChannelFactory) OnOpen(onOpen func(dc *webrtc.DataChannel)) {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	f.onOpen = onOpen
+const (
+	defaultMaxICERestarts    = 2
+	defaultICERestartTimeout = 15 * time.Second
+	senderReportInterval     = time.Second
+)
+
+type connOptions struct {
+	maxICERestarts    int
+	iceRestartTimeout time.Duration
+	statsInterval     time.Duration
 }
 
-func (f *dataChannelFactory) Open(dc *webrtc.DataChannel) {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	if f.onOpen != nil {
-		f.onOpen(dc)
+func defaultConnOptions() *connOptions {
+	return &connOptions{
+		maxICERestarts:    defaultMaxICERestarts,
+		iceRestartTimeout: defaultICERestartTimeout,
+		statsInterval:     defaultStatsInterval,
 	}
 }
 
-func NewWebRTCConn(cid string, pc *webrtc.PeerConnection) (*WebRTCConn, error) {
+type ConnOption interface {
+	apply(opts *connOptions)
+}
+
+type ConnOptionFunc func(*connOptions)
+
+func (f ConnOptionFunc) apply(opts *connOptions) {
+	f(opts)
+}
+
+// WithICERestart sets how many times ICE is restarted when the connection fails before reporting disconnection,
+// and how long to wait for the connection to be restored by each restart.
+// Zero maxAttempts reports disconnection on the first failure.
+func WithICERestart(maxAttempts int, timeout time.Duration) ConnOption {
+	return ConnOptionFunc(func(opts *connOptions) {
+		opts.maxICERestarts = maxAttempts
+		opts.iceRestartTimeout = timeout
+	})
+}
+
+// Renegotiator exchanges another offer and answer with the remote peer through the established signaling (e.g. for an ICE restart).
+type Renegotiator interface {
+	Renegotiate(ctx context.Context, options *webrtc.OfferOptions) error
+}
+
+// NewWebRTCConn wraps the peer connection with the data channels of all the purposes.
+// The channels are opened by the peer sending the first offer, and the connection is ready when the control channel opens.
+// A Disconnected ICE connection is expected to recover by itself, and a Failed one is restarted by renegotiation
+// (see SetRenegotiator and WithICERestart). OnDisconnect is called when the restarts are exhausted or the connection is closed.
+func NewWebRTCConn(cid string, pc *webrtc.PeerConnection, options ...ConnOption) (*WebRTCConn, error) {
+	opts := defaultConnOptions()
+	for _, opt := range options {
+		opt.apply(opts)
+	}
 	conn := &WebRTCConn{
-		cid:       cid,
-		pc:        pc,
-		connected: abool.New(),
+		cid:              cid,
+		pc:               pc,
+		opts:             opts,
+		connected:        abool.New(),
+		disconnected:     make(chan struct{}),
+		statsSubscribers: make(map[chan ConnStats]struct{}),
+		channels:         make(map[DataChannelPurpose]*webRTCDataChannel),
+	}
+	for _, purpose := range dataChannelPurposes {
+		conn.channels[purpose] = newWebRTCDataChannel(purpose)
 	}
 
-	// WebRTCConn will be ready when both ICE and DataChannel are ready
+	// WebRTCConn will be ready when both ICE and the control channel are ready,
+	// or when ICE is ready if the session has no data channels (e.g. standard WHEP clients)
 	var wg sync.WaitGroup
 	wg.Add(2)
-	dcf := &dataChannelFactory{}
-	dcf.OnOpen(func(dc *webrtc.DataChannel) {
+	ready := func() {
 		wg.Done()
-		conn.dcMu.Lock()
-		conn.dc = dc
-		conn.dcMu.Unlock()
-		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-			conn.callbackMu.Lock()
-			h := conn.onMessage
-			conn.callbackMu.Unlock()
-			if h != nil {
-				h(msg.Data)
-			}
-		})
 		wg.Wait()
 		conn.connected.Set()
 		conn.callbackMu.Lock()
@@ -76,12 +126,40 @@ func NewWebRTCConn(cid string, pc *webrtc.PeerConnection) (*WebRTCConn, error) {
 		if h != nil {
 			h()
 		}
-	})
-
-	dcOffer, err := pc.CreateDataChannel("data", nil)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create data channel")
 	}
+	open := func(purpose DataChannelPurpose, dc *webrtc.DataChannel) {
+		log.Printf("[%s] data channel opened: %s", conn.cid, purpose)
+		conn.channels[purpose].attach(dc)
+		if purpose != DataChannelControl {
+			return
+		}
+		ready()
+	}
+	// both peers create the channels before knowing which peer offers, and the channels of the answerer are left unused
+	for _, purpose := range dataChannelPurposes {
+		purpose := purpose
+		dc, err := pc.CreateDataChannel(string(purpose), dataChannelInit(purpose))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create data channel: %s", purpose)
+		}
+		dc.OnOpen(func() {
+			if conn.offerer() {
+				open(purpose, dc)
+			}
+		})
+	}
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		purpose := DataChannelPurpose(dc.Label())
+		if _, ok := conn.channels[purpose]; !ok {
+			log.Printf("[%s] ignored unknown data channel: %s", conn.cid, dc.Label())
+			return
+		}
+		dc.OnOpen(func() {
+			if !conn.offerer() {
+				open(purpose, dc)
+			}
+		})
+	})
 	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		log.Printf("[%s] connection state has changed: %s", conn.cid, state)
 	})
@@ -91,34 +169,151 @@ func NewWebRTCConn(cid string, pc *webrtc.PeerConnection) (*WebRTCConn, error) {
 	pc.OnSignalingStateChange(func(state webrtc.SignalingState) {
 		log.Printf("[%s] signaling state has changed: %s", conn.cid, state)
 	})
+	// ICE goes to Checking and Connected again on every ICE restart
+	var checkingOnce, connectedOnce sync.Once
 	pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
 		log.Printf("[%s] ICE connection state has changed: %s", conn.cid, state)
 		switch state {
 		case webrtc.ICEConnectionStateChecking:
-			weOffer := pc.RemoteDescription().Type == webrtc.SDPTypeAnswer
-			if weOffer {
-				dcf.Open(dcOffer)
-			} else {
-				pc.OnDataChannel(func(dc *webrtc.DataChannel) {
-					dc.OnOpen(func() {
-						dcf.Open(dc)
-					})
-				})
-			}
+			checkingOnce.Do(func() {
+				weOffer := pc.RemoteDescription().Type == webrtc.SDPTypeAnswer
+				conn.restartMu.Lock()
+				conn.weOffer = weOffer
+				conn.restartMu.Unlock()
+			})
 		case webrtc.ICEConnectionStateConnected:
-			wg.Done()
-		case webrtc.ICEConnectionStateDisconnected, webrtc.ICEConnectionStateFailed, webrtc.ICEConnectionStateClosed:
-			conn.callbackMu.Lock()
-			f := conn.onDisconnect
-			conn.callbackMu.Unlock()
-			if f != nil {
-				f()
-			}
+			connectedOnce.Do(func() {
+				wg.Done()
+				if !hasApplicationSection(pc.RemoteDescription()) {
+					log.Printf("[%s] no data channels are negotiated", conn.cid)
+					go ready()
+				}
+				go conn.collectStats()
+				if conn.senderReports != nil {
+					go conn.sendSenderReports()
+				}
+			})
+			conn.iceRestored()
+		case webrtc.ICEConnectionStateDisconnected:
+			// a transient loss of connectivity (e.g. switching networks) recovers by itself, or ICE goes to Failed
+		case webrtc.ICEConnectionStateFailed:
+			conn.iceFailed()
+		case webrtc.ICEConnectionStateClosed:
+			conn.disconnect()
 		}
 	})
 	return conn, nil
 }
 
+// hasApplicationSection reports whether the session description has an accepted media section of data channels.
+func hasApplicationSection(desc *webrtc.SessionDescription) bool {
+	if desc == nil {
+		return false
+	}
+	for _, line := range strings.Split(desc.SDP, "\n") {
+		fields := strings.Fields(line)
+		// a rejected media section has port 0
+		if len(fields) >= 2 && fields[0] == "m=application" && fields[1] != "0" {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRenegotiator enables the local peer to restart ICE when the connection fails.
+// Without it, the local peer waits for the remote peer to restart ICE.
+func (c *WebRTCConn) SetRenegotiator(r Renegotiator) {
+	c.restartMu.Lock()
+	defer c.restartMu.Unlock()
+	c.renegotiator = r
+}
+
+// offerer reports whether the local peer sent the first offer, which is known when ICE starts checking.
+func (c *WebRTCConn) offerer() bool {
+	c.restartMu.Lock()
+	defer c.restartMu.Unlock()
+	return c.weOffer
+}
+
+func (c *WebRTCConn) iceFailed() {
+	c.restartMu.Lock()
+	defer c.restartMu.Unlock()
+	if c.restartTimer != nil {
+		c.restartTimer.Stop()
+		c.restartTimer = nil
+	}
+	if c.restartAttempt >= c.opts.maxICERestarts {
+		log.Printf("[%s] ICE connection failed after %d restart attempts", c.cid, c.restartAttempt)
+		go c.disconnect()
+		return
+	}
+	c.restartAttempt++
+	attempt := c.restartAttempt
+	log.Printf("[%s] ICE connection failed, restarting ICE (attempt: %d/%d)", c.cid, attempt, c.opts.maxICERestarts)
+	c.restartTimer = time.AfterFunc(c.opts.iceRestartTimeout, func() {
+		c.restartMu.Lock()
+		timedOut := c.restartAttempt == attempt && c.restartTimer != nil
+		c.restartMu.Unlock()
+		if timedOut {
+			log.Printf("[%s] ICE restart timed out (attempt: %d)", c.cid, attempt)
+			c.iceFailed()
+		}
+	})
+	if c.renegotiator != nil {
+		go c.restartICE(attempt, c.renegotiator, c.weOffer)
+	}
+}
+
+func (c *WebRTCConn) restartICE(attempt int, r Renegotiator, weOffer bool) {
+	if !weOffer {
+		// the remote peer which sent the first offer is given a chance to restart ICE first,
+		// so that both peers don't send offers at the same time
+		time.Sleep(c.opts.iceRestartTimeout / 3)
+		c.restartMu.Lock()
+		current := c.restartAttempt == attempt && c.restartTimer != nil
+		c.restartMu.Unlock()
+		if !current || c.pc.SignalingState() != webrtc.SignalingStateStable {
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.iceRestartTimeout)
+	defer cancel()
+	if err := r.Renegotiate(ctx, &webrtc.OfferOptions{ICERestart: true}); err != nil {
+		log.Printf("[%s] failed to renegotiate for ICE restart: %+v", c.cid, err)
+	}
+}
+
+func (c *WebRTCConn) iceRestored() {
+	c.restartMu.Lock()
+	defer c.restartMu.Unlock()
+	if c.restartTimer != nil {
+		c.restartTimer.Stop()
+		c.restartTimer = nil
+	}
+	if c.restartAttempt > 0 {
+		log.Printf("[%s] ICE connection restored by restart (attempt: %d)", c.cid, c.restartAttempt)
+		c.restartAttempt = 0
+	}
+}
+
+func (c *WebRTCConn) disconnect() {
+	c.disconnectOnce.Do(func() {
+		c.restartMu.Lock()
+		if c.restartTimer != nil {
+			c.restartTimer.Stop()
+			c.restartTimer = nil
+		}
+		c.restartMu.Unlock()
+		close(c.disconnected)
+		c.callbackMu.Lock()
+		f := c.onDisconnect
+		c.callbackMu.Unlock()
+		if f != nil {
+			f()
+		}
+	})
+}
+
 func (c *WebRTCConn) PeerConnection() *webrtc.PeerConnection {
 	return c.pc
 }
@@ -139,70 +334,384 @@ func (c *WebRTCConn) OnDisconnect(f func()) {
 	c.onDisconnect = f
 }
 
+// SendMessage sends the message on the control channel.
 func (c *WebRTCConn) SendMessage(ctx context.Context, data []byte) error {
 	if c.connected.IsNotSet() {
 		return errors.New("not connected")
 	}
-	c.dcMu.Lock()
-	defer c.dcMu.Unlock()
-	return c.dc.Send(data)
+	return c.channels[DataChannelControl].Send(ctx, data)
 }
 
+// OnMessage sets a handler of messages on the control channel.
 func (c *WebRTCConn) OnMessage(f func(data []byte)) {
-	c.callbackMu.Lock()
-	defer c.callbackMu.Unlock()
-	c.onMessage = f
+	c.channels[DataChannelControl].OnMessage(f)
+}
+
+// DataChannel returns the data channel for the purpose.
+func (c *WebRTCConn) DataChannel(purpose DataChannelPurpose) (DataChannel, bool) {
+	ch, ok := c.channels[purpose]
+	if !ok {
+		return nil, false
+	}
+	return ch, true
 }
 
 type WebRTCStreamerConn struct {
 	*WebRTCConn
-	videoTrack *webrtc.TrackLocalStaticSample
-	audioTrack *webrtc.TrackLocalStaticSample
+	sendTracks        []*sendTrack
+	recvTrackSpecs    map[*webrtc.RTPReceiver]TrackSpec
+	bwe               *bandwidthEstimator
+	onKeyframeRequest func(trackID string)
+	onRecvTrack       func(track RecvTrack)
 }
 
-func NewWebRTCStreamerConn(wc webrtc.Configuration) (*WebRTCStreamerConn, error) {
-	pc, err := webrtc.NewPeerConnection(wc)
+type streamerOptions struct {
+	videoCodecs []VideoCodec
+	// nil means all the codecs of supportedVideoCodecs
+	supportedVideoCodecs []VideoCodec
+	sendTracks           []TrackSpec
+	recvTracks           []TrackSpec
+}
+
+// sendableVideoCodecs returns the video codecs both we and the local encoder support, in order of our preference.
+func (o *streamerOptions) sendableVideoCodecs() []VideoCodec {
+	if o.supportedVideoCodecs == nil {
+		return supportedVideoCodecs
+	}
+	var codecs []VideoCodec
+	for _, codec := range supportedVideoCodecs {
+		if containsVideoCodec(o.supportedVideoCodecs, codec) {
+			codecs = append(codecs, codec)
+		}
+	}
+	return codecs
+}
+
+func defaultStreamerOptions() *streamerOptions {
+	return &streamerOptions{
+		sendTracks: defaultSendTracks,
+	}
+}
+
+type StreamerOption interface {
+	apply(opts *streamerOptions)
+}
+
+type StreamerOptionFunc func(*streamerOptions)
+
+func (f StreamerOptionFunc) apply(opts *streamerOptions) {
+	f(opts)
+}
+
+// WithVideoCodecs restricts the video codecs to send in order of preference.
+// By default, the video codec is selected in order of the remote peer's preference.
+func WithVideoCodecs(codecs ...VideoCodec) StreamerOption {
+	return StreamerOptionFunc(func(opts *streamerOptions) {
+		opts.videoCodecs = codecs
+	})
+}
+
+// WithSupportedVideoCodecs limits the video codecs to send to the ones the local encoder supports,
+// so that another codec is selected when the remote peer prefers an unsupported one.
+// By default, all the video codecs are supposed to be supported.
+func WithSupportedVideoCodecs(codecs ...VideoCodec) StreamerOption {
+	return StreamerOptionFunc(func(opts *streamerOptions) {
+		// empty but non-nil to support nothing
+		opts.supportedVideoCodecs = append([]VideoCodec{}, codecs...)
+	})
+}
+
+// WithSendTracks replaces the tracks sent to the remote peer.
+// By default, a video track (TrackIDVideo) and an audio track (TrackIDAudio) are sent.
+func WithSendTracks(tracks ...TrackSpec) StreamerOption {
+	return StreamerOptionFunc(func(opts *streamerOptions) {
+		opts.sendTracks = tracks
+	})
+}
+
+// WithRecvTracks adds tracks received from the remote peer (e.g. TrackIDMicrophone).
+// A received track shares the transceiver of a sent track of the same kind if any,
+// so that the remote peer can send it on a sendrecv transceiver (e.g. the microphone on the audio transceiver).
+func WithRecvTracks(tracks ...TrackSpec) StreamerOption {
+	return StreamerOptionFunc(func(opts *streamerOptions) {
+		opts.recvTracks = tracks
+	})
+}
+
+func NewWebRTCStreamerConn(wc webrtc.Configuration, options ...StreamerOption) (*WebRTCStreamerConn, error) {
+	opts := defaultStreamerOptions()
+	for _, opt := range options {
+		opt.apply(opts)
+	}
+	bwe := newBandwidthEstimator()
+	rtpStats := newRTPStatsInterceptor()
+	api, err := newStreamerAPI(bwe, rtpStats)
 	if err != nil {
 		return nil, err
 	}
-	videoTrack, err := newVideoTrack()
+	pc, err := api.NewPeerConnection(wc)
 	if err != nil {
 		return nil, err
 	}
-	audioTrack, err := newAudioTrack()
+	if err := validateTrackSpecs(append(append([]TrackSpec{}, opts.sendTracks...), opts.recvTracks...)); err != nil {
+		return nil, err
+	}
+	var tracks []*sendTrack
+	var senders []*webrtc.RTPSender
+	for _, spec := range opts.sendTracks {
+		var local localSampleTrack
+		switch spec.Kind {
+		case TrackKindVideo:
+			local = newVideoTrack(spec.ID, opts.videoCodecs, opts.sendableVideoCodecs())
+		case TrackKindAudio:
+			local, err = newAudioTrack(spec.ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sender, err := pc.AddTrack(local)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, &sendTrack{local: local})
+		senders = append(senders, sender)
+	}
+	recvTrackSpecs := make(map[*webrtc.RTPReceiver]TrackSpec)
+	paired := make(map[*webrtc.RTPSender]struct{})
+	for _, spec := range opts.recvTracks {
+		var receiver *webrtc.RTPReceiver
+		for i, sender := range senders {
+			if _, ok := paired[sender]; ok || tracks[i].Kind() != spec.Kind {
+				continue
+			}
+			if transceiver := transceiverOf(pc, sender); transceiver != nil {
+				paired[sender] = struct{}{}
+				receiver = transceiver.Receiver()
+				break
+			}
+		}
+		if receiver == nil {
+			kind := webrtc.RTPCodecTypeAudio
+			if spec.Kind == TrackKindVideo {
+				kind = webrtc.RTPCodecTypeVideo
+			}
+			transceiver, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+			if err != nil {
+				return nil, err
+			}
+			receiver = transceiver.Receiver()
+		}
+		recvTrackSpecs[receiver] = spec
+	}
+	conn, err := NewWebRTCConn("streamer", pc)
 	if err != nil {
 		return nil, err
 	}
-	if _, err := pc.AddTrack(videoTrack); err != nil {
+	conn.rtpStats = rtpStats
+	sc := &WebRTCStreamerConn{
+		WebRTCConn:     conn,
+		sendTracks:     tracks,
+		recvTrackSpecs: recvTrackSpecs,
+		bwe:            bwe,
+	}
+	clock := &mediaClock{}
+	conn.senderReports = func(now time.Time) []rtcp.Packet {
+		return sc.senderReports(clock, now)
+	}
+	for i, sender := range senders {
+		go sc.readRTCP(sender, tracks[i].ID())
+	}
+	pc.OnTrack(sc.handleRemoteTrack)
+	return sc, nil
+}
+
+func transceiverOf(pc *webrtc.PeerConnection, sender *webrtc.RTPSender) *webrtc.RTPTransceiver {
+	for _, transceiver := range pc.GetTransceivers() {
+		if transceiver.Sender() == sender {
+			return transceiver
+		}
+	}
+	return nil
+}
+
+func validateTrackSpecs(specs []TrackSpec) error {
+	ids := make(map[string]struct{})
+	for _, spec := range specs {
+		if spec.Kind != TrackKindVideo && spec.Kind != TrackKindAudio {
+			return fmt.Errorf("unknown kind of track %s: %s", spec.ID, spec.Kind)
+		}
+		if _, ok := ids[spec.ID]; ok {
+			return fmt.Errorf("duplicated track ID: %s", spec.ID)
+		}
+		ids[spec.ID] = struct{}{}
+	}
+	return nil
+}
+
+// newStreamerAPI is the same as the default API of webrtc.NewPeerConnection with AV1, bandwidth estimation and RTP stats.
+func newStreamerAPI(bwe *bandwidthEstimator, rtpStats *rtpStatsInterceptor) (*webrtc.API, error) {
+	m := &webrtc.MediaEngine{}
+	if err := m.RegisterDefaultCodecs(); err != nil {
 		return nil, err
 	}
-	if _, err := pc.AddTrack(audioTrack); err != nil {
+	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:  VideoCodecAV1.mimeType(),
+			ClockRate: 90000,
+			// same as the other video codecs of RegisterDefaultCodecs
+			RTCPFeedback: []webrtc.RTCPFeedback{{Type: "goog-remb"}, {Type: "ccm", Parameter: "fir"}, {Type: "nack"}, {Type: "nack", Parameter: "pli"}},
+		},
+		PayloadType: av1PayloadType,
+	}, webrtc.RTPCodecTypeVideo); err != nil {
 		return nil, err
 	}
-	conn, err := NewWebRTCConn("streamer", pc)
-	if err != nil {
+	i := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(m, i); err != nil {
 		return nil, err
 	}
-	return &WebRTCStreamerConn{
-		WebRTCConn: conn,
-		videoTrack: videoTrack,
-		audioTrack: audioTrack,
-	}, nil
+	i.Add(bwe)
+	i.Add(rtpStats)
+	return webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(i)), nil
+}
+
+// OnBandwidthEstimate sets a handler called when the estimated bandwidth is updated by RTCP feedback from the remote peer.
+func (c *WebRTCStreamerConn) OnBandwidthEstimate(f func(estimate BandwidthEstimate)) {
+	c.bwe.OnEstimate(f)
+}
+
+// OnKeyframeRequest sets a handler called when the remote peer requests a keyframe of the track by RTCP PLI or FIR.
+func (c *WebRTCStreamerConn) OnKeyframeRequest(f func(trackID string)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.onKeyframeRequest = f
+}
+
+// OnRecvTrack sets a handler called when the remote peer starts sending a track declared by WithRecvTracks.
+func (c *WebRTCStreamerConn) OnRecvTrack(f func(track RecvTrack)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.onRecvTrack = f
+}
+
+func (c *WebRTCStreamerConn) handleRemoteTrack(remote *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+	spec, ok := c.recvTrackSpecs[receiver]
+	if !ok {
+		log.Printf("[%s] ignored undeclared remote track (kind: %s, id: %s)", c.cid, remote.Kind(), remote.ID())
+		return
+	}
+	c.callbackMu.Lock()
+	h := c.onRecvTrack
+	c.callbackMu.Unlock()
+	if h != nil {
+		h(newRecvTrack(spec.ID, remote))
+	}
+}
+
+func (c *WebRTCStreamerConn) readRTCP(sender *webrtc.RTPSender, trackID string) {
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, packet := range packets {
+			switch packet.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				c.callbackMu.Lock()
+				h := c.onKeyframeRequest
+				c.callbackMu.Unlock()
+				if h != nil {
+					h(trackID)
+				}
+			}
+		}
+	}
+}
+
+// senderReports returns the RTCP sender reports of the tracks sending packets.
+// All the tracks share the clock, so that the remote peer plays video and audio in sync.
+func (c *WebRTCStreamerConn) senderReports(clock *mediaClock, now time.Time) []rtcp.Packet {
+	var packets []rtcp.Packet
+	for _, t := range c.sendTracks {
+		if sr, ok := t.local.senderReport(clock, now); ok {
+			packets = append(packets, &sr)
+		}
+	}
+	return packets
+}
+
+// sendSenderReports sends RTCP sender reports periodically, as the pion version we use sends none.
+func (c *WebRTCConn) sendSenderReports() {
+	ticker := time.NewTicker(senderReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.disconnected:
+			return
+		case now := <-ticker.C:
+			packets := c.senderReports(now)
+			if len(packets) == 0 {
+				continue
+			}
+			if err := c.pc.WriteRTCP(packets); err != nil {
+				log.Printf("[%s] failed to send RTCP sender reports: %+v", c.cid, err)
+			}
+		}
+	}
 }
 
-func (c *WebRTCStreamerConn) SendVideoSample(ctx context.Context, sample MediaSample) error {
-	return c.videoTrack.WriteSample(media.Sample{Data: sample.Data, Duration: sample.Duration})
+// SendTracks returns the tracks sent to the remote peer in order of WithSendTracks.
+func (c *WebRTCStreamerConn) SendTracks() []SendTrack {
+	tracks := make([]SendTrack, len(c.sendTracks))
+	for i, t := range c.sendTracks {
+		tracks[i] = t
+	}
+	return tracks
 }
 
-func (c *WebRTCStreamerConn) SendAudioSample(ctx context.Context, sample MediaSample) error {
-	return c.audioTrack.WriteSample(media.Sample{Data: sample.Data, Duration: sample.Duration})
+// SendTrack returns the track sent to the remote peer by ID.
+func (c *WebRTCStreamerConn) SendTrack(id string) (SendTrack, bool) {
+	for _, t := range c.sendTracks {
+		if t.ID() == id {
+			return t, true
+		}
+	}
+	return nil, false
 }
 
 type WebRTCPlayerConn struct {
 	*WebRTCConn
 }
 
-func NewWebRTCPlayerConn(wc webrtc.Configuration) (*WebRTCPlayerConn, error) {
+type playerOptions struct {
+	microphone webrtc.TrackLocal
+}
+
+func defaultPlayerOptions() *playerOptions {
+	return &playerOptions{}
+}
+
+type PlayerOption interface {
+	apply(opts *playerOptions)
+}
+
+type PlayerOptionFunc func(*playerOptions)
+
+func (f PlayerOptionFunc) apply(opts *playerOptions) {
+	f(opts)
+}
+
+// WithMicrophone sends the audio track to the streamer on the sendrecv audio transceiver.
+func WithMicrophone(track webrtc.TrackLocal) PlayerOption {
+	return PlayerOptionFunc(func(opts *playerOptions) {
+		opts.microphone = track
+	})
+}
+
+func NewWebRTCPlayerConn(wc webrtc.Configuration, options ...PlayerOption) (*WebRTCPlayerConn, error) {
+	opts := defaultPlayerOptions()
+	for _, opt := range options {
+		opt.apply(opts)
+	}
 	pc, err := webrtc.NewPeerConnection(wc)
 	if err != nil {
 		return nil, err
@@ -210,8 +719,14 @@ func NewWebRTCPlayerConn(wc webrtc.Configuration) (*WebRTCPlayerConn, error) {
 	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
 		return nil, err
 	}
-	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
-		return nil, err
+	if opts.microphone != nil {
+		if _, err := pc.AddTransceiverFromTrack(opts.microphone, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendrecv}); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+			return nil, err
+		}
 	}
 	conn, err := NewWebRTCConn("player", pc)
 	if err != nil {
@@ -2,15 +2,27 @@ package transport
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/pion/logging"
+	"github.com/pion/rtcp"
+	"github.com/pion/transport/vnet"
 	"github.com/stretchr/testify/assert"
+	"github.com/tevino/abool"
 
 	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
 )
 
 func signalPair(pcOffer, pcAnswer *webrtc.PeerConnection) error {
-	offer, err := pcOffer.CreateOffer(nil)
+	return negotiate(pcOffer, pcAnswer, nil)
+}
+
+func negotiate(pcOffer, pcAnswer *webrtc.PeerConnection, options *webrtc.OfferOptions) error {
+	offer, err := pcOffer.CreateOffer(options)
 	if err != nil {
 		return err
 	}
@@ -43,6 +55,14 @@ func newStreamerConn(t *testing.T, wc webrtc.Configuration) *WebRTCStreamerConn
 	return streamer
 }
 
+func mustSendTrack(t *testing.T, streamer *WebRTCStreamerConn, id string) SendTrack {
+	track, ok := streamer.SendTrack(id)
+	if !ok {
+		t.Fatalf("track not found: %s", id)
+	}
+	return track
+}
+
 func newPlayerConn(t *testing.T, wc webrtc.Configuration) *WebRTCPlayerConn {
 	player, err := NewWebRTCPlayerConn(wc)
 	if err != nil {
@@ -113,3 +133,565 @@ func TestMessaging(t *testing.T) {
 	}
 
 }
+
+func TestKeyframeRequest(t *testing.T) {
+	streamer, player := signalStreamerPlayer(t, webrtc.Configuration{}, true)
+	keyframeRequested := make(chan struct{})
+	var once sync.Once
+	streamer.OnKeyframeRequest(func(trackID string) {
+		assert.Equal(t, TrackIDVideo, trackID)
+		once.Do(func() { close(keyframeRequested) })
+	})
+	videoSSRC := make(chan webrtc.SSRC, 1)
+	player.PeerConnection().OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		if track.Kind() == webrtc.RTPCodecTypeVideo {
+			videoSSRC <- track.SSRC()
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	video := mustSendTrack(t, streamer, TrackIDVideo)
+	go func() {
+		ticker := time.NewTicker(33 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = video.WriteSample(ctx, MediaSample{Data: []byte{0x65, 0x88, 0x84, 0x00}, Duration: 33 * time.Millisecond})
+			}
+		}
+	}()
+
+	var ssrc webrtc.SSRC
+	select {
+	case ssrc = <-videoSSRC:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for video track")
+	}
+	err := player.PeerConnection().WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(ssrc)}})
+	assert.NoError(t, err)
+	select {
+	case <-keyframeRequested:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for keyframe request")
+	}
+}
+
+func TestVideoCodecNegotiation(t *testing.T) {
+	tcs := []struct {
+		name          string
+		videoCodecs   []VideoCodec
+		isPlayerOffer bool
+		expected      VideoCodec
+	}{
+		// pion prefers VP8 by default
+		{name: "RemotePreference", videoCodecs: nil, isPlayerOffer: true, expected: VideoCodecVP8},
+		{name: "StreamerPreferenceH264", videoCodecs: []VideoCodec{VideoCodecH264}, isPlayerOffer: true, expected: VideoCodecH264},
+		// the player of pion does not support AV1
+		{name: "StreamerPreferenceVP9", videoCodecs: []VideoCodec{VideoCodecAV1, VideoCodecVP9}, isPlayerOffer: false, expected: VideoCodecVP9},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			streamer, err := NewWebRTCStreamerConn(webrtc.Configuration{}, WithVideoCodecs(tc.videoCodecs...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			player := newPlayerConn(t, webrtc.Configuration{})
+			receivedCodec := make(chan string, 1)
+			player.PeerConnection().OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+				if track.Kind() == webrtc.RTPCodecTypeVideo {
+					receivedCodec <- track.Codec().MimeType
+				}
+			})
+			if tc.isPlayerOffer {
+				err = signalPair(player.PeerConnection(), streamer.PeerConnection())
+			} else {
+				err = signalPair(streamer.PeerConnection(), player.PeerConnection())
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			video := mustSendTrack(t, streamer, TrackIDVideo)
+			go func() {
+				ticker := time.NewTicker(33 * time.Millisecond)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+						_ = video.WriteSample(ctx, MediaSample{Data: []byte{0x00, 0x01, 0x02, 0x03}, Duration: 33 * time.Millisecond})
+					}
+				}
+			}()
+			select {
+			case mimeType := <-receivedCodec:
+				assert.Equal(t, tc.expected.mimeType(), mimeType)
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for video track")
+			}
+			mimeType, err := video.Codec()
+			assert.NoError(t, err)
+			codec, err := VideoCodecFromMimeType(mimeType)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, codec)
+		})
+	}
+}
+
+func TestSelectVideoCodec(t *testing.T) {
+	negotiated := []webrtc.RTPCodecParameters{
+		{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: "video/AV1"}},
+		{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: "video/VP9"}},
+		{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: "video/h264"}},
+	}
+	codec, err := selectVideoCodec(nil, supportedVideoCodecs, negotiated)
+	assert.NoError(t, err)
+	assert.Equal(t, VideoCodecAV1, codec)
+
+	codec, err = selectVideoCodec([]VideoCodec{VideoCodecVP8, VideoCodecH264}, supportedVideoCodecs, negotiated)
+	assert.NoError(t, err)
+	assert.Equal(t, VideoCodecH264, codec)
+
+	_, err = selectVideoCodec([]VideoCodec{VideoCodecVP8}, supportedVideoCodecs, negotiated)
+	assert.Error(t, err)
+
+	_, err = selectVideoCodec(nil, supportedVideoCodecs, []webrtc.RTPCodecParameters{{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: "video/rtx"}}})
+	assert.Error(t, err)
+
+	// falls back from the codec the local encoder does not support
+	codec, err = selectVideoCodec(nil, []VideoCodec{VideoCodecH264, VideoCodecVP8}, negotiated)
+	assert.NoError(t, err)
+	assert.Equal(t, VideoCodecH264, codec)
+	_, err = selectVideoCodec([]VideoCodec{VideoCodecVP9}, []VideoCodec{VideoCodecH264, VideoCodecVP8}, negotiated)
+	assert.Error(t, err)
+
+	parsed, err := ParseVideoCodec("vp8")
+	assert.NoError(t, err)
+	assert.Equal(t, VideoCodecVP8, parsed)
+	_, err = ParseVideoCodec("theora")
+	assert.Error(t, err)
+}
+
+func TestRTPTimestampFromPTS(t *testing.T) {
+	streamer, player := signalStreamerPlayer(t, webrtc.Configuration{}, true)
+	timestamps := make(chan uint32, 10)
+	player.PeerConnection().OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		if track.Kind() != webrtc.RTPCodecTypeAudio {
+			return
+		}
+		for {
+			p, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			select {
+			case timestamps <- p.Timestamp:
+			default:
+			}
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	audio := mustSendTrack(t, streamer, TrackIDAudio)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		pts := 10 * time.Second
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = audio.WriteSample(ctx, MediaSample{Data: []byte{0xfc, 0xff, 0xfe}, Duration: 20 * time.Millisecond, PTS: pts})
+				// the gap of PTS (e.g. dropped samples) is kept in RTP timestamps
+				pts += 40 * time.Millisecond
+			}
+		}
+	}()
+
+	var prev uint32
+	for i := 0; i < 5; i++ {
+		select {
+		case ts := <-timestamps:
+			if i > 0 {
+				assert.Equal(t, uint32(40*48), ts-prev)
+			}
+			prev = ts
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for audio packets")
+		}
+	}
+}
+
+func TestSenderReports(t *testing.T) {
+	streamer, player := signalStreamerPlayer(t, webrtc.Configuration{}, true)
+	type received struct {
+		kind      webrtc.RTPCodecType
+		timestamp uint32
+		index     int
+	}
+	packets := make(chan received, 100)
+	reports := make(chan *rtcp.SenderReport, 100)
+	kinds := make(map[uint32]webrtc.RTPCodecType)
+	var kindsMu sync.Mutex
+	player.PeerConnection().OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		kindsMu.Lock()
+		kinds[uint32(track.SSRC())] = track.Kind()
+		kindsMu.Unlock()
+		go func() {
+			for {
+				rtcpPackets, _, err := receiver.ReadRTCP()
+				if err != nil {
+					return
+				}
+				for _, p := range rtcpPackets {
+					if sr, ok := p.(*rtcp.SenderReport); ok {
+						select {
+						case reports <- sr:
+						default:
+						}
+					}
+				}
+			}
+		}()
+		for {
+			p, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			select {
+			// the last byte of the payload is the index of the sample
+			case packets <- received{kind: track.Kind(), timestamp: p.Timestamp, index: int(p.Payload[len(p.Payload)-1])}:
+			default:
+			}
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	video := mustSendTrack(t, streamer, TrackIDVideo)
+	audio := mustSendTrack(t, streamer, TrackIDAudio)
+	const interval = 20 * time.Millisecond
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		// video and audio of the same PTS
+		pts := 10 * time.Second
+		for i := 0; i < 250; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = video.WriteSample(ctx, MediaSample{Data: []byte{0x65, 0x88, byte(i)}, Duration: interval, PTS: pts})
+				_ = audio.WriteSample(ctx, MediaSample{Data: []byte{0xfc, 0xff, byte(i)}, Duration: interval, PTS: pts})
+				pts += interval
+			}
+		}
+	}()
+
+	// the wall clock time of the first sample, calculated from the sender report and an RTP packet of each kind
+	firstSampleTimes := make(map[webrtc.RTPCodecType]float64)
+	lastPackets := make(map[webrtc.RTPCodecType]received)
+	timeout := time.After(5 * time.Second)
+	for len(firstSampleTimes) < 2 {
+		select {
+		case p := <-packets:
+			lastPackets[p.kind] = p
+		case sr := <-reports:
+			kindsMu.Lock()
+			kind, ok := kinds[sr.SSRC]
+			kindsMu.Unlock()
+			p, seen := lastPackets[kind]
+			if !ok || !seen {
+				continue
+			}
+			clockRate := 90000.0
+			if kind == webrtc.RTPCodecTypeAudio {
+				clockRate = 48000.0
+			}
+			ntp := float64(sr.NTPTime>>32) + float64(sr.NTPTime&0xffffffff)/(1<<32)
+			packetTime := ntp - float64(int32(sr.RTPTime-p.timestamp))/clockRate
+			firstSampleTimes[kind] = packetTime - (time.Duration(p.index) * interval).Seconds()
+		case <-timeout:
+			t.Fatal("timed out waiting for sender reports")
+		}
+	}
+	assert.InDelta(t, firstSampleTimes[webrtc.RTPCodecTypeVideo], firstSampleTimes[webrtc.RTPCodecTypeAudio], 0.001)
+}
+
+func TestTracks(t *testing.T) {
+	streamer, err := NewWebRTCStreamerConn(webrtc.Configuration{},
+		WithSendTracks(
+			TrackSpec{ID: TrackIDVideo, Kind: TrackKindVideo},
+			TrackSpec{ID: TrackIDVideoLow, Kind: TrackKindVideo},
+			TrackSpec{ID: TrackIDAudio, Kind: TrackKindAudio},
+		),
+		WithRecvTracks(TrackSpec{ID: TrackIDMicrophone, Kind: TrackKindAudio}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, track := range streamer.SendTracks() {
+		ids = append(ids, track.ID())
+	}
+	assert.Equal(t, []string{TrackIDVideo, TrackIDVideoLow, TrackIDAudio}, ids)
+	_, ok := streamer.SendTrack(TrackIDMicrophone)
+	assert.False(t, ok)
+
+	// the player receives all tracks and sends the microphone
+	player, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.Close()
+	for i := 0; i < 2; i++ {
+		_, err := player.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+		assert.NoError(t, err)
+	}
+	// the microphone shares the audio transceiver
+	mic, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2}, "mic", "player")
+	assert.NoError(t, err)
+	_, err = player.AddTransceiverFromTrack(mic, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendrecv})
+	assert.NoError(t, err)
+	received := make(chan string, 3)
+	player.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		received <- track.ID()
+	})
+	recvTrack := make(chan RecvTrack, 1)
+	streamer.OnRecvTrack(func(track RecvTrack) {
+		recvTrack <- track
+	})
+	if err := signalPair(player, streamer.PeerConnection()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, track := range streamer.SendTracks() {
+					_ = track.WriteSample(ctx, MediaSample{Data: []byte{0x00, 0x01, 0x02, 0x03}, Duration: 20 * time.Millisecond})
+				}
+				_ = mic.WriteSample(media.Sample{Data: []byte{0xfc, 0xff, 0xfe}, Duration: 20 * time.Millisecond})
+			}
+		}
+	}()
+
+	var receivedIDs []string
+	for i := 0; i < 3; i++ {
+		select {
+		case id := <-received:
+			receivedIDs = append(receivedIDs, id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for tracks")
+		}
+	}
+	assert.ElementsMatch(t, []string{TrackIDVideo, TrackIDVideoLow, TrackIDAudio}, receivedIDs)
+
+	select {
+	case track := <-recvTrack:
+		assert.Equal(t, TrackIDMicrophone, track.ID())
+		assert.Equal(t, TrackKindAudio, track.Kind())
+		sample, err := track.ReadSample()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0xfc, 0xff, 0xfe}, sample.Data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for microphone track")
+	}
+}
+
+// pairRenegotiator renegotiates with the remote peer in the same process.
+type pairRenegotiator struct {
+	local, remote *webrtc.PeerConnection
+	// called before renegotiation
+	onRenegotiate func()
+	count         int32
+}
+
+func (r *pairRenegotiator) Renegotiate(ctx context.Context, options *webrtc.OfferOptions) error {
+	atomic.AddInt32(&r.count, 1)
+	if r.onRenegotiate != nil {
+		r.onRenegotiate()
+	}
+	return negotiate(r.local, r.remote, options)
+}
+
+func (r *pairRenegotiator) Count() int {
+	return int(atomic.LoadInt32(&r.count))
+}
+
+// vnetPair is a pair of WebRTCConn connected on a virtual network, whose link can be cut.
+type vnetPair struct {
+	offer, answer *WebRTCConn
+	// chunks on the virtual network are dropped while linkDown is set
+	linkDown *abool.AtomicBool
+	router   *vnet.Router
+}
+
+func newVNetPair(t *testing.T, options ...ConnOption) *vnetPair {
+	router, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          "1.2.3.0/24",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	linkDown := abool.New()
+	router.AddChunkFilter(func(c vnet.Chunk) bool {
+		return linkDown.IsNotSet()
+	})
+	newConn := func(cid, ip string) *WebRTCConn {
+		n := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{ip}})
+		if err := router.AddNet(n); err != nil {
+			t.Fatal(err)
+		}
+		se := webrtc.SettingEngine{}
+		se.SetVNet(n)
+		se.SetICETimeouts(500*time.Millisecond, time.Second, 100*time.Millisecond)
+		pc, err := webrtc.NewAPI(webrtc.WithSettingEngine(se)).NewPeerConnection(webrtc.Configuration{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := NewWebRTCConn(cid, pc, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	p := &vnetPair{
+		offer:    newConn("offer", "1.2.3.4"),
+		answer:   newConn("answer", "1.2.3.5"),
+		linkDown: linkDown,
+		router:   router,
+	}
+	if err := router.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	offerConnected := make(chan struct{})
+	p.offer.OnConnect(func() { close(offerConnected) })
+	answerConnected := make(chan struct{})
+	p.answer.OnConnect(func() { close(answerConnected) })
+	if err := signalPair(p.offer.PeerConnection(), p.answer.PeerConnection()); err != nil {
+		t.Fatal(err)
+	}
+	for _, connected := range []chan struct{}{offerConnected, answerConnected} {
+		select {
+		case <-connected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for connection")
+		}
+	}
+	return p
+}
+
+func (p *vnetPair) Close() {
+	_ = p.offer.PeerConnection().Close()
+	_ = p.answer.PeerConnection().Close()
+	_ = p.router.Stop()
+}
+
+func waitICEConnectionState(t *testing.T, conn *WebRTCConn, state webrtc.ICEConnectionState, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for conn.PeerConnection().ICEConnectionState() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for ICE connection state %s of %s (current: %s)", state, conn.ConnectionID(), conn.PeerConnection().ICEConnectionState())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func assertMessaging(t *testing.T, sender, receiver *WebRTCConn) {
+	received := make(chan []byte, 1)
+	receiver.OnMessage(func(data []byte) {
+		received <- data
+	})
+	assert.NoError(t, sender.SendMessage(context.Background(), []byte("hello")))
+	select {
+	case data := <-received:
+		assert.Equal(t, []byte("hello"), data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+}
+
+func TestICERestart(t *testing.T) {
+	t.Run("TransientDisconnection", func(t *testing.T) {
+		p := newVNetPair(t)
+		defer p.Close()
+		disconnected := abool.New()
+		p.offer.OnDisconnect(disconnected.Set)
+		p.answer.OnDisconnect(disconnected.Set)
+		r := &pairRenegotiator{local: p.offer.PeerConnection(), remote: p.answer.PeerConnection()}
+		p.offer.SetRenegotiator(r)
+
+		p.linkDown.Set()
+		waitICEConnectionState(t, p.offer, webrtc.ICEConnectionStateDisconnected, 5*time.Second)
+		p.linkDown.UnSet()
+		waitICEConnectionState(t, p.offer, webrtc.ICEConnectionStateConnected, 5*time.Second)
+
+		assert.False(t, disconnected.IsSet())
+		assert.Equal(t, 0, r.Count())
+		assertMessaging(t, p.answer, p.offer)
+	})
+
+	t.Run("RestartOnFailure", func(t *testing.T) {
+		p := newVNetPair(t)
+		defer p.Close()
+		disconnected := abool.New()
+		p.offer.OnDisconnect(disconnected.Set)
+		p.answer.OnDisconnect(disconnected.Set)
+		// the link comes back (e.g. on another network) by the time ICE is restarted
+		r := &pairRenegotiator{local: p.offer.PeerConnection(), remote: p.answer.PeerConnection(), onRenegotiate: p.linkDown.UnSet}
+		p.offer.SetRenegotiator(r)
+
+		p.linkDown.Set()
+		waitICEConnectionState(t, p.offer, webrtc.ICEConnectionStateFailed, 5*time.Second)
+		waitICEConnectionState(t, p.offer, webrtc.ICEConnectionStateConnected, 5*time.Second)
+		waitICEConnectionState(t, p.answer, webrtc.ICEConnectionStateConnected, 5*time.Second)
+
+		assert.False(t, disconnected.IsSet())
+		assert.Equal(t, 1, r.Count())
+		assertMessaging(t, p.offer, p.answer)
+		assertMessaging(t, p.answer, p.offer)
+	})
+
+	t.Run("RestartsExhausted", func(t *testing.T) {
+		p := newVNetPair(t, WithICERestart(2, 2*time.Second))
+		defer p.Close()
+		var disconnectCount int32
+		disconnected := make(chan struct{})
+		p.offer.OnDisconnect(func() {
+			if atomic.AddInt32(&disconnectCount, 1) == 1 {
+				close(disconnected)
+			}
+		})
+		r := &pairRenegotiator{local: p.offer.PeerConnection(), remote: p.answer.PeerConnection()}
+		p.offer.SetRenegotiator(r)
+
+		p.linkDown.Set()
+		select {
+		case <-disconnected:
+		case <-time.After(20 * time.Second):
+			t.Fatal("timed out waiting for disconnection")
+		}
+		assert.Equal(t, 2, r.Count())
+		// disconnection is reported once
+		time.Sleep(time.Second)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&disconnectCount))
+	})
+}
@@ -9,21 +9,33 @@ import (
 	"github.com/castaneai/mashimaro/pkg/ayame"
 )
 
+// WebRTCSignaler exchanges the offer and answer of the peer connection with the remote peer in the room.
+// The returned Renegotiator renegotiates through the same signaling, or is nil if the signaler doesn't support it.
 type WebRTCSignaler interface {
-	Signaling(ctx context.Context, pc *webrtc.PeerConnection, roomID, clientID string) error
+	Signaling(ctx context.Context, pc *webrtc.PeerConnection, roomID, clientID string) (Renegotiator, error)
 }
 
+// AyameSignaler signals through an Ayame compatible server (e.g. the server of pkg/signaling).
 type AyameSignaler struct {
 	AyameURL string
+	// SignalingKey returns the signaling key to join the room (e.g. a join token of pkg/signaling) if not nil.
+	SignalingKey func(roomID string) string
 }
 
 func NewAyameSignaler(ayameURL string) *AyameSignaler {
 	return &AyameSignaler{AyameURL: ayameURL}
 }
 
-func (s *AyameSignaler) Signaling(ctx context.Context, pc *webrtc.PeerConnection, roomID, clientID string) error {
+func (s *AyameSignaler) Signaling(ctx context.Context, pc *webrtc.PeerConnection, roomID, clientID string) (Renegotiator, error) {
+	req := &ayame.ConnectRequest{RoomID: roomID, ClientID: clientID}
+	if s.SignalingKey != nil {
+		req.SignalingKey = s.SignalingKey(roomID)
+	}
 	ayamec := ayame.NewClient(pc)
-	return ayamec.Connect(ctx, s.AyameURL, &ayame.ConnectRequest{RoomID: roomID, ClientID: clientID})
+	if err := ayamec.Connect(ctx, s.AyameURL, req); err != nil {
+		return nil, err
+	}
+	return ayamec, nil
 }
 
 type AyameLaboSignaler struct {
@@ -40,11 +52,14 @@ func NewAyameLaboSignaler(ayameLaboURL, signalingKey, githubAccount string) *Aya
 	}
 }
 
-func (s *AyameLaboSignaler) Signaling(ctx context.Context, pc *webrtc.PeerConnection, roomID, clientID string) error {
+func (s *AyameLaboSignaler) Signaling(ctx context.Context, pc *webrtc.PeerConnection, roomID, clientID string) (Renegotiator, error) {
 	ayamec := ayame.NewClient(pc)
-	return ayamec.Connect(ctx, s.AyameLaboURL, &ayame.ConnectRequest{
+	if err := ayamec.Connect(ctx, s.AyameLaboURL, &ayame.ConnectRequest{
 		RoomID:       fmt.Sprintf("%s@%s", s.GitHubAccount, roomID),
 		ClientID:     clientID,
 		SignalingKey: s.SignalingKey,
-	})
+	}); err != nil {
+		return nil, err
+	}
+	return ayamec, nil
 }
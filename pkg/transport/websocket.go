@@ -0,0 +1,415 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/castaneai/mashimaro/pkg/fmp4"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+)
+
+// The WebSocket transport streams the main video to the player over a WebSocket for networks where WebRTC is blocked.
+// Binary messages to the player are segments of fragmented MP4 (H.264) for Media Source Extensions,
+// and text messages are the messages of Conn in JSON in both directions.
+// A video format message precedes every init segment, by which the player adds a SourceBuffer.
+// Audio, the low-resolution video and the microphone are not supported.
+const (
+	// WebSocketMessageTypeVideoFormat is the type of the video format message: {"type": "videoFormat", "body": {...}}
+	WebSocketMessageTypeVideoFormat = "videoFormat"
+
+	webSocketWriteTimeout   = 10 * time.Second
+	maxWebSocketMessageSize = 8 * 1024 * 1024
+)
+
+type webSocketVideoFormatMessage struct {
+	Type string               `json:"type"`
+	Body webSocketVideoFormat `json:"body"`
+}
+
+type webSocketVideoFormat struct {
+	MimeType string `json:"mimeType"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
+// WebSocketTransport is a Factory whose conns wait for the player of the room on the WebSocket endpoint.
+type WebSocketTransport struct {
+	rooms map[string]*WebSocketStreamerConn
+	opts  *webSocketOptions
+	mu    sync.Mutex
+}
+
+type webSocketOptions struct {
+	authenticator func(roomID, token string) error
+}
+
+type WebSocketOption interface {
+	apply(opts *webSocketOptions)
+}
+
+type WebSocketOptionFunc func(*webSocketOptions)
+
+func (f WebSocketOptionFunc) apply(opts *webSocketOptions) {
+	f(opts)
+}
+
+// WithWebSocketAuthenticator rejects players unless the token of the query parameter ("?token=...") passes the authentication
+// (e.g. a join token of pkg/signaling). Browsers cannot set the Authorization header on WebSockets.
+func WithWebSocketAuthenticator(authenticate func(roomID, token string) error) WebSocketOption {
+	return WebSocketOptionFunc(func(opts *webSocketOptions) {
+		opts.authenticator = authenticate
+	})
+}
+
+func NewWebSocketTransport(options ...WebSocketOption) *WebSocketTransport {
+	opts := &webSocketOptions{}
+	for _, opt := range options {
+		opt.apply(opts)
+	}
+	return &WebSocketTransport{
+		rooms: make(map[string]*WebSocketStreamerConn),
+		opts:  opts,
+	}
+}
+
+// NewStreamerConn returns a conn sending the main video (TrackIDVideo) in H.264.
+// The other tracks declared by the options are not sent nor received.
+func (t *WebSocketTransport) NewStreamerConn(roomID string, options ...StreamerOption) (StreamerConn, Connector, error) {
+	opts := defaultStreamerOptions()
+	for _, opt := range options {
+		opt.apply(opts)
+	}
+	if len(opts.videoCodecs) > 0 && !containsVideoCodec(opts.videoCodecs, VideoCodecH264) {
+		return nil, nil, fmt.Errorf("WebSocket transport sends %s only, but %v is preferred", VideoCodecH264, opts.videoCodecs)
+	}
+	if !containsVideoCodec(opts.sendableVideoCodecs(), VideoCodecH264) {
+		return nil, nil, fmt.Errorf("WebSocket transport sends %s only, but it is not supported", VideoCodecH264)
+	}
+	conn := newWebSocketStreamerConn()
+	return conn, &webSocketConnector{transport: t, roomID: roomID}, nil
+}
+
+type webSocketConnector struct {
+	transport *WebSocketTransport
+	roomID    string
+}
+
+// Connect lets the player connect to the room in the background.
+func (c *webSocketConnector) Connect(ctx context.Context, conn StreamerConn) error {
+	wconn, ok := conn.(*WebSocketStreamerConn)
+	if !ok {
+		return errors.New("failed to cast to WebSocketStreamerConn")
+	}
+	c.transport.mu.Lock()
+	defer c.transport.mu.Unlock()
+	c.transport.rooms[c.roomID] = wconn
+	return nil
+}
+
+// HTTPHandler returns the WebSocket endpoint on "/<room ID>", which is mounted on a prefix by http.StripPrefix (e.g. "/ws").
+func (t *WebSocketTransport) HTTPHandler() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/{roomID}", t.handlePlayer)
+	return r
+}
+
+func (t *WebSocketTransport) handlePlayer(w http.ResponseWriter, req *http.Request) {
+	roomID := chi.URLParam(req, "roomID")
+	if t.opts.authenticator != nil {
+		if err := t.opts.authenticator(roomID, req.URL.Query().Get("token")); err != nil {
+			log.Printf("unauthorized WebSocket player (room: %s): %+v", roomID, err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	t.mu.Lock()
+	conn, ok := t.rooms[roomID]
+	t.mu.Unlock()
+	if !ok {
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+	if conn.connected() {
+		http.Error(w, "another player is connected to the room", http.StatusConflict)
+		return
+	}
+	// websocket.Handler rejects requests from other origins than the host, but players are served on other origins
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		conn.serve(ws)
+		// the player cannot connect again to the ended session
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.rooms[roomID] == conn {
+			delete(t.rooms, roomID)
+		}
+	}}.ServeHTTP(w, req)
+}
+
+// WebSocketStreamerConn is a StreamerConn over a WebSocket from a player.
+type WebSocketStreamerConn struct {
+	video             *webSocketVideoTrack
+	ws                *websocket.Conn
+	wsMu              sync.Mutex
+	onMessage         func(data []byte)
+	onConnect         func()
+	onDisconnect      func()
+	onKeyframeRequest func(trackID string)
+	callbackMu        sync.Mutex
+	disconnectOnce    sync.Once
+	disconnected      chan struct{}
+}
+
+func newWebSocketStreamerConn() *WebSocketStreamerConn {
+	conn := &WebSocketStreamerConn{
+		disconnected: make(chan struct{}),
+	}
+	conn.video = &webSocketVideoTrack{conn: conn}
+	return conn
+}
+
+func (c *WebSocketStreamerConn) serve(ws *websocket.Conn) {
+	ws.MaxPayloadBytes = maxWebSocketMessageSize
+	c.wsMu.Lock()
+	if c.ws != nil {
+		c.wsMu.Unlock()
+		log.Printf("[%s] rejected another player", c.ConnectionID())
+		return
+	}
+	c.ws = ws
+	c.wsMu.Unlock()
+	defer c.disconnect()
+
+	log.Printf("[%s] WebSocket player connected from %s", c.ConnectionID(), ws.Request().RemoteAddr)
+	c.callbackMu.Lock()
+	onConnect := c.onConnect
+	onKeyframeRequest := c.onKeyframeRequest
+	c.callbackMu.Unlock()
+	if onConnect != nil {
+		onConnect()
+	}
+	// the video of the player starts from a keyframe
+	if onKeyframeRequest != nil {
+		onKeyframeRequest(TrackIDVideo)
+	}
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			if err != io.EOF {
+				log.Printf("[%s] failed to receive WebSocket message: %+v", c.ConnectionID(), err)
+			}
+			return
+		}
+		c.callbackMu.Lock()
+		h := c.onMessage
+		c.callbackMu.Unlock()
+		if h != nil {
+			h(data)
+		}
+	}
+}
+
+func (c *WebSocketStreamerConn) connected() bool {
+	c.wsMu.Lock()
+	defer c.wsMu.Unlock()
+	return c.ws != nil
+}
+
+// send writes a text message for a string, or a binary one for bytes.
+func (c *WebSocketStreamerConn) send(msg interface{}) error {
+	c.wsMu.Lock()
+	defer c.wsMu.Unlock()
+	if c.ws == nil {
+		return errors.New("not connected")
+	}
+	if err := c.ws.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout)); err != nil {
+		return err
+	}
+	if err := websocket.Message.Send(c.ws, msg); err != nil {
+		// the player cannot follow the stream after a lost message
+		go c.disconnect()
+		return errors.Wrap(err, "failed to send WebSocket message")
+	}
+	return nil
+}
+
+func (c *WebSocketStreamerConn) disconnect() {
+	c.disconnectOnce.Do(func() {
+		close(c.disconnected)
+		c.wsMu.Lock()
+		if c.ws != nil {
+			if err := c.ws.Close(); err != nil {
+				log.Printf("[%s] failed to close WebSocket: %+v", c.ConnectionID(), err)
+			}
+		}
+		c.wsMu.Unlock()
+		c.callbackMu.Lock()
+		f := c.onDisconnect
+		c.callbackMu.Unlock()
+		if f != nil {
+			f()
+		}
+	})
+}
+
+func (c *WebSocketStreamerConn) ConnectionID() string {
+	return "streamer"
+}
+
+// SendMessage sends the message as a text message.
+func (c *WebSocketStreamerConn) SendMessage(ctx context.Context, data []byte) error {
+	return c.send(string(data))
+}
+
+// OnMessage sets a handler of text and binary messages from the player.
+func (c *WebSocketStreamerConn) OnMessage(f func(data []byte)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.onMessage = f
+}
+
+// DataChannel returns the control channel only, which is the WebSocket itself.
+func (c *WebSocketStreamerConn) DataChannel(purpose DataChannelPurpose) (DataChannel, bool) {
+	if purpose != DataChannelControl {
+		return nil, false
+	}
+	return &webSocketDataChannel{conn: c}, true
+}
+
+func (c *WebSocketStreamerConn) OnConnect(f func()) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.onConnect = f
+}
+
+func (c *WebSocketStreamerConn) OnDisconnect(f func()) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.onDisconnect = f
+}
+
+func (c *WebSocketStreamerConn) SendTracks() []SendTrack {
+	return []SendTrack{c.video}
+}
+
+func (c *WebSocketStreamerConn) SendTrack(id string) (SendTrack, bool) {
+	if id != TrackIDVideo {
+		return nil, false
+	}
+	return c.video, true
+}
+
+// OnRecvTrack does nothing, as the player sends no track.
+func (c *WebSocketStreamerConn) OnRecvTrack(f func(track RecvTrack)) {}
+
+// OnKeyframeRequest sets a handler called when a player connects, whose video starts from a keyframe.
+func (c *WebSocketStreamerConn) OnKeyframeRequest(f func(trackID string)) {
+	c.callbackMu.Lock()
+	defer c.callbackMu.Unlock()
+	c.onKeyframeRequest = f
+}
+
+// OnBandwidthEstimate does nothing, as TCP controls the bitrate by itself.
+func (c *WebSocketStreamerConn) OnBandwidthEstimate(f func(estimate BandwidthEstimate)) {}
+
+// Stats returns false, as the stats are not collected over WebSocket.
+func (c *WebSocketStreamerConn) Stats() (ConnStats, bool) {
+	return ConnStats{}, false
+}
+
+// SubscribeStats returns a channel receiving nothing, which is closed when the context is done or the connection is disconnected.
+func (c *WebSocketStreamerConn) SubscribeStats(ctx context.Context) <-chan ConnStats {
+	ch := make(chan ConnStats)
+	go func() {
+		defer close(ch)
+		select {
+		case <-ctx.Done():
+		case <-c.disconnected:
+		}
+	}()
+	return ch
+}
+
+type webSocketDataChannel struct {
+	conn *WebSocketStreamerConn
+}
+
+func (c *webSocketDataChannel) Purpose() DataChannelPurpose {
+	return DataChannelControl
+}
+
+func (c *webSocketDataChannel) Send(ctx context.Context, data []byte) error {
+	if !c.conn.connected() {
+		return ErrDataChannelNotOpen
+	}
+	return c.conn.SendMessage(ctx, data)
+}
+
+func (c *webSocketDataChannel) OnMessage(f func(data []byte)) {
+	c.conn.OnMessage(f)
+}
+
+// webSocketVideoTrack sends H.264 frames in fragmented MP4 while a player is connected.
+type webSocketVideoTrack struct {
+	conn *WebSocketStreamerConn
+	// the muxer of the connected player, whose segments start from an init segment
+	muxer *fmp4.Muxer
+	mu    sync.Mutex
+}
+
+func (t *webSocketVideoTrack) ID() string {
+	return TrackIDVideo
+}
+
+func (t *webSocketVideoTrack) Kind() TrackKind {
+	return TrackKindVideo
+}
+
+func (t *webSocketVideoTrack) Codec() (string, error) {
+	return VideoCodecH264.mimeType(), nil
+}
+
+func (t *webSocketVideoTrack) WriteSample(ctx context.Context, sample MediaSample) error {
+	if !t.conn.connected() {
+		// samples are dropped until a player connects
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.muxer == nil {
+		t.muxer = fmp4.NewMuxer()
+	}
+	segments, err := t.muxer.Mux(sample.Data, sample.PTS, sample.Duration)
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if segment.Format != nil {
+			msg, err := json.Marshal(&webSocketVideoFormatMessage{
+				Type: WebSocketMessageTypeVideoFormat,
+				Body: webSocketVideoFormat{
+					MimeType: segment.Format.MIMEType,
+					Width:    segment.Format.Width,
+					Height:   segment.Format.Height,
+				},
+			})
+			if err != nil {
+				return err
+			}
+			if err := t.conn.send(string(msg)); err != nil {
+				return err
+			}
+		}
+		if err := t.conn.send(segment.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
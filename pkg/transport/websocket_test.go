@@ -0,0 +1,136 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+// 1920x1080 of H.264 High Profile encoded by x264
+var (
+	testSPS = []byte{0x67, 0x64, 0x00, 0x28, 0xac, 0xd9, 0x40, 0x78, 0x02, 0x27, 0xe5, 0xc0, 0x44, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc6, 0x58}
+	testPPS = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+)
+
+func newWebSocketServer(options ...WebSocketOption) (*WebSocketTransport, *httptest.Server) {
+	t := NewWebSocketTransport(options...)
+	mux := http.NewServeMux()
+	mux.Handle("/ws/", http.StripPrefix("/ws", t.HTTPHandler()))
+	return t, httptest.NewServer(mux)
+}
+
+func dialWebSocket(url string) (*websocket.Conn, error) {
+	return websocket.Dial(strings.Replace(url, "http://", "ws://", 1), "", "http://localhost/")
+}
+
+func TestWebSocketTransport(t *testing.T) {
+	wt, hs := newWebSocketServer()
+	defer hs.Close()
+	ctx := context.Background()
+
+	_, _, err := wt.NewStreamerConn("room1", WithVideoCodecs(VideoCodecVP8))
+	assert.Error(t, err)
+	conn, connector, err := wt.NewStreamerConn("room1", WithVideoCodecs(VideoCodecVP8, VideoCodecH264))
+	assert.NoError(t, err)
+	connected := make(chan struct{})
+	conn.OnConnect(func() { close(connected) })
+	disconnected := make(chan struct{})
+	conn.OnDisconnect(func() { close(disconnected) })
+	received := make(chan []byte, 1)
+	conn.OnMessage(func(data []byte) { received <- data })
+	keyframeRequested := make(chan string, 1)
+	conn.OnKeyframeRequest(func(trackID string) { keyframeRequested <- trackID })
+	assert.Len(t, conn.SendTracks(), 1)
+	_, ok := conn.SendTrack(TrackIDAudio)
+	assert.False(t, ok)
+	_, ok = conn.DataChannel(DataChannelPointer)
+	assert.False(t, ok)
+	video, ok := conn.SendTrack(TrackIDVideo)
+	assert.True(t, ok)
+	codec, err := video.Codec()
+	assert.NoError(t, err)
+	assert.Equal(t, "video/H264", codec)
+
+	_, err = dialWebSocket(hs.URL + "/ws/room1")
+	assert.Error(t, err, "the room is not connected yet")
+	assert.NoError(t, connector.Connect(ctx, conn))
+	ws, err := dialWebSocket(hs.URL + "/ws/room1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for connection")
+	}
+	assert.Equal(t, TrackIDVideo, <-keyframeRequested)
+	_, err = dialWebSocket(hs.URL + "/ws/room1")
+	assert.Error(t, err, "only one player is in the room")
+
+	// messages in both directions
+	assert.NoError(t, websocket.Message.Send(ws, `{"type":"exitGame"}`))
+	assert.Equal(t, []byte(`{"type":"exitGame"}`), receiveMessage(t, received))
+	assert.NoError(t, conn.SendMessage(ctx, []byte(`{"type":"connectionStats"}`)))
+	var text string
+	assert.NoError(t, websocket.Message.Receive(ws, &text))
+	assert.Equal(t, `{"type":"connectionStats"}`, text)
+
+	// the video starts from a keyframe with the format
+	assert.NoError(t, video.WriteSample(ctx, MediaSample{Data: []byte{0, 0, 0, 1, 0x41, 0x9a}, Duration: time.Second / 30}))
+	keyframe := bytes.Join([][]byte{{}, testSPS, testPPS, {0x65, 0x88, 0x84}}, []byte{0, 0, 0, 1})
+	assert.NoError(t, video.WriteSample(ctx, MediaSample{Data: keyframe, Duration: time.Second / 30}))
+	assert.NoError(t, websocket.Message.Receive(ws, &text))
+	var format webSocketVideoFormatMessage
+	assert.NoError(t, json.Unmarshal([]byte(text), &format))
+	assert.Equal(t, webSocketVideoFormatMessage{
+		Type: WebSocketMessageTypeVideoFormat,
+		Body: webSocketVideoFormat{MimeType: `video/mp4; codecs="avc1.640028"`, Width: 1920, Height: 1080},
+	}, format)
+	var segment []byte
+	assert.NoError(t, websocket.Message.Receive(ws, &segment))
+	assert.Equal(t, []byte("ftyp"), segment[4:8])
+	assert.NoError(t, websocket.Message.Receive(ws, &segment))
+	assert.Equal(t, []byte("moof"), segment[4:8])
+
+	// the player leaves
+	assert.NoError(t, ws.Close())
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for disconnection")
+	}
+	_, ok = <-conn.SubscribeStats(ctx)
+	assert.False(t, ok)
+	_, err = dialWebSocket(hs.URL + "/ws/room1")
+	assert.Error(t, err, "the session has ended")
+}
+
+func TestWebSocketTransportAuthentication(t *testing.T) {
+	wt, hs := newWebSocketServer(WithWebSocketAuthenticator(func(roomID, token string) error {
+		if token != "token-"+roomID {
+			return errors.New("invalid token")
+		}
+		return nil
+	}))
+	defer hs.Close()
+
+	conn, connector, err := wt.NewStreamerConn("room1")
+	assert.NoError(t, err)
+	assert.NoError(t, connector.Connect(context.Background(), conn))
+	_, err = dialWebSocket(hs.URL + "/ws/room1?token=invalid")
+	assert.Error(t, err)
+	ws, err := dialWebSocket(hs.URL + "/ws/room1?token=token-room1")
+	assert.NoError(t, err)
+	if ws != nil {
+		ws.Close()
+	}
+}
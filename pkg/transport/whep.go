@@ -0,0 +1,452 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v3"
+	"github.com/pkg/errors"
+)
+
+// WHEP (WebRTC-HTTP Egress Protocol, https://datatracker.ietf.org/doc/draft-murillo-whep/)
+const (
+	contentTypeSDP         = "application/sdp"
+	contentTypeTrickleICE  = "application/trickle-ice-sdpfrag"
+	whepGatheringTimeout   = 10 * time.Second
+	maxWHEPRequestBodySize = 64 * 1024
+)
+
+// WHEPSignaler is a WebRTCSignaler which lets a WHEP client (the player) connect to the room by HTTP.
+// The player POSTs an SDP offer to "<endpoint>/<room ID>" and receives the answer with the URL of the session resource,
+// to which it PATCHes trickled ICE candidates and DELETEs to end the session.
+type WHEPSignaler struct {
+	rooms map[string]*whepRoom
+	opts  *whepOptions
+	mu    sync.Mutex
+}
+
+type whepRoom struct {
+	pc *webrtc.PeerConnection
+	// the ID of the session resource, which is empty until the player sends an offer
+	resourceID string
+}
+
+type whepOptions struct {
+	authenticator func(roomID, token string) error
+}
+
+type WHEPOption interface {
+	apply(opts *whepOptions)
+}
+
+type WHEPOptionFunc func(*whepOptions)
+
+func (f WHEPOptionFunc) apply(opts *whepOptions) {
+	f(opts)
+}
+
+// WithWHEPAuthenticator rejects requests unless the bearer token of the Authorization header passes the authentication
+// (e.g. a join token of pkg/signaling).
+func WithWHEPAuthenticator(authenticate func(roomID, token string) error) WHEPOption {
+	return WHEPOptionFunc(func(opts *whepOptions) {
+		opts.authenticator = authenticate
+	})
+}
+
+func NewWHEPSignaler(options ...WHEPOption) *WHEPSignaler {
+	opts := &whepOptions{}
+	for _, opt := range options {
+		opt.apply(opts)
+	}
+	return &WHEPSignaler{
+		rooms: make(map[string]*whepRoom),
+		opts:  opts,
+	}
+}
+
+// Signaling waits for the offer of a player to the room in the background.
+// ICE restarts are initiated by the player, so no Renegotiator is returned.
+func (s *WHEPSignaler) Signaling(ctx context.Context, pc *webrtc.PeerConnection, roomID, clientID string) (Renegotiator, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the rooms of ended sessions are not deleted without DELETE requests
+	for id, room := range s.rooms {
+		if room.pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			delete(s.rooms, id)
+		}
+	}
+	s.rooms[roomID] = &whepRoom{pc: pc}
+	return nil, nil
+}
+
+// HTTPHandler returns the WHEP endpoint, which is mounted on a prefix by http.StripPrefix (e.g. "/whep").
+func (s *WHEPSignaler) HTTPHandler() http.Handler {
+	r := chi.NewRouter()
+	r.Use(whepCORS)
+	r.Options("/{roomID}", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Accept-Post", contentTypeSDP)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.Post("/{roomID}", s.handleOffer)
+	r.Options("/{roomID}/{resourceID}", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Accept-Patch", contentTypeTrickleICE)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.Patch("/{roomID}/{resourceID}", s.handleTrickleICE)
+	r.Delete("/{roomID}/{resourceID}", s.handleDelete)
+	return r
+}
+
+func whepCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "Location, Accept-Patch")
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (s *WHEPSignaler) authenticate(w http.ResponseWriter, req *http.Request, roomID string) bool {
+	if s.opts.authenticator == nil {
+		return true
+	}
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if err := s.opts.authenticator(roomID, token); err != nil {
+		log.Printf("unauthorized WHEP request (room: %s): %+v", roomID, err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// hasContentType reports whether the media type of the request is the type, ignoring the parameters (e.g. charset).
+func hasContentType(req *http.Request, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == contentType
+}
+
+func (s *WHEPSignaler) handleOffer(w http.ResponseWriter, req *http.Request) {
+	roomID := chi.URLParam(req, "roomID")
+	if !s.authenticate(w, req, roomID) {
+		return
+	}
+	if !hasContentType(req, contentTypeSDP) {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	offer, err := ioutil.ReadAll(io.LimitReader(req.Body, maxWHEPRequestBodySize))
+	if err != nil {
+		http.Error(w, "failed to read offer", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	room, ok := s.rooms[roomID]
+	if ok && room.resourceID != "" {
+		s.mu.Unlock()
+		http.Error(w, "another player is in the room", http.StatusConflict)
+		return
+	}
+	resourceID := uuid.Must(uuid.NewRandom()).String()
+	if ok {
+		room.resourceID = resourceID
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	answer, err := answerWHEP(req.Context(), room.pc, string(offer))
+	if err != nil {
+		log.Printf("failed to answer WHEP offer (room: %s): %+v", roomID, err)
+		s.mu.Lock()
+		room.resourceID = ""
+		s.mu.Unlock()
+		http.Error(w, "invalid offer", http.StatusBadRequest)
+		return
+	}
+	// the resource URL is relative to the request URI before http.StripPrefix
+	location := fmt.Sprintf("%s/%s", req.URL.Path, resourceID)
+	if u, err := url.ParseRequestURI(req.RequestURI); err == nil {
+		location = fmt.Sprintf("%s/%s", u.Path, resourceID)
+	}
+	w.Header().Set("Content-Type", contentTypeSDP)
+	w.Header().Set("Location", location)
+	w.Header().Set("Accept-Patch", contentTypeTrickleICE)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write([]byte(answer))
+	log.Printf("WHEP session created (room: %s, resource: %s)", roomID, resourceID)
+}
+
+// answerWHEP answers the offer with all the ICE candidates of the local peer, which doesn't trickle them.
+func answerWHEP(ctx context.Context, pc *webrtc.PeerConnection, offer string) (string, error) {
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		return "", err
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+	gatheringComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, whepGatheringTimeout)
+	defer cancel()
+	select {
+	case <-gatheringComplete:
+	case <-ctx.Done():
+		return "", errors.Wrap(ctx.Err(), "failed to gather ICE candidates")
+	}
+	return pc.LocalDescription().SDP, nil
+}
+
+// room returns the room having the session resource.
+func (s *WHEPSignaler) room(w http.ResponseWriter, req *http.Request) (string, *whepRoom, bool) {
+	roomID := chi.URLParam(req, "roomID")
+	if !s.authenticate(w, req, roomID) {
+		return "", nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	room, ok := s.rooms[roomID]
+	if !ok || room.resourceID == "" || room.resourceID != chi.URLParam(req, "resourceID") {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return "", nil, false
+	}
+	return roomID, room, true
+}
+
+func (s *WHEPSignaler) handleTrickleICE(w http.ResponseWriter, req *http.Request) {
+	roomID, room, ok := s.room(w, req)
+	if !ok {
+		return
+	}
+	if !hasContentType(req, contentTypeTrickleICE) {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxWHEPRequestBodySize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	frag := parseSDPFragment(string(body))
+	if frag.ufrag != "" && frag.ufrag != iceUfragOf(room.pc.RemoteDescription()) {
+		// an ICE restart requires a new answer in the response, which is not supported
+		http.Error(w, "ICE restart is not supported", http.StatusMethodNotAllowed)
+		return
+	}
+	for _, cand := range frag.candidates {
+		if err := room.pc.AddICECandidate(cand); err != nil {
+			log.Printf("failed to add ICE candidate of WHEP player (room: %s): %+v", roomID, err)
+			http.Error(w, "invalid candidate", http.StatusBadRequest)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *WHEPSignaler) handleDelete(w http.ResponseWriter, req *http.Request) {
+	roomID, room, ok := s.room(w, req)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	delete(s.rooms, roomID)
+	s.mu.Unlock()
+	// WebRTCConn reports disconnection as the ICE connection is closed
+	if err := room.pc.Close(); err != nil {
+		log.Printf("failed to close peer connection of WHEP session (room: %s): %+v", roomID, err)
+	}
+	w.WriteHeader(http.StatusOK)
+	log.Printf("WHEP session deleted (room: %s)", roomID)
+}
+
+type sdpFragment struct {
+	ufrag      string
+	candidates []webrtc.ICECandidateInit
+}
+
+// parseSDPFragment parses the SDP fragment of trickle ICE (https://tools.ietf.org/html/rfc8840).
+func parseSDPFragment(frag string) *sdpFragment {
+	f := &sdpFragment{}
+	var mid *string
+	sc := bufio.NewScanner(strings.NewReader(frag))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, "a=ice-ufrag:"):
+			f.ufrag = strings.TrimPrefix(line, "a=ice-ufrag:")
+		case strings.HasPrefix(line, "a=mid:"):
+			m := strings.TrimPrefix(line, "a=mid:")
+			mid = &m
+		case strings.HasPrefix(line, "a=candidate:"):
+			f.candidates = append(f.candidates, webrtc.ICECandidateInit{Candidate: strings.TrimPrefix(line, "a="), SDPMid: mid})
+		}
+	}
+	return f
+}
+
+// iceUfragOf returns the first ICE username fragment in the session description.
+func iceUfragOf(desc *webrtc.SessionDescription) string {
+	if desc == nil {
+		return ""
+	}
+	return parseSDPFragment(desc.SDP).ufrag
+}
+
+// firstMidOf returns the first media ID in the session description.
+func firstMidOf(desc *webrtc.SessionDescription) string {
+	if desc == nil {
+		return ""
+	}
+	sc := bufio.NewScanner(strings.NewReader(desc.SDP))
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); strings.HasPrefix(line, "a=mid:") {
+			return strings.TrimPrefix(line, "a=mid:")
+		}
+	}
+	return ""
+}
+
+// WHEPClient connects the peer connection of a player to a WHEP endpoint, trickling ICE candidates.
+type WHEPClient struct {
+	pc          *webrtc.PeerConnection
+	endpoint    string
+	token       string
+	httpClient  *http.Client
+	candidates  chan *webrtc.ICECandidate
+	resourceURL string
+	mu          sync.Mutex
+}
+
+// NewWHEPClient creates a client for the endpoint URL of the room (e.g. "https://example.com/whep/<room ID>").
+// The token is sent as the bearer token if not empty.
+func NewWHEPClient(pc *webrtc.PeerConnection, endpoint, token string) *WHEPClient {
+	return &WHEPClient{
+		pc:         pc,
+		endpoint:   endpoint,
+		token:      token,
+		httpClient: http.DefaultClient,
+		// candidates gathered before the answer wait in the channel
+		candidates: make(chan *webrtc.ICECandidate, 64),
+	}
+}
+
+// Connect sends the offer and applies the answer. ICE candidates are trickled in the background.
+func (c *WHEPClient) Connect(ctx context.Context) error {
+	c.pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		select {
+		case c.candidates <- candidate:
+		default:
+			log.Printf("dropped ICE candidate for WHEP: %v", candidate)
+		}
+	})
+	offer, err := c.pc.CreateOffer(nil)
+	if err != nil {
+		return err
+	}
+	if err := c.pc.SetLocalDescription(offer); err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPost, c.endpoint, contentTypeSDP, c.pc.LocalDescription().SDP)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return errors.Errorf("failed to post WHEP offer: %s", resp.Status)
+	}
+	answer, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read WHEP answer")
+	}
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return errors.Wrap(err, "invalid location of WHEP session")
+	}
+	c.mu.Lock()
+	c.resourceURL = location.String()
+	c.mu.Unlock()
+	if err := c.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: string(answer)}); err != nil {
+		return err
+	}
+	go c.trickle(location.String())
+	return nil
+}
+
+// trickle sends ICE candidates to the session resource until the end of candidates.
+func (c *WHEPClient) trickle(resourceURL string) {
+	desc := c.pc.LocalDescription()
+	header := fmt.Sprintf("a=ice-ufrag:%s\r\nm=audio 9 UDP/TLS/RTP/SAVPF 0\r\na=mid:%s\r\n", iceUfragOf(desc), firstMidOf(desc))
+	for candidate := range c.candidates {
+		body := header + "a=end-of-candidates\r\n"
+		if candidate != nil {
+			body = fmt.Sprintf("%sa=%s\r\n", header, candidate.ToJSON().Candidate)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), whepGatheringTimeout)
+		resp, err := c.do(ctx, http.MethodPatch, resourceURL, contentTypeTrickleICE, body)
+		cancel()
+		if err != nil {
+			log.Printf("failed to trickle ICE candidate to WHEP: %+v", err)
+		} else {
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent {
+				log.Printf("failed to trickle ICE candidate to WHEP: %s", resp.Status)
+			}
+		}
+		if candidate == nil {
+			return
+		}
+	}
+}
+
+// Close ends the session.
+func (c *WHEPClient) Close(ctx context.Context) error {
+	c.mu.Lock()
+	resourceURL := c.resourceURL
+	c.mu.Unlock()
+	if resourceURL == "" {
+		return errors.New("WHEP session not created")
+	}
+	resp, err := c.do(ctx, http.MethodDelete, resourceURL, "", "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return errors.Errorf("failed to delete WHEP session: %s", resp.Status)
+	}
+	return nil
+}
+
+func (c *WHEPClient) do(ctx context.Context, method, target, contentType, body string) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
+	}
+	return c.httpClient.Do(req)
+}
@@ -0,0 +1,178 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWHEPServer(options ...WHEPOption) (*WHEPSignaler, *httptest.Server) {
+	signaler := NewWHEPSignaler(options...)
+	mux := http.NewServeMux()
+	mux.Handle("/whep/", http.StripPrefix("/whep", signaler.HTTPHandler()))
+	return signaler, httptest.NewServer(mux)
+}
+
+func TestWHEPSignaler(t *testing.T) {
+	signaler, hs := newWHEPServer()
+	defer hs.Close()
+	ctx := context.Background()
+
+	streamer := newStreamerConn(t, webrtc.Configuration{})
+	streamerConnected := make(chan struct{})
+	streamer.OnConnect(func() { close(streamerConnected) })
+	streamerDisconnected := make(chan struct{})
+	streamer.OnDisconnect(func() { close(streamerDisconnected) })
+	r, err := signaler.Signaling(ctx, streamer.PeerConnection(), "room1", "streamer")
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	player := newPlayerConn(t, webrtc.Configuration{})
+	playerConnected := make(chan struct{})
+	player.OnConnect(func() { close(playerConnected) })
+
+	another := newPlayerConn(t, webrtc.Configuration{})
+	defer another.PeerConnection().Close()
+	assert.Error(t, NewWHEPClient(another.PeerConnection(), hs.URL+"/whep/unknown", "").Connect(ctx))
+
+	client := NewWHEPClient(player.PeerConnection(), hs.URL+"/whep/room1", "")
+	assert.NoError(t, client.Connect(ctx))
+	assert.True(t, strings.HasPrefix(client.resourceURL, hs.URL+"/whep/room1/"), client.resourceURL)
+	for _, connected := range []chan struct{}{streamerConnected, playerConnected} {
+		select {
+		case <-connected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for connection")
+		}
+	}
+	received := make(chan []byte, 1)
+	player.OnMessage(func(data []byte) { received <- data })
+	assert.NoError(t, streamer.SendMessage(ctx, []byte("hello")))
+	select {
+	case data := <-received:
+		assert.Equal(t, []byte("hello"), data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+
+	// only one player is in the room
+	assert.Error(t, NewWHEPClient(another.PeerConnection(), hs.URL+"/whep/room1", "").Connect(ctx))
+
+	// the session ends by DELETE
+	assert.NoError(t, client.Close(ctx))
+	select {
+	case <-streamerDisconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for disconnection")
+	}
+	assert.Error(t, client.Close(ctx))
+}
+
+func TestWHEPSignalerAuthentication(t *testing.T) {
+	signaler, hs := newWHEPServer(WithWHEPAuthenticator(func(roomID, token string) error {
+		if token != "token-"+roomID {
+			return errors.New("invalid token")
+		}
+		return nil
+	}))
+	defer hs.Close()
+	ctx := context.Background()
+
+	streamer := newStreamerConn(t, webrtc.Configuration{})
+	defer streamer.PeerConnection().Close()
+	_, err := signaler.Signaling(ctx, streamer.PeerConnection(), "room1", "streamer")
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, hs.URL+"/whep/room1", strings.NewReader("v=0"))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", contentTypeSDP)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	player := newPlayerConn(t, webrtc.Configuration{})
+	defer player.PeerConnection().Close()
+	assert.NoError(t, NewWHEPClient(player.PeerConnection(), hs.URL+"/whep/room1", "token-room1").Connect(ctx))
+}
+
+// TestWHEPSignalerWithoutDataChannels connects a standard WHEP client, which receives media only.
+func TestWHEPSignalerWithoutDataChannels(t *testing.T) {
+	signaler, hs := newWHEPServer()
+	defer hs.Close()
+	ctx := context.Background()
+
+	streamer := newStreamerConn(t, webrtc.Configuration{})
+	defer streamer.PeerConnection().Close()
+	streamerConnected := make(chan struct{})
+	streamer.OnConnect(func() { close(streamerConnected) })
+	_, err := signaler.Signaling(ctx, streamer.PeerConnection(), "room1", "streamer")
+	assert.NoError(t, err)
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		_, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+		assert.NoError(t, err)
+	}
+	playerConnected := make(chan struct{})
+	var once sync.Once
+	pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		if state == webrtc.ICEConnectionStateConnected {
+			once.Do(func() { close(playerConnected) })
+		}
+	})
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	gatheringComplete := webrtc.GatheringCompletePromise(pc)
+	assert.NoError(t, pc.SetLocalDescription(offer))
+	<-gatheringComplete
+	assert.NotContains(t, pc.LocalDescription().SDP, "m=application")
+
+	// the parameters of the content type are allowed
+	req, err := http.NewRequest(http.MethodPost, hs.URL+"/whep/room1", strings.NewReader(pc.LocalDescription().SDP))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/sdp; charset=utf-8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	answer, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.NoError(t, pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: string(answer)}))
+
+	for _, connected := range []chan struct{}{streamerConnected, playerConnected} {
+		select {
+		case <-connected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for connection")
+		}
+	}
+	assert.True(t, streamer.connected.IsSet())
+}
+
+func TestParseSDPFragment(t *testing.T) {
+	frag := parseSDPFragment("a=ice-ufrag:EsAw\r\na=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 0\r\na=mid:0\r\n" +
+		"a=candidate:1387637174 1 udp 2122260223 192.0.2.1 61764 typ host generation 0 ufrag EsAw network-id 1\r\n" +
+		"a=candidate:3471623853 1 udp 2122194687 198.51.100.2 61765 typ host generation 0 ufrag EsAw network-id 2\r\n" +
+		"a=end-of-candidates\r\n")
+	assert.Equal(t, "EsAw", frag.ufrag)
+	assert.Len(t, frag.candidates, 2)
+	assert.Equal(t, "candidate:1387637174 1 udp 2122260223 192.0.2.1 61764 typ host generation 0 ufrag EsAw network-id 1", frag.candidates[0].Candidate)
+	assert.Equal(t, "0", *frag.candidates[0].SDPMid)
+}
@@ -0,0 +1,58 @@
+package x11
+
+import (
+	"image"
+
+	"github.com/pkg/errors"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+)
+
+// CaptureScreen returns the image of the area of the root window.
+func CaptureScreen(xu *xgbutil.XUtil, x, y, width, height int) (*image.RGBA, error) {
+	if width <= 0 || height <= 0 {
+		return nil, errors.Errorf("invalid capture size: %dx%d", width, height)
+	}
+	bpp, err := bitsPerPixel(xu, xu.Screen().RootDepth)
+	if err != nil {
+		return nil, err
+	}
+	if bpp != 32 {
+		return nil, errors.Errorf("unsupported bits per pixel: %d", bpp)
+	}
+	reply, err := xproto.GetImage(xu.Conn(), xproto.ImageFormatZPixmap, xproto.Drawable(xu.RootWin()),
+		int16(x), int16(y), uint16(width), uint16(height), 0xffffffff).Reply()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get image")
+	}
+	if len(reply.Data) < width*height*4 {
+		return nil, errors.Errorf("short image data (size: %d, expected: %d)", len(reply.Data), width*height*4)
+	}
+	return bgrxToRGBA(reply.Data, width, height, xu.Setup().ImageByteOrder == xproto.ImageOrderLSBFirst), nil
+}
+
+func bitsPerPixel(xu *xgbutil.XUtil, depth byte) (byte, error) {
+	for _, f := range xu.Setup().PixmapFormats {
+		if f.Depth == depth {
+			return f.BitsPerPixel, nil
+		}
+	}
+	return 0, errors.Errorf("pixmap format not found (depth: %d)", depth)
+}
+
+// bgrxToRGBA converts 32-bit pixels of ZPixmap, which are BGRx in LSB first order, to RGBA.
+func bgrxToRGBA(data []byte, width, height int, lsbFirst bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		p := data[i*4 : i*4+4]
+		q := img.Pix[i*4 : i*4+4]
+		if lsbFirst {
+			q[0], q[1], q[2] = p[2], p[1], p[0]
+		} else {
+			q[0], q[1], q[2] = p[1], p[2], p[3]
+		}
+		q[3] = 0xff
+	}
+	return img
+}
@@ -0,0 +1,28 @@
+package x11
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureScreen(t *testing.T) {
+	xu := newDefaultXUtil(t)
+	img, err := CaptureScreen(xu, 0, 0, 64, 48)
+	assert.NoError(t, err)
+	assert.Equal(t, 64, img.Bounds().Dx())
+	assert.Equal(t, 48, img.Bounds().Dy())
+
+	_, err = CaptureScreen(xu, 0, 0, 0, 48)
+	assert.Error(t, err)
+}
+
+func TestBGRXToRGBA(t *testing.T) {
+	img := bgrxToRGBA([]byte{0x01, 0x02, 0x03, 0x00, 0x11, 0x12, 0x13, 0x00}, 2, 1, true)
+	assert.Equal(t, color.RGBA{R: 0x03, G: 0x02, B: 0x01, A: 0xff}, img.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{R: 0x13, G: 0x12, B: 0x11, A: 0xff}, img.RGBAAt(1, 0))
+
+	img = bgrxToRGBA([]byte{0x00, 0x03, 0x02, 0x01}, 1, 1, false)
+	assert.Equal(t, color.RGBA{R: 0x03, G: 0x02, B: 0x01, A: 0xff}, img.RGBAAt(0, 0))
+}
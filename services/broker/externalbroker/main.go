@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/castaneai/mashimaro/pkg/allocator"
 
@@ -13,6 +14,8 @@ import (
 
 	"github.com/castaneai/mashimaro/pkg/gamemetadata"
 	"github.com/castaneai/mashimaro/pkg/gamesession"
+	"github.com/castaneai/mashimaro/pkg/iceserver"
+	"github.com/castaneai/mashimaro/pkg/signaling"
 	"github.com/kelseyhightower/envconfig"
 
 	"cloud.google.com/go/firestore"
@@ -23,6 +26,16 @@ type config struct {
 	UseMockAllocator bool   `envconfig:"USE_MOCK_ALLOCATOR" default:"false"`
 	AllocatorAddr    string `envconfig:"ALLOCATOR_ADDR" default:"agones-allocator.agones-system.svc.cluster.local.:443"`
 	FleetNamespace   string `envconfig:"FLEET_NAMESPACE" default:"mashimaro"`
+	// ICE servers handed to players, which share the TURN secret with the game servers
+	ICESTUNURLs          []string      `envconfig:"ICE_STUN_URLS"`
+	ICETURNURLs          []string      `envconfig:"ICE_TURN_URLS"`
+	ICETURNSecret        string        `envconfig:"ICE_TURN_SECRET"`
+	ICETURNCredentialTTL time.Duration `envconfig:"ICE_TURN_CREDENTIAL_TTL" default:"12h"`
+	// serves the signaling server compatible with Ayame on /signaling
+	EmbedSignaling bool `envconfig:"EMBED_SIGNALING" default:"false"`
+	// players join the room of a session with a token issued by the broker if set
+	SignalingJoinTokenSecret string        `envconfig:"SIGNALING_JOIN_TOKEN_SECRET"`
+	SignalingJoinTokenTTL    time.Duration `envconfig:"SIGNALING_JOIN_TOKEN_TTL" default:"1h"`
 }
 
 func main() {
@@ -30,7 +43,14 @@ func main() {
 	if err := envconfig.Process("", &conf); err != nil {
 		log.Fatalf("failed to process config: %+v", err)
 	}
-	log.Printf("load config: %+v", conf)
+	logConf := conf
+	if logConf.ICETURNSecret != "" {
+		logConf.ICETURNSecret = "<hidden>"
+	}
+	if logConf.SignalingJoinTokenSecret != "" {
+		logConf.SignalingJoinTokenSecret = "<hidden>"
+	}
+	log.Printf("load config: %+v", logConf)
 
 	ctx := context.Background()
 	projectID := "mashimaro"
@@ -47,8 +67,30 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to new allocator: %+v", err)
 	}
-	s := broker.NewExternalBroker(sessionStore, metadataStore, allocator)
+	var opts []broker.ExternalBrokerOption
+	if len(conf.ICESTUNURLs) > 0 || len(conf.ICETURNURLs) > 0 {
+		if len(conf.ICETURNURLs) > 0 && conf.ICETURNSecret == "" {
+			log.Fatalf("ICE_TURN_SECRET is required for ICE_TURN_URLS")
+		}
+		opts = append(opts, broker.WithICEServers(iceserver.Config{
+			STUNURLs:          conf.ICESTUNURLs,
+			TURNURLs:          conf.ICETURNURLs,
+			TURNSecret:        conf.ICETURNSecret,
+			TURNCredentialTTL: conf.ICETURNCredentialTTL,
+		}))
+	}
+	if conf.SignalingJoinTokenSecret != "" {
+		opts = append(opts, broker.WithJoinTokens(conf.SignalingJoinTokenSecret, conf.SignalingJoinTokenTTL))
+	}
+	s := broker.NewExternalBroker(sessionStore, metadataStore, allocator, opts...)
 	http.Handle("/", s.HTTPHandler())
+	if conf.EmbedSignaling {
+		var signalingOpts []signaling.ServerOption
+		if conf.SignalingJoinTokenSecret != "" {
+			signalingOpts = append(signalingOpts, signaling.WithAuthenticator(signaling.NewJoinTokenAuthenticator(conf.SignalingJoinTokenSecret)))
+		}
+		http.Handle("/signaling", signaling.NewServer(signalingOpts...).HTTPHandler())
+	}
 	addr := fmt.Sprintf(":%s", conf.Port)
 	log.Printf("mashimaro external broker is listening on %s...", addr)
 	log.Fatal(http.ListenAndServe(addr, nil))
@@ -13,7 +13,10 @@ import (
 )
 
 type config struct {
-	Port string `envconfig:"PORT" required:"true"`
+	Port            string   `envconfig:"PORT" required:"true"`
+	AllowedElements []string `envconfig:"ALLOWED_ELEMENTS"`
+	// runs each pipeline in a child process
+	ProcessIsolation bool `envconfig:"PROCESS_ISOLATION"`
 }
 
 func main() {
@@ -21,14 +24,28 @@ func main() {
 	if err := envconfig.Process("", &conf); err != nil {
 		log.Fatalf("failed to process config: %+v", err)
 	}
+	var opts []encoder.EncoderServerOption
+	if len(conf.AllowedElements) > 0 {
+		opts = append(opts, encoder.WithAllowedElements(conf.AllowedElements...))
+	}
+	if encoder.IsChildProcess() {
+		log.Fatal(encoder.ServeChildProcess(opts...))
+	}
 	log.Printf("load config: %+v", conf)
+	if conf.ProcessIsolation {
+		opts = append(opts, encoder.WithProcessIsolation())
+	}
 
 	addr := fmt.Sprintf(":%s", conf.Port)
 	lis, err := net.Listen("tcp", addr)
 	if err != nil {
 		log.Fatal(err)
 	}
+	es, err := encoder.NewEncoderServer(opts...)
+	if err != nil {
+		log.Fatalf("failed to create encoder server: %+v", err)
+	}
 	s := grpc.NewServer()
-	proto.RegisterEncoderServer(s, encoder.NewEncoderServer())
+	proto.RegisterEncoderServer(s, es)
 	log.Fatal(s.Serve(lis))
 }
@@ -2,7 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"time"
 
@@ -11,6 +15,9 @@ import (
 	"github.com/castaneai/mashimaro/pkg/transport"
 
 	"github.com/castaneai/mashimaro/pkg/gameserver"
+	"github.com/castaneai/mashimaro/pkg/iceserver"
+	"github.com/castaneai/mashimaro/pkg/recorder"
+	"github.com/castaneai/mashimaro/pkg/signaling"
 
 	grpc_retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
 
@@ -23,21 +30,49 @@ import (
 )
 
 type config struct {
-	AyameLaboURL           string `envconfig:"AYAME_LABO_URL" required:"true"`
-	AyameLaboSignalingKey  string `envconfig:"AYAME_LABO_SIGNALING_KEY" required:"true"`
-	AyameLaboGitHubAccount string `envconfig:"AYAME_LABO_GITHUB_ACCOUNT" required:"true"`
-	InternalBrokerAddr     string `envconfig:"INTERNAL_BROKER_ADDR" required:"true"`
-	GameProcessAddr        string `envconfig:"GAME_PROCESS_ADDR" required:"true"`
-	EncoderAddr            string `envconfig:"ENCODER_ADDR" required:"true"`
-	UseMockAllocator       bool   `envconfig:"USE_MOCK_ALLOCATOR" default:"false"`
+	// the self-hosted signaling server (pkg/signaling) is used instead of Ayame Labo if set
+	SignalingURL             string `envconfig:"SIGNALING_URL"`
+	SignalingJoinTokenSecret string `envconfig:"SIGNALING_JOIN_TOKEN_SECRET"`
+	// players connect by WHEP on "/whep/<session ID>" of the port instead of Ayame if set
+	WHEPPort                 string        `envconfig:"WHEP_PORT"`
+	AyameLaboURL             string        `envconfig:"AYAME_LABO_URL"`
+	AyameLaboSignalingKey    string        `envconfig:"AYAME_LABO_SIGNALING_KEY"`
+	AyameLaboGitHubAccount   string        `envconfig:"AYAME_LABO_GITHUB_ACCOUNT"`
+	InternalBrokerAddr       string        `envconfig:"INTERNAL_BROKER_ADDR" required:"true"`
+	GameProcessAddr          string        `envconfig:"GAME_PROCESS_ADDR" required:"true"`
+	EncoderAddr              string        `envconfig:"ENCODER_ADDR" required:"true"`
+	UseMockAllocator         bool          `envconfig:"USE_MOCK_ALLOCATOR" default:"false"`
+	VideoCodecs              []string      `envconfig:"VIDEO_CODECS"`
+	RecordingDir             string        `envconfig:"RECORDING_DIR"`
+	RecordingMaxFileSize     int64         `envconfig:"RECORDING_MAX_FILE_SIZE"`
+	RecordingMaxFileDuration time.Duration `envconfig:"RECORDING_MAX_FILE_DURATION"`
+	GRPCPort                 string        `envconfig:"GRPC_PORT"`
+	LowResolutionVideoWidth  int           `envconfig:"LOW_RESOLUTION_VIDEO_WIDTH"`
+	LowResolutionVideoHeight int           `envconfig:"LOW_RESOLUTION_VIDEO_HEIGHT"`
+	ICESTUNURLs              []string      `envconfig:"ICE_STUN_URLS" default:"stun:stun.l.google.com:19302"`
+	ICETURNURLs              []string      `envconfig:"ICE_TURN_URLS"`
+	ICETURNSecret            string        `envconfig:"ICE_TURN_SECRET"`
+	ICETURNCredentialTTL     time.Duration `envconfig:"ICE_TURN_CREDENTIAL_TTL" default:"12h"`
+	// players connect by WebSocket on "/ws/<session ID>" of the port instead of WebRTC if set (e.g. where UDP is blocked)
+	WebSocketPort string `envconfig:"WEBSOCKET_PORT"`
 }
 
+// the game server joins the room right after the session is created
+const signalingJoinTokenTTL = 10 * time.Minute
+
 func main() {
 	var conf config
 	if err := envconfig.Process("", &conf); err != nil {
 		log.Fatalf("failed to process config: %+v", err)
 	}
-	log.Printf("load config: %+v", conf)
+	logConf := conf
+	if logConf.ICETURNSecret != "" {
+		logConf.ICETURNSecret = "<hidden>"
+	}
+	if logConf.SignalingJoinTokenSecret != "" {
+		logConf.SignalingJoinTokenSecret = "<hidden>"
+	}
+	log.Printf("load config: %+v", logConf)
 
 	allocatedServerID := ""
 	if conf.UseMockAllocator {
@@ -73,8 +108,48 @@ func main() {
 		log.Fatalf("failed to dial to game process: %+v", err)
 	}
 	encoderClient := proto.NewEncoderClient(encoderCC)
-	signaler := transport.NewAyameLaboSignaler(conf.AyameLaboURL, conf.AyameLaboSignalingKey, conf.AyameLaboGitHubAccount)
-	gameServer := gameserver.NewGameServer(allocatedServer, brokerClient, gameProcessClient, encoderClient, signaler)
+	var videoCodecs []transport.VideoCodec
+	for _, c := range conf.VideoCodecs {
+		codec, err := transport.ParseVideoCodec(c)
+		if err != nil {
+			log.Fatalf("invalid VIDEO_CODECS: %+v", err)
+		}
+		videoCodecs = append(videoCodecs, codec)
+	}
+	opts := []gameserver.GameServerOption{gameserver.WithVideoCodecs(videoCodecs...)}
+	var signaler transport.WebRTCSignaler
+	if conf.WebSocketPort != "" {
+		opts = append(opts, gameserver.WithTransportFactory(newWebSocketTransport(&conf)))
+	} else {
+		s, err := newSignaler(&conf)
+		if err != nil {
+			log.Fatalf("failed to new signaler: %+v", err)
+		}
+		signaler = s
+	}
+	if conf.RecordingDir != "" {
+		opts = append(opts, gameserver.WithRecording(recorder.Config{
+			Dir:             conf.RecordingDir,
+			MaxFileSize:     conf.RecordingMaxFileSize,
+			MaxFileDuration: conf.RecordingMaxFileDuration,
+		}))
+	}
+	if conf.LowResolutionVideoWidth > 0 && conf.LowResolutionVideoHeight > 0 {
+		opts = append(opts, gameserver.WithLowResolutionVideo(gameserver.VideoSize{
+			Width:  conf.LowResolutionVideoWidth,
+			Height: conf.LowResolutionVideoHeight,
+		}))
+	}
+	if len(conf.ICETURNURLs) > 0 && conf.ICETURNSecret == "" {
+		log.Fatalf("ICE_TURN_SECRET is required for ICE_TURN_URLS")
+	}
+	opts = append(opts, gameserver.WithICEServers(iceserver.Config{
+		STUNURLs:          conf.ICESTUNURLs,
+		TURNURLs:          conf.ICETURNURLs,
+		TURNSecret:        conf.ICETURNSecret,
+		TURNCredentialTTL: conf.ICETURNCredentialTTL,
+	}))
+	gameServer := gameserver.NewGameServer(allocatedServer, brokerClient, gameProcessClient, encoderClient, signaler, opts...)
 	if agones != nil {
 		gameServer.OnShutdown(func() {
 			if err := agones.Shutdown(); err != nil {
@@ -82,12 +157,44 @@ func main() {
 			}
 		})
 	}
+	if conf.GRPCPort != "" {
+		go serveGRPC(conf.GRPCPort, gameServer)
+	}
 	ctx := context.Background()
 	if err := gameServer.Serve(ctx); err != nil {
 		log.Fatalf("failed to serve game server: %+v", err)
 	}
 }
 
+// serveGRPC serves APIs of the game server such as screenshots.
+func serveGRPC(port string, gameServer *gameserver.GameServer) {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		log.Fatalf("failed to listen gRPC: %+v", err)
+	}
+	s := grpc.NewServer()
+	proto.RegisterGameServerServer(s, gameServer)
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("failed to serve gRPC: %+v", err)
+	}
+}
+
+func serveWHEP(port string, signaler *transport.WHEPSignaler) {
+	mux := http.NewServeMux()
+	mux.Handle("/whep/", http.StripPrefix("/whep", signaler.HTTPHandler()))
+	addr := fmt.Sprintf(":%s", port)
+	log.Printf("WHEP endpoint is listening on %s...", addr)
+	log.Fatalf("failed to serve WHEP: %+v", http.ListenAndServe(addr, mux))
+}
+
+func serveWebSocket(port string, t *transport.WebSocketTransport) {
+	mux := http.NewServeMux()
+	mux.Handle("/ws/", http.StripPrefix("/ws", t.HTTPHandler()))
+	addr := fmt.Sprintf(":%s", port)
+	log.Printf("WebSocket endpoint is listening on %s...", addr)
+	log.Fatalf("failed to serve WebSocket: %+v", http.ListenAndServe(addr, mux))
+}
+
 func retryDialOptions() []grpc.DialOption {
 	return []grpc.DialOption{
 		grpc.WithUnaryInterceptor(grpc_retry.UnaryClientInterceptor()),
@@ -123,3 +230,42 @@ func agonesHealth(agones *sdk.SDK) {
 		}
 	}
 }
+
+func newWebSocketTransport(conf *config) *transport.WebSocketTransport {
+	var opts []transport.WebSocketOption
+	if conf.SignalingJoinTokenSecret != "" {
+		opts = append(opts, transport.WithWebSocketAuthenticator(func(roomID, token string) error {
+			return signaling.VerifyJoinToken(conf.SignalingJoinTokenSecret, roomID, token, time.Now())
+		}))
+	}
+	t := transport.NewWebSocketTransport(opts...)
+	go serveWebSocket(conf.WebSocketPort, t)
+	return t
+}
+
+func newSignaler(conf *config) (transport.WebRTCSignaler, error) {
+	if conf.WHEPPort != "" {
+		var opts []transport.WHEPOption
+		if conf.SignalingJoinTokenSecret != "" {
+			opts = append(opts, transport.WithWHEPAuthenticator(func(roomID, token string) error {
+				return signaling.VerifyJoinToken(conf.SignalingJoinTokenSecret, roomID, token, time.Now())
+			}))
+		}
+		signaler := transport.NewWHEPSignaler(opts...)
+		go serveWHEP(conf.WHEPPort, signaler)
+		return signaler, nil
+	}
+	if conf.SignalingURL != "" {
+		signaler := transport.NewAyameSignaler(conf.SignalingURL)
+		if conf.SignalingJoinTokenSecret != "" {
+			signaler.SignalingKey = func(roomID string) string {
+				return signaling.JoinToken(conf.SignalingJoinTokenSecret, roomID, time.Now().Add(signalingJoinTokenTTL))
+			}
+		}
+		return signaler, nil
+	}
+	if conf.AyameLaboURL == "" || conf.AyameLaboSignalingKey == "" || conf.AyameLaboGitHubAccount == "" {
+		return nil, errors.New("SIGNALING_URL or AYAME_LABO_URL, AYAME_LABO_SIGNALING_KEY and AYAME_LABO_GITHUB_ACCOUNT are required")
+	}
+	return transport.NewAyameLaboSignaler(conf.AyameLaboURL, conf.AyameLaboSignalingKey, conf.AyameLaboGitHubAccount), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+
+	"github.com/castaneai/mashimaro/pkg/iceserver"
+	"github.com/castaneai/mashimaro/pkg/signaling"
+)
+
+type config struct {
+	Port string `envconfig:"PORT" default:"3000"`
+	// clients join rooms with tokens issued by the external broker if set
+	JoinTokenSecret string `envconfig:"JOIN_TOKEN_SECRET"`
+	// ICE servers handed to clients in the accept message
+	ICESTUNURLs          []string      `envconfig:"ICE_STUN_URLS"`
+	ICETURNURLs          []string      `envconfig:"ICE_TURN_URLS"`
+	ICETURNSecret        string        `envconfig:"ICE_TURN_SECRET"`
+	ICETURNCredentialTTL time.Duration `envconfig:"ICE_TURN_CREDENTIAL_TTL" default:"12h"`
+}
+
+func main() {
+	var conf config
+	if err := envconfig.Process("", &conf); err != nil {
+		log.Fatalf("failed to process config: %+v", err)
+	}
+	logConf := conf
+	if logConf.JoinTokenSecret != "" {
+		logConf.JoinTokenSecret = "<hidden>"
+	}
+	if logConf.ICETURNSecret != "" {
+		logConf.ICETURNSecret = "<hidden>"
+	}
+	log.Printf("load config: %+v", logConf)
+
+	var opts []signaling.ServerOption
+	if conf.JoinTokenSecret != "" {
+		opts = append(opts, signaling.WithAuthenticator(signaling.NewJoinTokenAuthenticator(conf.JoinTokenSecret)))
+	}
+	if len(conf.ICESTUNURLs) > 0 || len(conf.ICETURNURLs) > 0 {
+		if len(conf.ICETURNURLs) > 0 && conf.ICETURNSecret == "" {
+			log.Fatalf("ICE_TURN_SECRET is required for ICE_TURN_URLS")
+		}
+		opts = append(opts, signaling.WithICEServers(iceserver.Config{
+			STUNURLs:          conf.ICESTUNURLs,
+			TURNURLs:          conf.ICETURNURLs,
+			TURNSecret:        conf.ICETURNSecret,
+			TURNCredentialTTL: conf.ICETURNCredentialTTL,
+		}))
+	}
+	s := signaling.NewServer(opts...)
+	http.Handle("/signaling", s.HTTPHandler())
+	addr := fmt.Sprintf(":%s", conf.Port)
+	log.Printf("mashimaro signaling server is listening on %s...", addr)
+	log.Fatal(http.ListenAndServe(addr, nil))
+}